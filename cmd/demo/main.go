@@ -20,7 +20,7 @@ func main() {
 	}
 
 	// 2. 初始化依赖
-	store, err := storage.New(cfg.Storage.Database)
+	store, err := storage.Open(cfg.Storage)
 	if err != nil {
 		log.Fatalf("Failed to init storage: %v", err)
 	}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+func printDBUsage() {
+	fmt.Println(`Usage:
+  sentinel db <subcommand> [options]
+
+Subcommands:
+  migrate   Apply pending schema migrations (--to N stops at version N)
+  status    List known and applied migrations
+  rollback  Revert the most recent migrations (--steps N, default 1)
+  prune     Apply the storage.retention rules now (--dry-run to only count)
+  backup    Take a verified online snapshot (--list, --verify FILE)`)
+}
+
+// runDB dispatches `sentinel db <subcommand>`
+func runDB(args []string) {
+	if len(args) < 1 {
+		printDBUsage()
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("db "+args[0], flag.ExitOnError)
+	configPath := fs.String("config", "configs/config.yaml", "Path to config file")
+	to := fs.Int("to", 0, "migrate: target version (default latest)")
+	steps := fs.Int("steps", 1, "rollback: number of migrations to revert")
+	dryRun := fs.Bool("dry-run", false, "prune: show what would be removed without changing anything")
+	vacuum := fs.String("vacuum", "", "prune: vacuum mode override (incremental, full, off)")
+	dir := fs.String("dir", "", "backup: snapshot directory (default storage.backup.dir)")
+	keep := fs.Int("keep", -1, "backup: newest snapshots to keep (default storage.backup.keep)")
+	list := fs.Bool("list", false, "backup: list snapshots instead of taking one")
+	verify := fs.String("verify", "", "backup: run an integrity check on a snapshot file")
+
+	switch args[0] {
+	case "migrate", "status", "rollback", "prune", "backup":
+		fs.Parse(args[1:])
+	default:
+		printDBUsage()
+		os.Exit(1)
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if args[0] == "prune" {
+		if *vacuum != "" {
+			cfg.Storage.Retention.Vacuum = *vacuum
+		}
+		runPrune(cfg, *dryRun)
+		return
+	}
+	if args[0] == "backup" {
+		if *dir != "" {
+			cfg.Storage.Backup.Dir = *dir
+		}
+		if *keep >= 0 {
+			cfg.Storage.Backup.Keep = *keep
+		}
+		runBackup(cfg, *list, *verify)
+		return
+	}
+
+	m, err := storage.OpenMigrator(cfg.Storage)
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer m.Close()
+
+	switch args[0] {
+	case "migrate":
+		ran, err := m.Migrate(*to)
+		for _, mig := range ran {
+			fmt.Printf("applied  %04d %s\n", mig.Version, mig.Name)
+		}
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		if len(ran) == 0 {
+			fmt.Println("Schema is up to date")
+		}
+
+	case "rollback":
+		if *steps < 1 {
+			log.Fatal("rollback: --steps must be at least 1")
+		}
+		ran, err := m.Rollback(*steps)
+		for _, mig := range ran {
+			fmt.Printf("reverted %04d %s\n", mig.Version, mig.Name)
+		}
+		if err != nil {
+			log.Fatalf("Rollback failed: %v", err)
+		}
+		if len(ran) == 0 {
+			fmt.Println("Nothing to roll back")
+		}
+
+	case "status":
+		status, err := m.Status()
+		if err != nil {
+			log.Fatalf("Failed to read migrations: %v", err)
+		}
+		version, _ := m.Version()
+		fmt.Printf("Driver: %s  Schema version: %d  Latest known: %d\n\n", cfg.Storage.Driver, version, m.Latest())
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+		for _, st := range status {
+			state, at := "pending", ""
+			if st.Applied {
+				state = "applied"
+				at = st.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			if st.Unknown {
+				state = "unknown (newer binary)"
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", st.Version, st.Name, state, at)
+		}
+		w.Flush()
+	}
+}
+
+// runPrune applies the retention rules once, regardless of retention.enabled
+func runPrune(cfg *config.Config, dryRun bool) {
+	rules := storage.RetentionRules(cfg.Storage.Retention)
+	if len(rules) == 0 {
+		fmt.Println("No retention rules configured")
+		return
+	}
+
+	store, err := storage.Open(cfg.Storage)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	defer store.Close()
+
+	var results []storage.PruneResult
+	if dryRun {
+		results, err = store.Prune(rules, true)
+	} else {
+		results, err = storage.NewJanitor(store, cfg.Storage.Retention).RunOnce()
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RULE\tTABLE\tACTION\tOLDER THAN\tROWS\tCASCADED")
+	for _, r := range results {
+		var cascaded []string
+		for table, n := range r.Cascaded {
+			cascaded = append(cascaded, fmt.Sprintf("%s %d", table, n))
+		}
+		sort.Strings(cascaded)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", r.Rule, r.Table, r.Action, r.Cutoff.Local().Format("2006-01-02 15:04"), r.Rows,
+			strings.Join(cascaded, ", "))
+	}
+	w.Flush()
+	if err != nil {
+		log.Fatalf("Prune failed: %v", err)
+	}
+	if dryRun {
+		fmt.Println("\nDry run: nothing was changed")
+	}
+}
+
+// runBackup takes one snapshot and applies storage.backup.keep, regardless
+// of storage.backup.enabled
+func runBackup(cfg *config.Config, list bool, verify string) {
+	switch {
+	case verify != "":
+		if err := storage.VerifySnapshot(verify); err != nil {
+			log.Fatalf("%s: %v", verify, err)
+		}
+		fmt.Printf("%s: ok\n", verify)
+		return
+
+	case list:
+		snaps, err := storage.ListSnapshots(cfg.Storage.Backup.Dir)
+		if err != nil {
+			log.Fatalf("Failed to list snapshots: %v", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tCREATED\tSIZE")
+		for _, snap := range snaps {
+			fmt.Fprintf(w, "%s\t%s\t%d\n", snap.Name, snap.CreatedAt.Local().Format("2006-01-02 15:04:05"), snap.Size)
+		}
+		w.Flush()
+		return
+	}
+
+	store, err := storage.Open(cfg.Storage)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	defer store.Close()
+
+	snap, err := storage.NewSnapshotter(store, cfg.Storage.Backup).RunOnce()
+	if err != nil {
+		log.Fatalf("Backup failed: %v", err)
+	}
+	fmt.Printf("%s  %d bytes  %s  integrity ok\n", snap.Path, snap.Size, snap.Duration.Round(time.Millisecond))
+}
@@ -2,18 +2,30 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/chenzhiguo/market-sentinel/internal/analyzer"
 	"github.com/chenzhiguo/market-sentinel/internal/api"
+	"github.com/chenzhiguo/market-sentinel/internal/archive"
 	"github.com/chenzhiguo/market-sentinel/internal/collector"
 	"github.com/chenzhiguo/market-sentinel/internal/config"
+	"github.com/chenzhiguo/market-sentinel/internal/eval"
+	"github.com/chenzhiguo/market-sentinel/internal/llm"
+	"github.com/chenzhiguo/market-sentinel/internal/notifier"
+	"github.com/chenzhiguo/market-sentinel/internal/reporter"
+	"github.com/chenzhiguo/market-sentinel/internal/rules"
 	"github.com/chenzhiguo/market-sentinel/internal/storage"
+	"github.com/chenzhiguo/market-sentinel/internal/stream"
+	"github.com/chenzhiguo/market-sentinel/internal/webhook"
 )
 
 var (
@@ -26,6 +38,7 @@ func main() {
 	serveCmd := flag.NewFlagSet("serve", flag.ExitOnError)
 	scanCmd := flag.NewFlagSet("scan", flag.ExitOnError)
 	reportCmd := flag.NewFlagSet("report", flag.ExitOnError)
+	evalCmd := flag.NewFlagSet("eval", flag.ExitOnError)
 	versionCmd := flag.NewFlagSet("version", flag.ExitOnError)
 
 	// Serve flags
@@ -39,6 +52,17 @@ func main() {
 	reportType := reportCmd.String("type", "summary", "Report type: summary, morning-brief, alerts")
 	reportConfigPath := reportCmd.String("config", "configs/config.yaml", "Path to config file")
 
+	// Eval flags
+	evalConfigPath := evalCmd.String("config", "configs/config.yaml", "Path to config file")
+	evalDataset := evalCmd.String("dataset", "", "Labeled JSONL dataset (required)")
+	evalProvider := evalCmd.String("provider", "", "LLM provider override (anthropic, ollama)")
+	evalModel := evalCmd.String("model", "", "LLM model override")
+	evalURL := evalCmd.String("url", "", "Provider URL override (ollama)")
+	evalOut := evalCmd.String("out", "", "Write the run as JSON to this file")
+	evalBaseline := evalCmd.String("baseline", "", "Previous run JSON to diff against")
+	evalConcurrency := evalCmd.Int("concurrency", 1, "Samples analyzed in parallel")
+	evalTimeout := evalCmd.Duration("timeout", 2*time.Minute, "Per-sample timeout")
+
 	if len(os.Args) < 2 {
 		printUsage()
 		os.Exit(1)
@@ -57,6 +81,34 @@ func main() {
 		reportCmd.Parse(os.Args[2:])
 		runReport(*reportConfigPath, *reportType)
 
+	case "eval":
+		evalCmd.Parse(os.Args[2:])
+		runEval(*evalConfigPath, evalOptions{
+			dataset:     *evalDataset,
+			provider:    *evalProvider,
+			model:       *evalModel,
+			url:         *evalURL,
+			out:         *evalOut,
+			baseline:    *evalBaseline,
+			concurrency: *evalConcurrency,
+			timeout:     *evalTimeout,
+		})
+
+	case "db":
+		runDB(os.Args[2:])
+
+	case "export":
+		runExport(os.Args[2:])
+
+	case "import":
+		runImport(os.Args[2:])
+
+	case "restore":
+		runRestore(os.Args[2:])
+
+	case "token":
+		runToken(os.Args[2:])
+
 	case "version":
 		versionCmd.Parse(os.Args[2:])
 		fmt.Printf("Market Sentinel v%s (built: %s)\n", version, buildTime)
@@ -77,12 +129,26 @@ Commands:
   serve     Start the API server and collector
   scan      Run news/social media scan
   report    Generate reports
+  eval      Evaluate an LLM provider against a labeled dataset
+  db        Manage the database (migrate, status, rollback, prune, backup)
+  export    Export new news/analyses/alerts to JSONL and Parquet partitions
+  import    Import historical news from JSONL, CSV or RSS dumps
+  restore   Rebuild the database from the JSONL mirror
+  token     Manage scoped API tokens (create, list, revoke)
   version   Show version info
 
 Examples:
   sentinel serve --config configs/config.yaml
   sentinel scan --once
   sentinel report --type morning-brief
+  sentinel eval --dataset testdata/eval.jsonl --out runs/gemma.json --baseline runs/prev.json
+  sentinel db status
+  sentinel db prune --dry-run
+  sentinel db backup --keep 7
+  sentinel export --format parquet --dataset analyses
+  sentinel import --source stocktwits --map title=body,published_at=created_at --analyze dump.jsonl.gz
+  sentinel restore --from data/mirror
+  sentinel token create --name dashboard --scopes read:news,read:alerts
 
 Use "sentinel <command> --help" for more information.`)
 }
@@ -93,11 +159,47 @@ func runServe(configPath string) {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	store, err := storage.New(cfg.Storage.Database)
+	store, err := storage.Open(cfg.Storage)
 	if err != nil {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
 	defer store.Close()
+	if !store.SearchAvailable() {
+		log.Printf("Warning: %v; /api/v1/search will answer 503 (build with -tags sqlite_fts5, e.g. make build)", storage.ErrSearchUnavailable)
+	}
+
+	if cfg.Storage.Retention.Enabled {
+		janitor := storage.NewJanitor(store, cfg.Storage.Retention)
+		janitor.Start()
+		defer janitor.Stop()
+	}
+
+	// the admin backup endpoints only run while backups are enabled
+	var apiOpts []api.Option
+	if cfg.Storage.Backup.Enabled {
+		snapshotter := storage.NewSnapshotter(store, cfg.Storage.Backup)
+		apiOpts = append(apiOpts, api.WithSnapshotter(snapshotter))
+		if store.Dialect() == "sqlite" {
+			snapshotter.Start()
+			defer snapshotter.Stop()
+		} else {
+			log.Printf("storage.backup is ignored for %s: %v", store.Dialect(), storage.ErrBackupUnsupported)
+		}
+	}
+
+	if cfg.Archive.Enabled {
+		exporter, err := archive.NewExporter(store, cfg.Archive)
+		if err != nil {
+			log.Fatalf("Invalid archive config: %v", err)
+		}
+		archiver := archive.NewArchiver(exporter, cfg.Archive.Interval)
+		archiver.Start()
+		defer archiver.Stop()
+	}
+
+	// Everything stored from here on is pushed to /api/v1/stream
+	bus := stream.NewBus(stream.DefaultBuffer, store)
+	store.SetPublisher(bus)
 
 	// 1. Start Collector Manager (Producers)
 	colManager := collector.NewManager(cfg, store)
@@ -105,19 +207,59 @@ func runServe(configPath string) {
 	defer colManager.Stop()
 
 	// 2. Start Analysis Engine (Consumers)
+	ruleSet, err := rules.NewSet(cfg.Alerting, store)
+	if err != nil {
+		log.Fatalf("Invalid alert rules: %v", err)
+	}
+	alerts := reporter.NewAlertManager(store, ruleSet, cfg.Alerting.Cooldown)
 	ai := analyzer.New(cfg, store)
-	engine := analyzer.NewEngine(ai, store)
+	engine := analyzer.NewEngine(ai, store, alerts)
 	engine.Start()
 	defer engine.Stop()
 
+	// Mention volume spikes come from raw news, ahead of the LLM
+	if cfg.Analyzer.Velocity.Enabled {
+		detector := analyzer.NewVolumeDetector(cfg.Analyzer.Velocity, store, alerts)
+		detector.Start()
+		defer detector.Stop()
+	}
+
+	// Alerts queued for webhook subscriptions
+	if cfg.Webhooks.Enabled {
+		dispatcher := webhook.NewDispatcher(cfg.Webhooks, store)
+		dispatcher.Start()
+		defer dispatcher.Stop()
+	}
+
+	// Alerts routed to chat channels
+	if cfg.Notifier.Enabled {
+		n, err := notifier.New(cfg.Notifier, store)
+		if err != nil {
+			log.Fatalf("Invalid notifier config: %v", err)
+		}
+		n.Start()
+		defer n.Stop()
+	}
+
+	// Alert digests by email
+	if cfg.Email.Enabled {
+		mailer, err := notifier.NewMailer(cfg.Email, store)
+		if err != nil {
+			log.Fatalf("Invalid email config: %v", err)
+		}
+		mailer.Start()
+		defer mailer.Stop()
+	}
+
 	// 3. Start API Server
-	server := api.NewServer(cfg, store)
+	apiOpts = append(apiOpts, api.WithCollector(colManager), api.WithStream(bus), api.WithRules(ruleSet))
+	server := api.NewServer(cfg, store, apiOpts...)
 
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
 	go func() {
-		if err := server.Start(); err != nil {
+		if err := server.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalf("Server error: %v", err)
 		}
 	}()
@@ -125,6 +267,13 @@ func runServe(configPath string) {
 	log.Printf("Market Sentinel started on %s:%d", cfg.Server.Host, cfg.Server.Port)
 	<-done
 	log.Println("Shutting down...")
+
+	// ends open streams and waits for requests in flight
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Server shutdown: %v", err)
+	}
 }
 
 func runScan(configPath string, once bool) {
@@ -133,7 +282,7 @@ func runScan(configPath string, once bool) {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	store, err := storage.New(cfg.Storage.Database)
+	store, err := storage.Open(cfg.Storage)
 	if err != nil {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
@@ -154,6 +303,10 @@ func runScan(configPath string, once bool) {
 		unprocessed, _ := store.GetUnprocessedNews(20)
 		ctx := context.Background()
 		for _, item := range unprocessed {
+			if analyzer.StoryAnalyzed(store, &item) {
+				store.MarkNewsProcessed(item.ID)
+				continue
+			}
 			log.Printf("Analyzing: %s", item.Title)
 			ai.AnalyzeAndSave(ctx, &item)
 			store.MarkNewsProcessed(item.ID)
@@ -171,12 +324,131 @@ func runReport(configPath string, reportType string) {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
-	store, err := storage.New(cfg.Storage.Database)
+	store, err := storage.Open(cfg.Storage)
 	if err != nil {
 		log.Fatalf("Failed to initialize storage: %v", err)
 	}
 	defer store.Close()
 
+	var mailer *notifier.Mailer
+	if cfg.Email.Enabled {
+		if mailer, err = notifier.NewMailer(cfg.Email, store); err != nil {
+			log.Fatalf("Invalid email config: %v", err)
+		}
+	}
+
 	log.Printf("Generating %s report...", reportType)
-	// TODO: Implement report generation
+	ctx := context.Background()
+	rep := reporter.New(cfg, store)
+
+	var report *reporter.ReportData
+	switch reportType {
+	case "summary", "daily-summary":
+		report, err = rep.GenerateDailySummary(ctx)
+	case "morning-brief":
+		report, err = rep.GenerateMorningBrief(ctx)
+	case "alerts":
+		// A digest of the last day's alerts, nothing is stored
+		alerts, err := store.AlertsAfter(storage.Cursor{Time: time.Now().Add(-24 * time.Hour)}, time.Time{}, 1000)
+		if err != nil {
+			log.Fatalf("Failed to read alerts: %v", err)
+		}
+		log.Printf("%d alerts in the last 24h", len(alerts))
+		if mailer != nil {
+			sent, err := mailer.SendDigest(alerts)
+			log.Printf("Emailed %d digests", sent)
+			if err != nil {
+				log.Fatalf("Email failed: %v", err)
+			}
+		}
+		return
+	default:
+		log.Fatalf("Unknown report type %q (summary, morning-brief, alerts)", reportType)
+	}
+	if err != nil {
+		log.Fatalf("Report failed: %v", err)
+	}
+	log.Printf("Report %s: %s", report.ID, report.Summary)
+
+	if mailer != nil {
+		sent, err := mailer.SendReport(report)
+		log.Printf("Emailed %d copies", sent)
+		if err != nil {
+			log.Fatalf("Email failed: %v", err)
+		}
+	}
+}
+
+type evalOptions struct {
+	dataset     string
+	provider    string
+	model       string
+	url         string
+	out         string
+	baseline    string
+	concurrency int
+	timeout     time.Duration
+}
+
+func runEval(configPath string, opts evalOptions) {
+	if opts.dataset == "" {
+		log.Fatal("eval: --dataset is required")
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	if opts.provider != "" {
+		cfg.Analyzer.LLMProvider = opts.provider
+	}
+	if opts.model != "" {
+		cfg.Analyzer.LLMModel = opts.model
+	}
+	if opts.url != "" {
+		cfg.Analyzer.OllamaURL = opts.url
+	}
+
+	samples, err := eval.LoadDataset(opts.dataset)
+	if err != nil {
+		log.Fatalf("Failed to load dataset: %v", err)
+	}
+
+	providerName := strings.ToLower(cfg.Analyzer.LLMProvider)
+	provider, err := llm.NewProvider(providerName, map[string]string{
+		"model":   cfg.Analyzer.LLMModel,
+		"api_key": cfg.Analyzer.APIKey,
+		"url":     cfg.Analyzer.OllamaURL,
+	})
+	if err != nil {
+		log.Fatalf("Failed to create provider %s: %v", providerName, err)
+	}
+
+	// Analyze does not touch storage, so no database is opened here
+	ai := analyzer.NewWithProvider(cfg, nil, provider)
+	runner := eval.NewRunner(ai, opts.concurrency, opts.timeout)
+
+	log.Printf("Evaluating %d samples with %s/%s...", len(samples), providerName, cfg.Analyzer.LLMModel)
+	run := runner.Run(context.Background(), samples)
+	run.Provider = providerName
+	run.Model = cfg.Analyzer.LLMModel
+	run.Dataset = opts.dataset
+
+	eval.PrintRun(os.Stdout, run)
+
+	if opts.baseline != "" {
+		baseline, err := eval.LoadRun(opts.baseline)
+		if err != nil {
+			log.Fatalf("Failed to load baseline: %v", err)
+		}
+		fmt.Printf("\nDiff against %s (%s/%s):\n", opts.baseline, baseline.Provider, baseline.Model)
+		eval.PrintDiff(os.Stdout, eval.Compare(baseline, run))
+	}
+
+	if opts.out != "" {
+		if err := eval.SaveRun(opts.out, run); err != nil {
+			log.Fatalf("Failed to save run: %v", err)
+		}
+		log.Printf("Run saved to %s", opts.out)
+	}
 }
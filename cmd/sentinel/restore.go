@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+// runRestore handles `sentinel restore`: rebuild the database from the
+// JSONL mirror. Rows that already exist are skipped, except that alerts
+// take the state of their last mirrored record, so it can also fill
+// gaps in a database restored from an older snapshot.
+func runRestore(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	configPath := fs.String("config", "configs/config.yaml", "Path to config file")
+	from := fs.String("from", "", "Mirror directory (default storage.mirror.dir)")
+	sinceStr := fs.String("since", "", "Only restore day files from this date on (YYYY-MM-DD)")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), `Usage:
+  sentinel restore [--from dir] [--since YYYY-MM-DD]
+
+Restores news, analyses, alerts (with their follow-ups and ack, snooze and
+resolve history), and reports. Alerts take the state of their last mirrored
+record, which overwrites the database. Not restored:
+  - notification and webhook delivery logs, rules and webhooks
+  - a story's analysis link, when the analysis is only in day files
+    before --since
+
+Options:
+`)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	dir := cfg.Storage.Mirror.Dir
+	if *from != "" {
+		dir = *from
+	}
+	var since time.Time
+	if *sinceStr != "" {
+		if since, err = time.Parse("2006-01-02", *sinceStr); err != nil {
+			log.Fatalf("Invalid --since: %v", err)
+		}
+	}
+
+	// a fresh database needs the schema, and restored rows must not be
+	// appended to the mirror they come from
+	cfg.Storage.AutoMigrate = true
+	cfg.Storage.Mirror.Enabled = false
+	store, err := storage.Open(cfg.Storage)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v (move a corrupt database file aside first)", err)
+	}
+	defer store.Close()
+
+	start := time.Now()
+	results, err := store.RestoreMirror(dir, since)
+	for _, r := range results {
+		fmt.Printf("%-13s %3d files  %7d read  %7d restored  %d corrupt\n", r.Table, r.Files, r.Read, r.Restored, r.Corrupt)
+	}
+	if err != nil {
+		log.Fatalf("Restore failed: %v", err)
+	}
+	log.Printf("Restore from %s finished in %s", dir, time.Since(start).Round(time.Millisecond))
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/api"
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+func printTokenUsage() {
+	fmt.Printf(`Usage:
+  sentinel token <subcommand> [options]
+
+Subcommands:
+  create    Create a named API token (--name, --scopes, --expires)
+  list      List API tokens
+  revoke    Revoke a token by ID or name
+
+Scopes: %s
+
+Examples:
+  sentinel token create --name dashboard --scopes read:news,read:alerts --expires 2160h
+  sentinel token revoke dashboard
+`, strings.Join(api.Scopes, ", "))
+}
+
+// runToken dispatches `sentinel token <subcommand>`
+func runToken(args []string) {
+	if len(args) < 1 {
+		printTokenUsage()
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("token "+args[0], flag.ExitOnError)
+	configPath := fs.String("config", "configs/config.yaml", "Path to config file")
+	name := fs.String("name", "", "create: token name (required, unique)")
+	scopes := fs.String("scopes", "", "create: comma-separated scopes (required)")
+	expires := fs.Duration("expires", 0, "create: lifetime such as 720h (default never expires)")
+
+	switch args[0] {
+	case "create", "list", "revoke":
+		fs.Parse(args[1:])
+	default:
+		printTokenUsage()
+		os.Exit(1)
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	store, err := storage.Open(cfg.Storage)
+	if err != nil {
+		log.Fatalf("Failed to initialize storage: %v", err)
+	}
+	defer store.Close()
+
+	switch args[0] {
+	case "create":
+		var list []string
+		for _, sc := range strings.Split(*scopes, ",") {
+			if sc = strings.TrimSpace(sc); sc != "" {
+				list = append(list, sc)
+			}
+		}
+		t, secret, err := api.NewAPIToken(*name, list, *expires)
+		if err != nil {
+			log.Fatalf("token create: %v", err)
+		}
+		if err := store.CreateAPIToken(t); err != nil {
+			log.Fatalf("Failed to save token: %v", err)
+		}
+		fmt.Printf("Created token %s (%s) with scopes %s\n", t.Name, t.ID, strings.Join(t.Scopes, ", "))
+		if t.ExpiresAt != nil {
+			fmt.Printf("Expires: %s\n", t.ExpiresAt.Local().Format("2006-01-02 15:04:05"))
+		}
+		fmt.Printf("\n  %s\n\nStore it now: only its hash is kept and it cannot be shown again.\n", secret)
+
+	case "list":
+		tokens, err := store.ListAPITokens()
+		if err != nil {
+			log.Fatalf("Failed to list tokens: %v", err)
+		}
+		now := time.Now()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tPREFIX\tSCOPES\tSTATE\tEXPIRES\tCREATED")
+		for _, t := range tokens {
+			state := "active"
+			switch {
+			case t.RevokedAt != nil:
+				state = "revoked"
+			case !t.Active(now):
+				state = "expired"
+			}
+			exp := "never"
+			if t.ExpiresAt != nil {
+				exp = t.ExpiresAt.Local().Format("2006-01-02 15:04")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s…\t%s\t%s\t%s\t%s\n", t.ID, t.Name, t.Prefix, strings.Join(t.Scopes, ","),
+				state, exp, t.CreatedAt.Local().Format("2006-01-02 15:04"))
+		}
+		w.Flush()
+
+	case "revoke":
+		if fs.NArg() != 1 {
+			log.Fatal("token revoke: give the token ID or name")
+		}
+		found, err := store.RevokeAPIToken(fs.Arg(0), time.Now())
+		if err != nil {
+			log.Fatalf("Failed to revoke token: %v", err)
+		}
+		if !found {
+			log.Fatalf("token revoke: no active token %q", fs.Arg(0))
+		}
+		fmt.Printf("Revoked %s\n", fs.Arg(0))
+	}
+}
@@ -3,6 +3,7 @@ package analyzer
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
@@ -20,12 +21,16 @@ import (
 
 type Analyzer struct {
 	cfg      *config.Config
-	store    *storage.Storage
+	store    storage.Store
 	provider llm.Provider
 	mapper   *StockMapper // Added StockMapper
 }
 
-func New(cfg *config.Config, store *storage.Storage) *Analyzer {
+// ErrUnparseable is returned (wrapped) by Analyze when the LLM replied but the
+// reply could not be decoded into an AnalysisResult.
+var ErrUnparseable = errors.New("unparseable LLM response")
+
+func New(cfg *config.Config, store storage.Store) *Analyzer {
 	providerName := strings.ToLower(cfg.Analyzer.LLMProvider)
 	
 	providerConfig := map[string]string{
@@ -42,6 +47,11 @@ func New(cfg *config.Config, store *storage.Storage) *Analyzer {
 		}
 	}
 
+	return NewWithProvider(cfg, store, provider)
+}
+
+// NewWithProvider creates an Analyzer backed by an already constructed provider
+func NewWithProvider(cfg *config.Config, store storage.Store, provider llm.Provider) *Analyzer {
 	return &Analyzer{
 		cfg:      cfg,
 		store:    store,
@@ -54,6 +64,7 @@ type AnalysisResult struct {
 	Sentiment   string        `json:"sentiment"`
 	Impact      string        `json:"impact"`
 	Summary     string        `json:"summary"`
+	Entities    []string      `json:"entities"`
 	Stocks      []StockResult `json:"stocks"`
 	Confidence  float64       `json:"confidence"`
 }
@@ -75,7 +86,7 @@ func (a *Analyzer) Analyze(ctx context.Context, news *storage.NewsItem) (*storag
 
 	result, err := parseAnalysisResponse(responseText)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse response: %w\nResponse was: %s", err, responseText)
+		return nil, fmt.Errorf("%w: %v\nResponse was: %s", ErrUnparseable, err, responseText)
 	}
 
 	analysis := &storage.Analysis{
@@ -84,6 +95,7 @@ func (a *Analyzer) Analyze(ctx context.Context, news *storage.NewsItem) (*storag
 		Sentiment:      result.Sentiment,
 		ImpactLevel:    result.Impact,
 		Summary:        result.Summary,
+		Entities:       result.Entities,
 		SentimentScore: float64(calculateOverallScore(result.Stocks)),
 		Confidence:     result.Confidence,
 		AnalyzedAt:     time.Now(),
@@ -182,6 +194,7 @@ You must respond with valid JSON only. No other text. The JSON schema is:
   "sentiment": "positive|negative|neutral",
   "impact": "high|medium|low",
   "summary": "Brief summary of the content and its market implications",
+  "entities": ["Countries, companies, people, agencies or products the content is about"],
   "stocks": [
     {
       "symbol": "TICKER",
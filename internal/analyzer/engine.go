@@ -2,18 +2,19 @@ package analyzer
 
 import (
 	"context"
-	"fmt"
 	"log"
 	"sync"
 	"time"
 
+	"github.com/chenzhiguo/market-sentinel/internal/reporter"
 	"github.com/chenzhiguo/market-sentinel/internal/storage"
 )
 
 // Engine manages the analysis workflow independently from collectors
 type Engine struct {
 	analyzer  *Analyzer
-	store     *storage.Storage
+	store     storage.Store
+	alerts    *reporter.AlertManager
 	stopCh    chan struct{}
 	wg        sync.WaitGroup
 	isRunning bool
@@ -24,10 +25,12 @@ type Engine struct {
 	workerCount  int
 }
 
-func NewEngine(analyzer *Analyzer, store *storage.Storage) *Engine {
+// NewEngine analyzes news with analyzer and passes each analysis to alerts
+func NewEngine(analyzer *Analyzer, store storage.Store, alerts *reporter.AlertManager) *Engine {
 	return &Engine{
 		analyzer:     analyzer,
 		store:        store,
+		alerts:       alerts,
 		stopCh:       make(chan struct{}),
 		pollInterval: 10 * time.Second, // 默认10秒轮询一次
 		workerCount:  3,                // 默认3个并发分析
@@ -95,11 +98,25 @@ func (e *Engine) processBatch() {
 
 	log.Printf("Engine: processing batch of %d items", len(items))
 
-	// 2. 使用 Worker Pool 并发处理
+	// 2. 同一故事只分析一条，其余等它分析完再计入警报
+	var reps, copies []storage.NewsItem
+	seen := make(map[string]bool)
+	for _, item := range items {
+		if item.StoryID != "" && seen[item.StoryID] {
+			copies = append(copies, item)
+			continue
+		}
+		if item.StoryID != "" {
+			seen[item.StoryID] = true
+		}
+		reps = append(reps, item)
+	}
+
+	// 3. 使用 Worker Pool 并发处理
 	var wg sync.WaitGroup
 	sem := make(chan struct{}, e.workerCount) // 信号量控制并发
 
-	for _, item := range items {
+	for _, item := range reps {
 		wg.Add(1)
 		sem <- struct{}{} // Acquire
 
@@ -112,9 +129,31 @@ func (e *Engine) processBatch() {
 	}
 
 	wg.Wait()
+
+	// 4. 故事已分析的报道作为后续更新；分析失败的留给下一批重试
+	for _, item := range copies {
+		if StoryAnalyzed(e.store, &item) {
+			e.followUp(item)
+		}
+	}
+}
+
+// StoryAnalyzed reports whether item belongs to a story that already has an
+// analysis, in which case analyzing item again would only repeat it
+func StoryAnalyzed(store storage.Store, item *storage.NewsItem) bool {
+	if item.StoryID == "" {
+		return false
+	}
+	story, err := store.GetStory(item.StoryID)
+	return err == nil && story != nil && story.AnalysisID != ""
 }
 
 func (e *Engine) analyzeAndHandle(item storage.NewsItem) {
+	if StoryAnalyzed(e.store, &item) {
+		e.followUp(item)
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
 	defer cancel()
 
@@ -138,27 +177,20 @@ func (e *Engine) analyzeAndHandle(item storage.NewsItem) {
 		return
 	}
 
-	// 检查是否需要警报 (高影响且高置信度)
-	if analysis.ImpactLevel == "high" && analysis.SentimentScore != 0 {
-		e.triggerAlert(item, analysis)
+	// 按警报规则检查是否需要警报
+	if _, err := e.alerts.CheckAndCreateAlert(analysis, &item); err != nil {
+		log.Printf("Engine: failed to create alert for %s: %v", analysis.ID, err)
 	}
 }
 
-func (e *Engine) triggerAlert(news storage.NewsItem, analysis *storage.Analysis) {
-	log.Printf("🚨 HIGH IMPACT ALERT: %s (Score: %.2f)", news.Title, analysis.SentimentScore)
-	
-	alert := &storage.Alert{
-		ID:          fmt.Sprintf("alert_%d", time.Now().UnixNano()),
-		NewsID:      news.ID,
-		AnalysisID:  analysis.ID,
-		Title:       news.Title,
-		Description: analysis.Summary,
-		Severity:    "high",
-		Stocks:      analysis.RelatedStocks,
-		CreatedAt:   time.Now(),
-	}
-
-	if err := e.store.SaveAlert(alert); err != nil {
-		log.Printf("Engine: failed to save alert: %v", err)
+// followUp marks an item of an analyzed story processed and attaches it to
+// the story's open alert
+func (e *Engine) followUp(item storage.NewsItem) {
+	if err := e.store.MarkNewsProcessed(item.ID); err != nil {
+		log.Printf("Engine: failed to mark processed %s: %v", item.ID, err)
+	}
+	// 同一故事的后续报道计入已有警报
+	if _, err := e.alerts.FollowUp(&item); err != nil {
+		log.Printf("Engine: failed to attach %s to its story's alert: %v", item.ID, err)
 	}
 }
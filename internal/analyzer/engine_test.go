@@ -0,0 +1,61 @@
+package analyzer
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/reporter"
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+// countingProvider gives every prompt the same reply and counts the calls
+type countingProvider struct {
+	reply string
+	calls atomic.Int32
+}
+
+func (p *countingProvider) Generate(ctx context.Context, prompt string) (string, error) {
+	p.calls.Add(1)
+	return p.reply, nil
+}
+
+func TestEngineFollowsUpCopiesInTheSameBatch(t *testing.T) {
+	store, err := storage.New(filepath.Join(t.TempDir(), "engine.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	// three outlets carry the same story and arrive in one batch
+	now := time.Now()
+	for i, src := range []string{"rss:Reuters", "rss:Bloomberg", "twitter:WSJ"} {
+		item := &storage.NewsItem{ID: src, Source: src, Title: "US tightens chip export curbs on Nvidia and AMD",
+			PublishedAt: now.Add(time.Duration(i) * time.Minute), CollectedAt: now}
+		if err := store.SaveNews(item); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	provider := &countingProvider{reply: `{"sentiment":"negative","impact":"high","summary":"出口限制收紧",
+		"stocks":[{"symbol":"NVDA","score":-8}],"confidence":0.9}`}
+	am := reporter.NewAlertManager(store, nil, map[string]time.Duration{"high": time.Hour, "critical": time.Hour})
+	e := NewEngine(NewWithProvider(nil, store, provider), store, am)
+	e.processBatch()
+
+	if n := provider.calls.Load(); n != 1 {
+		t.Errorf("LLM called %d times, want once for the story", n)
+	}
+	alerts, total, err := store.ListAlerts(storage.AlertQuery{Limit: 10})
+	if err != nil || total != 1 {
+		t.Fatalf("alerts = %d, %v; want one for the story", total, err)
+	}
+	if alerts[0].Updates != 2 {
+		t.Errorf("alert has %d updates, want the 2 copies", alerts[0].Updates)
+	}
+	if pending, _ := store.GetUnprocessedNews(10); len(pending) != 0 {
+		t.Errorf("unprocessed after the batch: %d", len(pending))
+	}
+}
@@ -2,7 +2,9 @@ package analyzer
 
 import (
 	"regexp"
+	"sort"
 	"strings"
+	"unicode"
 )
 
 // StockMapper maps company names and keywords to stock symbols
@@ -135,6 +137,37 @@ func (m *StockMapper) FindRelatedStocks(text string) []string {
 	return result
 }
 
+var cashtagRe = regexp.MustCompile(`\$([A-Za-z]{1,5})\b`)
+
+// FindMentionedStocks 查找文本中直接提及的股票（$代码或公司名，按整词匹配）
+//
+// Unlike FindRelatedStocks it skips industry keywords and bare uppercase
+// words, so it suits counting mentions: "chips" is not a mention of NVDA.
+func (m *StockMapper) FindMentionedStocks(text string) []string {
+	found := make(map[string]bool)
+	for _, match := range cashtagRe.FindAllStringSubmatch(text, -1) {
+		if symbol := strings.ToUpper(match[1]); m.isValidTicker(symbol) {
+			found[symbol] = true
+		}
+	}
+
+	lower := " " + strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ") + " "
+	for name, symbol := range m.companies {
+		if strings.Contains(lower, " "+name+" ") {
+			found[symbol] = true
+		}
+	}
+
+	result := make([]string, 0, len(found))
+	for s := range found {
+		result = append(result, s)
+	}
+	sort.Strings(result)
+	return result
+}
+
 func (m *StockMapper) isValidTicker(s string) bool {
 	if len(s) < 1 || len(s) > 5 {
 		return false
@@ -0,0 +1,312 @@
+package analyzer
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+	"github.com/chenzhiguo/market-sentinel/internal/reporter"
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+// collectLag is how late a news row can become visible after its
+// collected_at: collectors stamp items before a slow batch is saved
+const collectLag = 5 * time.Minute
+
+// Spike is a bucket with unusually many mentions of a symbol on one source
+type Spike struct {
+	Symbol string
+	Source string
+	Bucket time.Time // start of the counting period
+	Count  int
+	Mean   float64 // baseline mentions per bucket
+	StdDev float64
+	Z      float64
+	NewsID string // latest item counted
+}
+
+type volumeKey struct {
+	symbol string
+	source string
+}
+
+// VolumeDetector counts mentions per symbol and source in fixed buckets and
+// raises volume_spike alerts when the current bucket's z-score against the
+// previous cfg.Baseline buckets reaches cfg.Threshold. It works on raw news,
+// so alerts go out before the LLM has looked at the items.
+type VolumeDetector struct {
+	cfg    config.VelocityConfig
+	store  storage.Store
+	alerts *reporter.AlertManager
+	mapper *StockMapper
+	now    func() time.Time
+
+	counts  map[volumeKey]map[int64]int // bucket index -> mentions
+	alerted map[volumeKey]int64         // bucket already alerted
+	since   map[string]int64            // first bucket with news from each source
+	seen    map[string]time.Time        // counted news IDs by collected_at
+	cursor  time.Time                   // newest collected_at counted
+
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+	isRunning bool
+	mu        sync.Mutex
+}
+
+func NewVolumeDetector(cfg config.VelocityConfig, store storage.Store, alerts *reporter.AlertManager) *VolumeDetector {
+	if cfg.Bucket <= 0 {
+		cfg.Bucket = time.Hour
+	}
+	if cfg.Baseline <= 1 {
+		cfg.Baseline = 24
+	}
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = 3
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 30 * time.Second
+	}
+	return &VolumeDetector{
+		cfg:     cfg,
+		store:   store,
+		alerts:  alerts,
+		mapper:  NewStockMapper(),
+		now:     time.Now,
+		counts:  make(map[volumeKey]map[int64]int),
+		alerted: make(map[volumeKey]int64),
+		since:   make(map[string]int64),
+		seen:    make(map[string]time.Time),
+		stopCh:  make(chan struct{}),
+	}
+}
+
+// Start rebuilds the baseline from stored news, then polls for new items
+func (d *VolumeDetector) Start() {
+	d.mu.Lock()
+	if d.isRunning {
+		d.mu.Unlock()
+		return
+	}
+	d.isRunning = true
+	d.stopCh = make(chan struct{})
+	d.mu.Unlock()
+
+	log.Printf("Starting Volume Detector (%s buckets, baseline %d, z >= %.1f)", d.cfg.Bucket, d.cfg.Baseline, d.cfg.Threshold)
+
+	d.wg.Add(1)
+	go d.loop()
+}
+
+// Stop gracefully shuts down the detector
+func (d *VolumeDetector) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.isRunning {
+		return
+	}
+	close(d.stopCh)
+	d.isRunning = false
+	d.wg.Wait()
+	log.Println("Volume Detector stopped")
+}
+
+func (d *VolumeDetector) loop() {
+	defer d.wg.Done()
+
+	// spikes found while replaying history were alerted before the restart
+	d.cursor = d.now().Add(-time.Duration(d.cfg.Baseline+1) * d.cfg.Bucket)
+	if _, err := d.poll(); err != nil {
+		log.Printf("VolumeDetector: warm-up failed: %v", err)
+	}
+
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stopCh:
+			return
+		case <-ticker.C:
+			spikes, err := d.poll()
+			if err != nil {
+				log.Printf("VolumeDetector: failed to read news: %v", err)
+			}
+			for _, sp := range spikes {
+				d.raise(sp)
+			}
+		}
+	}
+}
+
+// poll counts news collected since the last poll and returns new spikes
+func (d *VolumeDetector) poll() ([]Spike, error) {
+	var spikes []Spike
+	c := storage.Cursor{Time: d.cursor.Add(-collectLag)}
+	for {
+		items, err := d.store.NewsAfter(c, time.Time{}, 500)
+		if err != nil {
+			return spikes, err
+		}
+		var fresh []storage.NewsItem
+		for _, item := range items {
+			if _, ok := d.seen[item.ID]; ok {
+				continue
+			}
+			d.seen[item.ID] = item.CollectedAt
+			if item.CollectedAt.After(d.cursor) {
+				d.cursor = item.CollectedAt
+			}
+			fresh = append(fresh, item)
+		}
+		spikes = append(spikes, d.Observe(fresh)...)
+		if len(items) < 500 {
+			break
+		}
+		last := items[len(items)-1]
+		c = storage.Cursor{Time: last.CollectedAt, ID: last.ID}
+	}
+
+	for id, at := range d.seen {
+		if at.Before(d.cursor.Add(-2 * collectLag)) {
+			delete(d.seen, id)
+		}
+	}
+	return spikes, nil
+}
+
+// Observe counts the symbols mentioned in items and returns the keys whose
+// current bucket became a spike. Each key alerts at most once per bucket,
+// and a source only alerts once it has half a baseline of history.
+func (d *VolumeDetector) Observe(items []storage.NewsItem) []Spike {
+	now := d.now()
+	current := d.bucketOf(now)
+	touched := make(map[volumeKey]string)
+
+	for _, item := range items {
+		at := item.PublishedAt
+		if at.IsZero() || at.After(now) {
+			at = now
+		}
+		b := d.bucketOf(at)
+		if current-b > int64(d.cfg.Baseline) {
+			continue
+		}
+		if first, ok := d.since[item.Source]; !ok || b < first {
+			d.since[item.Source] = b
+		}
+		for _, symbol := range d.mapper.FindMentionedStocks(item.Title + " " + item.Content) {
+			k := volumeKey{symbol, item.Source}
+			if d.counts[k] == nil {
+				d.counts[k] = make(map[int64]int)
+			}
+			d.counts[k][b]++
+			if b == current {
+				touched[k] = item.ID
+			}
+		}
+	}
+
+	var spikes []Spike
+	for k, newsID := range touched {
+		if last, ok := d.alerted[k]; ok && last == current {
+			continue
+		}
+		// a new source has no baseline yet: everything on it looks like a burst
+		if current-d.since[k.source] < int64(d.cfg.Baseline/2) {
+			continue
+		}
+		sp := d.score(k, current)
+		if sp.Count < d.cfg.MinCount || sp.Z < d.cfg.Threshold {
+			continue
+		}
+		sp.NewsID = newsID
+		d.alerted[k] = current
+		spikes = append(spikes, sp)
+	}
+	d.prune(current)
+
+	sort.Slice(spikes, func(i, j int) bool { return spikes[i].Z > spikes[j].Z })
+	return spikes
+}
+
+// score compares bucket b of k with the cfg.Baseline buckets before it.
+// The deviation is floored at 1 so a quiet symbol needs MinCount mentions,
+// not just one, to look unusual.
+func (d *VolumeDetector) score(k volumeKey, b int64) Spike {
+	counts := d.counts[k]
+	n := float64(d.cfg.Baseline)
+	var sum, sumSq float64
+	for i := b - int64(d.cfg.Baseline); i < b; i++ {
+		c := float64(counts[i])
+		sum += c
+		sumSq += c * c
+	}
+	mean := sum / n
+	std := math.Sqrt(math.Max(sumSq/n-mean*mean, 0))
+	count := counts[b]
+	return Spike{
+		Symbol: k.symbol,
+		Source: k.source,
+		Bucket: time.Unix(0, b*int64(d.cfg.Bucket)).UTC(),
+		Count:  count,
+		Mean:   mean,
+		StdDev: std,
+		Z:      (float64(count) - mean) / math.Max(std, 1),
+	}
+}
+
+func (d *VolumeDetector) bucketOf(t time.Time) int64 {
+	return t.UnixNano() / int64(d.cfg.Bucket)
+}
+
+// prune drops buckets that fell out of the baseline and keys left empty
+func (d *VolumeDetector) prune(current int64) {
+	oldest := current - int64(d.cfg.Baseline)
+	for k, counts := range d.counts {
+		for b := range counts {
+			if b < oldest {
+				delete(counts, b)
+			}
+		}
+		if len(counts) == 0 {
+			delete(d.counts, k)
+		}
+	}
+	for k, b := range d.alerted {
+		if b < current {
+			delete(d.alerted, k)
+		}
+	}
+}
+
+// raise creates a volume_spike alert for sp
+func (d *VolumeDetector) raise(sp Spike) {
+	log.Printf("📊 VOLUME SPIKE: %s on %s, %d mentions (baseline %.1f, z=%.1f)", sp.Symbol, sp.Source, sp.Count, sp.Mean, sp.Z)
+
+	severity := "high"
+	if sp.Z >= 2*d.cfg.Threshold {
+		severity = "critical"
+	}
+	alert := &storage.Alert{
+		Kind:     storage.AlertKindVolumeSpike,
+		NewsID:   sp.NewsID,
+		Title:    fmt.Sprintf("📊 提及量异常 | $%s @ %s", sp.Symbol, sp.Source),
+		Severity: severity,
+		Description: fmt.Sprintf("%s 起 %s 内提及 %d 次，基线 %.1f ± %.1f（z=%.1f）",
+			sp.Bucket.Format("2006-01-02 15:04"), formatBucket(d.cfg.Bucket), sp.Count, sp.Mean, sp.StdDev, sp.Z),
+		Stocks: []string{sp.Symbol},
+		Source: sp.Source,
+	}
+	if err := d.alerts.Raise(alert); err != nil {
+		log.Printf("VolumeDetector: %v", err)
+	}
+}
+
+func formatBucket(b time.Duration) string {
+	return strings.TrimSuffix(strings.TrimSuffix(b.String(), "0s"), "0m")
+}
@@ -0,0 +1,67 @@
+package analyzer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+func TestVolumeDetectorSpike(t *testing.T) {
+	now := time.Date(2025, 3, 10, 14, 30, 0, 0, time.UTC)
+	d := NewVolumeDetector(config.VelocityConfig{Bucket: time.Hour, Baseline: 24, Threshold: 3, MinCount: 5}, nil, nil)
+	d.now = func() time.Time { return now }
+
+	const wsb = "reddit:r/wallstreetbets"
+	var items []storage.NewsItem
+	post := func(source, text string, at time.Time) {
+		items = append(items, storage.NewsItem{ID: fmt.Sprintf("n%d", len(items)), Source: source, Content: text, PublishedAt: at})
+	}
+	// a day of background chatter: GME once or twice an hour, Tesla ten
+	for h := 1; h <= 24; h++ {
+		at := now.Add(-time.Duration(h) * time.Hour)
+		for i := 0; i < 1+h%2; i++ {
+			post(wsb, "holding $GME", at)
+		}
+		for i := 0; i < 8+h%5; i++ {
+			post(wsb, "Tesla deliveries thread", at)
+		}
+	}
+	if spikes := d.Observe(items); len(spikes) != 0 {
+		t.Fatalf("history raised %+v", spikes)
+	}
+
+	items = nil
+	for i := 0; i < 11; i++ {
+		post(wsb, "$GME squeeze is on", now.Add(-time.Minute))
+		post(wsb, "Tesla robotaxi", now.Add(-time.Minute))
+	}
+	// a source seen for the first time has no baseline to compare with
+	for i := 0; i < 20; i++ {
+		post("rss:NewFeed", "$AMC halted", now)
+	}
+	spikes := d.Observe(items)
+	if len(spikes) != 1 {
+		t.Fatalf("spikes = %+v, want only GME", spikes)
+	}
+	sp := spikes[0]
+	if sp.Symbol != "GME" || sp.Source != wsb || sp.Count != 11 || sp.Z < 9 || !sp.Bucket.Equal(now.Truncate(time.Hour)) {
+		t.Errorf("spike = %+v", sp)
+	}
+
+	// more of the same burst does not alert again in this bucket
+	post(wsb, "$GME to the moon", now)
+	if spikes := d.Observe(items[len(items)-1:]); len(spikes) != 0 {
+		t.Errorf("repeat spikes = %+v", spikes)
+	}
+}
+
+func TestFindMentionedStocks(t *testing.T) {
+	m := NewStockMapper()
+	got := m.FindMentionedStocks("Apple and $nvda rally; macro data and metaverse chips, AI BIG NEW")
+	if len(got) != 2 || got[0] != "AAPL" || got[1] != "NVDA" {
+		t.Errorf("FindMentionedStocks = %v, want [AAPL NVDA]", got)
+	}
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+// alertStateRequest is the optional body of the alert state endpoints.
+// Snoozing takes either a duration ("2h") or an RFC3339 until.
+type alertStateRequest struct {
+	Note     string    `json:"note"`
+	Duration string    `json:"duration"`
+	Until    time.Time `json:"until"`
+}
+
+func (s *Server) handleAckAlert(w http.ResponseWriter, r *http.Request) {
+	s.changeAlertState(w, r, storage.AlertAcknowledged)
+}
+
+func (s *Server) handleSnoozeAlert(w http.ResponseWriter, r *http.Request) {
+	s.changeAlertState(w, r, storage.AlertSnoozed)
+}
+
+func (s *Server) handleResolveAlert(w http.ResponseWriter, r *http.Request) {
+	s.changeAlertState(w, r, storage.AlertResolved)
+}
+
+// changeAlertState moves the alert to state on behalf of the request's
+// token and returns the updated alert
+func (s *Server) changeAlertState(w http.ResponseWriter, r *http.Request, state string) {
+	var req alertStateRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			writeError(w, http.StatusBadRequest, "INVALID_BODY", err.Error())
+			return
+		}
+	}
+
+	now := time.Now()
+	ev := &storage.AlertEvent{ToState: state, Actor: requestIdentity(r), Note: req.Note, CreatedAt: now}
+	if state == storage.AlertSnoozed {
+		until := req.Until
+		if req.Duration != "" {
+			d, err := time.ParseDuration(req.Duration)
+			if err != nil || d <= 0 {
+				writeError(w, http.StatusBadRequest, "INVALID_BODY", "duration must be a positive duration like 30m or 2h")
+				return
+			}
+			until = now.Add(d)
+		}
+		if !until.After(now) {
+			writeError(w, http.StatusBadRequest, "INVALID_BODY", "snooze needs a duration or a future until")
+			return
+		}
+		ev.SnoozedUntil = &until
+	}
+
+	alert, err := s.store.ChangeAlertState(chi.URLParam(r, "id"), ev)
+	if errors.Is(err, storage.ErrAlertState) {
+		writeError(w, http.StatusConflict, "INVALID_STATE", err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "DB_ERROR", err.Error())
+		return
+	}
+	if alert == nil {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Alert not found")
+		return
+	}
+	writeSuccess(w, alert)
+}
@@ -2,11 +2,18 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+
+	"github.com/chenzhiguo/market-sentinel/internal/collector"
+	"github.com/chenzhiguo/market-sentinel/internal/events"
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
 )
 
 // Response structures
@@ -125,6 +132,68 @@ func (s *Server) handleGetNews(w http.ResponseWriter, r *http.Request) {
 	writeSuccess(w, item)
 }
 
+func (s *Server) handleGetStory(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	story, err := s.store.GetStory(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "DB_ERROR", err.Error())
+		return
+	}
+	if story == nil {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Story not found")
+		return
+	}
+	items, err := s.store.ListStoryNews(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "DB_ERROR", err.Error())
+		return
+	}
+	writeSuccess(w, map[string]interface{}{
+		"story": story,
+		"news":  items,
+	})
+}
+
+// handleListEvents clusters the stories analyzed in the last `hours` into
+// events, busiest first
+func (s *Server) handleListEvents(w http.ResponseWriter, r *http.Request) {
+	hours := queryInt(r, "hours", 24)
+	symbol := strings.ToUpper(r.URL.Query().Get("symbol"))
+	minStories := queryInt(r, "min_stories", 1)
+	limit := queryInt(r, "limit", 20)
+	if limit > 100 {
+		limit = 100
+	}
+
+	now := time.Now()
+	members, err := events.Load(s.store, now.Add(-time.Duration(hours)*time.Hour), now, 500)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "DB_ERROR", err.Error())
+		return
+	}
+
+	result := []events.Event{}
+	for _, e := range events.Cluster(members, now) {
+		if e.StoryCount < minStories || (symbol != "" && !contains(e.Stocks, symbol)) {
+			continue
+		}
+		result = append(result, e)
+		if len(result) == limit {
+			break
+		}
+	}
+	writeSuccess(w, result)
+}
+
+func contains(list []string, v string) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Server) handleListAnalysis(w http.ResponseWriter, r *http.Request) {
 	since := queryTime(r, "since")
 	until := queryTime(r, "until")
@@ -220,8 +289,69 @@ func (s *Server) handleGetStockSentiment(w http.ResponseWriter, r *http.Request)
 	writeSuccess(w, sentiment)
 }
 
+func (s *Server) handleGetStockTimeseries(w http.ResponseWriter, r *http.Request) {
+	symbol := chi.URLParam(r, "symbol")
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "1h"
+	}
+
+	points, err := s.store.GetSentimentTimeseries(symbol, interval, queryTime(r, "since"), queryTime(r, "until"))
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidInterval) {
+			writeError(w, http.StatusBadRequest, "INVALID_INTERVAL", "interval must be one of 5m, 1h, 1d")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "DB_ERROR", err.Error())
+		return
+	}
+
+	writeSuccess(w, map[string]interface{}{
+		"symbol":   strings.ToUpper(symbol),
+		"interval": interval,
+		"points":   points,
+	})
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	if q == "" {
+		writeError(w, http.StatusBadRequest, "INVALID_QUERY", "Missing search query parameter q")
+		return
+	}
+	limit := queryInt(r, "limit", 50)
+	offset := queryInt(r, "offset", 0)
+
+	if limit > 200 {
+		limit = 200
+	}
+
+	hits, total, err := s.store.Search(storage.SearchQuery{
+		Query:  q,
+		Type:   r.URL.Query().Get("type"),
+		Since:  queryTime(r, "since"),
+		Until:  queryTime(r, "until"),
+		Source: r.URL.Query().Get("source"),
+		Symbol: r.URL.Query().Get("symbol"),
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrInvalidQuery):
+			writeError(w, http.StatusBadRequest, "INVALID_QUERY", err.Error())
+		case errors.Is(err, storage.ErrSearchUnavailable):
+			writeError(w, http.StatusServiceUnavailable, "SEARCH_UNAVAILABLE", err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "DB_ERROR", err.Error())
+		}
+		return
+	}
+
+	writeSuccessWithMeta(w, hits, total, limit, offset)
+}
+
 func (s *Server) handleListAlerts(w http.ResponseWriter, r *http.Request) {
-	level := r.URL.Query().Get("level")
 	limit := queryInt(r, "limit", 50)
 	offset := queryInt(r, "offset", 0)
 
@@ -229,7 +359,23 @@ func (s *Server) handleListAlerts(w http.ResponseWriter, r *http.Request) {
 		limit = 200
 	}
 
-	items, total, err := s.store.ListAlerts(level, limit, offset)
+	state := r.URL.Query().Get("state")
+	switch state {
+	case "", storage.AlertOpen, storage.AlertAcknowledged, storage.AlertSnoozed, storage.AlertResolved:
+	default:
+		writeError(w, http.StatusBadRequest, "INVALID_QUERY", "state must be open, acknowledged, snoozed or resolved")
+		return
+	}
+
+	items, total, err := s.store.ListAlerts(storage.AlertQuery{
+		Severity: r.URL.Query().Get("level"),
+		State:    state,
+		Symbol:   r.URL.Query().Get("symbol"),
+		Since:    queryTime(r, "since"),
+		Until:    queryTime(r, "until"),
+		Limit:    limit,
+		Offset:   offset,
+	})
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "DB_ERROR", err.Error())
 		return
@@ -238,10 +384,133 @@ func (s *Server) handleListAlerts(w http.ResponseWriter, r *http.Request) {
 	writeSuccessWithMeta(w, items, total, limit, offset)
 }
 
-func (s *Server) handleTriggerScan(w http.ResponseWriter, r *http.Request) {
-	// TODO: Trigger actual scan
+// handleGetAlert returns an alert with the follow-ups attached to it and
+// the audit trail of its state changes
+func (s *Server) handleGetAlert(w http.ResponseWriter, r *http.Request) {
+	alert, err := s.store.GetAlert(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "DB_ERROR", err.Error())
+		return
+	}
+	if alert == nil {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Alert not found")
+		return
+	}
+	updates, err := s.store.ListAlertUpdates(alert.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "DB_ERROR", err.Error())
+		return
+	}
+	events, err := s.store.ListAlertEvents(alert.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "DB_ERROR", err.Error())
+		return
+	}
 	writeSuccess(w, map[string]interface{}{
-		"status":  "triggered",
-		"message": "Scan has been triggered",
+		"alert":   alert,
+		"updates": updates,
+		"events":  events,
 	})
 }
+
+// handleTriggerScan starts a scan, optionally limited to some sources or
+// feeds. Triggers that arrive while a scan is running or queued join it.
+func (s *Server) handleTriggerScan(w http.ResponseWriter, r *http.Request) {
+	if s.collectors == nil {
+		writeError(w, http.StatusServiceUnavailable, "SCAN_UNAVAILABLE", "Collectors are not running")
+		return
+	}
+	var req struct {
+		Sources []string `json:"sources"`
+		Feeds   []string `json:"feeds"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			writeError(w, http.StatusBadRequest, "INVALID_BODY", err.Error())
+			return
+		}
+	}
+
+	scan, coalesced, err := s.collectors.Trigger(req.Sources, req.Feeds)
+	if errors.Is(err, collector.ErrUnknownFeed) {
+		writeError(w, http.StatusBadRequest, "UNKNOWN_FEED", err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "SCAN_ERROR", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusAccepted, Response{
+		Success: true,
+		Data: map[string]interface{}{
+			"scan_id":   scan.ID,
+			"status":    scan.Status,
+			"coalesced": coalesced,
+			"targets":   scan.Targets,
+		},
+	})
+}
+
+func (s *Server) handleGetScan(w http.ResponseWriter, r *http.Request) {
+	if s.collectors == nil {
+		writeError(w, http.StatusServiceUnavailable, "SCAN_UNAVAILABLE", "Collectors are not running")
+		return
+	}
+	scan, ok := s.collectors.Scan(chi.URLParam(r, "id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Scan not found")
+		return
+	}
+	writeSuccess(w, scan)
+}
+
+// handleTriggerBackup starts a snapshot in the background. Large databases
+// can take longer than the request timeout, so progress is reported by
+// GET /api/v1/admin/backups.
+func (s *Server) handleTriggerBackup(w http.ResponseWriter, r *http.Request) {
+	if s.snapshotter == nil {
+		writeError(w, http.StatusServiceUnavailable, "BACKUP_UNAVAILABLE", "Backups are not configured")
+		return
+	}
+	if s.store.Dialect() != "sqlite" {
+		writeError(w, http.StatusNotImplemented, "BACKUP_UNSUPPORTED", storage.ErrBackupUnsupported.Error())
+		return
+	}
+	if !s.snapshotter.TryRunAsync() {
+		writeError(w, http.StatusConflict, "BACKUP_IN_PROGRESS", "A backup is already running")
+		return
+	}
+	writeJSON(w, http.StatusAccepted, Response{
+		Success: true,
+		Data: map[string]interface{}{
+			"status": "started",
+			"dir":    s.snapshotter.Dir(),
+		},
+	})
+}
+
+// handleListBackups lists snapshots, newest first, with the state of the last run
+func (s *Server) handleListBackups(w http.ResponseWriter, r *http.Request) {
+	if s.snapshotter == nil {
+		writeError(w, http.StatusServiceUnavailable, "BACKUP_UNAVAILABLE", "Backups are not configured")
+		return
+	}
+	snaps, err := storage.ListSnapshots(s.snapshotter.Dir())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "BACKUP_ERROR", err.Error())
+		return
+	}
+	if snaps == nil {
+		snaps = []storage.Snapshot{}
+	}
+	running, last, lastErr := s.snapshotter.Status()
+	data := map[string]interface{}{
+		"snapshots": snaps,
+		"running":   running,
+		"last":      last,
+	}
+	if lastErr != nil {
+		data["last_error"] = lastErr.Error()
+	}
+	writeSuccess(w, data)
+}
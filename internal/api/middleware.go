@@ -2,13 +2,33 @@ package api
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"net/http"
 	"strings"
+	"time"
 )
 
 type contextKey string
 
-const tokenContextKey contextKey = "token"
+const (
+	tokenContextKey     contextKey = "token"
+	principalContextKey contextKey = "principal"
+)
+
+// principal is the holder of the token that authenticated a request
+type principal struct {
+	name     string // name of a stored token, empty for config tokens
+	identity string // recorded in audit trails
+	scopes   []string
+	limitKey string // auth.token_limits key: the name, or "sha256:<hex>" of a config token
+}
+
+// can reports whether p holds scope
+func (p *principal) can(scope string) bool {
+	return contains(p.scopes, scope)
+}
 
 func (s *Server) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -18,16 +38,36 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		if !s.isValidToken(token) {
-			writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid authentication token")
+		p, err := s.authenticate(token)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "DB_ERROR", err.Error())
+			return
+		}
+		if p == nil {
+			writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Invalid, expired or revoked authentication token")
 			return
 		}
 
 		ctx := context.WithValue(r.Context(), tokenContextKey, token)
+		ctx = context.WithValue(ctx, principalContextKey, p)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// requireScope refuses requests whose token lacks scope. It runs after
+// authMiddleware.
+func requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if p := requestPrincipal(r); p == nil || !p.can(scope) {
+				writeError(w, http.StatusForbidden, "FORBIDDEN", "Token lacks the "+scope+" scope")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func extractToken(r *http.Request) string {
 	// Check Authorization header
 	auth := r.Header.Get("Authorization")
@@ -43,11 +83,48 @@ func extractToken(r *http.Request) string {
 	return ""
 }
 
-func (s *Server) isValidToken(token string) bool {
-	for _, t := range s.cfg.Auth.Tokens {
-		if t == token {
-			return true
-		}
+// authenticate finds the holder of token: a config token, which has every
+// scope, or an active stored token. Tokens are only ever compared as
+// SHA-256 digests, in constant time. It returns nil for unknown, expired
+// and revoked tokens.
+func (s *Server) authenticate(token string) (*principal, error) {
+	digest := sha256.Sum256([]byte(token))
+
+	match := 0
+	for _, d := range s.configTokens {
+		match |= subtle.ConstantTimeCompare(digest[:], d)
 	}
-	return false
+	hash := hex.EncodeToString(digest[:])
+	if match == 1 {
+		return &principal{identity: tokenIdentity(token), scopes: Scopes, limitKey: hashedTokenPrefix + hash}, nil
+	}
+
+	t, err := s.store.GetAPITokenByHash(hash)
+	if err != nil || t == nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(t.Hash), []byte(hash)) != 1 || !t.Active(time.Now()) {
+		return nil, nil
+	}
+	return &principal{name: t.Name, identity: "token:" + t.Name, scopes: t.Scopes, limitKey: t.Name}, nil
+}
+
+// tokenIdentity names the holder of a config token in audit records
+// without storing the token itself
+func tokenIdentity(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:])[:12]
+}
+
+func requestPrincipal(r *http.Request) *principal {
+	p, _ := r.Context().Value(principalContextKey).(*principal)
+	return p
+}
+
+// requestIdentity is the identity of the token that authenticated r
+func requestIdentity(r *http.Request) string {
+	if p := requestPrincipal(r); p != nil {
+		return p.identity
+	}
+	return ""
 }
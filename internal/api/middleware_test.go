@@ -0,0 +1,89 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+func TestAuthRejectsExpiredAndRevokedTokens(t *testing.T) {
+	s, store := newTestServer(t, config.AuthConfig{})
+
+	live := createToken(t, store, "live", ScopeReadNews)
+	revoked := createToken(t, store, "revoked", ScopeReadNews)
+	if found, err := store.RevokeAPIToken("revoked", time.Now()); err != nil || !found {
+		t.Fatalf("RevokeAPIToken = %v, %v", found, err)
+	}
+	tok, expired, err := NewAPIToken("expired", []string{ScopeReadNews}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Minute)
+	tok.ExpiresAt = &past
+	if err := store.CreateAPIToken(tok); err != nil {
+		t.Fatal(err)
+	}
+
+	expectStatus(t, call(s, http.MethodGet, "/api/v1/news", live), http.StatusOK, "live token")
+	for what, token := range map[string]string{
+		"expired token": expired,
+		"revoked token": revoked,
+		"unknown token": "sk-sentinel-unknown",
+		"no token":      "",
+	} {
+		rec := call(s, http.MethodGet, "/api/v1/news", token)
+		expectStatus(t, rec, http.StatusUnauthorized, what)
+		if code := errorCode(t, rec); code != "UNAUTHORIZED" {
+			t.Errorf("%s: error code %q", what, code)
+		}
+	}
+}
+
+func TestAuthRequiresScope(t *testing.T) {
+	s, store := newTestServer(t, config.AuthConfig{})
+	if err := store.SaveAlert(&storage.Alert{ID: "al1", Severity: "high", CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	reader := createToken(t, store, "reader", ScopeReadNews)
+	oncall := createToken(t, store, "oncall", ScopeReadAlerts, ScopeWriteAlerts)
+
+	for _, path := range []string{"/api/v1/alerts", "/api/v1/alerts/al1"} {
+		rec := call(s, http.MethodGet, path, reader)
+		expectStatus(t, rec, http.StatusForbidden, "read:news token on "+path)
+		if code := errorCode(t, rec); code != "FORBIDDEN" {
+			t.Errorf("%s: error code %q", path, code)
+		}
+	}
+	expectStatus(t, call(s, http.MethodPost, "/api/v1/alerts/al1/ack", reader), http.StatusForbidden, "read:news token acking")
+	expectStatus(t, call(s, http.MethodPost, "/api/v1/scan", oncall), http.StatusForbidden, "alerts token scanning")
+	expectStatus(t, call(s, http.MethodGet, "/api/v1/news", oncall), http.StatusForbidden, "alerts token reading news")
+
+	expectStatus(t, call(s, http.MethodPost, "/api/v1/alerts/al1/ack", oncall), http.StatusOK, "write:alerts token acking")
+	events, err := store.ListAlertEvents("al1")
+	if err != nil || len(events) != 1 || events[0].Actor != "token:oncall" {
+		t.Errorf("audit trail = %+v, %v; want one event by token:oncall", events, err)
+	}
+}
+
+func TestAuthConfigTokenDigest(t *testing.T) {
+	s, _ := newTestServer(t, config.AuthConfig{Tokens: []string{
+		"sha256:" + HashToken("cron-secret"),
+		"sha256:not-hex", // ignored
+		"plain-secret",
+	}})
+
+	for _, token := range []string{"cron-secret", "plain-secret"} {
+		rec := call(s, http.MethodGet, "/api/v1/news", token)
+		expectStatus(t, rec, http.StatusOK, token)
+	}
+	// config tokens hold every scope
+	expectStatus(t, call(s, http.MethodGet, "/api/v1/alerts", "cron-secret"), http.StatusOK, "config token reading alerts")
+
+	// the digest itself is not a token
+	for _, token := range []string{"sha256:" + HashToken("cron-secret"), HashToken("cron-secret"), "sha256:not-hex"} {
+		expectStatus(t, call(s, http.MethodGet, "/api/v1/news", token), http.StatusUnauthorized, "digest "+token)
+	}
+}
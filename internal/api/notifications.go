@@ -0,0 +1,23 @@
+package api
+
+import (
+	"net/http"
+)
+
+// handleListNotifications returns the notifier's send log, optionally for one
+// alert, channel or status
+func (s *Server) handleListNotifications(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := queryInt(r, "limit", 50)
+	offset := queryInt(r, "offset", 0)
+	if limit > 200 {
+		limit = 200
+	}
+
+	items, total, err := s.store.ListNotifications(q.Get("alert_id"), q.Get("channel"), q.Get("status"), limit, offset)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "DB_ERROR", err.Error())
+		return
+	}
+	writeSuccessWithMeta(w, items, total, limit, offset)
+}
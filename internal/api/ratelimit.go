@@ -0,0 +1,122 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+	"github.com/chenzhiguo/market-sentinel/internal/ratelimit"
+)
+
+// defaultRouteCosts weighs the expensive endpoints; auth.route_costs adds
+// to and overrides them. Other routes cost 1.
+var defaultRouteCosts = map[string]int{
+	"/api/v1/search":                     5,
+	"/api/v1/stocks/{symbol}/timeseries": 3,
+	"/api/v1/rules/dry-run":              10,
+	"/api/v1/scan":                       10,
+	"/api/v1/admin/backup":               10,
+}
+
+// rateLimiter gives each token a bucket of rate requests per minute. A
+// request spends the cost of its route. Buckets are keyed by the token's
+// identity, so secrets are not held on to.
+type rateLimiter struct {
+	rate      int            // default requests per minute, 0 is unlimited
+	overrides map[string]int // by principal.limitKey
+	costs     map[string]int // by route pattern
+	now       func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*ratelimit.Bucket // by token identity
+}
+
+func newRateLimiter(cfg config.AuthConfig) *rateLimiter {
+	l := &rateLimiter{
+		rate:      cfg.RateLimit,
+		overrides: make(map[string]int),
+		costs:     make(map[string]int),
+		now:       time.Now,
+		buckets:   make(map[string]*ratelimit.Bucket),
+	}
+	for _, o := range cfg.TokenLimits {
+		l.overrides[o.Token] = o.RateLimit
+	}
+	for route, cost := range defaultRouteCosts {
+		l.costs[route] = cost
+	}
+	for route, cost := range cfg.RouteCosts {
+		l.costs[route] = cost
+	}
+	return l
+}
+
+// rateLimitMiddleware runs after authMiddleware, inside a route group, so
+// both the token and the matched route pattern are known
+func (s *Server) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := requestPrincipal(r)
+		rate := s.limiter.rateFor(p.limitKey)
+		if rate <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cost := s.limiter.cost(chi.RouteContext(r.Context()).RoutePattern())
+		ok, remaining, reset, retry := s.limiter.take(p.identity, rate, cost)
+
+		h := w.Header()
+		h.Set("X-RateLimit-Limit", strconv.Itoa(rate))
+		h.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		h.Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		h.Set("X-RateLimit-Cost", strconv.Itoa(cost))
+		if !ok {
+			h.Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+			writeError(w, http.StatusTooManyRequests, "RATE_LIMITED", "Rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateFor is the limit of the token with limitKey. Overrides never name
+// a secret: config.Load rejects them.
+func (l *rateLimiter) rateFor(limitKey string) int {
+	if rate, ok := l.overrides[limitKey]; ok {
+		return rate
+	}
+	return l.rate
+}
+
+func (l *rateLimiter) cost(route string) int {
+	if c, ok := l.costs[route]; ok && c > 0 {
+		return c
+	}
+	return 1
+}
+
+// take spends cost from the bucket of identity. It returns whether the
+// request may proceed, the whole requests left, when the bucket is full
+// again and, when refused, how long until cost is available.
+func (l *rateLimiter) take(identity string, rate, cost int) (bool, int, time.Time, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.buckets[identity]
+	if b == nil || b.Rate() != float64(rate) {
+		b = ratelimit.NewBucket(rate, time.Minute)
+		l.buckets[identity] = b
+	}
+	// a route costing more than the whole bucket takes all of it
+	if cost > rate {
+		cost = rate
+	}
+	now := l.now()
+	ok := b.Take(now, float64(cost))
+	return ok, int(b.Tokens()), now.Add(b.Wait(b.Rate())), b.Wait(float64(cost))
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+)
+
+func TestRateLimitExhaustionAndRefill(t *testing.T) {
+	s, _ := newTestServer(t, config.AuthConfig{Tokens: []string{"secret"}, RateLimit: 3})
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	s.limiter.now = func() time.Time { return now }
+
+	for i, want := range []string{"2", "1", "0"} {
+		rec := call(s, http.MethodGet, "/api/v1/news", "secret")
+		expectStatus(t, rec, http.StatusOK, "request within the limit")
+		if got := rec.Header().Get("X-RateLimit-Remaining"); got != want {
+			t.Errorf("request %d: remaining %s, want %s", i+1, got, want)
+		}
+	}
+	if got := call(s, http.MethodGet, "/api/v1/news", "secret").Header().Get("X-RateLimit-Limit"); got != "3" {
+		t.Errorf("X-RateLimit-Limit = %q", got)
+	}
+
+	rec := call(s, http.MethodGet, "/api/v1/news", "secret")
+	expectStatus(t, rec, http.StatusTooManyRequests, "exhausted bucket")
+	if code := errorCode(t, rec); code != "RATE_LIMITED" {
+		t.Errorf("error code %q", code)
+	}
+	// 3 per minute refill one request every 20s
+	if got := rec.Header().Get("Retry-After"); got != "20" {
+		t.Errorf("Retry-After = %q, want 20", got)
+	}
+
+	now = now.Add(10 * time.Second)
+	expectStatus(t, call(s, http.MethodGet, "/api/v1/news", "secret"), http.StatusTooManyRequests, "half refilled")
+	now = now.Add(10 * time.Second)
+	expectStatus(t, call(s, http.MethodGet, "/api/v1/news", "secret"), http.StatusOK, "refilled")
+
+	// an idle hour fills the bucket, but only up to the rate
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		expectStatus(t, call(s, http.MethodGet, "/api/v1/news", "secret"), http.StatusOK, "full bucket")
+	}
+	expectStatus(t, call(s, http.MethodGet, "/api/v1/news", "secret"), http.StatusTooManyRequests, "capped bucket")
+}
+
+func TestRateLimitRouteCost(t *testing.T) {
+	s, _ := newTestServer(t, config.AuthConfig{
+		Tokens:     []string{"secret"},
+		RateLimit:  10,
+		RouteCosts: map[string]int{"/api/v1/news": 4},
+	})
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	s.limiter.now = func() time.Time { return now }
+
+	rec := call(s, http.MethodGet, "/api/v1/search?q=nvda", "secret")
+	if rec.Header().Get("X-RateLimit-Cost") != "5" || rec.Header().Get("X-RateLimit-Remaining") != "5" {
+		t.Errorf("search: cost %s, remaining %s; want 5, 5",
+			rec.Header().Get("X-RateLimit-Cost"), rec.Header().Get("X-RateLimit-Remaining"))
+	}
+	rec = call(s, http.MethodGet, "/api/v1/news", "secret")
+	expectStatus(t, rec, http.StatusOK, "configured route cost")
+	if rec.Header().Get("X-RateLimit-Cost") != "4" || rec.Header().Get("X-RateLimit-Remaining") != "1" {
+		t.Errorf("news: cost %s, remaining %s; want 4, 1",
+			rec.Header().Get("X-RateLimit-Cost"), rec.Header().Get("X-RateLimit-Remaining"))
+	}
+
+	// one token left is too little for a search but enough for a plain route
+	rec = call(s, http.MethodGet, "/api/v1/search?q=nvda", "secret")
+	expectStatus(t, rec, http.StatusTooManyRequests, "search with 1 token left")
+	if got := rec.Header().Get("Retry-After"); got != "24" {
+		t.Errorf("Retry-After = %q, want 24 (4 tokens at 10/min)", got)
+	}
+	expectStatus(t, call(s, http.MethodGet, "/api/v1/events", "secret"), http.StatusOK, "cost 1 route")
+}
+
+func TestRateLimitTokenOverrides(t *testing.T) {
+	s, store := newTestServer(t, config.AuthConfig{
+		Tokens:    []string{"sha256:" + HashToken("cron-secret")},
+		RateLimit: 2,
+		TokenLimits: []config.TokenRateLimit{
+			{Token: "batch", RateLimit: 1},
+			{Token: "ops", RateLimit: 0},
+			{Token: "sha256:" + HashToken("cron-secret"), RateLimit: 5},
+		},
+	})
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	s.limiter.now = func() time.Time { return now }
+
+	batch := createToken(t, store, "batch", ScopeReadNews)
+	ops := createToken(t, store, "ops", ScopeReadNews)
+	dash := createToken(t, store, "dashboard", ScopeReadNews)
+
+	rec := call(s, http.MethodGet, "/api/v1/news", batch)
+	expectStatus(t, rec, http.StatusOK, "batch")
+	if got := rec.Header().Get("X-RateLimit-Limit"); got != "1" {
+		t.Errorf("batch limit %q, want 1", got)
+	}
+	expectStatus(t, call(s, http.MethodGet, "/api/v1/news", batch), http.StatusTooManyRequests, "batch over its override")
+
+	// rate 0 lifts the limit for one token
+	for i := 0; i < 5; i++ {
+		rec := call(s, http.MethodGet, "/api/v1/news", ops)
+		expectStatus(t, rec, http.StatusOK, "unlimited token")
+		if got := rec.Header().Get("X-RateLimit-Limit"); got != "" {
+			t.Fatalf("unlimited token got X-RateLimit-Limit %q", got)
+		}
+	}
+
+	// a config token is overridden by its digest
+	rec = call(s, http.MethodGet, "/api/v1/news", "cron-secret")
+	expectStatus(t, rec, http.StatusOK, "config token")
+	if got := rec.Header().Get("X-RateLimit-Limit"); got != "5" {
+		t.Errorf("config token limit %q, want 5", got)
+	}
+
+	// the others keep the default, each in its own bucket
+	for i := 0; i < 2; i++ {
+		expectStatus(t, call(s, http.MethodGet, "/api/v1/news", dash), http.StatusOK, "dashboard")
+	}
+	expectStatus(t, call(s, http.MethodGet, "/api/v1/news", dash), http.StatusTooManyRequests, "dashboard over the default")
+}
+
+func TestRateLimitBucketPerToken(t *testing.T) {
+	s, _ := newTestServer(t, config.AuthConfig{Tokens: []string{"alice", "bob"}, RateLimit: 1})
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	s.limiter.now = func() time.Time { return now }
+
+	expectStatus(t, call(s, http.MethodGet, "/api/v1/news", "alice"), http.StatusOK, "alice")
+	expectStatus(t, call(s, http.MethodGet, "/api/v1/news", "alice"), http.StatusTooManyRequests, "alice again")
+	expectStatus(t, call(s, http.MethodGet, "/api/v1/news", "bob"), http.StatusOK, "bob, unaffected by alice")
+
+	// buckets are keyed by identity, never by the secret
+	for identity := range s.limiter.buckets {
+		if identity == "alice" || identity == "bob" {
+			t.Errorf("bucket keyed by secret %q", identity)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/chenzhiguo/market-sentinel/internal/rules"
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+// ruleRequest is the body of create, update and dry-run requests
+type ruleRequest struct {
+	Name     string   `json:"name"`
+	When     string   `json:"when"`
+	Severity string   `json:"severity"`
+	Channels []string `json:"channels"`
+	Enabled  *bool    `json:"enabled"` // default true
+}
+
+// compileRule validates req as a rule. Channels must be configured notifier
+// channels.
+func (s *Server) compileRule(req ruleRequest) (rules.Rule, error) {
+	r := rules.Rule{
+		Name:     strings.TrimSpace(req.Name),
+		When:     req.When,
+		Severity: strings.ToLower(strings.TrimSpace(req.Severity)),
+		Channels: req.Channels,
+		Enabled:  req.Enabled == nil || *req.Enabled,
+		Source:   rules.SourceAPI,
+	}
+	if r.Name == "" {
+		return r, fmt.Errorf("name is required")
+	}
+	var known []string
+	for _, ch := range s.cfg.Notifier.Channels {
+		known = append(known, ch.Name)
+	}
+	for _, ch := range r.Channels {
+		if !contains(known, ch) {
+			return r, fmt.Errorf("unknown channel %q, configured: %s", ch, strings.Join(known, ", "))
+		}
+	}
+	return r, r.Compile()
+}
+
+func (s *Server) handleListRules(w http.ResponseWriter, r *http.Request) {
+	if s.rules == nil {
+		writeError(w, http.StatusServiceUnavailable, "RULES_UNAVAILABLE", "Alert rules are not loaded")
+		return
+	}
+	stored, err := s.store.ListAlertRules()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "DB_ERROR", err.Error())
+		return
+	}
+	list := s.rules.Static()
+	for _, sr := range stored {
+		list = append(list, rules.FromStored(sr))
+	}
+	writeSuccess(w, list)
+}
+
+func (s *Server) handleCreateRule(w http.ResponseWriter, r *http.Request) {
+	if s.rules == nil {
+		writeError(w, http.StatusServiceUnavailable, "RULES_UNAVAILABLE", "Alert rules are not loaded")
+		return
+	}
+	var req ruleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_BODY", err.Error())
+		return
+	}
+	rule, err := s.compileRule(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_RULE", err.Error())
+		return
+	}
+	rule.ID = "rule_" + randomHex(6)
+
+	stored := &storage.AlertRule{
+		ID:       rule.ID,
+		Name:     rule.Name,
+		When:     rule.When,
+		Severity: rule.Severity,
+		Channels: rule.Channels,
+		Enabled:  rule.Enabled,
+	}
+	if err := s.store.CreateAlertRule(stored); err != nil {
+		writeError(w, http.StatusInternalServerError, "DB_ERROR", err.Error())
+		return
+	}
+	s.reloadRules()
+	writeJSON(w, http.StatusCreated, Response{Success: true, Data: rule})
+}
+
+func (s *Server) handleGetRule(w http.ResponseWriter, r *http.Request) {
+	if s.rules == nil {
+		writeError(w, http.StatusServiceUnavailable, "RULES_UNAVAILABLE", "Alert rules are not loaded")
+		return
+	}
+	rule, err := s.findRule(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "DB_ERROR", err.Error())
+		return
+	}
+	if rule == nil {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Rule not found")
+		return
+	}
+	writeSuccess(w, rule)
+}
+
+// handleUpdateRule replaces a rule created through the API
+func (s *Server) handleUpdateRule(w http.ResponseWriter, r *http.Request) {
+	if s.rules == nil {
+		writeError(w, http.StatusServiceUnavailable, "RULES_UNAVAILABLE", "Alert rules are not loaded")
+		return
+	}
+	id := chi.URLParam(r, "id")
+	if s.isStaticRule(id) {
+		writeError(w, http.StatusConflict, "RULE_READ_ONLY", "Rules from the config file are changed there")
+		return
+	}
+	var req ruleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_BODY", err.Error())
+		return
+	}
+	rule, err := s.compileRule(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_RULE", err.Error())
+		return
+	}
+	rule.ID = id
+
+	found, err := s.store.UpdateAlertRule(&storage.AlertRule{
+		ID:       id,
+		Name:     rule.Name,
+		When:     rule.When,
+		Severity: rule.Severity,
+		Channels: rule.Channels,
+		Enabled:  rule.Enabled,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "DB_ERROR", err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Rule not found")
+		return
+	}
+	s.reloadRules()
+	writeSuccess(w, rule)
+}
+
+func (s *Server) handleDeleteRule(w http.ResponseWriter, r *http.Request) {
+	if s.rules == nil {
+		writeError(w, http.StatusServiceUnavailable, "RULES_UNAVAILABLE", "Alert rules are not loaded")
+		return
+	}
+	id := chi.URLParam(r, "id")
+	if s.isStaticRule(id) {
+		writeError(w, http.StatusConflict, "RULE_READ_ONLY", "Rules from the config file are changed there")
+		return
+	}
+	found, err := s.store.DeleteAlertRule(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "DB_ERROR", err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Rule not found")
+		return
+	}
+	s.reloadRules()
+	writeSuccess(w, map[string]interface{}{"id": id, "deleted": true})
+}
+
+// handleDryRunRule evaluates an existing rule (rule_id) or an unsaved one
+// against stored analyses, by default those of the last 7 days
+func (s *Server) handleDryRunRule(w http.ResponseWriter, r *http.Request) {
+	if s.rules == nil {
+		writeError(w, http.StatusServiceUnavailable, "RULES_UNAVAILABLE", "Alert rules are not loaded")
+		return
+	}
+	var req struct {
+		ruleRequest
+		RuleID string    `json:"rule_id"`
+		Since  time.Time `json:"since"`
+		Until  time.Time `json:"until"`
+		Limit  int       `json:"limit"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_BODY", err.Error())
+		return
+	}
+
+	var rule rules.Rule
+	if req.RuleID != "" {
+		found, err := s.findRule(req.RuleID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "DB_ERROR", err.Error())
+			return
+		}
+		if found == nil {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Rule not found")
+			return
+		}
+		rule = *found
+		if err := rule.Compile(); err != nil {
+			writeError(w, http.StatusBadRequest, "INVALID_RULE", err.Error())
+			return
+		}
+	} else {
+		if req.Name == "" {
+			req.Name = "dry-run"
+		}
+		compiled, err := s.compileRule(req.ruleRequest)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "INVALID_RULE", err.Error())
+			return
+		}
+		rule = compiled
+	}
+
+	if req.Until.IsZero() {
+		req.Until = time.Now()
+	}
+	if req.Since.IsZero() {
+		req.Since = req.Until.Add(-7 * 24 * time.Hour)
+	}
+	if req.Limit <= 0 {
+		req.Limit = 50
+	}
+	if req.Limit > 200 {
+		req.Limit = 200
+	}
+	res, err := s.rules.DryRun(rule, req.Since, req.Until, req.Limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "DB_ERROR", err.Error())
+		return
+	}
+	writeSuccess(w, res)
+}
+
+// findRule looks id up among the config and stored rules
+func (s *Server) findRule(id string) (*rules.Rule, error) {
+	for _, r := range s.rules.Static() {
+		if r.ID == id {
+			return &r, nil
+		}
+	}
+	sr, err := s.store.GetAlertRule(id)
+	if err != nil || sr == nil {
+		return nil, err
+	}
+	r := rules.FromStored(*sr)
+	return &r, nil
+}
+
+func (s *Server) isStaticRule(id string) bool {
+	for _, r := range s.rules.Static() {
+		if r.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// reloadRules applies a rule change to the running engine
+func (s *Server) reloadRules() {
+	if err := s.rules.Reload(); err != nil {
+		log.Printf("API: failed to reload alert rules: %v", err)
+	}
+}
@@ -5,26 +5,70 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
+	"github.com/chenzhiguo/market-sentinel/internal/collector"
 	"github.com/chenzhiguo/market-sentinel/internal/config"
+	"github.com/chenzhiguo/market-sentinel/internal/rules"
 	"github.com/chenzhiguo/market-sentinel/internal/storage"
+	"github.com/chenzhiguo/market-sentinel/internal/stream"
 )
 
 type Server struct {
-	cfg    *config.Config
-	store  *storage.Storage
-	router *chi.Mux
-	http   *http.Server
+	cfg         *config.Config
+	store       storage.Store
+	snapshotter *storage.Snapshotter
+	collectors  *collector.Manager
+	bus         *stream.Bus
+	rules       *rules.Set
+	limiter     *rateLimiter
+	router      *chi.Mux
+	http        *http.Server
+
+	configTokens [][]byte // SHA-256 of auth.tokens
+
+	closing   chan struct{} // closed on Shutdown to end open streams
+	closeOnce sync.Once
 }
 
-func NewServer(cfg *config.Config, store *storage.Storage) *Server {
+// Option wires optional services into the Server
+type Option func(*Server)
+
+// WithSnapshotter enables the admin backup endpoints
+func WithSnapshotter(sn *storage.Snapshotter) Option {
+	return func(s *Server) { s.snapshotter = sn }
+}
+
+// WithStream enables the live event stream
+func WithStream(b *stream.Bus) Option {
+	return func(s *Server) { s.bus = b }
+}
+
+// WithCollector enables manual scans
+func WithCollector(m *collector.Manager) Option {
+	return func(s *Server) { s.collectors = m }
+}
+
+// WithRules enables alert rule management
+func WithRules(rs *rules.Set) Option {
+	return func(s *Server) { s.rules = rs }
+}
+
+func NewServer(cfg *config.Config, store storage.Store, opts ...Option) *Server {
 	s := &Server{
-		cfg:   cfg,
-		store: store,
+		cfg:     cfg,
+		store:   store,
+		limiter: newRateLimiter(cfg.Auth),
+		closing: make(chan struct{}),
+
+		configTokens: configTokenDigests(cfg.Auth.Tokens),
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
 	s.setupRouter()
 	return s
@@ -38,40 +82,114 @@ func (s *Server) setupRouter() {
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(30 * time.Second))
 	r.Use(corsMiddleware)
 
-	// Health check (no auth)
-	r.Get("/api/v1/health", s.handleHealth)
-
-	// Protected routes
+	// Live streams stay open, so they skip the request timeout
 	r.Group(func(r chi.Router) {
 		r.Use(s.authMiddleware)
+		r.Use(s.rateLimitMiddleware)
 
-		// News
-		r.Get("/api/v1/news", s.handleListNews)
-		r.Get("/api/v1/news/{id}", s.handleGetNews)
-
-		// Analysis
-		r.Get("/api/v1/analysis", s.handleListAnalysis)
-		r.Get("/api/v1/analysis/{id}", s.handleGetAnalysis)
+		r.Get("/api/v1/stream", s.handleStream)
+		r.Get("/api/v1/stream/ws", s.handleStreamWS)
+	})
 
-		// Reports
-		r.Get("/api/v1/reports", s.handleListReports)
-		r.Get("/api/v1/reports/latest", s.handleGetLatestReport)
-		r.Get("/api/v1/reports/{id}", s.handleGetReport)
+	r.Group(func(r chi.Router) {
+		r.Use(middleware.Timeout(30 * time.Second))
+		s.routes(r)
+	})
 
-		// Stocks
-		r.Get("/api/v1/stocks/{symbol}/sentiment", s.handleGetStockSentiment)
+	s.router = r
+}
 
-		// Alerts
-		r.Get("/api/v1/alerts", s.handleListAlerts)
+func (s *Server) routes(r chi.Router) {
+	// Health check (no auth)
+	r.Get("/api/v1/health", s.handleHealth)
 
-		// Manual scan trigger
-		r.Post("/api/v1/scan", s.handleTriggerScan)
+	// Protected routes
+	r.Group(func(r chi.Router) {
+		r.Use(s.authMiddleware)
+		r.Use(s.rateLimitMiddleware)
+
+		r.Group(func(r chi.Router) {
+			r.Use(requireScope(ScopeReadNews))
+
+			// News
+			r.Get("/api/v1/news", s.handleListNews)
+			r.Get("/api/v1/news/{id}", s.handleGetNews)
+			r.Get("/api/v1/stories/{id}", s.handleGetStory)
+
+			// Analysis
+			r.Get("/api/v1/analysis", s.handleListAnalysis)
+			r.Get("/api/v1/analysis/{id}", s.handleGetAnalysis)
+
+			// Reports
+			r.Get("/api/v1/reports", s.handleListReports)
+			r.Get("/api/v1/reports/latest", s.handleGetLatestReport)
+			r.Get("/api/v1/reports/{id}", s.handleGetReport)
+
+			// Events
+			r.Get("/api/v1/events", s.handleListEvents)
+
+			// Search
+			r.Get("/api/v1/search", s.handleSearch)
+
+			// Stocks
+			r.Get("/api/v1/stocks/{symbol}/sentiment", s.handleGetStockSentiment)
+			r.Get("/api/v1/stocks/{symbol}/timeseries", s.handleGetStockTimeseries)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(requireScope(ScopeReadAlerts))
+
+			// Alerts
+			r.Get("/api/v1/alerts", s.handleListAlerts)
+			r.Get("/api/v1/alerts/{id}", s.handleGetAlert)
+
+			// Alert rules
+			r.Get("/api/v1/rules", s.handleListRules)
+			r.Get("/api/v1/rules/{id}", s.handleGetRule)
+
+			// Chat channel notifications
+			r.Get("/api/v1/notifications", s.handleListNotifications)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(requireScope(ScopeWriteAlerts))
+
+			r.Post("/api/v1/alerts/{id}/ack", s.handleAckAlert)
+			r.Post("/api/v1/alerts/{id}/snooze", s.handleSnoozeAlert)
+			r.Post("/api/v1/alerts/{id}/resolve", s.handleResolveAlert)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(requireScope(ScopeAdminScan))
+
+			// Manual scan trigger
+			r.Post("/api/v1/scan", s.handleTriggerScan)
+			r.Get("/api/v1/scans/{id}", s.handleGetScan)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(requireScope(ScopeAdminConfig))
+
+			// Alert rules
+			r.Post("/api/v1/rules", s.handleCreateRule)
+			r.Post("/api/v1/rules/dry-run", s.handleDryRunRule)
+			r.Put("/api/v1/rules/{id}", s.handleUpdateRule)
+			r.Delete("/api/v1/rules/{id}", s.handleDeleteRule)
+
+			// Webhook subscriptions
+			r.Post("/api/v1/webhooks", s.handleCreateWebhook)
+			r.Get("/api/v1/webhooks", s.handleListWebhooks)
+			r.Get("/api/v1/webhooks/{id}", s.handleGetWebhook)
+			r.Delete("/api/v1/webhooks/{id}", s.handleDeleteWebhook)
+			r.Get("/api/v1/webhooks/{id}/deliveries", s.handleListWebhookDeliveries)
+
+			// Admin
+			r.Post("/api/v1/admin/backup", s.handleTriggerBackup)
+			r.Get("/api/v1/admin/backups", s.handleListBackups)
+		})
 	})
-
-	s.router = r
 }
 
 func (s *Server) Start() error {
@@ -88,14 +206,19 @@ func (s *Server) Start() error {
 }
 
 func (s *Server) Shutdown(ctx context.Context) error {
+	s.closeOnce.Do(func() { close(s.closing) })
+	if s.http == nil { // not started
+		return nil
+	}
 	return s.http.Shutdown(ctx)
 }
 
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Accept, Authorization, Content-Type, Last-Event-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, X-RateLimit-Cost, Retry-After")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
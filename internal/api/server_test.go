@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+func newTestServer(t *testing.T, auth config.AuthConfig, opts ...Option) (*Server, *storage.Storage) {
+	t.Helper()
+	store, err := storage.New(filepath.Join(t.TempDir(), "api.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return NewServer(&config.Config{Auth: auth}, store, opts...), store
+}
+
+// createToken stores a token named name and returns its secret
+func createToken(t *testing.T, store *storage.Storage, name string, scopes ...string) string {
+	t.Helper()
+	tok, secret, err := NewAPIToken(name, scopes, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateAPIToken(tok); err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+func call(s *Server, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// errorCode is the error code of a JSON error response, "" for success
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var resp Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode %q: %v", rec.Body.String(), err)
+	}
+	if resp.Error == nil {
+		return ""
+	}
+	return resp.Error.Code
+}
+
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, status int, what string) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("%s: status %d, want %d: %s", what, rec.Code, status, rec.Body.String())
+	}
+}
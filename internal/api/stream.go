@@ -0,0 +1,247 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/chenzhiguo/market-sentinel/internal/stream"
+)
+
+const (
+	// streamHeartbeat keeps idle streams alive through proxies
+	streamHeartbeat = 15 * time.Second
+	// wsWriteTimeout bounds one WebSocket send to a stalled client
+	wsWriteTimeout = 10 * time.Second
+)
+
+// handleStream serves alerts, analyses and news as Server-Sent Events.
+// Each event carries its ID, so EventSource resumes with Last-Event-ID on
+// reconnect; clients that cannot set headers pass ?last_event_id= instead.
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	if s.bus == nil {
+		writeError(w, http.StatusServiceUnavailable, "STREAM_UNAVAILABLE", "Event stream is not enabled")
+		return
+	}
+	filter, lastID, err := streamParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_QUERY", err.Error())
+		return
+	}
+	if filter, err = scopeTopics(r, filter); err != nil {
+		writeError(w, http.StatusForbidden, "FORBIDDEN", err.Error())
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// the server's WriteTimeout would cut the stream off
+	rc.SetWriteDeadline(time.Time{})
+
+	sub := s.bus.Subscribe(filter, lastID)
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if sub.Gap {
+		writeSSE(w, gapEvent(lastID))
+	}
+	for _, e := range sub.Replay {
+		writeSSE(w, e)
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	ticker := time.NewTicker(streamHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.closing:
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				return // fell behind; the client reconnects and replays
+			}
+			writeSSE(w, e)
+		case <-ticker.C:
+			fmt.Fprint(w, ": ping\n\n")
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeSSE(w io.Writer, e stream.Event) {
+	data, _ := json.Marshal(e)
+	if e.ID > 0 {
+		fmt.Fprintf(w, "id: %d\n", e.ID)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Topic, data)
+}
+
+// handleStreamWS serves the same events as handleStream over a WebSocket,
+// one JSON Event per message. Filters and last_event_id are query
+// parameters. Messages from the client are ignored.
+func (s *Server) handleStreamWS(w http.ResponseWriter, r *http.Request) {
+	if s.bus == nil {
+		writeError(w, http.StatusServiceUnavailable, "STREAM_UNAVAILABLE", "Event stream is not enabled")
+		return
+	}
+	filter, lastID, err := streamParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_QUERY", err.Error())
+		return
+	}
+	if filter, err = scopeTopics(r, filter); err != nil {
+		writeError(w, http.StatusForbidden, "FORBIDDEN", err.Error())
+		return
+	}
+
+	ws := websocket.Server{
+		// clients are authenticated by token, so any origin may connect
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(conn *websocket.Conn) {
+			s.serveWS(conn, filter, lastID)
+		},
+	}
+	ws.ServeHTTP(w, r)
+}
+
+func (s *Server) serveWS(conn *websocket.Conn, filter stream.Filter, lastID uint64) {
+	defer conn.Close()
+	conn.SetReadDeadline(time.Time{})
+
+	sub := s.bus.Subscribe(filter, lastID)
+	defer sub.Close()
+
+	// reading is how a closed connection is noticed
+	gone := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, conn)
+		close(gone)
+	}()
+
+	send := func(e stream.Event) bool {
+		conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		return websocket.JSON.Send(conn, e) == nil
+	}
+	if sub.Gap && !send(gapEvent(lastID)) {
+		return
+	}
+	for _, e := range sub.Replay {
+		if !send(e) {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(streamHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-gone:
+			return
+		case <-s.closing:
+			return
+		case e, ok := <-sub.C:
+			if !ok || !send(e) {
+				return
+			}
+		case <-ticker.C:
+			if !send(stream.Event{Topic: "heartbeat", Time: time.Now()}) {
+				return
+			}
+		}
+	}
+}
+
+// gapEvent tells a resuming client that events after lastID were lost
+func gapEvent(lastID uint64) stream.Event {
+	return stream.Event{
+		Topic: "gap",
+		Time:  time.Now(),
+		Data:  map[string]uint64{"last_event_id": lastID},
+	}
+}
+
+// streamParams reads the filter (topics, symbol, severity, source, each
+// comma-separated or repeated) and the ID to resume after
+func streamParams(r *http.Request) (stream.Filter, uint64, error) {
+	f := stream.Filter{
+		Topics:     queryList(r, "topics"),
+		Symbols:    queryList(r, "symbol"),
+		Severities: queryList(r, "severity"),
+		Sources:    queryList(r, "source"),
+	}
+	for _, t := range f.Topics {
+		if !contains(stream.Topics, strings.ToLower(t)) {
+			return f, 0, fmt.Errorf("unknown topic %q, want one of %s", t, strings.Join(stream.Topics, ", "))
+		}
+	}
+
+	last := r.Header.Get("Last-Event-ID")
+	if last == "" {
+		last = r.URL.Query().Get("last_event_id")
+	}
+	if last == "" {
+		return f, 0, nil
+	}
+	id, err := strconv.ParseUint(last, 10, 64)
+	if err != nil {
+		return f, 0, fmt.Errorf("invalid last event ID %q", last)
+	}
+	return f, id, nil
+}
+
+// scopeTopics limits f to the topics the request's token may read: alerts
+// need read:alerts, analyses and news read:news
+func scopeTopics(r *http.Request, f stream.Filter) (stream.Filter, error) {
+	p := requestPrincipal(r)
+	var allowed []string
+	for _, t := range stream.Topics {
+		scope := ScopeReadNews
+		if t == stream.TopicAlert {
+			scope = ScopeReadAlerts
+		}
+		if p != nil && p.can(scope) {
+			allowed = append(allowed, t)
+		}
+	}
+	if len(f.Topics) == 0 {
+		f.Topics = allowed
+	}
+	for _, t := range f.Topics {
+		if !contains(allowed, strings.ToLower(t)) {
+			return f, fmt.Errorf("token may not read topic %q", t)
+		}
+	}
+	if len(f.Topics) == 0 {
+		return f, fmt.Errorf("token may not read any topic")
+	}
+	return f, nil
+}
+
+func queryList(r *http.Request, key string) []string {
+	var list []string
+	for _, v := range r.URL.Query()[key] {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				list = append(list, part)
+			}
+		}
+	}
+	return list
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+	"github.com/chenzhiguo/market-sentinel/internal/stream"
+)
+
+func TestStreamTopicsFollowScopes(t *testing.T) {
+	bus := stream.NewBus(16, nil)
+	s, store := newTestServer(t, config.AuthConfig{}, WithStream(bus))
+	reader := createToken(t, store, "reader", ScopeReadNews)
+	watcher := createToken(t, store, "watcher", ScopeReadAlerts)
+
+	bus.Publish(&storage.Alert{ID: "al1", Severity: "high"})
+	bus.Publish(&storage.NewsItem{ID: "n1", Title: "Chip export ban widened"})
+	bus.Publish(&storage.Alert{ID: "al2", Severity: "critical"})
+	bus.Publish(&storage.NewsItem{ID: "n2", Title: "Chipmakers fall on export ban"})
+
+	// a live server and a deadline, so a stream opened by mistake ends
+	srv := httptest.NewServer(s.router)
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	open := func(token, path string) *http.Response {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// asking for a topic outside the token's scopes is refused
+	for _, path := range []string{"/api/v1/stream?topics=alert", "/api/v1/stream?topics=news,alert", "/api/v1/stream/ws?topics=alert"} {
+		resp := open(reader, path)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("read:news token on %s: status %d, want 403", path, resp.StatusCode)
+		}
+	}
+
+	// without topics the replay carries only what the token may read; it
+	// returns the topics received up to the row with ID last, as the
+	// stream stays open after the replay
+	read := func(token, last string) []string {
+		resp := open(token, "/api/v1/stream?last_event_id=1")
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("stream status %d", resp.StatusCode)
+		}
+
+		var topics []string
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			line := sc.Text()
+			if topic, ok := strings.CutPrefix(line, "event: "); ok && topic != "gap" {
+				topics = append(topics, topic)
+			}
+			if strings.HasPrefix(line, "data: ") && strings.Contains(line, `"id":"`+last+`"`) {
+				break
+			}
+		}
+		return topics
+	}
+
+	if got := strings.Join(read(reader, "n2"), ","); got != "news,news" {
+		t.Errorf("read:news token got %s, want news only", got)
+	}
+	if got := strings.Join(read(watcher, "al2"), ","); got != "alert,alert" {
+		t.Errorf("read:alerts token got %s, want alerts only", got)
+	}
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+// Token scopes
+const (
+	ScopeReadNews    = "read:news"    // news, stories, analyses, reports, events, search, stocks
+	ScopeReadAlerts  = "read:alerts"  // alerts, alert rules, notifications
+	ScopeWriteAlerts = "write:alerts" // acknowledge, snooze and resolve alerts
+	ScopeAdminScan   = "admin:scan"   // trigger and follow scans
+	ScopeAdminConfig = "admin:config" // manage alert rules, webhooks and backups
+)
+
+// Scopes lists every scope. Tokens from auth.tokens hold all of them.
+var Scopes = []string{ScopeReadNews, ScopeReadAlerts, ScopeWriteAlerts, ScopeAdminScan, ScopeAdminConfig}
+
+const (
+	tokenSecretPrefix = "sk-sentinel-"
+	// hashedTokenPrefix marks an auth.tokens entry given as its SHA-256
+	hashedTokenPrefix = "sha256:"
+)
+
+// HashToken is the hex SHA-256 of a token secret, as stored
+func HashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewAPIToken generates a token secret and the record to store for it. The
+// secret is returned once and never stored. ttl 0 never expires.
+func NewAPIToken(name string, scopes []string, ttl time.Duration) (*storage.APIToken, string, error) {
+	if name == "" {
+		return nil, "", fmt.Errorf("token name is required")
+	}
+	// names key auth.token_limits next to digests, and must not pass for secrets
+	if strings.HasPrefix(name, hashedTokenPrefix) || strings.HasPrefix(name, tokenSecretPrefix) {
+		return nil, "", fmt.Errorf("token name must not start with %q or %q", hashedTokenPrefix, tokenSecretPrefix)
+	}
+	if len(scopes) == 0 {
+		return nil, "", fmt.Errorf("at least one scope is required (%s)", strings.Join(Scopes, ", "))
+	}
+	for _, sc := range scopes {
+		if !contains(Scopes, sc) {
+			return nil, "", fmt.Errorf("unknown scope %q (scopes: %s)", sc, strings.Join(Scopes, ", "))
+		}
+	}
+	if ttl < 0 {
+		return nil, "", fmt.Errorf("expiry must not be negative")
+	}
+
+	secret := tokenSecretPrefix + randomHex(24)
+	now := time.Now()
+	t := &storage.APIToken{
+		ID:        "tok_" + randomHex(6),
+		Name:      name,
+		Hash:      HashToken(secret),
+		Prefix:    secret[:len(tokenSecretPrefix)+6],
+		Scopes:    scopes,
+		CreatedAt: now,
+	}
+	if ttl > 0 {
+		expires := now.Add(ttl)
+		t.ExpiresAt = &expires
+	}
+	return t, secret, nil
+}
+
+// configTokenDigests reads auth.tokens, each a secret or "sha256:<hex>"
+func configTokenDigests(tokens []string) [][]byte {
+	var digests [][]byte
+	for _, t := range tokens {
+		if h, ok := strings.CutPrefix(t, hashedTokenPrefix); ok {
+			d, err := hex.DecodeString(h)
+			if err != nil || len(d) != sha256.Size {
+				log.Printf("Auth: ignoring malformed hashed token %q", t)
+				continue
+			}
+			digests = append(digests, d)
+			continue
+		}
+		sum := sha256.Sum256([]byte(t))
+		digests = append(digests, sum[:])
+	}
+	return digests
+}
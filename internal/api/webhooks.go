@@ -0,0 +1,166 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+// Accepted webhook filter values
+var (
+	webhookSeverities = []string{"high", "critical"}
+	webhookSentiments = []string{"positive", "negative", "neutral"}
+	webhookEventTypes = []string{storage.AlertKindImpact, storage.AlertKindVolumeSpike}
+)
+
+// createdWebhook is the create response: the only time the secret is shown
+type createdWebhook struct {
+	*storage.Webhook
+	Secret string `json:"secret"`
+}
+
+func (s *Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name       string   `json:"name"`
+		URL        string   `json:"url"`
+		Secret     string   `json:"secret"`
+		Symbols    []string `json:"symbols"`
+		Severities []string `json:"severities"`
+		Sentiments []string `json:"sentiments"`
+		EventTypes []string `json:"event_types"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_BODY", err.Error())
+		return
+	}
+	if u, err := url.Parse(req.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		writeError(w, http.StatusBadRequest, "INVALID_BODY", "url must be an absolute http or https URL")
+		return
+	}
+	for _, f := range []struct {
+		name    string
+		values  *[]string
+		allowed []string
+	}{
+		{"severities", &req.Severities, webhookSeverities},
+		{"sentiments", &req.Sentiments, webhookSentiments},
+		{"event_types", &req.EventTypes, webhookEventTypes},
+	} {
+		for i, v := range *f.values {
+			v = strings.ToLower(strings.TrimSpace(v))
+			if !contains(f.allowed, v) {
+				writeError(w, http.StatusBadRequest, "INVALID_BODY",
+					fmt.Sprintf("%s: unknown value %q, want one of %s", f.name, v, strings.Join(f.allowed, ", ")))
+				return
+			}
+			(*f.values)[i] = v
+		}
+	}
+	for i, sym := range req.Symbols {
+		req.Symbols[i] = strings.ToUpper(strings.TrimSpace(sym))
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		secret = "whsec_" + randomHex(24)
+	}
+	hook := &storage.Webhook{
+		ID:         "wh_" + randomHex(8),
+		Name:       req.Name,
+		URL:        req.URL,
+		Secret:     secret,
+		Symbols:    req.Symbols,
+		Severities: req.Severities,
+		Sentiments: req.Sentiments,
+		EventTypes: req.EventTypes,
+		CreatedAt:  time.Now(),
+	}
+	if err := s.store.CreateWebhook(hook); err != nil {
+		writeError(w, http.StatusInternalServerError, "DB_ERROR", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, Response{
+		Success: true,
+		Data:    createdWebhook{Webhook: hook, Secret: secret},
+	})
+}
+
+func (s *Server) handleListWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks, err := s.store.ListWebhooks()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "DB_ERROR", err.Error())
+		return
+	}
+	writeSuccess(w, hooks)
+}
+
+func (s *Server) handleGetWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, err := s.store.GetWebhook(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "DB_ERROR", err.Error())
+		return
+	}
+	if hook == nil {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Webhook not found")
+		return
+	}
+	writeSuccess(w, hook)
+}
+
+func (s *Server) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	found, err := s.store.DeleteWebhook(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "DB_ERROR", err.Error())
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Webhook not found")
+		return
+	}
+	writeSuccess(w, map[string]interface{}{"id": id, "deleted": true})
+}
+
+// handleListWebhookDeliveries returns the delivery log of one webhook,
+// optionally only pending, delivered or failed deliveries
+func (s *Server) handleListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	limit := queryInt(r, "limit", 50)
+	offset := queryInt(r, "offset", 0)
+	if limit > 200 {
+		limit = 200
+	}
+
+	hook, err := s.store.GetWebhook(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "DB_ERROR", err.Error())
+		return
+	}
+	if hook == nil {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Webhook not found")
+		return
+	}
+	items, total, err := s.store.ListWebhookDeliveries(id, r.URL.Query().Get("status"), limit, offset)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "DB_ERROR", err.Error())
+		return
+	}
+	writeSuccessWithMeta(w, items, total, limit, offset)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // crypto/rand does not fail on supported platforms
+	}
+	return hex.EncodeToString(b)
+}
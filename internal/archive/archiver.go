@@ -0,0 +1,93 @@
+package archive
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Archiver runs the exporter on a schedule
+type Archiver struct {
+	exporter  *Exporter
+	interval  time.Duration
+	stopCh    chan struct{}
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	isRunning bool
+	mu        sync.Mutex
+}
+
+func NewArchiver(exporter *Exporter, interval time.Duration) *Archiver {
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+	return &Archiver{
+		exporter: exporter,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start exports once right away, then every interval
+func (a *Archiver) Start() {
+	a.mu.Lock()
+	if a.isRunning {
+		a.mu.Unlock()
+		return
+	}
+	a.isRunning = true
+	a.stopCh = make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	a.cancel = cancel
+	a.mu.Unlock()
+
+	log.Printf("Starting Archiver (every %s) to %s", a.interval, a.exporter.dir)
+
+	a.wg.Add(1)
+	go a.loop(ctx)
+}
+
+// Stop cancels a running export; its files are discarded and the
+// high-water mark stays where it was
+func (a *Archiver) Stop() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.isRunning {
+		return
+	}
+	close(a.stopCh)
+	a.cancel()
+	a.isRunning = false
+	a.wg.Wait()
+	log.Println("Archiver stopped")
+}
+
+func (a *Archiver) loop(ctx context.Context) {
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	a.runOnce(ctx)
+	for {
+		select {
+		case <-a.stopCh:
+			return
+		case <-ticker.C:
+			a.runOnce(ctx)
+		}
+	}
+}
+
+func (a *Archiver) runOnce(ctx context.Context) {
+	results, err := a.exporter.Export(ctx)
+	for _, r := range results {
+		if r.Rows > 0 {
+			log.Printf("Archiver: exported %d %s rows to %d files", r.Rows, r.Dataset, len(r.Files))
+		}
+	}
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Archiver: %v", err)
+	}
+}
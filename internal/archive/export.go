@@ -0,0 +1,227 @@
+// Package archive exports news, analyses and alerts to date-partitioned
+// JSONL and Parquet files for offline research.
+//
+// Layout: <dir>/<dataset>/date=YYYY-MM-DD/part-<start>.<format>, partitioned
+// on the UTC event date (publish, analysis or alert time). Each dataset keeps
+// a high-water mark in <dir>/_state.json so runs only export new rows.
+package archive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+// Datasets
+const (
+	DatasetNews     = "news"
+	DatasetAnalyses = "analyses"
+	DatasetAlerts   = "alerts"
+)
+
+// Datasets lists every exportable dataset
+var Datasets = []string{DatasetNews, DatasetAnalyses, DatasetAlerts}
+
+// settleDelay keeps rows this recent out of a run. Timestamps are set
+// before the row is committed, so the newest rows may still be in flight.
+const settleDelay = 5 * time.Minute
+
+const batchSize = 1000
+
+const stateFile = "_state.json"
+
+// Result summarizes one dataset of an export run
+type Result struct {
+	Dataset string         `json:"dataset"`
+	Rows    int            `json:"rows"`
+	Files   []string       `json:"files"`
+	From    storage.Cursor `json:"from"`
+	To      storage.Cursor `json:"to"`
+}
+
+// Exporter writes incremental exports of a Store
+type Exporter struct {
+	store    storage.Store
+	dir      string
+	formats  []string
+	datasets []string
+}
+
+func NewExporter(store storage.Store, cfg config.ArchiveConfig) (*Exporter, error) {
+	e := &Exporter{store: store, dir: cfg.Dir, formats: cfg.Formats, datasets: cfg.Datasets}
+	if e.dir == "" {
+		return nil, fmt.Errorf("archive.dir is required")
+	}
+	if len(e.formats) == 0 {
+		e.formats = []string{FormatJSONLGz, FormatParquet}
+	}
+	for _, f := range e.formats {
+		if !ValidFormat(f) {
+			return nil, fmt.Errorf("unknown archive format %q (jsonl, jsonl.gz, parquet)", f)
+		}
+	}
+	if len(e.datasets) == 0 {
+		e.datasets = Datasets
+	}
+	for _, d := range e.datasets {
+		if d != DatasetNews && d != DatasetAnalyses && d != DatasetAlerts {
+			return nil, fmt.Errorf("unknown archive dataset %q (news, analyses, alerts)", d)
+		}
+	}
+	return e, nil
+}
+
+// State returns the high-water mark of every dataset exported so far
+func (e *Exporter) State() (map[string]storage.Cursor, error) {
+	state := make(map[string]storage.Cursor)
+	data, err := os.ReadFile(filepath.Join(e.dir, stateFile))
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("corrupt %s: %w", stateFile, err)
+	}
+	return state, nil
+}
+
+func (e *Exporter) saveState(state map[string]storage.Cursor) error {
+	if err := os.MkdirAll(e.dir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(e.dir, stateFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(e.dir, stateFile))
+}
+
+// Reset forgets the high-water marks of the configured datasets so the next
+// run exports them from the start. Other datasets keep their marks.
+func (e *Exporter) Reset() error {
+	state, err := e.State()
+	if err != nil {
+		return err
+	}
+	for _, d := range e.datasets {
+		delete(state, d)
+	}
+	return e.saveState(state)
+}
+
+// Export runs every configured dataset. A failed dataset keeps its old
+// high-water mark; the others still advance.
+func (e *Exporter) Export(ctx context.Context) ([]Result, error) {
+	state, err := e.State()
+	if err != nil {
+		return nil, err
+	}
+	until := time.Now().Add(-settleDelay)
+
+	var results []Result
+	var errs []error
+	for _, dataset := range e.datasets {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+
+		var res Result
+		switch dataset {
+		case DatasetNews:
+			res, err = exportDataset(ctx, e, dataset, state[dataset], until, e.store.NewsAfter,
+				func(n *storage.NewsItem) (storage.Cursor, time.Time, []NewsRow) {
+					event := n.PublishedAt
+					if event.IsZero() {
+						event = n.CollectedAt
+					}
+					return storage.Cursor{Time: n.CollectedAt, ID: n.ID}, event, []NewsRow{newsRow(n)}
+				})
+		case DatasetAnalyses:
+			res, err = exportDataset(ctx, e, dataset, state[dataset], until, e.store.AnalysesAfter,
+				func(a *storage.Analysis) (storage.Cursor, time.Time, []AnalysisRow) {
+					return storage.Cursor{Time: a.AnalyzedAt, ID: a.ID}, a.AnalyzedAt, analysisRows(a)
+				})
+		case DatasetAlerts:
+			res, err = exportDataset(ctx, e, dataset, state[dataset], until, e.store.AlertsAfter,
+				func(a *storage.Alert) (storage.Cursor, time.Time, []AlertRow) {
+					return storage.Cursor{Time: a.CreatedAt, ID: a.ID}, a.CreatedAt, []AlertRow{alertRow(a)}
+				})
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("export %s: %w", dataset, err))
+			continue
+		}
+		results = append(results, res)
+
+		if res.Rows > 0 {
+			state[dataset] = res.To
+			if err := e.saveState(state); err != nil {
+				return results, err
+			}
+		}
+	}
+	return results, errors.Join(errs...)
+}
+
+// exportDataset pages through one table after the cursor. The part file is
+// named after the starting cursor, so a run retried after a crash rewrites
+// the same files instead of duplicating rows.
+func exportDataset[S any, R any](
+	ctx context.Context,
+	e *Exporter,
+	dataset string,
+	from storage.Cursor,
+	until time.Time,
+	fetch func(storage.Cursor, time.Time, int) ([]S, error),
+	convert func(*S) (storage.Cursor, time.Time, []R),
+) (Result, error) {
+	res := Result{Dataset: dataset, From: from, To: from}
+	name := "part-" + from.Time.UTC().Format("20060102T150405.000000000")
+	w := newPartitionedWriter[R](filepath.Join(e.dir, dataset), name, e.formats)
+
+	cursor := from
+	for {
+		if err := ctx.Err(); err != nil {
+			w.abort()
+			return res, err
+		}
+		batch, err := fetch(cursor, until, batchSize)
+		if err != nil {
+			w.abort()
+			return res, err
+		}
+		for i := range batch {
+			next, event, rows := convert(&batch[i])
+			if err := w.add(event.UTC().Format("2006-01-02"), rows...); err != nil {
+				w.abort()
+				return res, err
+			}
+			cursor = next
+		}
+		if len(batch) < batchSize {
+			break
+		}
+	}
+
+	files, err := w.commit()
+	if err != nil {
+		return res, err
+	}
+	res.Rows = w.rows
+	res.Files = files
+	res.To = cursor
+	return res, nil
+}
@@ -0,0 +1,181 @@
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+	"github.com/parquet-go/parquet-go"
+)
+
+func newTestStore(t *testing.T) *storage.Storage {
+	t.Helper()
+	s, err := storage.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func readJSONLGz[T any](t *testing.T, path string) []T {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []T
+	sc := bufio.NewScanner(gz)
+	for sc.Scan() {
+		var r T
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, r)
+	}
+	return rows
+}
+
+func TestExportIncremental(t *testing.T) {
+	store := newTestStore(t)
+	dir := t.TempDir()
+	day1 := time.Date(2025, 3, 10, 15, 0, 0, 0, time.UTC)
+	day2 := day1.Add(24 * time.Hour)
+
+	save := func(id string, published time.Time, symbols ...string) {
+		t.Helper()
+		if err := store.SaveNews(&storage.NewsItem{
+			ID: id, Source: "rss:Reuters", SourceID: id, Title: "title " + id,
+			PublishedAt: published, CollectedAt: published,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		a := &storage.Analysis{
+			ID: "a-" + id, NewsID: id, Sentiment: "positive", SentimentScore: 3, Confidence: 0.8,
+			RelatedStocks: symbols, AnalyzedAt: published,
+		}
+		for _, sym := range symbols {
+			a.StockDetails = append(a.StockDetails, storage.StockImpact{Symbol: sym, Score: 5, Reasoning: "because " + sym})
+		}
+		if err := store.SaveAnalysis(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+	save("n1", day1, "AAPL", "MSFT")
+	save("n2", day2)
+	if err := store.SaveAlert(&storage.Alert{ID: "al1", Severity: "high", Stocks: []string{"AAPL"}, CreatedAt: day2}); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := NewExporter(store, config.ArchiveConfig{Dir: dir, Formats: []string{FormatJSONLGz, FormatParquet}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := e.Export(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := map[string]int{}
+	for _, r := range results {
+		rows[r.Dataset] = r.Rows
+	}
+	// n1 flattens into one row per symbol, n2 has no symbols
+	if rows[DatasetNews] != 2 || rows[DatasetAnalyses] != 3 || rows[DatasetAlerts] != 1 {
+		t.Fatalf("rows = %v", rows)
+	}
+
+	part := "part-" + time.Time{}.Format("20060102T150405.000000000")
+	analyses, err := parquet.ReadFile[AnalysisRow](filepath.Join(dir, "analyses", "date=2025-03-10", part+".parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(analyses) != 2 || analyses[0].Symbol != "AAPL" || analyses[0].SymbolScore != 5 ||
+		analyses[0].Reasoning != "because AAPL" || !analyses[0].AnalyzedAt.Equal(day1) {
+		t.Errorf("parquet analyses = %+v", analyses)
+	}
+	alerts := readJSONLGz[AlertRow](t, filepath.Join(dir, "alerts", "date=2025-03-11", part+".jsonl.gz"))
+	if len(alerts) != 1 || alerts[0].Stocks[0] != "AAPL" {
+		t.Errorf("jsonl alerts = %+v", alerts)
+	}
+
+	// nothing new: no files, high-water mark unchanged
+	again, err := e.Export(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range again {
+		if r.Rows != 0 || len(r.Files) != 0 {
+			t.Errorf("second run exported %+v", r)
+		}
+	}
+
+	save("n3", day2.Add(time.Hour), "NVDA")
+	third, err := e.Export(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third[0].Rows != 1 || len(third[0].Files) != 2 || strings.Contains(third[0].Files[0], part) {
+		t.Errorf("incremental news = %+v", third[0])
+	}
+	news := readJSONLGz[NewsRow](t, third[0].Files[0])
+	if len(news) != 1 || news[0].ID != "n3" {
+		t.Errorf("incremental file = %+v", news)
+	}
+
+	state, _ := e.State()
+	if state[DatasetNews].ID != "n3" {
+		t.Errorf("news high-water mark = %+v", state[DatasetNews])
+	}
+
+	// resetting one dataset leaves the marks of the others
+	alertsOnly, err := NewExporter(store, config.ArchiveConfig{Dir: dir, Datasets: []string{DatasetAlerts}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := alertsOnly.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	state, _ = e.State()
+	if _, ok := state[DatasetAlerts]; ok || state[DatasetNews].ID != "n3" || state[DatasetAnalyses].ID == "" {
+		t.Errorf("state after resetting alerts = %+v", state)
+	}
+}
+
+func TestExportSkipsUnsettledRows(t *testing.T) {
+	store := newTestStore(t)
+	now := time.Now()
+	if err := store.SaveNews(&storage.NewsItem{ID: "fresh", SourceID: "fresh", PublishedAt: now, CollectedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	e, _ := NewExporter(store, config.ArchiveConfig{Dir: t.TempDir(), Formats: []string{FormatJSONL}, Datasets: []string{DatasetNews}})
+	results, err := e.Export(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Rows != 0 {
+		t.Errorf("exported %d rows collected within the settle delay", results[0].Rows)
+	}
+}
+
+func TestNewExporterValidates(t *testing.T) {
+	if _, err := NewExporter(nil, config.ArchiveConfig{Dir: "x", Formats: []string{"csv"}}); err == nil {
+		t.Error("csv format accepted")
+	}
+	if _, err := NewExporter(nil, config.ArchiveConfig{Dir: "x", Datasets: []string{"reports"}}); err == nil {
+		t.Error("reports dataset accepted")
+	}
+}
@@ -0,0 +1,114 @@
+package archive
+
+import (
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+// NewsRow is the exported shape of a NewsItem
+type NewsRow struct {
+	ID          string    `json:"id" parquet:"id"`
+	Source      string    `json:"source" parquet:"source,dict"`
+	SourceID    string    `json:"source_id" parquet:"source_id"`
+	Author      string    `json:"author" parquet:"author,dict"`
+	Title       string    `json:"title" parquet:"title"`
+	Content     string    `json:"content" parquet:"content"`
+	URL         string    `json:"url" parquet:"url"`
+	PublishedAt time.Time `json:"published_at" parquet:"published_at,timestamp(millisecond)"`
+	CollectedAt time.Time `json:"collected_at" parquet:"collected_at,timestamp(millisecond)"`
+}
+
+// AnalysisRow is one symbol of an analysis. Analyses without symbols
+// export a single row with an empty Symbol.
+type AnalysisRow struct {
+	AnalysisID     string    `json:"analysis_id" parquet:"analysis_id"`
+	NewsID         string    `json:"news_id" parquet:"news_id"`
+	Symbol         string    `json:"symbol" parquet:"symbol,dict"`
+	SymbolScore    float64   `json:"symbol_score" parquet:"symbol_score"` // per-stock score, or the analysis score
+	Timeframe      string    `json:"timeframe" parquet:"timeframe,dict"`
+	Reasoning      string    `json:"reasoning" parquet:"reasoning"`
+	Sentiment      string    `json:"sentiment" parquet:"sentiment,dict"`
+	SentimentScore float64   `json:"sentiment_score" parquet:"sentiment_score"`
+	Confidence     float64   `json:"confidence" parquet:"confidence"`
+	ImpactLevel    string    `json:"impact_level" parquet:"impact_level,dict"`
+	Summary        string    `json:"summary" parquet:"summary"`
+	AnalyzedAt     time.Time `json:"analyzed_at" parquet:"analyzed_at,timestamp(millisecond)"`
+}
+
+// AlertRow is the exported shape of an Alert
+type AlertRow struct {
+	ID          string    `json:"id" parquet:"id"`
+	Kind        string    `json:"kind" parquet:"kind,dict"`
+	NewsID      string    `json:"news_id" parquet:"news_id"`
+	AnalysisID  string    `json:"analysis_id" parquet:"analysis_id"`
+	Title       string    `json:"title" parquet:"title"`
+	Description string    `json:"description" parquet:"description"`
+	Severity    string    `json:"severity" parquet:"severity,dict"`
+	Stocks      []string  `json:"stocks" parquet:"stocks,list"`
+	CreatedAt   time.Time `json:"created_at" parquet:"created_at,timestamp(millisecond)"`
+}
+
+func newsRow(n *storage.NewsItem) NewsRow {
+	return NewsRow{
+		ID:          n.ID,
+		Source:      n.Source,
+		SourceID:    n.SourceID,
+		Author:      n.Author,
+		Title:       n.Title,
+		Content:     n.Content,
+		URL:         n.URL,
+		PublishedAt: n.PublishedAt.UTC(),
+		CollectedAt: n.CollectedAt.UTC(),
+	}
+}
+
+// analysisRows flattens an analysis into one row per mentioned symbol
+func analysisRows(a *storage.Analysis) []AnalysisRow {
+	base := AnalysisRow{
+		AnalysisID:     a.ID,
+		NewsID:         a.NewsID,
+		SymbolScore:    a.SentimentScore,
+		Sentiment:      a.Sentiment,
+		SentimentScore: a.SentimentScore,
+		Confidence:     a.Confidence,
+		ImpactLevel:    a.ImpactLevel,
+		Summary:        a.Summary,
+		AnalyzedAt:     a.AnalyzedAt.UTC(),
+	}
+
+	mentions := storage.MentionsFor(a)
+	if len(mentions) == 0 {
+		return []AnalysisRow{base}
+	}
+
+	reasoning := make(map[string]string, len(a.StockDetails))
+	for _, d := range a.StockDetails {
+		reasoning[storage.NormalizeSymbol(d.Symbol)] = d.Reasoning
+	}
+
+	rows := make([]AnalysisRow, 0, len(mentions))
+	for _, m := range mentions {
+		r := base
+		r.Symbol = m.Symbol
+		r.SymbolScore = m.Score
+		r.Timeframe = m.Timeframe
+		r.Reasoning = reasoning[m.Symbol]
+		rows = append(rows, r)
+	}
+	return rows
+}
+
+func alertRow(a *storage.Alert) AlertRow {
+	return AlertRow{
+		ID:          a.ID,
+		Kind:        a.Kind,
+		NewsID:      a.NewsID,
+		AnalysisID:  a.AnalysisID,
+		Title:       a.Title,
+		Description: a.Description,
+		Severity:    a.Severity,
+		Stocks:      a.Stocks,
+		CreatedAt:   a.CreatedAt.UTC(),
+	}
+}
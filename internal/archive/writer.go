@@ -0,0 +1,224 @@
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress/zstd"
+)
+
+// Output formats
+const (
+	FormatJSONL   = "jsonl"
+	FormatJSONLGz = "jsonl.gz"
+	FormatParquet = "parquet"
+)
+
+// ValidFormat reports whether f is a supported output format
+func ValidFormat(f string) bool {
+	return f == FormatJSONL || f == FormatJSONLGz || f == FormatParquet
+}
+
+// sink writes rows of one partition in one format. Data goes to a temp file
+// that is renamed into place on close, so readers never see partial files.
+type sink[T any] interface {
+	write(rows []T) error
+	close() error
+	abort()
+	path() string
+}
+
+type fileSink struct {
+	f     *os.File
+	final string
+}
+
+func createFileSink(final string) (fileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(final), 0755); err != nil {
+		return fileSink{}, err
+	}
+	f, err := os.CreateTemp(filepath.Dir(final), "."+filepath.Base(final)+".*.tmp")
+	if err != nil {
+		return fileSink{}, err
+	}
+	return fileSink{f: f, final: final}, nil
+}
+
+func (s fileSink) commit() error {
+	if err := s.f.Close(); err != nil {
+		os.Remove(s.f.Name())
+		return err
+	}
+	return os.Rename(s.f.Name(), s.final)
+}
+
+func (s fileSink) abort() {
+	s.f.Close()
+	os.Remove(s.f.Name())
+}
+
+func (s fileSink) path() string { return s.final }
+
+type jsonlSink[T any] struct {
+	fileSink
+	gz  *gzip.Writer
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func newJSONLSink[T any](final string, compress bool) (*jsonlSink[T], error) {
+	fs, err := createFileSink(final)
+	if err != nil {
+		return nil, err
+	}
+	s := &jsonlSink[T]{fileSink: fs}
+	if compress {
+		s.gz = gzip.NewWriter(fs.f)
+		s.buf = bufio.NewWriter(s.gz)
+	} else {
+		s.buf = bufio.NewWriter(fs.f)
+	}
+	s.enc = json.NewEncoder(s.buf)
+	return s, nil
+}
+
+func (s *jsonlSink[T]) write(rows []T) error {
+	for i := range rows {
+		if err := s.enc.Encode(&rows[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *jsonlSink[T]) close() error {
+	if err := s.buf.Flush(); err != nil {
+		s.fileSink.abort()
+		return err
+	}
+	if s.gz != nil {
+		if err := s.gz.Close(); err != nil {
+			s.fileSink.abort()
+			return err
+		}
+	}
+	return s.commit()
+}
+
+type parquetSink[T any] struct {
+	fileSink
+	w *parquet.GenericWriter[T]
+}
+
+func newParquetSink[T any](final string) (*parquetSink[T], error) {
+	fs, err := createFileSink(final)
+	if err != nil {
+		return nil, err
+	}
+	return &parquetSink[T]{
+		fileSink: fs,
+		w:        parquet.NewGenericWriter[T](fs.f, parquet.Compression(&zstd.Codec{})),
+	}, nil
+}
+
+func (s *parquetSink[T]) write(rows []T) error {
+	_, err := s.w.Write(rows)
+	return err
+}
+
+func (s *parquetSink[T]) close() error {
+	if err := s.w.Close(); err != nil {
+		s.fileSink.abort()
+		return err
+	}
+	return s.commit()
+}
+
+// partitionedWriter fans rows out to <root>/date=YYYY-MM-DD/<name>.<format>
+type partitionedWriter[T any] struct {
+	root    string
+	name    string
+	formats []string
+	sinks   map[string][]sink[T]
+	rows    int
+}
+
+func newPartitionedWriter[T any](root, name string, formats []string) *partitionedWriter[T] {
+	return &partitionedWriter[T]{root: root, name: name, formats: formats, sinks: make(map[string][]sink[T])}
+}
+
+func (w *partitionedWriter[T]) add(date string, rows ...T) error {
+	sinks, ok := w.sinks[date]
+	if !ok {
+		for _, format := range w.formats {
+			final := filepath.Join(w.root, "date="+date, w.name+"."+format)
+			var s sink[T]
+			var err error
+			switch format {
+			case FormatJSONL:
+				s, err = newJSONLSink[T](final, false)
+			case FormatJSONLGz:
+				s, err = newJSONLSink[T](final, true)
+			case FormatParquet:
+				s, err = newParquetSink[T](final)
+			default:
+				err = fmt.Errorf("unknown format %q", format)
+			}
+			if err != nil {
+				return err
+			}
+			sinks = append(sinks, s)
+			// register as we go so abort cleans up partially opened partitions
+			w.sinks[date] = sinks
+		}
+	}
+	for _, s := range sinks {
+		if err := s.write(rows); err != nil {
+			return err
+		}
+	}
+	w.rows += len(rows)
+	return nil
+}
+
+// commit closes every partition and returns the files written
+func (w *partitionedWriter[T]) commit() ([]string, error) {
+	dates := make([]string, 0, len(w.sinks))
+	for d := range w.sinks {
+		dates = append(dates, d)
+	}
+	sort.Strings(dates)
+
+	var files []string
+	var firstErr error
+	for _, d := range dates {
+		for _, s := range w.sinks[d] {
+			if firstErr != nil {
+				s.abort()
+				continue
+			}
+			if err := s.close(); err != nil {
+				firstErr = fmt.Errorf("write %s: %w", s.path(), err)
+				continue
+			}
+			files = append(files, s.path())
+		}
+	}
+	w.sinks = nil
+	return files, firstErr
+}
+
+func (w *partitionedWriter[T]) abort() {
+	for _, sinks := range w.sinks {
+		for _, s := range sinks {
+			s.abort()
+		}
+	}
+	w.sinks = nil
+}
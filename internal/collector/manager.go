@@ -11,25 +11,34 @@ import (
 
 // SubCollector defines the interface for individual source collectors
 type SubCollector interface {
-	Collect() ([]storage.NewsItem, error)
+	Name() string    // source name used to select it: twitter, rss, reddit
+	Feeds() []string // configured accounts, feed URLs or subreddits
+	CollectFeed(feed string) ([]storage.NewsItem, error)
 }
 
 // Manager orchestrates all collectors
 type Manager struct {
 	cfg        *config.Config
-	store      *storage.Storage
+	store      storage.Store
 	collectors []SubCollector
 	stopCh     chan struct{}
 	wg         sync.WaitGroup
 	isRunning  bool
 	mu         sync.Mutex
+
+	scanMu  sync.Mutex
+	running *Scan
+	pending *Scan
+	scans   map[string]*Scan
+	history []string // scan IDs, oldest first
 }
 
-func NewManager(cfg *config.Config, store *storage.Storage) *Manager {
+func NewManager(cfg *config.Config, store storage.Store) *Manager {
 	m := &Manager{
 		cfg:    cfg,
 		store:  store,
 		stopCh: make(chan struct{}),
+		scans:  make(map[string]*Scan),
 	}
 
 	// Initialize enabled collectors
@@ -95,35 +104,14 @@ func (m *Manager) loop() {
 	}
 }
 
-// RunOnce executes all collectors concurrently and saves results
-func (m *Manager) RunOnce() {
-	var wg sync.WaitGroup
-	
-	log.Println("Collector: starting scan cycle...")
-
-	for _, col := range m.collectors {
-		wg.Add(1)
-		go func(c SubCollector) {
-			defer wg.Done()
-			
-			items, err := c.Collect()
-			if err != nil {
-				log.Printf("Collector error: %v", err)
-				return
-			}
-
-			count := 0
-			for _, item := range items {
-				if err := m.store.SaveNews(&item); err == nil {
-					count++
-				}
-			}
-			if len(items) > 0 {
-				log.Printf("Collected %d items from source", len(items))
-			}
-		}(col)
-	}
+// RunOnce scans every feed and waits for the scan to finish. A scan that
+// is already running or queued for all feeds is joined instead.
+func (m *Manager) RunOnce() *Scan {
+	targets, _ := m.Targets(nil, nil)
+	s, _ := m.trigger(targets)
+	<-s.done
 
-	wg.Wait()
-	log.Println("Collector: scan cycle completed")
+	m.scanMu.Lock()
+	defer m.scanMu.Unlock()
+	return s.copy()
 }
@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -56,6 +57,48 @@ func (r *RedditCollector) Collect() ([]storage.NewsItem, error) {
 	return allItems, nil
 }
 
+func (r *RedditCollector) Name() string { return "reddit" }
+
+// Feeds returns the configured subreddits
+func (r *RedditCollector) Feeds() []string {
+	var subs []string
+	seen := make(map[string]bool)
+	for _, feed := range r.buildFeedConfigs() {
+		if !seen[feed.Subreddit] {
+			seen[feed.Subreddit] = true
+			subs = append(subs, feed.Subreddit)
+		}
+	}
+	return subs
+}
+
+// CollectFeed fetches every configured sort of one subreddit
+func (r *RedditCollector) CollectFeed(subreddit string) ([]storage.NewsItem, error) {
+	subreddit = strings.TrimPrefix(subreddit, "r/")
+	var allItems []storage.NewsItem
+	var errs []error
+	n := 0
+	for _, feed := range r.buildFeedConfigs() {
+		if !strings.EqualFold(feed.Subreddit, subreddit) {
+			continue
+		}
+		if n > 0 {
+			time.Sleep(1 * time.Second)
+		}
+		n++
+		items, err := r.fetchFeed(feed)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", feed.SortType, err))
+			continue
+		}
+		allItems = append(allItems, items...)
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("r/%s is not configured", subreddit)
+	}
+	return allItems, errors.Join(errs...)
+}
+
 // buildFeedConfigs creates feed configurations from config
 func (r *RedditCollector) buildFeedConfigs() []RedditFeedConfig {
 	var feeds []RedditFeedConfig
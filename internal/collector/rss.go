@@ -21,6 +21,15 @@ func NewRSSCollector(cfg config.RSSConfig) *RSSCollector {
 	}
 }
 
+func (r *RSSCollector) Name() string { return "rss" }
+
+// Feeds returns the configured feed URLs
+func (r *RSSCollector) Feeds() []string { return r.cfg.Feeds }
+
+func (r *RSSCollector) CollectFeed(feedURL string) ([]storage.NewsItem, error) {
+	return r.fetchFeed(feedURL)
+}
+
 func (r *RSSCollector) Collect() ([]storage.NewsItem, error) {
 	var allItems []storage.NewsItem
 
@@ -0,0 +1,302 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scan statuses
+const (
+	ScanQueued  = "queued"
+	ScanRunning = "running"
+	ScanDone    = "done"
+	ScanFailed  = "failed" // every feed failed
+)
+
+// scanHistory is how many finished scans Manager remembers
+const scanHistory = 50
+
+// ErrUnknownFeed is returned when a trigger names a source or feed that is
+// not configured
+var ErrUnknownFeed = errors.New("unknown source or feed")
+
+// Target is one feed of one source
+type Target struct {
+	Source string `json:"source"`
+	Feed   string `json:"feed"`
+}
+
+// FeedResult reports what scanning one feed produced
+type FeedResult struct {
+	Source   string        `json:"source"`
+	Feed     string        `json:"feed"`
+	Items    int           `json:"items"`
+	New      int           `json:"new"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Scan is one run of the collectors over a set of feeds. Triggers that
+// arrive while it is queued, or that it already covers while running, are
+// coalesced into it.
+type Scan struct {
+	ID         string        `json:"id"`
+	Status     string        `json:"status"`
+	Targets    []Target      `json:"targets"`
+	Triggers   int           `json:"triggers"` // requests served by this scan
+	QueuedAt   time.Time     `json:"queued_at"`
+	StartedAt  *time.Time    `json:"started_at,omitempty"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+	Duration   time.Duration `json:"duration,omitempty"`
+	Items      int           `json:"items"`
+	New        int           `json:"new"`
+	Results    []FeedResult  `json:"results"`
+
+	done chan struct{}
+}
+
+func (s *Scan) covers(targets []Target) bool {
+	have := make(map[Target]bool, len(s.Targets))
+	for _, t := range s.Targets {
+		have[t] = true
+	}
+	for _, t := range targets {
+		if !have[t] {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Scan) add(targets []Target) {
+	for _, t := range targets {
+		if !s.covers([]Target{t}) {
+			s.Targets = append(s.Targets, t)
+		}
+	}
+}
+
+func (s *Scan) copy() *Scan {
+	c := *s
+	c.Targets = append([]Target(nil), s.Targets...)
+	c.Results = append([]FeedResult{}, s.Results...)
+	return &c
+}
+
+// Targets lists the feeds matching the filters. Empty sources or feeds
+// match everything; feeds match case-insensitively, without "@" or "r/".
+func (m *Manager) Targets(sources, feeds []string) ([]Target, error) {
+	wantSource := make(map[string]bool)
+	for _, s := range sources {
+		wantSource[strings.ToLower(s)] = true
+	}
+	wantFeed := make(map[string]bool)
+	for _, f := range feeds {
+		wantFeed[normalizeFeed(f)] = true
+	}
+
+	var targets []Target
+	matchedSource := make(map[string]bool)
+	matchedFeed := make(map[string]bool)
+	for _, c := range m.collectors {
+		if len(wantSource) > 0 && !wantSource[c.Name()] {
+			continue
+		}
+		matchedSource[c.Name()] = true
+		for _, f := range c.Feeds() {
+			if len(wantFeed) > 0 && !wantFeed[normalizeFeed(f)] {
+				continue
+			}
+			matchedFeed[normalizeFeed(f)] = true
+			targets = append(targets, Target{Source: c.Name(), Feed: f})
+		}
+	}
+
+	for s := range wantSource {
+		if !matchedSource[s] {
+			return nil, fmt.Errorf("%w: source %q is not enabled", ErrUnknownFeed, s)
+		}
+	}
+	for f := range wantFeed {
+		if !matchedFeed[f] {
+			return nil, fmt.Errorf("%w: feed %q is not configured", ErrUnknownFeed, f)
+		}
+	}
+	return targets, nil
+}
+
+func normalizeFeed(f string) string {
+	f = strings.ToLower(strings.TrimSpace(f))
+	f = strings.TrimPrefix(f, "@")
+	return strings.TrimPrefix(f, "r/")
+}
+
+// Trigger starts a scan of the feeds matching the filters (see Targets) and
+// returns it. If a running scan already covers them, or a scan is queued
+// behind it, the trigger joins that scan and coalesced is true.
+func (m *Manager) Trigger(sources, feeds []string) (scan *Scan, coalesced bool, err error) {
+	targets, err := m.Targets(sources, feeds)
+	if err != nil {
+		return nil, false, err
+	}
+	s, coalesced := m.trigger(targets)
+	m.scanMu.Lock()
+	defer m.scanMu.Unlock()
+	return s.copy(), coalesced, nil
+}
+
+func (m *Manager) trigger(targets []Target) (*Scan, bool) {
+	m.scanMu.Lock()
+	defer m.scanMu.Unlock()
+
+	if m.running != nil && m.running.covers(targets) {
+		m.running.Triggers++
+		return m.running, true
+	}
+	if m.pending != nil {
+		m.pending.add(targets)
+		m.pending.Triggers++
+		return m.pending, true
+	}
+
+	s := &Scan{
+		ID:       fmt.Sprintf("scan_%d", time.Now().UnixNano()),
+		Status:   ScanQueued,
+		Targets:  targets,
+		Triggers: 1,
+		QueuedAt: time.Now(),
+		Results:  []FeedResult{},
+		done:     make(chan struct{}),
+	}
+	m.remember(s)
+	if m.running != nil {
+		m.pending = s
+		return s, false
+	}
+	m.running = s
+	s.start()
+	go m.run(s)
+	return s, false
+}
+
+// start marks s running; the caller holds scanMu
+func (s *Scan) start() {
+	now := time.Now()
+	s.Status = ScanRunning
+	s.StartedAt = &now
+}
+
+// remember records s and forgets the oldest finished scans
+func (m *Manager) remember(s *Scan) {
+	m.scans[s.ID] = s
+	m.history = append(m.history, s.ID)
+	for len(m.history) > scanHistory {
+		old := m.scans[m.history[0]]
+		if old.Status == ScanQueued || old.Status == ScanRunning {
+			break
+		}
+		delete(m.scans, old.ID)
+		m.history = m.history[1:]
+	}
+}
+
+// Scan returns a copy of the scan with id, if it is still remembered
+func (m *Manager) Scan(id string) (*Scan, bool) {
+	m.scanMu.Lock()
+	defer m.scanMu.Unlock()
+	s, ok := m.scans[id]
+	if !ok {
+		return nil, false
+	}
+	return s.copy(), true
+}
+
+// run scans s, then any scan queued behind it. Sources run concurrently,
+// the feeds of one source one after another.
+func (m *Manager) run(s *Scan) {
+	for s != nil {
+		m.scanMu.Lock()
+		started := *s.StartedAt
+		bySource := make(map[string][]string)
+		for _, t := range s.Targets {
+			bySource[t.Source] = append(bySource[t.Source], t.Feed)
+		}
+		m.scanMu.Unlock()
+
+		log.Printf("Collector: starting scan %s (%d feeds)...", s.ID, len(s.Targets))
+
+		var wg sync.WaitGroup
+		for _, c := range m.collectors {
+			feeds := bySource[c.Name()]
+			if len(feeds) == 0 {
+				continue
+			}
+			wg.Add(1)
+			go func(c SubCollector, feeds []string) {
+				defer wg.Done()
+				for _, feed := range feeds {
+					res := m.scanFeed(c, feed)
+					m.scanMu.Lock()
+					s.Results = append(s.Results, res)
+					s.Items += res.Items
+					s.New += res.New
+					m.scanMu.Unlock()
+				}
+			}(c, feeds)
+		}
+		wg.Wait()
+
+		m.scanMu.Lock()
+		finished := time.Now()
+		s.FinishedAt = &finished
+		s.Duration = finished.Sub(started)
+		s.Status = ScanDone
+		failed := 0
+		for _, r := range s.Results {
+			if r.Error != "" {
+				failed++
+			}
+		}
+		if failed > 0 && failed == len(s.Results) {
+			s.Status = ScanFailed
+		}
+		close(s.done)
+		log.Printf("Collector: scan %s %s in %s: %d items (%d new), %d/%d feeds failed",
+			s.ID, s.Status, s.Duration.Round(time.Millisecond), s.Items, s.New, failed, len(s.Results))
+
+		s, m.pending = m.pending, nil
+		m.running = s
+		if s != nil {
+			s.start()
+		}
+		m.scanMu.Unlock()
+	}
+}
+
+// scanFeed collects one feed and saves its items
+func (m *Manager) scanFeed(c SubCollector, feed string) FeedResult {
+	start := time.Now()
+	res := FeedResult{Source: c.Name(), Feed: feed}
+
+	items, err := c.CollectFeed(feed)
+	res.Items = len(items)
+	if err != nil {
+		log.Printf("Collector error (%s %s): %v", c.Name(), feed, err)
+		res.Error = err.Error()
+	}
+	if len(items) > 0 {
+		n, err := m.store.SaveNewsBatch(items)
+		if err != nil {
+			log.Printf("Collector: failed to save items: %v", err)
+			res.Error = err.Error()
+		}
+		res.New = n
+		log.Printf("Collected %d items from %s %s (%d new)", len(items), c.Name(), feed, n)
+	}
+	res.Duration = time.Since(start)
+	return res
+}
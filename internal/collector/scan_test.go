@@ -0,0 +1,141 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+// fakeCollector returns two items per feed, and blocks until release is
+// closed when one is set
+type fakeCollector struct {
+	name    string
+	feeds   []string
+	release chan struct{}
+	fail    map[string]bool
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (f *fakeCollector) Name() string    { return f.name }
+func (f *fakeCollector) Feeds() []string { return f.feeds }
+
+func (f *fakeCollector) CollectFeed(feed string) ([]storage.NewsItem, error) {
+	if f.release != nil {
+		<-f.release
+	}
+	f.mu.Lock()
+	f.calls[feed]++
+	f.mu.Unlock()
+	if f.fail[feed] {
+		return nil, errors.New("feed is down")
+	}
+	var items []storage.NewsItem
+	for i := 0; i < 2; i++ {
+		// the same two items every time, so later scans find nothing new
+		id := fmt.Sprintf("%s-%s-%d", f.name, feed, i)
+		items = append(items, storage.NewsItem{ID: id, SourceID: id, Source: f.name, Title: id, PublishedAt: time.Now()})
+	}
+	return items, nil
+}
+
+func newTestManager(t *testing.T, collectors ...SubCollector) *Manager {
+	t.Helper()
+	store, err := storage.New(filepath.Join(t.TempDir(), "scan.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return &Manager{store: store, collectors: collectors, scans: make(map[string]*Scan)}
+}
+
+func TestTargets(t *testing.T) {
+	m := newTestManager(t,
+		&fakeCollector{name: "rss", feeds: []string{"https://a.example/feed"}},
+		&fakeCollector{name: "reddit", feeds: []string{"wallstreetbets", "stocks"}},
+	)
+	all, err := m.Targets(nil, nil)
+	if err != nil || len(all) != 3 {
+		t.Fatalf("all targets = %v, %v", all, err)
+	}
+	got, err := m.Targets(nil, []string{"r/WallStreetBets"})
+	if err != nil || len(got) != 1 || got[0] != (Target{"reddit", "wallstreetbets"}) {
+		t.Errorf("feed filter = %v, %v", got, err)
+	}
+	if _, err := m.Targets([]string{"twitter"}, nil); !errors.Is(err, ErrUnknownFeed) {
+		t.Errorf("disabled source err = %v", err)
+	}
+	if _, err := m.Targets([]string{"rss"}, []string{"stocks"}); !errors.Is(err, ErrUnknownFeed) {
+		t.Errorf("feed outside the selected sources err = %v", err)
+	}
+}
+
+func TestTriggerCoalesces(t *testing.T) {
+	release := make(chan struct{})
+	rss := &fakeCollector{name: "rss", feeds: []string{"a", "b"}, release: release, fail: map[string]bool{"b": true}, calls: map[string]int{}}
+	reddit := &fakeCollector{name: "reddit", feeds: []string{"wsb"}, release: release, calls: map[string]int{}}
+	m := newTestManager(t, rss, reddit)
+
+	first, coalesced, err := m.Trigger([]string{"rss"}, nil)
+	if err != nil || coalesced || first.Status != ScanRunning {
+		t.Fatalf("first trigger = %+v, %v, %v", first, coalesced, err)
+	}
+	// covered by the running scan
+	again, coalesced, _ := m.Trigger(nil, []string{"a"})
+	if !coalesced || again.ID != first.ID {
+		t.Errorf("covered trigger started %s, want to join %s", again.ID, first.ID)
+	}
+	// not covered: queued, and everything after joins the queued scan
+	queued, coalesced, _ := m.Trigger([]string{"reddit"}, nil)
+	if coalesced || queued.Status != ScanQueued {
+		t.Errorf("uncovered trigger = %+v, %v", queued, coalesced)
+	}
+	for i := 0; i < 5; i++ {
+		s, coalesced, _ := m.Trigger(nil, nil)
+		if !coalesced || s.ID != queued.ID {
+			t.Fatalf("stampede trigger %d started %s", i, s.ID)
+		}
+	}
+
+	close(release)
+	waitScan(t, m, queued.ID)
+
+	s, _ := m.Scan(first.ID)
+	if s.Status != ScanDone || s.Triggers != 2 || s.Items != 2 || s.New != 2 || len(s.Results) != 2 {
+		t.Errorf("first scan = %+v", s)
+	}
+	for _, r := range s.Results {
+		if (r.Feed == "b") != (r.Error != "") {
+			t.Errorf("result %+v", r)
+		}
+	}
+	q, _ := m.Scan(queued.ID)
+	if q.Triggers != 6 || len(q.Targets) != 3 || len(q.Results) != 3 || q.New != 2 || q.Duration <= 0 {
+		t.Errorf("queued scan = %+v, want all three feeds once", q)
+	}
+	if rss.calls["a"] != 2 || reddit.calls["wsb"] != 1 {
+		t.Errorf("calls = rss %v reddit %v, want each scan to hit a feed once", rss.calls, reddit.calls)
+	}
+
+	if _, ok := m.Scan("scan_missing"); ok {
+		t.Error("unknown scan found")
+	}
+}
+
+func waitScan(t *testing.T, m *Manager, id string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if s, _ := m.Scan(id); s.Status == ScanDone || s.Status == ScanFailed {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("scan %s did not finish", id)
+}
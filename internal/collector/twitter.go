@@ -27,6 +27,15 @@ func NewTwitterCollector(cfg config.TwitterConfig) *TwitterCollector {
 	}
 }
 
+func (t *TwitterCollector) Name() string { return "twitter" }
+
+// Feeds returns the configured accounts
+func (t *TwitterCollector) Feeds() []string { return t.cfg.Accounts }
+
+func (t *TwitterCollector) CollectFeed(account string) ([]storage.NewsItem, error) {
+	return t.fetchAccount(strings.TrimPrefix(account, "@"))
+}
+
 func (t *TwitterCollector) Collect() ([]storage.NewsItem, error) {
 	var allItems []storage.NewsItem
 
@@ -1,7 +1,11 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
@@ -15,6 +19,11 @@ type Config struct {
 	Collector CollectorConfig `mapstructure:"collector"`
 	Analyzer  AnalyzerConfig  `mapstructure:"analyzer"`
 	Reporter  ReporterConfig  `mapstructure:"reporter"`
+	Archive   ArchiveConfig   `mapstructure:"archive"`
+	Webhooks  WebhookConfig   `mapstructure:"webhooks"`
+	Notifier  NotifierConfig  `mapstructure:"notifier"`
+	Email     EmailConfig     `mapstructure:"email"`
+	Alerting  AlertingConfig  `mapstructure:"alerting"`
 }
 
 type ServerConfig struct {
@@ -25,13 +34,93 @@ type ServerConfig struct {
 }
 
 type AuthConfig struct {
-	Tokens    []string `mapstructure:"tokens"`
-	RateLimit int      `mapstructure:"rate_limit"` // requests per minute
+	Tokens      []string         `mapstructure:"tokens"`
+	RateLimit   int              `mapstructure:"rate_limit"`   // requests per minute per token, 0 disables
+	RouteCosts  map[string]int   `mapstructure:"route_costs"`  // requests a call counts as, by route pattern
+	TokenLimits []TokenRateLimit `mapstructure:"token_limits"` // per-token overrides of rate_limit
+}
+
+// TokenRateLimit overrides the rate limit of one token; 0 leaves it unlimited
+type TokenRateLimit struct {
+	Token     string `mapstructure:"token"` // name of a token from `sentinel token create`, or "sha256:<hex>" of an auth.tokens entry
+	RateLimit int    `mapstructure:"rate_limit"`
+}
+
+// validate rejects token_limits keyed by a secret, which would keep the
+// secret in plain text next to its hash, and lowercases digests
+func (a *AuthConfig) validate() error {
+	for i, o := range a.TokenLimits {
+		if h, ok := strings.CutPrefix(o.Token, "sha256:"); ok {
+			if d, err := hex.DecodeString(h); err != nil || len(d) != sha256.Size {
+				return fmt.Errorf("auth.token_limits[%d]: malformed sha256 digest", i)
+			}
+			a.TokenLimits[i].Token = "sha256:" + strings.ToLower(h)
+			continue
+		}
+		if o.Token == "" {
+			return fmt.Errorf("auth.token_limits[%d]: token is required", i)
+		}
+		if strings.HasPrefix(o.Token, "sk-sentinel-") || slices.Contains(a.Tokens, o.Token) {
+			return fmt.Errorf(`auth.token_limits[%d]: give the token's name or "sha256:<hex>" digest, not the secret`, i)
+		}
+	}
+	return nil
 }
 
 type StorageConfig struct {
-	Database   string `mapstructure:"database"`
-	ReportsDir string `mapstructure:"reports_dir"`
+	Driver      string `mapstructure:"driver"`   // sqlite, postgres
+	Database    string `mapstructure:"database"` // SQLite file path
+	DSN         string `mapstructure:"dsn"`      // PostgreSQL connection string
+	ReportsDir  string `mapstructure:"reports_dir"`
+	AutoMigrate bool   `mapstructure:"auto_migrate"` // apply pending schema migrations on startup
+
+	Retention RetentionConfig `mapstructure:"retention"`
+	Mirror    MirrorConfig    `mapstructure:"mirror"`
+	Backup    BackupConfig    `mapstructure:"backup"`
+}
+
+// BackupConfig schedules online SQLite snapshots
+type BackupConfig struct {
+	Enabled  bool          `mapstructure:"enabled"` // take snapshots on a schedule in serve
+	Dir      string        `mapstructure:"dir"`
+	Interval time.Duration `mapstructure:"interval"`
+	Keep     int           `mapstructure:"keep"` // newest snapshots to keep, 0 keeps all
+}
+
+// MirrorConfig appends every created news item, analysis, alert and report
+// to daily JSONL files, so `sentinel restore` can rebuild a lost database
+type MirrorConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Dir      string        `mapstructure:"dir"`
+	Compress bool          `mapstructure:"compress"` // gzip finished day files
+	MaxAge   time.Duration `mapstructure:"max_age"`  // delete day files older than this, 0 keeps forever
+}
+
+// RetentionConfig sets how long each kind of data is kept. Zero keeps forever.
+type RetentionConfig struct {
+	Enabled           bool          `mapstructure:"enabled"`
+	Interval          time.Duration `mapstructure:"interval"`
+	RawResponses      time.Duration `mapstructure:"raw_responses"`   // clear Analysis.RawResponse
+	UnanalyzedNews    time.Duration `mapstructure:"unanalyzed_news"` // news that never got an analysis
+	News              time.Duration `mapstructure:"news"`            // news with their analyses
+	Analyses          time.Duration `mapstructure:"analyses"`
+	Alerts            time.Duration `mapstructure:"alerts"`
+	WebhookDeliveries time.Duration `mapstructure:"webhook_deliveries"` // sent or abandoned deliveries
+	Notifications     time.Duration `mapstructure:"notifications"`      // sent or abandoned notifier messages
+	Reports           time.Duration `mapstructure:"reports"`
+	ReportContent     time.Duration `mapstructure:"report_content"` // clear Report.Content
+	Rollups5m         time.Duration `mapstructure:"rollups_5m"`
+	Rollups1h         time.Duration `mapstructure:"rollups_1h"`
+	Vacuum            string        `mapstructure:"vacuum"` // incremental, full, off
+}
+
+// ArchiveConfig controls exports to date-partitioned research files
+type ArchiveConfig struct {
+	Enabled  bool          `mapstructure:"enabled"` // run the scheduled archiver in serve
+	Dir      string        `mapstructure:"dir"`
+	Formats  []string      `mapstructure:"formats"`  // jsonl, jsonl.gz, parquet
+	Datasets []string      `mapstructure:"datasets"` // news, analyses, alerts
+	Interval time.Duration `mapstructure:"interval"`
 }
 
 type CollectorConfig struct {
@@ -74,6 +163,104 @@ type AnalyzerConfig struct {
 	LLMModel    string `mapstructure:"llm_model"`
 	APIKey      string `mapstructure:"api_key"`
 	OllamaURL   string `mapstructure:"ollama_url"` // e.g. "http://localhost:11434"
+
+	Velocity VelocityConfig `mapstructure:"velocity"`
+}
+
+// VelocityConfig tunes the mention volume spike detector
+type VelocityConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	Bucket       time.Duration `mapstructure:"bucket"`        // counting period
+	Baseline     int           `mapstructure:"baseline"`      // buckets in the rolling baseline
+	Threshold    float64       `mapstructure:"threshold"`     // z-score that counts as a spike
+	MinCount     int           `mapstructure:"min_count"`     // fewer mentions in a bucket never alert
+	PollInterval time.Duration `mapstructure:"poll_interval"` // how often new news is counted
+}
+
+// AlertingConfig holds the rules that turn analyses into alerts
+type AlertingConfig struct {
+	Watchlist        string        `mapstructure:"watchlist"`         // accounts and feeds file for the watchlist variables
+	VelocityWindow   time.Duration `mapstructure:"velocity_window"`   // period counted by the mentions variable
+	VelocityBaseline time.Duration `mapstructure:"velocity_baseline"` // history velocity compares the window with
+	Rules            []RuleConfig  `mapstructure:"rules"`             // empty uses the built-in rules
+
+	// Cooldown is how long after an alert the follow-ups of its story in the
+	// same direction attach to it, by the alert's severity. 0 never groups.
+	Cooldown map[string]time.Duration `mapstructure:"cooldown"`
+}
+
+// RuleConfig is an alert rule: an expression over an analysis and each of
+// its symbols, and the severity and notifier channels of the alert it raises
+type RuleConfig struct {
+	Name     string   `mapstructure:"name"`
+	When     string   `mapstructure:"when"`
+	Severity string   `mapstructure:"severity"` // high, critical
+	Channels []string `mapstructure:"channels"` // notifier channel names, empty uses channel routes
+}
+
+// WebhookConfig controls delivery of alerts to webhook subscriptions
+type WebhookConfig struct {
+	Enabled      bool          `mapstructure:"enabled"` // deliver queued alerts in serve
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	Timeout      time.Duration `mapstructure:"timeout"` // per request
+	MaxAttempts  int           `mapstructure:"max_attempts"`
+	Backoff      time.Duration `mapstructure:"backoff"`     // wait before the first retry, doubled after each
+	MaxBackoff   time.Duration `mapstructure:"max_backoff"` // longest wait between retries
+}
+
+// NotifierConfig sends alerts to chat channels
+type NotifierConfig struct {
+	Enabled      bool            `mapstructure:"enabled"`
+	PollInterval time.Duration   `mapstructure:"poll_interval"`
+	Lookback     time.Duration   `mapstructure:"lookback"` // alerts this old at startup are still sent
+	Timeout      time.Duration   `mapstructure:"timeout"`  // per request
+	MaxAttempts  int             `mapstructure:"max_attempts"`
+	Backoff      time.Duration   `mapstructure:"backoff"` // wait before the first retry, doubled after each
+	Channels     []ChannelConfig `mapstructure:"channels"`
+}
+
+// ChannelConfig is one notification destination and the alerts routed to it.
+// Empty route lists match every alert.
+type ChannelConfig struct {
+	Name   string `mapstructure:"name"`
+	Type   string `mapstructure:"type"`    // telegram, slack, discord, feishu, dingtalk, wecom
+	URL    string `mapstructure:"url"`     // incoming webhook or robot URL; API base for telegram
+	Token  string `mapstructure:"token"`   // telegram bot token
+	ChatID string `mapstructure:"chat_id"` // telegram chat
+	Secret string `mapstructure:"secret"`  // feishu / dingtalk signing secret
+
+	Severities []string `mapstructure:"severities"`
+	Symbols    []string `mapstructure:"symbols"`
+	Kinds      []string `mapstructure:"kinds"` // alert kinds
+
+	RateLimit int    `mapstructure:"rate_limit"` // messages per minute, 0 uses the default
+	Template  string `mapstructure:"template"`   // text/template over the alert, "" uses the default
+}
+
+// EmailConfig sends reports and alert digests over SMTP
+type EmailConfig struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Host     string        `mapstructure:"host"`
+	Port     int           `mapstructure:"port"`
+	Security string        `mapstructure:"security"` // starttls, tls (implicit, port 465) or none
+	Username string        `mapstructure:"username"` // empty skips AUTH
+	Password string        `mapstructure:"password"`
+	From     string        `mapstructure:"from"`
+	Timeout  time.Duration `mapstructure:"timeout"`
+
+	Reports        map[string][]string `mapstructure:"reports"` // report type -> recipients
+	Digest         []string            `mapstructure:"digest"`  // recipients of every alert
+	DigestInterval time.Duration       `mapstructure:"digest_interval"`
+	Watchlists     []EmailWatchlist    `mapstructure:"watchlists"`
+}
+
+// EmailWatchlist sends its recipients the alerts and report sections about
+// its symbols
+type EmailWatchlist struct {
+	Name       string   `mapstructure:"name"`
+	Symbols    []string `mapstructure:"symbols"`
+	Recipients []string `mapstructure:"recipients"`
+	Reports    []string `mapstructure:"reports"` // report types sent, narrowed to Symbols
 }
 
 type ReporterConfig struct {
@@ -90,12 +277,65 @@ func Load(path string) (*Config, error) {
 	v.SetDefault("server.read_timeout", "30s")
 	v.SetDefault("server.write_timeout", "30s")
 	v.SetDefault("auth.rate_limit", 100)
+	v.SetDefault("storage.driver", "sqlite")
 	v.SetDefault("storage.database", "./data/sentinel.db")
+	v.SetDefault("storage.dsn", "")
+	v.SetDefault("storage.auto_migrate", true)
+	v.SetDefault("storage.retention.enabled", true)
+	v.SetDefault("storage.retention.interval", "6h")
+	v.SetDefault("storage.retention.raw_responses", "720h")
+	v.SetDefault("storage.retention.unanalyzed_news", "168h")
+	v.SetDefault("storage.retention.alerts", "8760h")
+	v.SetDefault("storage.retention.webhook_deliveries", "720h")
+	v.SetDefault("storage.retention.notifications", "720h")
+	v.SetDefault("storage.retention.rollups_5m", "168h")
+	v.SetDefault("storage.retention.vacuum", "incremental")
 	v.SetDefault("storage.reports_dir", "./data/reports")
+	v.SetDefault("storage.mirror.enabled", false)
+	v.SetDefault("storage.mirror.dir", "./data/mirror")
+	v.SetDefault("storage.mirror.compress", true)
+	v.SetDefault("storage.mirror.max_age", "2160h")
+	v.SetDefault("storage.backup.enabled", false)
+	v.SetDefault("storage.backup.dir", "./data/backups")
+	v.SetDefault("storage.backup.interval", "24h")
+	v.SetDefault("storage.backup.keep", 7)
+	v.SetDefault("archive.enabled", false)
+	v.SetDefault("archive.dir", "./data/archive")
+	v.SetDefault("archive.formats", []string{"jsonl.gz", "parquet"})
+	v.SetDefault("archive.datasets", []string{"news", "analyses", "alerts"})
+	v.SetDefault("archive.interval", "24h")
 	v.SetDefault("collector.scan_interval", "15m")
 	v.SetDefault("collector.sources", []string{"twitter", "rss"})
 	v.SetDefault("analyzer.llm_provider", "anthropic")
 	v.SetDefault("analyzer.llm_model", "claude-sonnet-4-20250514")
+	v.SetDefault("analyzer.velocity.enabled", true)
+	v.SetDefault("analyzer.velocity.bucket", "1h")
+	v.SetDefault("analyzer.velocity.baseline", 24)
+	v.SetDefault("analyzer.velocity.threshold", 3.0)
+	v.SetDefault("analyzer.velocity.min_count", 5)
+	v.SetDefault("analyzer.velocity.poll_interval", "30s")
+	v.SetDefault("webhooks.enabled", true)
+	v.SetDefault("webhooks.poll_interval", "5s")
+	v.SetDefault("webhooks.timeout", "10s")
+	v.SetDefault("webhooks.max_attempts", 8)
+	v.SetDefault("webhooks.backoff", "30s")
+	v.SetDefault("webhooks.max_backoff", "1h")
+	v.SetDefault("notifier.enabled", false)
+	v.SetDefault("notifier.poll_interval", "10s")
+	v.SetDefault("notifier.lookback", "1h")
+	v.SetDefault("notifier.timeout", "10s")
+	v.SetDefault("notifier.max_attempts", 5)
+	v.SetDefault("notifier.backoff", "1m")
+	v.SetDefault("alerting.watchlist", "configs/watchlist.yaml")
+	v.SetDefault("alerting.velocity_window", "1h")
+	v.SetDefault("alerting.velocity_baseline", "24h")
+	v.SetDefault("alerting.cooldown.high", "2h")
+	v.SetDefault("alerting.cooldown.critical", "1h")
+	v.SetDefault("email.enabled", false)
+	v.SetDefault("email.port", 587)
+	v.SetDefault("email.security", "starttls")
+	v.SetDefault("email.timeout", "30s")
+	v.SetDefault("email.digest_interval", "1h")
 	v.SetDefault("reporter.save_to_file", true)
 	v.SetDefault("reporter.file_format", "json")
 
@@ -127,6 +367,9 @@ func Load(path string) (*Config, error) {
 	if token := os.Getenv("SENTINEL_API_TOKEN"); token != "" {
 		cfg.Auth.Tokens = append(cfg.Auth.Tokens, token)
 	}
+	if err := cfg.Auth.validate(); err != nil {
+		return nil, err
+	}
 
 	return &cfg, nil
 }
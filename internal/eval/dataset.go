@@ -0,0 +1,98 @@
+package eval
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+// Sample is one labeled line of an evaluation dataset (JSONL)
+type Sample struct {
+	ID          string    `json:"id"`
+	Source      string    `json:"source"`
+	Author      string    `json:"author"`
+	Title       string    `json:"title"`
+	Content     string    `json:"content"`
+	PublishedAt time.Time `json:"published_at"`
+	Expected    Expected  `json:"expected"`
+}
+
+// Expected holds the labels a sample is graded against.
+// Empty fields are not graded.
+type Expected struct {
+	Sentiment string         `json:"sentiment"` // positive, negative, neutral
+	Impact    string         `json:"impact"`    // high, medium, low
+	Tickers   []string       `json:"tickers"`
+	Scores    map[string]int `json:"scores"` // symbol -> -10..+10
+}
+
+// LoadDataset reads a JSONL file of samples. Blank lines and lines starting
+// with "#" are skipped.
+func LoadDataset(path string) ([]Sample, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var samples []Sample
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var s Sample
+		if err := json.Unmarshal([]byte(line), &s); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		if s.ID == "" {
+			s.ID = fmt.Sprintf("line-%d", lineNo)
+		}
+		if s.Content == "" && s.Title == "" {
+			return nil, fmt.Errorf("%s:%d: sample %s has no title or content", path, lineNo, s.ID)
+		}
+		samples = append(samples, s)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("%s: dataset is empty", path)
+	}
+	return samples, nil
+}
+
+// NewsItem converts the sample into the shape Analyzer.Analyze expects
+func (s Sample) NewsItem() *storage.NewsItem {
+	source := s.Source
+	if source == "" {
+		source = "eval"
+	}
+	published := s.PublishedAt
+	if published.IsZero() {
+		published = time.Now()
+	}
+	content := s.Content
+	if content == "" {
+		content = s.Title
+	}
+	return &storage.NewsItem{
+		ID:          "eval_" + s.ID,
+		Source:      source,
+		Author:      s.Author,
+		Title:       s.Title,
+		Content:     content,
+		PublishedAt: published,
+		CollectedAt: time.Now(),
+	}
+}
@@ -0,0 +1,130 @@
+package eval
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// MetricDelta compares one metric between a baseline and the current run
+type MetricDelta struct {
+	Name     string
+	Baseline float64
+	Current  float64
+	// HigherIsBetter drives the verdict column
+	HigherIsBetter bool
+}
+
+func (d MetricDelta) Delta() float64 {
+	return d.Current - d.Baseline
+}
+
+// Verdict returns "better", "worse" or "same"
+func (d MetricDelta) Verdict() string {
+	const eps = 1e-9
+	delta := d.Delta()
+	switch {
+	case delta > eps && d.HigherIsBetter, delta < -eps && !d.HigherIsBetter:
+		return "better"
+	case delta > eps, delta < -eps:
+		return "worse"
+	default:
+		return "same"
+	}
+}
+
+// SampleChange lists samples whose sentiment grading flipped between runs
+type SampleChange struct {
+	ID       string
+	Baseline string
+	Current  string
+	Fixed    bool // wrong (or failed) before, right now
+}
+
+// Diff is the comparison of two runs
+type Diff struct {
+	Metrics []MetricDelta
+	Changes []SampleChange
+}
+
+// Compare diffs the current run against a baseline run
+func Compare(baseline, current *Run) *Diff {
+	b, c := baseline.Metrics, current.Metrics
+	d := &Diff{
+		Metrics: []MetricDelta{
+			{"sentiment_accuracy", b.SentimentAccuracy, c.SentimentAccuracy, true},
+			{"impact_accuracy", b.ImpactAccuracy, c.ImpactAccuracy, true},
+			{"ticker_precision", b.TickerPrecision, c.TickerPrecision, true},
+			{"ticker_recall", b.TickerRecall, c.TickerRecall, true},
+			{"ticker_f1", b.TickerF1, c.TickerF1, true},
+			{"score_mae", b.ScoreMAE, c.ScoreMAE, false},
+			{"parse_failure_rate", b.ParseFailureRate, c.ParseFailureRate, false},
+			{"latency_mean_ms", b.LatencyMeanMs, c.LatencyMeanMs, false},
+			{"latency_p95_ms", b.LatencyP95Ms, c.LatencyP95Ms, false},
+		},
+	}
+
+	prev := make(map[string]SampleResult, len(baseline.Results))
+	for _, r := range baseline.Results {
+		prev[r.ID] = r
+	}
+	for _, cur := range current.Results {
+		old, ok := prev[cur.ID]
+		if !ok || old.SentimentCorrect() == cur.SentimentCorrect() {
+			continue
+		}
+		d.Changes = append(d.Changes, SampleChange{
+			ID:       cur.ID,
+			Baseline: describe(old),
+			Current:  describe(cur),
+			Fixed:    cur.SentimentCorrect(),
+		})
+	}
+	return d
+}
+
+func describe(r SampleResult) string {
+	if !r.OK {
+		return "error(" + r.ErrorKind + ")"
+	}
+	return r.Sentiment
+}
+
+// PrintRun writes a human readable metrics table
+func PrintRun(w io.Writer, run *Run) {
+	m := run.Metrics
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "provider\t%s / %s\n", run.Provider, run.Model)
+	fmt.Fprintf(tw, "samples\t%d (ok %d, parse failures %d, generation errors %d)\n",
+		m.Samples, m.Succeeded, m.ParseFailures, m.GenerationErrors)
+	fmt.Fprintf(tw, "sentiment accuracy\t%.3f (n=%d)\n", m.SentimentAccuracy, m.SentimentGraded)
+	fmt.Fprintf(tw, "impact accuracy\t%.3f (n=%d)\n", m.ImpactAccuracy, m.ImpactGraded)
+	fmt.Fprintf(tw, "ticker precision/recall/f1\t%.3f / %.3f / %.3f\n", m.TickerPrecision, m.TickerRecall, m.TickerF1)
+	fmt.Fprintf(tw, "score MAE\t%.3f (n=%d)\n", m.ScoreMAE, m.ScorePairs)
+	fmt.Fprintf(tw, "parse failure rate\t%.3f\n", m.ParseFailureRate)
+	fmt.Fprintf(tw, "latency mean/p50/p95/max\t%.0f / %.0f / %.0f / %.0f ms\n",
+		m.LatencyMeanMs, m.LatencyP50Ms, m.LatencyP95Ms, m.LatencyMaxMs)
+	tw.Flush()
+}
+
+// PrintDiff writes the metric deltas and flipped samples
+func PrintDiff(w io.Writer, d *Diff) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "metric\tbaseline\tcurrent\tdelta\t")
+	for _, m := range d.Metrics {
+		fmt.Fprintf(tw, "%s\t%.3f\t%.3f\t%+.3f\t%s\n", m.Name, m.Baseline, m.Current, m.Delta(), m.Verdict())
+	}
+	tw.Flush()
+
+	if len(d.Changes) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\nsentiment changes:")
+	for _, c := range d.Changes {
+		mark := "-"
+		if c.Fixed {
+			mark = "+"
+		}
+		fmt.Fprintf(w, "  %s %s: %s -> %s\n", mark, c.ID, c.Baseline, c.Current)
+	}
+}
@@ -0,0 +1,320 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/analyzer"
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+// Error kinds recorded on failed samples
+const (
+	ErrorKindParse      = "parse"
+	ErrorKindGeneration = "generation"
+)
+
+// Run is the persisted outcome of one evaluation, suitable for diffing
+type Run struct {
+	Provider   string         `json:"provider"`
+	Model      string         `json:"model"`
+	Dataset    string         `json:"dataset"`
+	StartedAt  time.Time      `json:"started_at"`
+	DurationMs int64          `json:"duration_ms"`
+	Metrics    Metrics        `json:"metrics"`
+	Results    []SampleResult `json:"results"`
+}
+
+// SampleResult records what the model produced for a single sample
+type SampleResult struct {
+	ID                string         `json:"id"`
+	OK                bool           `json:"ok"`
+	ErrorKind         string         `json:"error_kind,omitempty"`
+	Error             string         `json:"error,omitempty"`
+	LatencyMs         float64        `json:"latency_ms"`
+	Sentiment         string         `json:"sentiment,omitempty"`
+	ExpectedSentiment string         `json:"expected_sentiment,omitempty"`
+	Impact            string         `json:"impact,omitempty"`
+	ExpectedImpact    string         `json:"expected_impact,omitempty"`
+	Tickers           []string       `json:"tickers,omitempty"`
+	ExpectedTickers   []string       `json:"expected_tickers,omitempty"`
+	Scores            map[string]int `json:"scores,omitempty"`
+	ExpectedScores    map[string]int `json:"expected_scores,omitempty"`
+}
+
+// SentimentCorrect reports whether the sample was graded and matched
+func (r SampleResult) SentimentCorrect() bool {
+	return r.OK && r.ExpectedSentiment != "" && strings.EqualFold(r.Sentiment, r.ExpectedSentiment)
+}
+
+// Metrics aggregates a run
+type Metrics struct {
+	Samples          int     `json:"samples"`
+	Succeeded        int     `json:"succeeded"`
+	ParseFailures    int     `json:"parse_failures"`
+	GenerationErrors int     `json:"generation_errors"`
+	ParseFailureRate float64 `json:"parse_failure_rate"`
+
+	SentimentGraded   int     `json:"sentiment_graded"`
+	SentimentAccuracy float64 `json:"sentiment_accuracy"`
+	ImpactGraded      int     `json:"impact_graded"`
+	ImpactAccuracy    float64 `json:"impact_accuracy"`
+
+	TickerPrecision float64 `json:"ticker_precision"`
+	TickerRecall    float64 `json:"ticker_recall"`
+	TickerF1        float64 `json:"ticker_f1"`
+
+	ScorePairs int     `json:"score_pairs"`
+	ScoreMAE   float64 `json:"score_mae"`
+
+	LatencyMeanMs float64 `json:"latency_mean_ms"`
+	LatencyP50Ms  float64 `json:"latency_p50_ms"`
+	LatencyP95Ms  float64 `json:"latency_p95_ms"`
+	LatencyMaxMs  float64 `json:"latency_max_ms"`
+}
+
+// Runner evaluates samples through an Analyzer
+type Runner struct {
+	analyzer    *analyzer.Analyzer
+	concurrency int
+	timeout     time.Duration
+}
+
+func NewRunner(a *analyzer.Analyzer, concurrency int, timeout time.Duration) *Runner {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if timeout <= 0 {
+		timeout = 2 * time.Minute
+	}
+	return &Runner{
+		analyzer:    a,
+		concurrency: concurrency,
+		timeout:     timeout,
+	}
+}
+
+// Run analyzes every sample and computes metrics. Results keep dataset order.
+func (r *Runner) Run(ctx context.Context, samples []Sample) *Run {
+	started := time.Now()
+	results := make([]SampleResult, len(samples))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, r.concurrency)
+	for i := range samples {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = r.evaluate(ctx, samples[i])
+		}(i)
+	}
+	wg.Wait()
+
+	return &Run{
+		StartedAt:  started,
+		DurationMs: time.Since(started).Milliseconds(),
+		Metrics:    ComputeMetrics(results),
+		Results:    results,
+	}
+}
+
+func (r *Runner) evaluate(ctx context.Context, s Sample) SampleResult {
+	res := SampleResult{
+		ID:                s.ID,
+		ExpectedSentiment: s.Expected.Sentiment,
+		ExpectedImpact:    s.Expected.Impact,
+		ExpectedTickers:   normalizeTickers(s.Expected.Tickers),
+		ExpectedScores:    s.Expected.Scores,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	start := time.Now()
+	analysis, err := r.analyzer.Analyze(ctx, s.NewsItem())
+	res.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+
+	if err != nil {
+		res.Error = err.Error()
+		res.ErrorKind = ErrorKindGeneration
+		if errors.Is(err, analyzer.ErrUnparseable) {
+			res.ErrorKind = ErrorKindParse
+		}
+		return res
+	}
+
+	res.OK = true
+	res.Sentiment = analysis.Sentiment
+	res.Impact = analysis.ImpactLevel
+	res.Tickers = normalizeTickers(analysis.RelatedStocks)
+	res.Scores = scoresOf(analysis.StockDetails)
+	return res
+}
+
+// ComputeMetrics aggregates per-sample results. Ticker precision/recall are
+// micro-averaged; score MAE is taken over tickers both labeled and scored.
+func ComputeMetrics(results []SampleResult) Metrics {
+	m := Metrics{Samples: len(results)}
+
+	var sentimentHits, impactHits int
+	var tp, fp, fn int
+	var absErr float64
+	var latencies []float64
+
+	for _, r := range results {
+		latencies = append(latencies, r.LatencyMs)
+
+		if !r.OK {
+			if r.ErrorKind == ErrorKindParse {
+				m.ParseFailures++
+			} else {
+				m.GenerationErrors++
+			}
+			continue
+		}
+		m.Succeeded++
+
+		if r.ExpectedSentiment != "" {
+			m.SentimentGraded++
+			if r.SentimentCorrect() {
+				sentimentHits++
+			}
+		}
+		if r.ExpectedImpact != "" {
+			m.ImpactGraded++
+			if strings.EqualFold(r.Impact, r.ExpectedImpact) {
+				impactHits++
+			}
+		}
+
+		if r.ExpectedTickers != nil {
+			expected := make(map[string]bool, len(r.ExpectedTickers))
+			for _, t := range r.ExpectedTickers {
+				expected[t] = true
+			}
+			for _, t := range r.Tickers {
+				if expected[t] {
+					tp++
+					delete(expected, t)
+				} else {
+					fp++
+				}
+			}
+			fn += len(expected)
+		}
+
+		for symbol, want := range r.ExpectedScores {
+			got, ok := r.Scores[strings.ToUpper(symbol)]
+			if !ok {
+				continue
+			}
+			m.ScorePairs++
+			absErr += math.Abs(float64(got - want))
+		}
+	}
+
+	if m.Samples > 0 {
+		m.ParseFailureRate = float64(m.ParseFailures) / float64(m.Samples)
+	}
+	if m.SentimentGraded > 0 {
+		m.SentimentAccuracy = float64(sentimentHits) / float64(m.SentimentGraded)
+	}
+	if m.ImpactGraded > 0 {
+		m.ImpactAccuracy = float64(impactHits) / float64(m.ImpactGraded)
+	}
+	if tp+fp > 0 {
+		m.TickerPrecision = float64(tp) / float64(tp+fp)
+	}
+	if tp+fn > 0 {
+		m.TickerRecall = float64(tp) / float64(tp+fn)
+	}
+	if m.TickerPrecision+m.TickerRecall > 0 {
+		m.TickerF1 = 2 * m.TickerPrecision * m.TickerRecall / (m.TickerPrecision + m.TickerRecall)
+	}
+	if m.ScorePairs > 0 {
+		m.ScoreMAE = absErr / float64(m.ScorePairs)
+	}
+
+	if len(latencies) > 0 {
+		sort.Float64s(latencies)
+		var sum float64
+		for _, l := range latencies {
+			sum += l
+		}
+		m.LatencyMeanMs = sum / float64(len(latencies))
+		m.LatencyP50Ms = percentile(latencies, 0.50)
+		m.LatencyP95Ms = percentile(latencies, 0.95)
+		m.LatencyMaxMs = latencies[len(latencies)-1]
+	}
+
+	return m
+}
+
+// percentile uses nearest-rank on an already sorted slice
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+func normalizeTickers(tickers []string) []string {
+	if tickers == nil {
+		return nil
+	}
+	seen := make(map[string]bool, len(tickers))
+	out := make([]string, 0, len(tickers))
+	for _, t := range tickers {
+		t = strings.ToUpper(strings.TrimPrefix(strings.TrimSpace(t), "$"))
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func scoresOf(details []storage.StockImpact) map[string]int {
+	if len(details) == 0 {
+		return nil
+	}
+	scores := make(map[string]int, len(details))
+	for _, d := range details {
+		scores[strings.ToUpper(d.Symbol)] = d.Score
+	}
+	return scores
+}
+
+// SaveRun writes a run as indented JSON
+func SaveRun(path string, run *Run) error {
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// LoadRun reads a run previously written by SaveRun
+func LoadRun(path string) (*Run, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var run Run
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
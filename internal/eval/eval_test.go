@@ -0,0 +1,138 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/analyzer"
+)
+
+// fakeProvider answers with a canned reply keyed by a substring of the prompt
+type fakeProvider struct {
+	replies map[string]string
+}
+
+func (f *fakeProvider) Generate(ctx context.Context, prompt string) (string, error) {
+	for key, reply := range f.replies {
+		if strings.Contains(prompt, key) {
+			if reply == "" {
+				return "", errors.New("connection refused")
+			}
+			return reply, nil
+		}
+	}
+	return "not json at all", nil
+}
+
+func TestRunner_Metrics(t *testing.T) {
+	provider := &fakeProvider{replies: map[string]string{
+		"Exporting restrictions": `{"sentiment":"negative","impact":"high","summary":"s","stocks":[{"symbol":"NVDA","score":-6}],"confidence":0.9}`,
+		"record quarterly":       `{"sentiment":"positive","impact":"medium","summary":"s","stocks":[{"symbol":"XYZ","score":4},{"symbol":"QRS","score":2}],"confidence":0.7}`,
+		"timeout scenario":       "",
+	}}
+	samples := []Sample{
+		{ID: "a", Content: "Exporting restrictions tightened", Expected: Expected{
+			Sentiment: "negative", Impact: "high", Tickers: []string{"NVDA"}, Scores: map[string]int{"NVDA": -8},
+		}},
+		{ID: "b", Content: "Xyzcorp announces record quarterly results", Expected: Expected{
+			Sentiment: "neutral", Tickers: []string{"XYZ"}, Scores: map[string]int{"XYZ": 5},
+		}},
+		{ID: "c", Content: "garbled replies expected", Expected: Expected{Sentiment: "neutral"}},
+		{ID: "d", Content: "timeout scenario", Expected: Expected{Sentiment: "neutral"}},
+	}
+
+	runner := NewRunner(analyzer.NewWithProvider(nil, nil, provider), 2, time.Second)
+	run := runner.Run(context.Background(), samples)
+	m := run.Metrics
+
+	if m.Samples != 4 || m.Succeeded != 2 || m.ParseFailures != 1 || m.GenerationErrors != 1 {
+		t.Fatalf("unexpected counts: %+v", m)
+	}
+	if m.ParseFailureRate != 0.25 {
+		t.Errorf("parse failure rate = %v, want 0.25", m.ParseFailureRate)
+	}
+	if m.SentimentAccuracy != 0.5 {
+		t.Errorf("sentiment accuracy = %v, want 0.5", m.SentimentAccuracy)
+	}
+	if m.ImpactGraded != 1 || m.ImpactAccuracy != 1 {
+		t.Errorf("impact = %d/%v, want 1/1", m.ImpactGraded, m.ImpactAccuracy)
+	}
+	// predicted {NVDA} and {XYZ, QRS} against expected {NVDA} and {XYZ}
+	if math.Abs(m.TickerPrecision-2.0/3.0) > 1e-9 || m.TickerRecall != 1 {
+		t.Errorf("ticker precision/recall = %v/%v", m.TickerPrecision, m.TickerRecall)
+	}
+	// |-6 - -8| and |4 - 5|
+	if m.ScorePairs != 2 || m.ScoreMAE != 1.5 {
+		t.Errorf("score MAE = %v over %d pairs, want 1.5 over 2", m.ScoreMAE, m.ScorePairs)
+	}
+	if run.Results[0].ID != "a" || run.Results[3].ID != "d" {
+		t.Errorf("results out of dataset order")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	baseline := &Run{
+		Metrics: Metrics{SentimentAccuracy: 0.5, ScoreMAE: 2},
+		Results: []SampleResult{
+			{ID: "a", OK: true, Sentiment: "neutral", ExpectedSentiment: "positive"},
+			{ID: "b", OK: true, Sentiment: "negative", ExpectedSentiment: "negative"},
+		},
+	}
+	current := &Run{
+		Metrics: Metrics{SentimentAccuracy: 0.5, ScoreMAE: 1},
+		Results: []SampleResult{
+			{ID: "a", OK: true, Sentiment: "positive", ExpectedSentiment: "positive"},
+			{ID: "b", OK: false, ErrorKind: ErrorKindParse, ExpectedSentiment: "negative"},
+		},
+	}
+
+	d := Compare(baseline, current)
+	for _, m := range d.Metrics {
+		switch m.Name {
+		case "sentiment_accuracy":
+			if m.Verdict() != "same" {
+				t.Errorf("sentiment_accuracy verdict = %s", m.Verdict())
+			}
+		case "score_mae":
+			if m.Verdict() != "better" {
+				t.Errorf("score_mae verdict = %s, lower MAE should be better", m.Verdict())
+			}
+		}
+	}
+	if len(d.Changes) != 2 || !d.Changes[0].Fixed || d.Changes[1].Fixed {
+		t.Fatalf("unexpected changes: %+v", d.Changes)
+	}
+	if d.Changes[1].Current != "error(parse)" {
+		t.Errorf("change b current = %q", d.Changes[1].Current)
+	}
+}
+
+func TestLoadDataset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ds.jsonl")
+	data := "# comment\n" +
+		`{"id":"x","content":"hello","expected":{"sentiment":"neutral","tickers":["$aapl"]}}` + "\n\n" +
+		`{"title":"headline only"}` + "\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	samples, err := LoadDataset(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2 {
+		t.Fatalf("got %d samples, want 2", len(samples))
+	}
+	if samples[1].ID != "line-4" {
+		t.Errorf("generated id = %q", samples[1].ID)
+	}
+	if got := samples[1].NewsItem().Content; got != "headline only" {
+		t.Errorf("content fallback = %q", got)
+	}
+}
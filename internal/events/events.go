@@ -0,0 +1,317 @@
+// Package events clusters analyzed stories into market events: several
+// differently worded stories about one development ("China raises tariffs
+// on US chips", "Beijing hits American semiconductors with new levies").
+//
+// Stories already merge reposts of one headline. Events go further and link
+// stories that share tickers or entities and enough vocabulary in their
+// titles and summaries. Sharing a ticker alone is not enough: an iPhone
+// launch and an antitrust suit are both AAPL news but different events.
+package events
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/minhash"
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+const (
+	// Window is how far apart two linked stories may be
+	Window = 24 * time.Hour
+
+	// textOnly links stories whose wording alone is this similar
+	textOnly = 0.5
+	// withShared links stories sharing half their tickers and entities
+	// at this lower text similarity
+	withShared     = 0.2
+	sharedRequired = 0.5
+)
+
+// Member is one analyzed story within an event
+type Member struct {
+	NewsID      string    `json:"news_id"`
+	StoryID     string    `json:"story_id"`
+	AnalysisID  string    `json:"analysis_id"`
+	Title       string    `json:"title"`
+	Source      string    `json:"source"`
+	PublishedAt time.Time `json:"published_at"`
+	Sentiment   string    `json:"sentiment"`
+	Score       float64   `json:"score"`
+	Impact      string    `json:"impact"`
+	Summary     string    `json:"summary"`
+	Stocks      []string  `json:"stocks"`
+	Entities    []string  `json:"entities"`
+	Mentions    int       `json:"mentions"` // news items in the story
+
+	Analysis *storage.Analysis `json:"-"`
+	News     *storage.NewsItem `json:"-"`
+
+	words map[string]struct{}
+	keys  map[string]struct{}
+}
+
+// Event is a cluster of stories about one development
+type Event struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	FirstSeenAt  time.Time `json:"first_seen_at"`
+	LastSeenAt   time.Time `json:"last_seen_at"`
+	Stocks       []string  `json:"stocks"`
+	Entities     []string  `json:"entities"`
+	Sentiment    string    `json:"sentiment"` // positive, negative, neutral or mixed
+	AvgScore     float64   `json:"avg_score"`
+	Positive     int       `json:"positive_count"`
+	Negative     int       `json:"negative_count"`
+	Neutral      int       `json:"neutral_count"`
+	StoryCount   int       `json:"story_count"`
+	MentionCount int       `json:"mention_count"` // news items across all stories
+	Velocity     float64   `json:"velocity"`      // mentions per hour since first seen
+	Members      []Member  `json:"members"`
+}
+
+// NewMember builds the member for analysis a of news item n. story may be
+// nil for news collected before stories existed.
+func NewMember(a *storage.Analysis, n *storage.NewsItem, story *storage.Story) Member {
+	m := Member{
+		NewsID:     a.NewsID,
+		AnalysisID: a.ID,
+		Sentiment:  a.Sentiment,
+		Score:      a.SentimentScore,
+		Impact:     a.ImpactLevel,
+		Summary:    a.Summary,
+		Stocks:     a.RelatedStocks,
+		Entities:   a.Entities,
+		Mentions:   1,
+		Analysis:   a,
+		News:       n,
+	}
+	if n != nil {
+		m.StoryID = n.StoryID
+		m.Title = n.Title
+		if m.Title == "" {
+			m.Title = truncate(strings.SplitN(n.Content, "\n", 2)[0], 200)
+		}
+		m.Source = n.Source
+		m.PublishedAt = n.PublishedAt
+	}
+	if m.PublishedAt.IsZero() {
+		m.PublishedAt = a.AnalyzedAt
+	}
+	if story != nil && story.MentionCount > 0 {
+		m.Mentions = story.MentionCount
+		if story.FirstSeenAt.Before(m.PublishedAt) && !story.FirstSeenAt.IsZero() {
+			m.PublishedAt = story.FirstSeenAt
+		}
+	}
+	return m
+}
+
+// Load builds members from up to limit analyses made in [since, until)
+func Load(store storage.Store, since, until time.Time, limit int) ([]Member, error) {
+	analyses, _, err := store.ListAnalysis(since, until, "", limit, 0)
+	if err != nil {
+		return nil, err
+	}
+	return Members(store, analyses)
+}
+
+// Members builds a member for each of analyses, looking up news and stories
+func Members(store storage.Store, analyses []storage.Analysis) ([]Member, error) {
+	members := make([]Member, 0, len(analyses))
+	for i := range analyses {
+		a := &analyses[i]
+		news, err := store.GetNews(a.NewsID)
+		if err != nil {
+			return nil, err
+		}
+		var story *storage.Story
+		if news != nil && news.StoryID != "" {
+			if story, err = store.GetStory(news.StoryID); err != nil {
+				return nil, err
+			}
+		}
+		members = append(members, NewMember(a, news, story))
+	}
+	return members, nil
+}
+
+// Cluster groups members into events, busiest first. now anchors velocity.
+func Cluster(members []Member, now time.Time) []Event {
+	ms := make([]Member, len(members))
+	copy(ms, members)
+	sort.SliceStable(ms, func(i, j int) bool { return ms[i].PublishedAt.Before(ms[j].PublishedAt) })
+	for i := range ms {
+		ms[i].words = minhash.Words(ms[i].Title + " " + ms[i].Summary)
+		ms[i].keys = make(map[string]struct{})
+		for _, s := range ms[i].Stocks {
+			ms[i].keys["$"+strings.ToUpper(s)] = struct{}{}
+		}
+		for _, e := range ms[i].Entities {
+			ms[i].keys[strings.ToLower(strings.TrimSpace(e))] = struct{}{}
+		}
+	}
+
+	// single-link: any linked pair puts two stories in one event
+	parent := make([]int, len(ms))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range ms {
+		for j := i + 1; j < len(ms); j++ {
+			if ms[j].PublishedAt.Sub(ms[i].PublishedAt) > Window {
+				break
+			}
+			if linked(&ms[i], &ms[j]) {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	groups := make(map[int][]Member)
+	var roots []int
+	for i := range ms {
+		r := find(i)
+		if _, ok := groups[r]; !ok {
+			roots = append(roots, r)
+		}
+		groups[r] = append(groups[r], ms[i])
+	}
+
+	events := make([]Event, 0, len(roots))
+	for _, r := range roots {
+		events = append(events, newEvent(groups[r], now))
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Velocity != events[j].Velocity {
+			return events[i].Velocity > events[j].Velocity
+		}
+		return events[i].LastSeenAt.After(events[j].LastSeenAt)
+	})
+	return events
+}
+
+// linked reports whether two stories are about the same development
+func linked(a, b *Member) bool {
+	text := jaccard(a.words, b.words)
+	if text >= textOnly {
+		return true
+	}
+	return text >= withShared && jaccard(a.keys, b.keys) >= sharedRequired
+}
+
+func jaccard(a, b map[string]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	inter := 0
+	for k := range a {
+		if _, ok := b[k]; ok {
+			inter++
+		}
+	}
+	return float64(inter) / float64(len(a)+len(b)-inter)
+}
+
+// newEvent aggregates members, which are sorted by first-seen time
+func newEvent(members []Member, now time.Time) Event {
+	e := Event{
+		ID:          "evt_" + members[0].AnalysisID,
+		FirstSeenAt: members[0].PublishedAt,
+		LastSeenAt:  members[len(members)-1].PublishedAt,
+		StoryCount:  len(members),
+		Members:     members,
+	}
+
+	stocks := make(map[string]int)
+	entities := make(map[string]int)
+	entityName := make(map[string]string)
+	var scoreSum float64
+	lead := 0
+	for i, m := range members {
+		e.MentionCount += m.Mentions
+		scoreSum += m.Score
+		switch m.Sentiment {
+		case "positive":
+			e.Positive++
+		case "negative":
+			e.Negative++
+		default:
+			e.Neutral++
+		}
+		for _, s := range m.Stocks {
+			stocks[s]++
+		}
+		for _, name := range m.Entities {
+			k := strings.ToLower(strings.TrimSpace(name))
+			if k == "" {
+				continue
+			}
+			if _, ok := entityName[k]; !ok {
+				entityName[k] = name
+			}
+			entities[k]++
+		}
+		if m.Mentions > members[lead].Mentions {
+			lead = i
+		}
+	}
+	// the most repeated story names the event
+	e.Title = members[lead].Title
+	e.AvgScore = scoreSum / float64(len(members))
+	e.Stocks = byCount(stocks, nil)
+	e.Entities = byCount(entities, entityName)
+
+	switch {
+	case e.Positive > 0 && e.Negative > 0 && e.Positive == e.Negative:
+		e.Sentiment = "mixed"
+	case e.Positive > e.Negative && e.Positive >= e.Neutral:
+		e.Sentiment = "positive"
+	case e.Negative > e.Positive && e.Negative >= e.Neutral:
+		e.Sentiment = "negative"
+	default:
+		e.Sentiment = "neutral"
+	}
+
+	hours := now.Sub(e.FirstSeenAt).Hours()
+	if hours < 1 {
+		hours = 1
+	}
+	e.Velocity = float64(e.MentionCount) / hours
+	return e
+}
+
+// byCount returns the keys of counts, most frequent first
+func byCount(counts map[string]int, names map[string]string) []string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if names != nil {
+		for i, k := range keys {
+			keys[i] = names[k]
+		}
+	}
+	return keys
+}
+
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
@@ -0,0 +1,80 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+func member(id, title, summary, sentiment string, at time.Time, mentions int, stocks, entities []string) Member {
+	return Member{
+		NewsID: id, AnalysisID: "a-" + id, Title: title, Summary: summary,
+		Sentiment: sentiment, PublishedAt: at, Mentions: mentions,
+		Stocks: stocks, Entities: entities,
+	}
+}
+
+func TestCluster(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	members := []Member{
+		member("t1", "China announces new tariffs on US semiconductors",
+			"China imposes tariffs on US chips, negative for chipmakers exposed to China",
+			"negative", now.Add(-3*time.Hour), 5, []string{"NVDA", "AMD"}, []string{"China", "US"}),
+		member("t2", "Beijing hits American chipmakers with 25% levies",
+			"New China tariffs on US chips raise costs for chipmakers",
+			"negative", now.Add(-2*time.Hour), 3, []string{"NVDA", "AMD"}, []string{"china", "US"}),
+		member("t3", "Nvidia says China tariffs will have limited impact",
+			"Nvidia downplays the impact of the new China tariffs on US chips",
+			"positive", now.Add(-time.Hour), 1, []string{"NVDA"}, []string{"Nvidia", "China", "US"}),
+		// same ticker, different development
+		member("a1", "Apple unveils iPhone 17 with longer battery life",
+			"Apple launches new iPhone lineup, positive for upgrade cycle",
+			"positive", now.Add(-2*time.Hour), 2, []string{"AAPL"}, []string{"Apple"}),
+		member("a2", "DOJ sues Apple over App Store monopoly",
+			"Justice Department antitrust suit raises regulatory risk for Apple",
+			"negative", now.Add(-time.Hour), 2, []string{"AAPL"}, []string{"Apple", "DOJ"}),
+		// same wording, but two days earlier: a different round of tariffs
+		member("old", "China announces new tariffs on US semiconductors",
+			"China imposes tariffs on US chips, negative for chipmakers exposed to China",
+			"negative", now.Add(-50*time.Hour), 1, []string{"NVDA"}, []string{"China", "US"}),
+	}
+
+	events := Cluster(members, now)
+	if len(events) != 4 {
+		for _, e := range events {
+			t.Logf("%s: %d stories", e.Title, e.StoryCount)
+		}
+		t.Fatalf("events = %d, want 4", len(events))
+	}
+
+	tariffs := events[0]
+	if tariffs.StoryCount != 3 || tariffs.MentionCount != 9 {
+		t.Fatalf("busiest event = %+v, want the three tariff stories", tariffs)
+	}
+	if tariffs.ID != "evt_a-t1" || tariffs.Title != members[0].Title || !tariffs.FirstSeenAt.Equal(now.Add(-3*time.Hour)) {
+		t.Errorf("tariff event = %s %q first seen %v", tariffs.ID, tariffs.Title, tariffs.FirstSeenAt)
+	}
+	if tariffs.Sentiment != "negative" || tariffs.Negative != 2 || tariffs.Positive != 1 {
+		t.Errorf("tariff sentiment = %s (+%d -%d)", tariffs.Sentiment, tariffs.Positive, tariffs.Negative)
+	}
+	if tariffs.Velocity != 3 {
+		t.Errorf("velocity = %v, want 9 mentions over 3h", tariffs.Velocity)
+	}
+	if len(tariffs.Stocks) != 2 || tariffs.Stocks[0] != "NVDA" {
+		t.Errorf("stocks = %v, want NVDA first", tariffs.Stocks)
+	}
+	if len(tariffs.Entities) != 3 || tariffs.Entities[0] != "China" {
+		t.Errorf("entities = %v, want China first in its first spelling", tariffs.Entities)
+	}
+
+	for _, e := range events[1:] {
+		if e.StoryCount != 1 {
+			t.Errorf("event %q has %d stories, want 1", e.Title, e.StoryCount)
+		}
+	}
+}
+
+func TestClusterEmpty(t *testing.T) {
+	if events := Cluster(nil, time.Now()); len(events) != 0 {
+		t.Errorf("events = %v", events)
+	}
+}
@@ -0,0 +1,244 @@
+// Package importer loads historical news from JSONL, CSV and RSS/Atom dump
+// files into storage, e.g. to backfill months of headlines for backtesting.
+package importer
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+// Input formats
+const (
+	FormatAuto  = "auto"
+	FormatJSONL = "jsonl"
+	FormatCSV   = "csv"
+	FormatRSS   = "rss"
+)
+
+// Fields are the NewsItem fields a mapping can target
+var Fields = []string{"title", "content", "url", "author", "source_id", "published_at", "source"}
+
+// defaultAliases are tried, in order, for fields without an explicit mapping
+var defaultAliases = map[string][]string{
+	"title":        {"title", "headline"},
+	"content":      {"content", "body", "text", "description", "summary"},
+	"url":          {"url", "link"},
+	"author":       {"author", "by", "user"},
+	"source_id":    {"source_id", "id", "guid"},
+	"published_at": {"published_at", "published", "pubDate", "date", "datetime", "timestamp", "created_at", "time"},
+	"source":       {"source"},
+}
+
+// Options controls how records become NewsItems
+type Options struct {
+	Format     string            // jsonl, csv, rss or auto (by file extension)
+	Source     string            // NewsItem.Source for rows without a mapped source
+	Mapping    map[string]string // field -> input column or dotted JSON path
+	TimeFormat string            // Go layout for published_at, tried before the defaults
+	Analyze    bool              // leave rows unprocessed so the engine analyzes them
+	DryRun     bool              // parse and count without writing
+}
+
+// Stats reports the outcome of an import
+type Stats struct {
+	Read       int      `json:"read"`
+	Inserted   int      `json:"inserted"`
+	Duplicates int      `json:"duplicates"`
+	Skipped    int      `json:"skipped"`
+	Errors     []string `json:"errors,omitempty"` // first maxErrors problems
+}
+
+const (
+	batchSize = 500
+	maxErrors = 20
+)
+
+func (s *Stats) skip(format string, args ...interface{}) {
+	s.Skipped++
+	if len(s.Errors) < maxErrors {
+		s.Errors = append(s.Errors, fmt.Sprintf(format, args...))
+	}
+}
+
+// Add accumulates the stats of another file
+func (s *Stats) Add(o *Stats) {
+	s.Read += o.Read
+	s.Inserted += o.Inserted
+	s.Duplicates += o.Duplicates
+	s.Skipped += o.Skipped
+	for _, e := range o.Errors {
+		if len(s.Errors) < maxErrors {
+			s.Errors = append(s.Errors, e)
+		}
+	}
+}
+
+// ParseMapping parses "title=headline,published_at=meta.date"
+func ParseMapping(s string) (map[string]string, error) {
+	m := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		field, column, ok := strings.Cut(pair, "=")
+		if !ok || column == "" {
+			return nil, fmt.Errorf("invalid mapping %q, want field=column", pair)
+		}
+		m[strings.TrimSpace(field)] = strings.TrimSpace(column)
+	}
+	return m, validateMapping(m)
+}
+
+func validateMapping(m map[string]string) error {
+	for field := range m {
+		if _, ok := defaultAliases[field]; !ok {
+			return fmt.Errorf("unknown field %q in mapping (%s)", field, strings.Join(Fields, ", "))
+		}
+	}
+	return nil
+}
+
+// DetectFormat guesses the format from the file name, ignoring .gz
+func DetectFormat(path string) (string, error) {
+	name := strings.TrimSuffix(strings.ToLower(path), ".gz")
+	switch filepath.Ext(name) {
+	case ".jsonl", ".ndjson", ".json":
+		return FormatJSONL, nil
+	case ".csv":
+		return FormatCSV, nil
+	case ".xml", ".rss", ".atom":
+		return FormatRSS, nil
+	}
+	return "", fmt.Errorf("cannot detect format of %s, use --format", path)
+}
+
+// ImportFile imports one file; .gz files are decompressed transparently
+func ImportFile(ctx context.Context, store storage.Store, path string, opts Options) (*Stats, error) {
+	if opts.Format == "" || opts.Format == FormatAuto {
+		format, err := DetectFormat(path)
+		if err != nil {
+			return nil, err
+		}
+		opts.Format = format
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = bufio.NewReader(f)
+	if strings.HasSuffix(strings.ToLower(path), ".gz") {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	return Import(ctx, store, r, opts)
+}
+
+// Import reads records from r and saves them in batches. Rows whose ID
+// already exists are counted as duplicates, so re-running an import is safe.
+func Import(ctx context.Context, store storage.Store, r io.Reader, opts Options) (*Stats, error) {
+	if err := validateMapping(opts.Mapping); err != nil {
+		return nil, err
+	}
+	if opts.Source == "" {
+		opts.Source = "import"
+	}
+
+	stats := &Stats{}
+	batch := make([]storage.NewsItem, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if !opts.DryRun {
+			n, err := store.SaveNewsBatch(batch)
+			if err != nil {
+				return err
+			}
+			stats.Inserted += n
+			stats.Duplicates += len(batch) - n
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	emit := func(item storage.NewsItem) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		batch = append(batch, item)
+		if len(batch) == batchSize {
+			return flush()
+		}
+		return nil
+	}
+
+	var err error
+	switch opts.Format {
+	case FormatJSONL:
+		err = readJSONL(r, opts, stats, emit)
+	case FormatCSV:
+		err = readCSV(r, opts, stats, emit)
+	case FormatRSS:
+		err = readRSS(r, opts, stats, emit)
+	default:
+		err = fmt.Errorf("unknown format %q (jsonl, csv, rss)", opts.Format)
+	}
+	if err != nil {
+		return stats, err
+	}
+	return stats, flush()
+}
+
+// timeLayouts are tried after Options.TimeFormat
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC1123Z,
+	time.RFC1123,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"01/02/2006 15:04",
+	"01/02/2006",
+}
+
+func parseTime(s, layout string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if layout != "" {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	for _, l := range timeLayouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return t, nil
+		}
+	}
+	// unix seconds or milliseconds
+	var n int64
+	if _, err := fmt.Sscanf(s, "%d", &n); err == nil && fmt.Sprint(n) == s {
+		if n > 1e12 {
+			return time.UnixMilli(n), nil
+		}
+		return time.Unix(n, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time %q", s)
+}
@@ -0,0 +1,223 @@
+package importer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/collector"
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+func newTestStore(t *testing.T) *storage.Storage {
+	t.Helper()
+	s, err := storage.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestImportJSONLMapping(t *testing.T) {
+	store := newTestStore(t)
+	input := `{"headline":"NVDA beats estimates","body":"Revenue up","meta":{"date":"2025-03-10T15:00:00Z"},"link":"https://a.example/1"}
+{"headline":"TSLA recalls cars","body":"Recall","meta":{"date":1741618800},"link":"https://a.example/2"}
+
+{"headline":"","body":"","meta":{"date":"2025-03-10"}}
+not json
+`
+	mapping, err := ParseMapping("title=headline, published_at=meta.date")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{Format: FormatJSONL, Source: "dump", Mapping: mapping}
+
+	stats, err := Import(context.Background(), store, strings.NewReader(input), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Read != 4 || stats.Inserted != 2 || stats.Skipped != 2 || len(stats.Errors) != 2 {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	id := collector.GenerateID("rss", "https://a.example/1"+"NVDA beats estimates")
+	got, err := store.GetNews(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Source != "dump" || got.Content != "Revenue up" || got.Processed != 1 {
+		t.Errorf("news = %+v", got)
+	}
+	if !got.PublishedAt.Equal(time.Date(2025, 3, 10, 15, 0, 0, 0, time.UTC)) {
+		t.Errorf("published_at = %v", got.PublishedAt)
+	}
+
+	// re-running the same dump only finds duplicates
+	stats, err = Import(context.Background(), store, strings.NewReader(input), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Inserted != 0 || stats.Duplicates != 2 {
+		t.Errorf("second run stats = %+v", stats)
+	}
+}
+
+func TestImportFileIDsIgnoreFileName(t *testing.T) {
+	store := newTestStore(t)
+	live := &storage.NewsItem{ID: collector.GenerateID("rss", "https://a.example/1NVDA beats estimates"),
+		Source: "rss:Wire", Title: "NVDA beats estimates", PublishedAt: time.Now(), CollectedAt: time.Now()}
+	if err := store.SaveNews(live); err != nil {
+		t.Fatal(err)
+	}
+
+	input := `{"title":"NVDA beats estimates","url":"https://a.example/1","date":"2025-03-10"}
+{"title":"TSLA recalls cars","id":"42","date":"2025-03-10"}
+{"title":"Fed holds rates","date":"2025-03-10"}
+`
+	dir := t.TempDir()
+	var inserted, duplicates int
+	for _, name := range []string{"dump-2025-03.jsonl", "dump-copy.jsonl"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(input), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		stats, err := ImportFile(context.Background(), store, path, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		inserted += stats.Inserted
+		duplicates += stats.Duplicates
+	}
+	// the collected article is skipped, the rest only land once
+	if inserted != 2 || duplicates != 4 {
+		t.Errorf("inserted %d, duplicates %d; want 2, 4", inserted, duplicates)
+	}
+}
+
+func TestImportJSONArray(t *testing.T) {
+	store := newTestStore(t)
+	input := ` [{"title":"A","published":"2025-03-10 09:30:00"},{"title":"B"}]`
+
+	stats, err := Import(context.Background(), store, strings.NewReader(input), Options{Format: FormatJSONL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Read != 2 || stats.Inserted != 1 || stats.Skipped != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestImportCSVAnalyze(t *testing.T) {
+	store := newTestStore(t)
+	input := "\ufeffID,Title,Text,PubDate,Source\n" +
+		"1,\"Apple, Inc. guidance\",Quote,2025-03-10,twitter\n" +
+		"2,Fed holds rates,,03/11/2025 14:00,\n" +
+		"3,Bad date,x,yesterday,\n"
+
+	stats, err := Import(context.Background(), store, strings.NewReader(input),
+		Options{Format: FormatCSV, Source: "csvdump", Analyze: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Read != 3 || stats.Inserted != 2 || stats.Skipped != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+
+	unprocessed, err := store.GetUnprocessedNews(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unprocessed) != 2 {
+		t.Fatalf("unprocessed = %d, want 2", len(unprocessed))
+	}
+	sources := map[string]string{}
+	for _, n := range unprocessed {
+		sources[n.SourceID] = n.Source
+	}
+	if sources["1"] != "twitter" || sources["2"] != "csvdump" {
+		t.Errorf("sources = %v", sources)
+	}
+}
+
+func TestImportRSS(t *testing.T) {
+	store := newTestStore(t)
+	input := `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>Wire</title>
+<item><title>Chip stocks rally</title><link>https://w.example/1</link><guid>g1</guid>
+<pubDate>Mon, 10 Mar 2025 15:00:00 +0000</pubDate><description>Semis up</description></item>
+<item><title>Undated</title><link>https://w.example/2</link></item>
+</channel></rss>`
+
+	stats, err := Import(context.Background(), store, strings.NewReader(input), Options{Format: FormatRSS, Source: "rss"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Read != 2 || stats.Inserted != 1 || stats.Skipped != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	got, err := store.GetNews(collector.GenerateID("rss", "https://w.example/1Chip stocks rally"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Author != "Wire" || got.SourceID != "g1" {
+		t.Errorf("news = %+v", got)
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+	store := newTestStore(t)
+	input := `{"title":"A","date":"2025-03-10"}`
+
+	stats, err := Import(context.Background(), store, strings.NewReader(input), Options{Format: FormatJSONL, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Read != 1 || stats.Inserted != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if _, total, _ := store.ListNews(time.Time{}, time.Time{}, "", 10, 0); total != 0 {
+		t.Errorf("dry run wrote %d rows", total)
+	}
+}
+
+func TestParseMapping(t *testing.T) {
+	if _, err := ParseMapping("title"); err == nil {
+		t.Error("expected error for missing column")
+	}
+	if _, err := ParseMapping("headline=title"); err == nil {
+		t.Error("expected error for unknown field")
+	}
+	if f, err := DetectFormat("dump/2024.JSONL.gz"); err != nil || f != FormatJSONL {
+		t.Errorf("DetectFormat = %q, %v", f, err)
+	}
+}
+
+func TestImportSurvivesPrune(t *testing.T) {
+	store := newTestStore(t)
+	input := `{"title":"NVDA beats estimates","published_at":"2024-11-20T21:05:00Z"}`
+	if _, err := Import(context.Background(), store, strings.NewReader(input), Options{Format: FormatJSONL, Source: "dump"}); err != nil {
+		t.Fatal(err)
+	}
+	collected := &storage.NewsItem{ID: "live", Source: "rss:Reuters", Title: "TSLA recalls cars", PublishedAt: time.Now(), CollectedAt: time.Now()}
+	if err := store.SaveNews(collected); err != nil {
+		t.Fatal(err)
+	}
+
+	// neither has an analysis; only the collected item is pruned
+	time.Sleep(10 * time.Millisecond)
+	results, err := store.Prune([]storage.RetentionRule{{Name: "unanalyzed_news", MaxAge: time.Millisecond}}, false)
+	if err != nil || len(results) != 1 || results[0].Rows != 1 {
+		t.Fatalf("Prune = %+v, %v", results, err)
+	}
+	if n, _ := store.GetNews("live"); n != nil {
+		t.Error("collected news survived")
+	}
+	items, _, _ := store.ListNews(time.Time{}, time.Time{}, "dump", 10, 0)
+	if len(items) != 1 || !items[0].Imported {
+		t.Errorf("imported news = %+v", items)
+	}
+}
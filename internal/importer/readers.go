@@ -0,0 +1,299 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	"github.com/chenzhiguo/market-sentinel/internal/collector"
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+// record looks up a raw input value by column name or dotted JSON path
+type record func(key string) (string, bool)
+
+func processedFlag(opts Options) int {
+	if opts.Analyze {
+		return 0
+	}
+	return 1
+}
+
+// buildItem maps one record to a NewsItem. The ID never depends on the file
+// name, so the same row imported twice is a duplicate: rows with a URL get
+// the live RSS collector's ID (link + title), so articles it already
+// collected are skipped too; otherwise the ID is GenerateID over the source
+// and its source_id, or the title or content.
+func buildItem(rec record, opts Options) (storage.NewsItem, error) {
+	get := func(field string) string {
+		if col, ok := opts.Mapping[field]; ok {
+			v, _ := rec(col)
+			return strings.TrimSpace(v)
+		}
+		for _, alias := range defaultAliases[field] {
+			if v, ok := rec(alias); ok && strings.TrimSpace(v) != "" {
+				return strings.TrimSpace(v)
+			}
+		}
+		return ""
+	}
+
+	title, content := get("title"), get("content")
+	if title == "" && content == "" {
+		return storage.NewsItem{}, errors.New("no title or content")
+	}
+	published := get("published_at")
+	if published == "" {
+		return storage.NewsItem{}, errors.New("no published_at")
+	}
+	publishedAt, err := parseTime(published, opts.TimeFormat)
+	if err != nil {
+		return storage.NewsItem{}, err
+	}
+
+	source := get("source")
+	if source == "" {
+		source = opts.Source
+	}
+	sourceID, url := get("source_id"), get("url")
+	var id string
+	switch {
+	case url != "":
+		id = collector.GenerateID("rss", url+title)
+	case sourceID != "":
+		id = collector.GenerateID(source, sourceID)
+	case title != "":
+		id = collector.GenerateID(source, title)
+	default:
+		id = collector.GenerateID(source, content)
+	}
+
+	return storage.NewsItem{
+		ID:          id,
+		Source:      source,
+		SourceID:    sourceID,
+		Author:      get("author"),
+		Title:       title,
+		Content:     collector.CleanContent(content),
+		URL:         url,
+		PublishedAt: publishedAt,
+		CollectedAt: time.Now(),
+		Processed:   processedFlag(opts),
+		Imported:    true,
+	}, nil
+}
+
+// readJSONL accepts one object per line, or a single top-level array
+func readJSONL(r io.Reader, opts Options, stats *Stats, emit func(storage.NewsItem) error) error {
+	br := bufio.NewReader(r)
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return nil // empty input
+		}
+		if b[0] == ' ' || b[0] == '\t' || b[0] == '\r' || b[0] == '\n' {
+			br.ReadByte()
+			continue
+		}
+		if b[0] == '[' {
+			return readJSONArray(br, opts, stats, emit)
+		}
+		break
+	}
+
+	sc := bufio.NewScanner(br)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		stats.Read++
+		obj, err := decodeObject([]byte(text))
+		if err != nil {
+			stats.skip("line %d: %v", line, err)
+			continue
+		}
+		item, err := buildItem(jsonRecord(obj), opts)
+		if err != nil {
+			stats.skip("line %d: %v", line, err)
+			continue
+		}
+		if err := emit(item); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+func readJSONArray(r io.Reader, opts Options, stats *Stats, emit func(storage.NewsItem) error) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if _, err := dec.Token(); err != nil { // [
+		return err
+	}
+	for i := 1; dec.More(); i++ {
+		stats.Read++
+		var obj map[string]interface{}
+		if err := dec.Decode(&obj); err != nil {
+			return fmt.Errorf("element %d: %w", i, err)
+		}
+		item, err := buildItem(jsonRecord(obj), opts)
+		if err != nil {
+			stats.skip("element %d: %v", i, err)
+			continue
+		}
+		if err := emit(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeObject(data []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var obj map[string]interface{}
+	if err := dec.Decode(&obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// jsonRecord resolves dotted paths like "meta.published" into nested objects
+func jsonRecord(obj map[string]interface{}) record {
+	return func(key string) (string, bool) {
+		var cur interface{} = obj
+		for _, part := range strings.Split(key, ".") {
+			m, ok := cur.(map[string]interface{})
+			if !ok {
+				return "", false
+			}
+			if cur, ok = m[part]; !ok {
+				return "", false
+			}
+		}
+		switch v := cur.(type) {
+		case nil:
+			return "", false
+		case string:
+			return v, true
+		case json.Number:
+			return v.String(), true
+		case bool:
+			return fmt.Sprint(v), true
+		default:
+			b, _ := json.Marshal(v)
+			return string(b), true
+		}
+	}
+}
+
+// readCSV requires a header row; column names match case-insensitively
+func readCSV(r io.Reader, opts Options, stats *Stats, emit func(storage.NewsItem) error) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		columns[h] = i
+	}
+
+	for n := 1; ; n++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		stats.Read++
+		if err != nil {
+			stats.skip("row %d: %v", n, err)
+			continue
+		}
+		rec := func(key string) (string, bool) {
+			i, ok := columns[strings.ToLower(key)]
+			if !ok || i >= len(row) {
+				return "", false
+			}
+			return row[i], true
+		}
+		item, err := buildItem(rec, opts)
+		if err != nil {
+			stats.skip("row %d: %v", n, err)
+			continue
+		}
+		if err := emit(item); err != nil {
+			return err
+		}
+	}
+}
+
+// readRSS imports a saved RSS/Atom feed. IDs match the live RSS collector,
+// so items it already collected are skipped as duplicates.
+func readRSS(r io.Reader, opts Options, stats *Stats, emit func(storage.NewsItem) error) error {
+	feed, err := gofeed.NewParser().Parse(r)
+	if err != nil {
+		return err
+	}
+
+	for i, it := range feed.Items {
+		stats.Read++
+		published := it.PublishedParsed
+		if published == nil {
+			published = it.UpdatedParsed
+		}
+		if published == nil {
+			stats.skip("item %d: no publish date", i+1)
+			continue
+		}
+		if it.Title == "" && it.Description == "" && it.Content == "" {
+			stats.skip("item %d: no title or content", i+1)
+			continue
+		}
+
+		content := it.Description
+		if it.Content != "" {
+			content = it.Content
+		}
+		author := feed.Title
+		if it.Author != nil && it.Author.Name != "" {
+			author = it.Author.Name
+		}
+
+		err := emit(storage.NewsItem{
+			ID:          collector.GenerateID("rss", it.Link+it.Title),
+			Source:      opts.Source,
+			SourceID:    it.GUID,
+			Author:      author,
+			Title:       it.Title,
+			Content:     collector.CleanContent(content),
+			URL:         it.Link,
+			PublishedAt: *published,
+			CollectedAt: time.Now(),
+			Processed:   processedFlag(opts),
+			Imported:    true,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
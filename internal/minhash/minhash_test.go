@@ -0,0 +1,76 @@
+package minhash
+
+import "testing"
+
+func TestSameStory(t *testing.T) {
+	base := "Nvidia shares jump after record data center revenue beats Wall Street estimates"
+	tests := []struct {
+		name string
+		text string
+		same bool
+	}{
+		{"identical", base, true},
+		{"case and punctuation", "NVIDIA shares jump after record data-center revenue beats Wall Street estimates!", true},
+		{"retweet with prefix and link", "RT @DeItaone: BREAKING: Nvidia shares jump after record data center revenue beats Wall Street estimates https://t.co/abc", true},
+		{"outlet suffix", "Nvidia shares jump after record data center revenue beats estimates - Bloomberg", true},
+		{"unrelated", "Federal Reserve holds rates steady and signals two cuts later this year", false},
+		{"same company, different story", "Nvidia shares fall as export restrictions on data center chips to China tighten", false},
+	}
+	sig, ok := Compute(base)
+	if !ok {
+		t.Fatal("base has no signature")
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			other, ok := Compute(tt.text)
+			if !ok {
+				t.Fatal("no signature")
+			}
+			sim := sig.Similarity(other)
+			if got := sim >= Threshold; got != tt.same {
+				t.Errorf("similarity = %.2f, same story = %v, want %v", sim, got, tt.same)
+			}
+			if tt.same && !sharesBand(sig, other) {
+				t.Error("same story shares no band key")
+			}
+		})
+	}
+}
+
+func sharesBand(a, b Signature) bool {
+	ka, kb := a.BandKeys(), b.BandKeys()
+	for i := range ka {
+		if ka[i] == kb[i] {
+			return true
+		}
+	}
+	return false
+}
+
+func TestShortTextHasNoSignature(t *testing.T) {
+	for _, text := range []string{"", "$TSLA to the moon", "https://t.co/x @someone lol"} {
+		if _, ok := Compute(text); ok {
+			t.Errorf("Compute(%q) returned a signature", text)
+		}
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	sig, _ := Compute("Apple unveils new iPhone lineup with faster chips and longer battery life")
+	got, err := Parse(sig.String())
+	if err != nil || got != sig {
+		t.Fatalf("Parse(String()) = %v, %v", got, err)
+	}
+	if _, err := Parse("abcd"); err == nil {
+		t.Error("short signature accepted")
+	}
+}
+
+func TestWordsHan(t *testing.T) {
+	words := Words("英伟达 股价大涨 NVDA")
+	for _, w := range []string{"英", "伟", "达", "股", "价", "大", "涨", "nvda"} {
+		if _, ok := words[w]; !ok {
+			t.Errorf("missing %q in %v", w, words)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+)
+
+// Channel types
+const (
+	TypeTelegram = "telegram"
+	TypeSlack    = "slack"
+	TypeDiscord  = "discord"
+	TypeFeishu   = "feishu"
+	TypeDingTalk = "dingtalk"
+	TypeWeCom    = "wecom"
+)
+
+const telegramAPI = "https://api.telegram.org"
+
+// Sender delivers one rendered message to a chat service
+type Sender interface {
+	Send(ctx context.Context, text string) error
+}
+
+// newSender builds the Sender for cfg.Type, checking its required fields
+func newSender(cfg config.ChannelConfig, client *http.Client) (Sender, error) {
+	switch cfg.Type {
+	case TypeTelegram:
+		if cfg.Token == "" || cfg.ChatID == "" {
+			return nil, errors.New("telegram needs token and chat_id")
+		}
+		base := cfg.URL
+		if base == "" {
+			base = telegramAPI
+		}
+		return &telegram{client: client, base: strings.TrimSuffix(base, "/"), token: cfg.Token, chatID: cfg.ChatID}, nil
+	case TypeSlack, TypeDiscord, TypeFeishu, TypeDingTalk, TypeWeCom:
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("%s needs url", cfg.Type)
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %q", cfg.Type)
+	}
+
+	switch cfg.Type {
+	case TypeSlack:
+		return &slack{client: client, url: cfg.URL}, nil
+	case TypeDiscord:
+		return &discord{client: client, url: cfg.URL}, nil
+	case TypeFeishu:
+		return &feishu{client: client, url: cfg.URL, secret: cfg.Secret}, nil
+	case TypeDingTalk:
+		return &dingtalk{client: client, url: cfg.URL, secret: cfg.Secret}, nil
+	default:
+		return &wecom{client: client, url: cfg.URL}, nil
+	}
+}
+
+// telegram uses the Bot API sendMessage method
+type telegram struct {
+	client *http.Client
+	base   string
+	token  string
+	chatID string
+}
+
+func (t *telegram) Send(ctx context.Context, text string) error {
+	var resp struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	err := postJSON(ctx, t.client, t.base+"/bot"+t.token+"/sendMessage", map[string]interface{}{
+		"chat_id":                  t.chatID,
+		"text":                     truncateRunes(text, 4096),
+		"disable_web_page_preview": true,
+	}, &resp)
+	if err != nil {
+		return err
+	}
+	if !resp.OK {
+		return fmt.Errorf("telegram: %s", resp.Description)
+	}
+	return nil
+}
+
+// slack posts to an incoming webhook, which answers "ok"
+type slack struct {
+	client *http.Client
+	url    string
+}
+
+func (s *slack) Send(ctx context.Context, text string) error {
+	return postJSON(ctx, s.client, s.url, map[string]string{"text": text}, nil)
+}
+
+// discord posts to a channel webhook, which answers 204
+type discord struct {
+	client *http.Client
+	url    string
+}
+
+func (d *discord) Send(ctx context.Context, text string) error {
+	return postJSON(ctx, d.client, d.url, map[string]string{"content": truncateRunes(text, 2000)}, nil)
+}
+
+// feishu posts to a group robot. With a secret the body carries a
+// timestamp and a signature keyed by "<timestamp>\n<secret>".
+type feishu struct {
+	client *http.Client
+	url    string
+	secret string
+}
+
+func (f *feishu) Send(ctx context.Context, text string) error {
+	body := map[string]interface{}{
+		"msg_type": "text",
+		"content":  map[string]string{"text": text},
+	}
+	if f.secret != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(ts+"\n"+f.secret))
+		body["timestamp"] = ts
+		body["sign"] = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+	var resp struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err := postJSON(ctx, f.client, f.url, body, &resp); err != nil {
+		return err
+	}
+	if resp.Code != 0 {
+		return fmt.Errorf("feishu: %d %s", resp.Code, resp.Msg)
+	}
+	return nil
+}
+
+// dingtalk posts to a group robot. With a secret the URL carries a
+// millisecond timestamp and the HMAC of "<timestamp>\n<secret>".
+type dingtalk struct {
+	client *http.Client
+	url    string
+	secret string
+}
+
+func (d *dingtalk) Send(ctx context.Context, text string) error {
+	target := d.url
+	if d.secret != "" {
+		ts := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		mac := hmac.New(sha256.New, []byte(d.secret))
+		mac.Write([]byte(ts + "\n" + d.secret))
+		sep := "?"
+		if strings.Contains(target, "?") {
+			sep = "&"
+		}
+		target += sep + "timestamp=" + ts + "&sign=" + url.QueryEscape(base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	}
+	return postRobot(ctx, d.client, target, "dingtalk", map[string]interface{}{
+		"msgtype": "text",
+		"text":    map[string]string{"content": text},
+	})
+}
+
+// wecom posts to a WeCom (企业微信) group robot
+type wecom struct {
+	client *http.Client
+	url    string
+}
+
+func (w *wecom) Send(ctx context.Context, text string) error {
+	return postRobot(ctx, w.client, w.url, "wecom", map[string]interface{}{
+		"msgtype": "text",
+		"text":    map[string]string{"content": truncateBytes(text, 2048)},
+	})
+}
+
+// postRobot posts to a DingTalk or WeCom robot, which report errors as a
+// non-zero errcode in a 200 response
+func postRobot(ctx context.Context, client *http.Client, target, name string, body interface{}) error {
+	var resp struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := postJSON(ctx, client, target, body, &resp); err != nil {
+		return err
+	}
+	if resp.ErrCode != 0 {
+		return fmt.Errorf("%s: %d %s", name, resp.ErrCode, resp.ErrMsg)
+	}
+	return nil
+}
+
+// postJSON sends body and decodes a JSON answer into out, if given. Errors
+// never include the URL: robot URLs and bot tokens are credentials.
+func postJSON(ctx context.Context, client *http.Client, target string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(data))
+	if err != nil {
+		return errors.New("invalid channel url")
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			err = ue.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, truncateRunes(string(bytes.TrimSpace(raw)), 200))
+	}
+	if out != nil && len(bytes.TrimSpace(raw)) > 0 {
+		if err := json.Unmarshal(raw, out); err != nil {
+			return fmt.Errorf("unexpected response: %s", truncateRunes(string(raw), 200))
+		}
+	}
+	return nil
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:n-1]) + "…"
+}
+
+// truncateBytes cuts s to at most n bytes without splitting a character
+func truncateBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	cut := n - len("…")
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + "…"
+}
@@ -0,0 +1,426 @@
+package notifier
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"net/mail"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+	"github.com/chenzhiguo/market-sentinel/internal/reporter"
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+const subjectPrefix = "[Market Sentinel] "
+
+// Mailer emails reports and alert digests. Reports go to the recipients of
+// their type; alerts are batched into a digest every cfg.DigestInterval.
+// Watchlist recipients get the same mail narrowed to their symbols.
+type Mailer struct {
+	cfg       config.EmailConfig
+	store     storage.Store
+	tlsConfig *tls.Config
+	now       func() time.Time
+	cursor    storage.Cursor // last alert digested
+
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+	isRunning bool
+	mu        sync.Mutex
+}
+
+// NewMailer checks the server settings and every recipient address
+func NewMailer(cfg config.EmailConfig, store storage.Store) (*Mailer, error) {
+	if cfg.Host == "" {
+		return nil, errors.New("email.host is required")
+	}
+	if _, err := mail.ParseAddress(cfg.From); err != nil {
+		return nil, fmt.Errorf("email.from: %w", err)
+	}
+	switch cfg.Security {
+	case "":
+		cfg.Security = SecuritySTARTTLS
+	case SecuritySTARTTLS, SecurityTLS, SecurityNone:
+	default:
+		return nil, fmt.Errorf("email.security: unknown mode %q", cfg.Security)
+	}
+	if cfg.Port == 0 {
+		cfg.Port = 587
+		if cfg.Security == SecurityTLS {
+			cfg.Port = 465
+		}
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.DigestInterval <= 0 {
+		cfg.DigestInterval = time.Hour
+	}
+
+	lists := map[string][]string{"email.digest": cfg.Digest}
+	for typ, to := range cfg.Reports {
+		lists["email.reports."+typ] = to
+	}
+	for i, wl := range cfg.Watchlists {
+		if wl.Name == "" || len(wl.Symbols) == 0 {
+			return nil, fmt.Errorf("email.watchlists[%d]: name and symbols are required", i)
+		}
+		lists["email.watchlists."+wl.Name] = wl.Recipients
+	}
+	for key, to := range lists {
+		for _, addr := range to {
+			if _, err := mail.ParseAddress(addr); err != nil {
+				return nil, fmt.Errorf("%s: %q: %w", key, addr, err)
+			}
+		}
+	}
+
+	m := &Mailer{
+		cfg:       cfg,
+		store:     store,
+		tlsConfig: &tls.Config{MinVersion: tls.VersionTLS12},
+		now:       time.Now,
+		stopCh:    make(chan struct{}),
+	}
+	m.cursor = storage.Cursor{Time: m.now()}
+	return m, nil
+}
+
+// SendReport mails report to the recipients of its type, and a copy narrowed
+// to each subscribed watchlist's symbols. Watchlists with nothing in the
+// report are skipped.
+func (m *Mailer) SendReport(report *reporter.ReportData) (int, error) {
+	var mails []message
+	if to := m.cfg.Reports[report.Type]; len(to) > 0 {
+		msg, err := renderReport(report, "")
+		if err != nil {
+			return 0, err
+		}
+		msg.to = to
+		mails = append(mails, msg)
+	}
+	for _, wl := range m.cfg.Watchlists {
+		if len(wl.Recipients) == 0 || !hasFold(wl.Reports, report.Type) {
+			continue
+		}
+		narrowed := narrowReport(report, wl.Symbols)
+		if len(narrowed.Highlights) == 0 && len(narrowed.StockSummary) == 0 {
+			continue
+		}
+		msg, err := renderReport(narrowed, wl.Name)
+		if err != nil {
+			return 0, err
+		}
+		msg.to = wl.Recipients
+		mails = append(mails, msg)
+	}
+	return m.deliver(mails)
+}
+
+// SendDigest mails alerts to the digest recipients, and to each watchlist
+// the alerts about its symbols
+func (m *Mailer) SendDigest(alerts []storage.Alert) (int, error) {
+	if len(alerts) == 0 {
+		return 0, nil
+	}
+	var mails []message
+	if len(m.cfg.Digest) > 0 {
+		msg, err := renderDigest(alerts, "", m.now())
+		if err != nil {
+			return 0, err
+		}
+		msg.to = m.cfg.Digest
+		mails = append(mails, msg)
+	}
+	for _, wl := range m.cfg.Watchlists {
+		if len(wl.Recipients) == 0 {
+			continue
+		}
+		var matched []storage.Alert
+		for _, a := range alerts {
+			if anyFold(wl.Symbols, a.Stocks) {
+				matched = append(matched, a)
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+		msg, err := renderDigest(matched, wl.Name, m.now())
+		if err != nil {
+			return 0, err
+		}
+		msg.to = wl.Recipients
+		mails = append(mails, msg)
+	}
+	return m.deliver(mails)
+}
+
+// deliver sends each mail, continuing past failures
+func (m *Mailer) deliver(mails []message) (int, error) {
+	sent := 0
+	var errs []error
+	for _, msg := range mails {
+		if err := m.sendMail(msg); err != nil {
+			errs = append(errs, fmt.Errorf("%q to %s: %w", msg.subject, strings.Join(msg.to, ", "), err))
+			continue
+		}
+		sent++
+	}
+	return sent, errors.Join(errs...)
+}
+
+// Start begins sending alert digests
+func (m *Mailer) Start() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.isRunning {
+		return
+	}
+	m.isRunning = true
+	m.stopCh = make(chan struct{})
+
+	log.Printf("Starting Mailer (alert digest every %s)", m.cfg.DigestInterval)
+
+	m.wg.Add(1)
+	go m.loop()
+}
+
+// Stop waits for the current digest and shuts down
+func (m *Mailer) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.isRunning {
+		return
+	}
+	close(m.stopCh)
+	m.isRunning = false
+	m.wg.Wait()
+	log.Println("Mailer stopped")
+}
+
+func (m *Mailer) loop() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.cfg.DigestInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		case <-ticker.C:
+			if _, err := m.RunDigest(); err != nil {
+				log.Printf("Mailer: %v", err)
+			}
+		}
+	}
+}
+
+// RunDigest mails the alerts created since the last digest. Alerts from the
+// last minute wait for the next one, so a slow commit is not skipped. When
+// every mail fails the alerts are kept for the next digest.
+func (m *Mailer) RunDigest() (int, error) {
+	until := m.now().Add(-queueLag)
+	var alerts []storage.Alert
+	c := m.cursor
+	for {
+		page, err := m.store.AlertsAfter(c, until, 500)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read alerts: %w", err)
+		}
+		alerts = append(alerts, page...)
+		if len(page) < 500 {
+			break
+		}
+		last := page[len(page)-1]
+		c = storage.Cursor{Time: last.CreatedAt, ID: last.ID}
+	}
+	if len(alerts) == 0 {
+		return 0, nil
+	}
+
+	sent, err := m.SendDigest(alerts)
+	if sent > 0 || err == nil {
+		last := alerts[len(alerts)-1]
+		m.cursor = storage.Cursor{Time: last.CreatedAt, ID: last.ID}
+	}
+	return sent, err
+}
+
+// narrowReport keeps the highlights and stock rows about symbols
+func narrowReport(report *reporter.ReportData, symbols []string) *reporter.ReportData {
+	out := *report
+	out.Highlights, out.StockSummary = nil, nil
+	for _, h := range report.Highlights {
+		for _, s := range h.Stocks {
+			if hasFold(symbols, s.Symbol) {
+				out.Highlights = append(out.Highlights, h)
+				break
+			}
+		}
+	}
+	for _, s := range report.StockSummary {
+		if hasFold(symbols, s.Symbol) {
+			out.StockSummary = append(out.StockSummary, s)
+		}
+	}
+	return &out
+}
+
+func anyFold(list, values []string) bool {
+	for _, v := range values {
+		if hasFold(list, v) {
+			return true
+		}
+	}
+	return false
+}
+
+var labels = map[string]string{
+	"bullish":          "看多",
+	"slightly_bullish": "偏多",
+	"neutral":          "中性",
+	"slightly_bearish": "偏空",
+	"bearish":          "看空",
+	"positive":         "利好",
+	"negative":         "利空",
+	"high":             "高",
+	"medium":           "中",
+	"low":              "低",
+	"critical":         "严重",
+}
+
+func label(s string) string {
+	if l, ok := labels[s]; ok {
+		return l
+	}
+	return s
+}
+
+var funcs = map[string]interface{}{
+	"label": label,
+	"time":  func(t time.Time) string { return t.Local().Format("2006-01-02 15:04") },
+	"stocks": func(items []storage.StockImpact) string {
+		var out []string
+		for _, s := range items {
+			out = append(out, s.Symbol)
+		}
+		return strings.Join(out, ", ")
+	},
+	"join": strings.Join,
+	"add":  func(a, b int) int { return a + b },
+}
+
+const reportText = `{{.R.Title}}{{with .Watchlist}}（{{.}}）{{end}}
+{{time .R.Period.Start}} — {{time .R.Period.End}}
+
+{{.R.Summary}}
+市场情绪：{{label .R.MarketMood.Overall}}（看多 {{.R.MarketMood.Bullish}} / 看空 {{.R.MarketMood.Bearish}} / 中性 {{.R.MarketMood.Neutral}}）
+{{if .R.Highlights}}
+重点事件
+{{range $i, $h := .R.Highlights}}{{add $i 1}}. [{{label $h.Impact}}·{{label $h.Sentiment}}] {{$h.EventTitle}}{{with stocks $h.Stocks}}（{{.}}）{{end}}
+   {{$h.Summary}}{{if gt $h.Stories 1}}（{{$h.Stories}} 条报道）{{end}}
+{{end}}{{end}}{{if .R.StockSummary}}
+个股情绪
+{{range .R.StockSummary}}{{printf "%-6s" .Symbol}} 提及 {{.MentionCount}}　均分 {{printf "%+.1f" .AvgScore}}　{{label .Sentiment}}
+{{end}}{{end}}`
+
+const reportHTML = `<!DOCTYPE html>
+<html><body style="font-family:sans-serif;color:#222">
+<h2>{{.R.Title}}{{with .Watchlist}}（{{.}}）{{end}}</h2>
+<p style="color:#888">{{time .R.Period.Start}} — {{time .R.Period.End}}</p>
+<p>{{.R.Summary}}</p>
+<p>市场情绪：<b>{{label .R.MarketMood.Overall}}</b>（看多 {{.R.MarketMood.Bullish}} / 看空 {{.R.MarketMood.Bearish}} / 中性 {{.R.MarketMood.Neutral}}）</p>
+{{if .R.Highlights}}<h3>重点事件</h3>
+<ol>{{range .R.Highlights}}
+<li><b>[{{label .Impact}}·{{label .Sentiment}}] {{.EventTitle}}</b>{{with stocks .Stocks}}（{{.}}）{{end}}<br>{{.Summary}}{{if gt .Stories 1}}（{{.Stories}} 条报道）{{end}}</li>{{end}}
+</ol>{{end}}
+{{if .R.StockSummary}}<h3>个股情绪</h3>
+<table cellpadding="4" style="border-collapse:collapse">
+<tr><th align="left">股票</th><th>提及</th><th>均分</th><th>情绪</th></tr>{{range .R.StockSummary}}
+<tr><td>{{.Symbol}}</td><td align="right">{{.MentionCount}}</td><td align="right">{{printf "%+.1f" .AvgScore}}</td><td>{{label .Sentiment}}</td></tr>{{end}}
+</table>{{end}}
+</body></html>`
+
+const digestText = `{{len .Alerts}} 条警报{{with .Watchlist}}（{{.}}）{{end}}
+
+{{range .Alerts}}[{{label .Severity}}] {{.Title}}{{with .Stocks}}（{{join . ", "}}）{{end}}
+{{time .CreatedAt}}{{with .Source}}　{{.}}{{end}}
+{{.Description}}{{with .URL}}
+原文：{{.}}{{end}}
+
+{{end}}`
+
+const digestHTML = `<!DOCTYPE html>
+<html><body style="font-family:sans-serif;color:#222">
+<h2>{{len .Alerts}} 条警报{{with .Watchlist}}（{{.}}）{{end}}</h2>
+{{range .Alerts}}<div style="margin-bottom:16px">
+<b>[{{label .Severity}}] {{.Title}}</b>{{with .Stocks}}（{{join . ", "}}）{{end}}<br>
+<span style="color:#888">{{time .CreatedAt}}{{with .Source}}　{{.}}{{end}}</span>
+<p style="white-space:pre-wrap;margin:4px 0">{{.Description}}</p>{{with .URL}}
+<a href="{{.}}">原文</a>{{end}}
+</div>{{end}}
+</body></html>`
+
+var (
+	reportTextTmpl = template.Must(template.New("report").Funcs(funcs).Parse(reportText))
+	reportHTMLTmpl = htmltemplate.Must(htmltemplate.New("report").Funcs(funcs).Parse(reportHTML))
+	digestTextTmpl = template.Must(template.New("digest").Funcs(funcs).Parse(digestText))
+	digestHTMLTmpl = htmltemplate.Must(htmltemplate.New("digest").Funcs(funcs).Parse(digestHTML))
+)
+
+func render(text *template.Template, html *htmltemplate.Template, data interface{}) (message, error) {
+	var t, h strings.Builder
+	if err := text.Execute(&t, data); err != nil {
+		return message{}, err
+	}
+	if err := html.Execute(&h, data); err != nil {
+		return message{}, err
+	}
+	return message{text: t.String(), html: h.String()}, nil
+}
+
+func renderReport(report *reporter.ReportData, watchlist string) (message, error) {
+	msg, err := render(reportTextTmpl, reportHTMLTmpl, struct {
+		R         *reporter.ReportData
+		Watchlist string
+	}{report, watchlist})
+	if err != nil {
+		return msg, err
+	}
+	msg.subject = subjectPrefix + report.Title + " " + report.GeneratedAt.Local().Format("2006-01-02")
+	if watchlist != "" {
+		msg.subject += " · " + watchlist
+	}
+	return msg, nil
+}
+
+func renderDigest(alerts []storage.Alert, watchlist string, now time.Time) (message, error) {
+	msg, err := render(digestTextTmpl, digestHTMLTmpl, struct {
+		Alerts    []storage.Alert
+		Watchlist string
+	}{alerts, watchlist})
+	if err != nil {
+		return msg, err
+	}
+	critical := 0
+	for _, a := range alerts {
+		if a.Severity == "critical" {
+			critical++
+		}
+	}
+	msg.subject = fmt.Sprintf("%s警报摘要 %s：%d 条", subjectPrefix, now.Local().Format("01-02 15:04"), len(alerts))
+	if critical > 0 {
+		msg.subject += fmt.Sprintf("（严重 %d）", critical)
+	}
+	if watchlist != "" {
+		msg.subject += " · " + watchlist
+	}
+	return msg, nil
+}
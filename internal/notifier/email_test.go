@@ -0,0 +1,347 @@
+package notifier
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+	"github.com/chenzhiguo/market-sentinel/internal/reporter"
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+// sinkMail is one message accepted by smtpSink
+type sinkMail struct {
+	from string
+	rcpt []string
+	data string
+	tls  bool
+	auth string // decoded AUTH PLAIN credentials
+}
+
+// smtpSink is a minimal SMTP server on localhost that offers STARTTLS and
+// AUTH PLAIN and keeps every message
+type smtpSink struct {
+	ln     net.Listener
+	tlsCfg *tls.Config
+	pool   *x509.CertPool
+
+	mu    sync.Mutex
+	mails []sinkMail
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpSink{
+		ln:     ln,
+		tlsCfg: &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}},
+		pool:   pool,
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *smtpSink) port() int { return s.ln.Addr().(*net.TCPAddr).Port }
+
+func (s *smtpSink) serve(conn net.Conn) {
+	defer conn.Close()
+	r, w := bufio.NewReader(conn), conn
+	reply := func(line string) { io.WriteString(w, line+"\r\n") }
+	var cur sinkMail
+
+	reply("220 localhost sink")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch verb {
+		case "EHLO":
+			reply("250-localhost")
+			if !cur.tls {
+				reply("250-STARTTLS")
+			}
+			reply("250 AUTH PLAIN")
+		case "STARTTLS":
+			reply("220 go ahead")
+			tc := tls.Server(conn, s.tlsCfg)
+			if err := tc.Handshake(); err != nil {
+				return
+			}
+			r, w = bufio.NewReader(tc), tc
+			cur.tls = true
+		case "AUTH":
+			raw, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "AUTH PLAIN "))
+			cur.auth = string(raw)
+			reply("235 ok")
+		case "MAIL":
+			cur.from = line[len("MAIL FROM:"):]
+			reply("250 ok")
+		case "RCPT":
+			cur.rcpt = append(cur.rcpt, line[len("RCPT TO:"):])
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var b strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				b.WriteString(strings.TrimPrefix(l, "."))
+			}
+			cur.data = b.String()
+			s.mu.Lock()
+			s.mails = append(s.mails, cur)
+			s.mu.Unlock()
+			cur = sinkMail{tls: cur.tls, auth: cur.auth}
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func (s *smtpSink) received() []sinkMail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]sinkMail(nil), s.mails...)
+}
+
+// parts decodes a multipart/alternative message into subject and bodies
+// by content type
+func parts(t *testing.T, data string) (string, map[string]string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q", msg.Header.Get("Content-Type"))
+	}
+	bodies := make(map[string]string)
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		typ, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		b, _ := io.ReadAll(p) // multipart.Reader undoes quoted-printable
+		bodies[typ] = string(b)
+	}
+	return subject, bodies
+}
+
+func newTestMailer(t *testing.T, sink *smtpSink, cfg config.EmailConfig, store storage.Store) *Mailer {
+	t.Helper()
+	cfg.Host, cfg.Port, cfg.From = "localhost", sink.port(), "Sentinel <sentinel@example.com>"
+	m, err := NewMailer(cfg, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.tlsConfig.RootCAs = sink.pool
+	return m
+}
+
+func TestSendReportToTypeAndWatchlists(t *testing.T) {
+	sink := newSMTPSink(t)
+	m := newTestMailer(t, sink, config.EmailConfig{
+		Username: "bot",
+		Password: "pw",
+		Reports:  map[string][]string{"daily_summary": {"desk@example.com", "pm@example.com"}},
+		Watchlists: []config.EmailWatchlist{
+			{Name: "半导体", Symbols: []string{"nvda", "AMD"}, Recipients: []string{"chips@example.com"}, Reports: []string{"daily_summary"}},
+			{Name: "Banks", Symbols: []string{"JPM"}, Recipients: []string{"banks@example.com"}, Reports: []string{"daily_summary"}},
+		},
+	}, nil)
+
+	report := &reporter.ReportData{
+		Type:        "daily_summary",
+		Title:       "每日舆情汇总",
+		GeneratedAt: time.Now(),
+		Summary:     "共分析 2 条信息",
+		MarketMood:  reporter.MarketMood{Overall: "slightly_bullish", Bullish: 1, Bearish: 1},
+		Highlights: []reporter.HighlightItem{
+			{EventTitle: "Nvidia <beats> estimates", Impact: "high", Sentiment: "positive", Summary: "数据中心收入创新高", Stories: 3, Stocks: []storage.StockImpact{{Symbol: "NVDA"}}},
+			{EventTitle: "Tesla recall", Impact: "medium", Sentiment: "negative", Summary: "召回", Stocks: []storage.StockImpact{{Symbol: "TSLA"}}},
+		},
+		StockSummary: []reporter.StockSummary{{Symbol: "NVDA", MentionCount: 3, AvgScore: 6, Sentiment: "bullish"}, {Symbol: "TSLA", MentionCount: 1, AvgScore: -4, Sentiment: "bearish"}},
+	}
+	sent, err := m.SendReport(report)
+	if err != nil || sent != 2 {
+		t.Fatalf("SendReport = %d, %v; want 2 mails (Banks has nothing)", sent, err)
+	}
+
+	mails := sink.received()
+	full, chips := mails[0], mails[1]
+	if !full.tls || full.auth != "\x00bot\x00pw" || full.from != "<sentinel@example.com>" {
+		t.Errorf("session = tls %v, auth %q, from %s", full.tls, full.auth, full.from)
+	}
+	if strings.Join(full.rcpt, " ") != "<desk@example.com> <pm@example.com>" {
+		t.Errorf("rcpt = %v", full.rcpt)
+	}
+	subject, bodies := parts(t, full.data)
+	if !strings.HasPrefix(subject, "[Market Sentinel] 每日舆情汇总 ") {
+		t.Errorf("subject = %q", subject)
+	}
+	if text := bodies["text/plain"]; !strings.Contains(text, "市场情绪：偏多") || !strings.Contains(text, "Tesla recall") ||
+		!strings.Contains(text, "（3 条报道）") {
+		t.Errorf("text body = %s", text)
+	}
+	if html := bodies["text/html"]; !strings.Contains(html, "Nvidia &lt;beats&gt; estimates") || !strings.Contains(html, "<td>TSLA</td>") {
+		t.Errorf("html body = %s", html)
+	}
+
+	subject, bodies = parts(t, chips.data)
+	if !strings.HasSuffix(subject, " · 半导体") || strings.Join(chips.rcpt, " ") != "<chips@example.com>" {
+		t.Errorf("watchlist mail = %q to %v", subject, chips.rcpt)
+	}
+	if text := bodies["text/plain"]; !strings.Contains(text, "Nvidia") || strings.Contains(text, "Tesla") || strings.Contains(text, "TSLA") {
+		t.Errorf("watchlist body not narrowed: %s", text)
+	}
+}
+
+func TestDigestBatchesNewAlerts(t *testing.T) {
+	store, err := storage.New(filepath.Join(t.TempDir(), "mail.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	sink := newSMTPSink(t)
+	m := newTestMailer(t, sink, config.EmailConfig{
+		Digest:     []string{"ops@example.com"},
+		Watchlists: []config.EmailWatchlist{{Name: "EV", Symbols: []string{"TSLA"}, Recipients: []string{"ev@example.com"}}},
+	}, store)
+	start := time.Now().Truncate(time.Second)
+	now := start
+	m.now = func() time.Time { return now }
+	m.cursor = storage.Cursor{Time: start}
+
+	for _, a := range []storage.Alert{
+		{ID: "al1", Title: "英伟达遭出口限制", Description: "line one\nline two", Severity: "critical", Stocks: []string{"NVDA"}, CreatedAt: start.Add(time.Second)},
+		{ID: "al2", Title: "特斯拉交付超预期", Severity: "high", Stocks: []string{"TSLA"}, CreatedAt: start.Add(2 * time.Second)},
+	} {
+		a := a
+		if err := store.SaveAlert(&a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// too fresh: left for the next digest
+	if sent, err := m.RunDigest(); sent != 0 || err != nil {
+		t.Fatalf("early digest = %d, %v", sent, err)
+	}
+	now = start.Add(2 * time.Minute)
+	if sent, err := m.RunDigest(); sent != 2 || err != nil {
+		t.Fatalf("digest = %d, %v", sent, err)
+	}
+	mails := sink.received()
+	subject, bodies := parts(t, mails[0].data)
+	if !strings.Contains(subject, "2 条（严重 1）") || !strings.Contains(bodies["text/plain"], "[严重] 英伟达遭出口限制（NVDA）") ||
+		!strings.Contains(bodies["text/plain"], "line one\r\nline two") {
+		t.Errorf("digest = %q\n%s", subject, bodies["text/plain"])
+	}
+	subject, bodies = parts(t, mails[1].data)
+	if !strings.Contains(subject, "1 条") || !strings.HasSuffix(subject, " · EV") || strings.Contains(bodies["text/plain"], "英伟达") {
+		t.Errorf("watchlist digest = %q\n%s", subject, bodies["text/plain"])
+	}
+
+	if sent, _ := m.RunDigest(); sent != 0 || len(sink.received()) != 2 {
+		t.Error("alerts digested twice")
+	}
+}
+
+func TestSTARTTLSRequired(t *testing.T) {
+	sink := newSMTPSink(t)
+	m := newTestMailer(t, sink, config.EmailConfig{Digest: []string{"ops@example.com"}}, nil)
+	m.tlsConfig.RootCAs = nil // the sink's certificate is no longer trusted
+
+	if _, err := m.SendDigest([]storage.Alert{{ID: "al1", Title: "t"}}); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("untrusted STARTTLS err = %v", err)
+	}
+	if len(sink.received()) != 0 {
+		t.Error("mail sent over an unverified connection")
+	}
+}
+
+func TestNewMailerValidates(t *testing.T) {
+	for _, cfg := range []config.EmailConfig{
+		{From: "a@example.com"},
+		{Host: "smtp.example.com", From: "not an address"},
+		{Host: "smtp.example.com", From: "a@example.com", Security: "ssl3"},
+		{Host: "smtp.example.com", From: "a@example.com", Reports: map[string][]string{"daily_summary": {"bad"}}},
+		{Host: "smtp.example.com", From: "a@example.com", Watchlists: []config.EmailWatchlist{{Name: "x"}}},
+	} {
+		if _, err := NewMailer(cfg, nil); err == nil {
+			t.Errorf("NewMailer(%+v) accepted", cfg)
+		}
+	}
+}
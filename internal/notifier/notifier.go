@@ -0,0 +1,385 @@
+// Package notifier sends alerts to chat channels: Telegram bots, Slack and
+// Discord incoming webhooks, and Feishu, DingTalk and WeCom group robots.
+//
+// Each configured channel has routes (severities, symbols, alert kinds), a
+// message template and a rate limit. The Notifier follows new alerts and
+// queues a storage.Notification for every channel that routes them, then
+// sends due notifications with retries. The queued rows double as the
+// delivery status shown by GET /api/v1/notifications.
+//
+// The Mailer sends reports and batched alert digests over SMTP.
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+	"github.com/chenzhiguo/market-sentinel/internal/ratelimit"
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+const (
+	// DefaultRateLimit is messages per minute when a channel sets none;
+	// DingTalk robots accept 20
+	DefaultRateLimit = 20
+
+	// queueLag re-reads alerts this far behind the cursor: an alert stamped
+	// before a slow commit becomes visible late
+	queueLag = time.Minute
+
+	batchSize  = 50
+	maxBackoff = time.Hour
+)
+
+// DefaultTemplate renders the alert's (Chinese) title, level, symbols,
+// description and a link to the source
+const DefaultTemplate = `{{.Alert.Title}}
+级别：{{.Level}}{{if .Alert.Escalations}}（已升级）{{end}}{{with .Symbols}}　股票：{{.}}{{end}}{{with .Source}}　来源：{{.}}{{end}}{{with .Alert.Updates}}　后续报道：{{.}} 条{{end}}
+
+{{.Alert.Description}}{{with .URL}}
+
+原文：{{.}}{{end}}`
+
+// Message is the data a channel template renders
+type Message struct {
+	Alert   storage.Alert
+	Level   string // localized severity
+	Symbols string // comma-separated stocks
+	Source  string // source of the alert's news item
+	URL     string // link to the news item
+}
+
+// channel is a configured destination
+type channel struct {
+	name   string
+	sender Sender
+	route  config.ChannelConfig
+	tmpl   *template.Template
+	bucket *ratelimit.Bucket
+}
+
+// matches reports whether a goes to c. Channels picked by the alert's rule
+// take precedence over the route.
+func (c *channel) matches(a *storage.Alert) bool {
+	if len(a.Channels) > 0 {
+		return hasFold(a.Channels, c.name)
+	}
+	if len(c.route.Severities) > 0 && !hasFold(c.route.Severities, a.Severity) {
+		return false
+	}
+	if len(c.route.Kinds) > 0 && !hasFold(c.route.Kinds, a.Kind) {
+		return false
+	}
+	if len(c.route.Symbols) > 0 {
+		for _, s := range a.Stocks {
+			if hasFold(c.route.Symbols, s) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func hasFold(list []string, s string) bool {
+	for _, v := range list {
+		if s != "" && strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Notifier routes new alerts to channels and sends them
+type Notifier struct {
+	cfg       config.NotifierConfig
+	store     storage.Store
+	channels  []*channel
+	byName    map[string]*channel
+	now       func() time.Time
+	cursor    time.Time // newest alert queued
+	escCursor time.Time // newest escalation queued
+
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+	isRunning bool
+	mu        sync.Mutex
+}
+
+// New validates the channel configs. Alerts created within cfg.Lookback
+// before the first poll are still sent.
+func New(cfg config.NotifierConfig, store storage.Store) (*Notifier, error) {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 10 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = time.Minute
+	}
+
+	n := &Notifier{
+		cfg:    cfg,
+		store:  store,
+		byName: make(map[string]*channel),
+		now:    time.Now,
+		stopCh: make(chan struct{}),
+	}
+	client := &http.Client{Timeout: cfg.Timeout}
+	for i, cc := range cfg.Channels {
+		if cc.Name == "" {
+			return nil, fmt.Errorf("notifier.channels[%d]: name is required", i)
+		}
+		if _, dup := n.byName[cc.Name]; dup {
+			return nil, fmt.Errorf("notifier.channels[%d]: duplicate name %q", i, cc.Name)
+		}
+		sender, err := newSender(cc, client)
+		if err != nil {
+			return nil, fmt.Errorf("notifier channel %q: %w", cc.Name, err)
+		}
+		text := cc.Template
+		if text == "" {
+			text = DefaultTemplate
+		}
+		tmpl, err := template.New(cc.Name).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("notifier channel %q: template: %w", cc.Name, err)
+		}
+		rate := cc.RateLimit
+		if rate <= 0 {
+			rate = DefaultRateLimit
+		}
+		c := &channel{name: cc.Name, sender: sender, route: cc, tmpl: tmpl, bucket: ratelimit.NewBucket(rate, time.Minute)}
+		n.channels = append(n.channels, c)
+		n.byName[c.name] = c
+	}
+	n.cursor = n.now().Add(-cfg.Lookback)
+	n.escCursor = n.cursor
+	return n, nil
+}
+
+// Start begins following alerts
+func (n *Notifier) Start() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.isRunning {
+		return
+	}
+	n.isRunning = true
+	n.stopCh = make(chan struct{})
+
+	log.Printf("Starting Notifier (%d channels, every %s)", len(n.channels), n.cfg.PollInterval)
+
+	n.wg.Add(1)
+	go n.loop()
+}
+
+// Stop waits for the current batch and shuts down
+func (n *Notifier) Stop() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !n.isRunning {
+		return
+	}
+	close(n.stopCh)
+	n.isRunning = false
+	n.wg.Wait()
+	log.Println("Notifier stopped")
+}
+
+func (n *Notifier) loop() {
+	defer n.wg.Done()
+
+	ticker := time.NewTicker(n.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := n.RunOnce(); err != nil {
+			log.Printf("Notifier: %v", err)
+		}
+		select {
+		case <-n.stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce queues new alerts and sends the notifications due now. It returns
+// how many were sent.
+func (n *Notifier) RunOnce() (int, error) {
+	if err := n.queue(); err != nil {
+		return 0, fmt.Errorf("failed to queue alerts: %w", err)
+	}
+	return n.deliver()
+}
+
+// queue adds a pending notification for each channel routing each alert
+// created, or escalated, since the last poll. Re-queuing is a no-op.
+func (n *Notifier) queue() error {
+	created := func(c storage.Cursor) ([]storage.Alert, error) { return n.store.AlertsAfter(c, time.Time{}, 200) }
+	if err := n.queueAlerts(&n.cursor, created, false); err != nil {
+		return err
+	}
+	escalated := func(c storage.Cursor) ([]storage.Alert, error) { return n.store.EscalationsAfter(c, 200) }
+	return n.queueAlerts(&n.escCursor, escalated, true)
+}
+
+// queueAlerts pages from *cursor through read. Each escalation of an alert
+// is a notification of its own; an alert escalated before it was first
+// queued is only notified as escalated.
+func (n *Notifier) queueAlerts(cursor *time.Time, read func(storage.Cursor) ([]storage.Alert, error), escalations bool) error {
+	stamp := func(a *storage.Alert) time.Time {
+		if escalations {
+			return *a.EscalatedAt
+		}
+		return a.CreatedAt
+	}
+	c := storage.Cursor{Time: cursor.Add(-queueLag)}
+	for {
+		alerts, err := read(c)
+		if err != nil {
+			return err
+		}
+		now := n.now()
+		var batch []storage.Notification
+		for i := range alerts {
+			a := &alerts[i]
+			id := a.ID
+			if escalations {
+				id = fmt.Sprintf("%s_e%d", a.ID, a.Escalations)
+			}
+			for _, ch := range n.channels {
+				// the escalation pass notifies escalated alerts, once,
+				// unless they were snoozed
+				if !escalations && a.Escalations > 0 || escalations && a.Snoozed(now) || !ch.matches(a) {
+					continue
+				}
+				batch = append(batch, storage.Notification{
+					ID:            fmt.Sprintf("ntf_%s_%s", id, ch.name),
+					AlertID:       a.ID,
+					Channel:       ch.name,
+					Status:        storage.DeliveryPending,
+					NextAttemptAt: now,
+					CreatedAt:     now,
+				})
+			}
+			if t := stamp(a); t.After(*cursor) {
+				*cursor = t
+			}
+		}
+		if _, err := n.store.QueueNotifications(batch); err != nil {
+			return err
+		}
+		if len(alerts) < 200 {
+			return nil
+		}
+		last := &alerts[len(alerts)-1]
+		c = storage.Cursor{Time: stamp(last), ID: last.ID}
+	}
+}
+
+// deliver sends due notifications. One over its channel's rate limit stays
+// pending for the next poll without using up an attempt.
+func (n *Notifier) deliver() (int, error) {
+	due, err := n.store.DueNotifications(n.now(), batchSize)
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	for i := range due {
+		nt := &due[i]
+		now := n.now()
+		ch := n.byName[nt.Channel]
+		if ch == nil {
+			nt.Status, nt.LastError = storage.DeliveryFailed, "channel is no longer configured"
+		} else if !ch.bucket.Take(now, 1) {
+			continue
+		} else if err := n.send(ch, nt.AlertID); err != nil {
+			n.retry(nt, err, now)
+		} else {
+			nt.Attempts++
+			nt.Status, nt.LastError, nt.SentAt = storage.DeliveryDelivered, "", &now
+			sent++
+		}
+		if err := n.store.RecordNotificationAttempt(nt); err != nil {
+			log.Printf("Notifier: failed to record %s: %v", nt.ID, err)
+		}
+	}
+	return sent, nil
+}
+
+func (n *Notifier) send(ch *channel, alertID string) error {
+	alert, err := n.store.GetAlert(alertID)
+	if err != nil {
+		return err
+	}
+	if alert == nil {
+		return fmt.Errorf("alert %s no longer exists", alertID)
+	}
+	text, err := n.Render(ch.tmpl, alert)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), n.cfg.Timeout)
+	defer cancel()
+	return ch.sender.Send(ctx, text)
+}
+
+func (n *Notifier) retry(nt *storage.Notification, err error, now time.Time) {
+	nt.Attempts++
+	nt.LastError = err.Error()
+	if nt.Attempts >= n.cfg.MaxAttempts {
+		nt.Status = storage.DeliveryFailed
+		log.Printf("Notifier: giving up on %s after %d attempts: %v", nt.ID, nt.Attempts, err)
+		return
+	}
+	wait := n.cfg.Backoff << (nt.Attempts - 1)
+	if wait > maxBackoff || wait <= 0 {
+		wait = maxBackoff
+	}
+	nt.NextAttemptAt = now.Add(wait)
+	log.Printf("Notifier: %s failed (attempt %d), retrying in %s: %v", nt.ID, nt.Attempts, wait, err)
+}
+
+// Render fills tmpl with alert and its news item
+func (n *Notifier) Render(tmpl *template.Template, alert *storage.Alert) (string, error) {
+	msg := Message{
+		Alert:   *alert,
+		Level:   levelLabel(alert.Severity),
+		Symbols: strings.Join(alert.Stocks, ", "),
+	}
+	msg.Source, msg.URL = alert.Source, alert.URL
+	// alerts created before they carried their source
+	if msg.URL == "" && alert.NewsID != "" {
+		if news, err := n.store.GetNews(alert.NewsID); err == nil && news != nil {
+			msg.Source, msg.URL = news.Source, news.URL
+		}
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, msg); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+func levelLabel(severity string) string {
+	switch severity {
+	case "critical":
+		return "🔴 严重"
+	case "high":
+		return "🟠 高"
+	}
+	return severity
+}
@@ -0,0 +1,322 @@
+package notifier
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+// recorder stands in for a chat service: it keeps each request and answers
+// with a fixed body
+type recorder struct {
+	mu    sync.Mutex
+	paths []string
+	query []string
+	body  []map[string]interface{}
+}
+
+func (rec *recorder) serve(t *testing.T, reply string) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		var body map[string]interface{}
+		if err := json.Unmarshal(raw, &body); err != nil {
+			t.Errorf("bad body %q", raw)
+		}
+		rec.mu.Lock()
+		rec.paths = append(rec.paths, r.URL.Path)
+		rec.query = append(rec.query, r.URL.RawQuery)
+		rec.body = append(rec.body, body)
+		rec.mu.Unlock()
+		io.WriteString(w, reply)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSenders(t *testing.T) {
+	tests := []struct {
+		cfg   config.ChannelConfig
+		reply string
+		check func(t *testing.T, rec *recorder)
+	}{
+		{config.ChannelConfig{Type: TypeTelegram, Token: "123:abc", ChatID: "-100"}, `{"ok":true}`, func(t *testing.T, rec *recorder) {
+			if rec.paths[0] != "/bot123:abc/sendMessage" || rec.body[0]["chat_id"] != "-100" || rec.body[0]["text"] != "hi" {
+				t.Errorf("telegram request = %s %v", rec.paths[0], rec.body[0])
+			}
+		}},
+		{config.ChannelConfig{Type: TypeSlack}, "ok", func(t *testing.T, rec *recorder) {
+			if rec.body[0]["text"] != "hi" {
+				t.Errorf("slack body = %v", rec.body[0])
+			}
+		}},
+		{config.ChannelConfig{Type: TypeDiscord}, "", func(t *testing.T, rec *recorder) {
+			if rec.body[0]["content"] != "hi" {
+				t.Errorf("discord body = %v", rec.body[0])
+			}
+		}},
+		{config.ChannelConfig{Type: TypeFeishu, Secret: "fs"}, `{"code":0}`, func(t *testing.T, rec *recorder) {
+			b := rec.body[0]
+			if b["msg_type"] != "text" || b["content"].(map[string]interface{})["text"] != "hi" {
+				t.Errorf("feishu body = %v", b)
+			}
+			mac := hmac.New(sha256.New, []byte(b["timestamp"].(string)+"\nfs"))
+			if b["sign"] != base64.StdEncoding.EncodeToString(mac.Sum(nil)) {
+				t.Errorf("feishu sign = %v", b["sign"])
+			}
+		}},
+		{config.ChannelConfig{Type: TypeDingTalk, Secret: "dt"}, `{"errcode":0}`, func(t *testing.T, rec *recorder) {
+			if rec.body[0]["msgtype"] != "text" || !strings.Contains(rec.query[0], "access_token=x&timestamp=") {
+				t.Errorf("dingtalk request = %s %v", rec.query[0], rec.body[0])
+			}
+			q := rec.query[0]
+			ts := q[strings.Index(q, "timestamp=")+10 : strings.Index(q, "&sign=")]
+			mac := hmac.New(sha256.New, []byte("dt"))
+			mac.Write([]byte(ts + "\ndt"))
+			if want := "sign=" + strings.NewReplacer("+", "%2B", "/", "%2F", "=", "%3D").Replace(base64.StdEncoding.EncodeToString(mac.Sum(nil))); !strings.HasSuffix(q, want) {
+				t.Errorf("dingtalk query = %s, want %s", q, want)
+			}
+		}},
+		{config.ChannelConfig{Type: TypeWeCom}, `{"errcode":0,"errmsg":"ok"}`, func(t *testing.T, rec *recorder) {
+			if rec.body[0]["text"].(map[string]interface{})["content"] != "hi" {
+				t.Errorf("wecom body = %v", rec.body[0])
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cfg.Type, func(t *testing.T) {
+			rec := &recorder{}
+			srv := rec.serve(t, tt.reply)
+			if tt.cfg.Type == TypeTelegram {
+				tt.cfg.URL = srv.URL
+			} else {
+				tt.cfg.URL = srv.URL + "/robot?access_token=x"
+			}
+			s, err := newSender(tt.cfg, srv.Client())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Send(context.Background(), "hi"); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+			tt.check(t, rec)
+		})
+	}
+}
+
+func TestSenderErrors(t *testing.T) {
+	for typ, reply := range map[string]string{
+		TypeTelegram: `{"ok":false,"description":"chat not found"}`,
+		TypeFeishu:   `{"code":19021,"msg":"sign match fail"}`,
+		TypeDingTalk: `{"errcode":310000,"errmsg":"keywords not in content"}`,
+		TypeWeCom:    `{"errcode":93000,"errmsg":"invalid webhook url"}`,
+	} {
+		srv := (&recorder{}).serve(t, reply)
+		s, err := newSender(config.ChannelConfig{Type: typ, URL: srv.URL + "/secret-token", Token: "t", ChatID: "1"}, srv.Client())
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = s.Send(context.Background(), "hi")
+		if err == nil {
+			t.Errorf("%s: accepted error reply %s", typ, reply)
+		} else if strings.Contains(err.Error(), "secret-token") {
+			t.Errorf("%s: error leaks the URL: %v", typ, err)
+		}
+	}
+
+	if _, err := newSender(config.ChannelConfig{Type: TypeSlack}, nil); err == nil {
+		t.Error("slack without url accepted")
+	}
+	if _, err := newSender(config.ChannelConfig{Type: "pager"}, nil); err == nil {
+		t.Error("unknown type accepted")
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := truncateRunes("利好消息", 3); got != "利好…" {
+		t.Errorf("truncateRunes = %q", got)
+	}
+	if got := truncateBytes("利好消息", 8); got != "利…" {
+		t.Errorf("truncateBytes = %q", got)
+	}
+}
+
+// fakeSender records messages and fails while err is set
+type fakeSender struct {
+	sent []string
+	err  error
+}
+
+func (f *fakeSender) Send(_ context.Context, text string) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.sent = append(f.sent, text)
+	return nil
+}
+
+func TestNotifierRoutesRetriesAndLimits(t *testing.T) {
+	store, err := storage.New(filepath.Join(t.TempDir(), "notify.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	now := time.Now().Truncate(time.Second)
+	n, err := New(config.NotifierConfig{Lookback: time.Hour, MaxAttempts: 2, Backoff: time.Minute, Channels: []config.ChannelConfig{
+		{Name: "desk", Type: TypeSlack, URL: "http://slack.local", RateLimit: 1},
+		{Name: "nvda", Type: TypeWeCom, URL: "http://wecom.local", Symbols: []string{"nvda"}, Severities: []string{"critical"}},
+	}}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.now = func() time.Time { return now }
+	desk, nvda := &fakeSender{}, &fakeSender{err: errors.New("HTTP 502")}
+	n.byName["desk"].sender, n.byName["nvda"].sender = desk, nvda
+
+	if err := store.SaveNews(&storage.NewsItem{ID: "n1", Source: "rss:Reuters", URL: "https://example.com/n1", Title: "t", PublishedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range []storage.Alert{
+		{ID: "al1", NewsID: "n1", Title: "英伟达遭出口限制", Severity: "critical", Stocks: []string{"NVDA"}, CreatedAt: now.Add(-2 * time.Second)},
+		{ID: "al2", Title: "特斯拉交付超预期", Severity: "high", Stocks: []string{"TSLA"}, CreatedAt: now.Add(-time.Second)},
+	} {
+		a := a
+		if err := store.SaveAlert(&a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// desk routes both but may send one per minute; nvda fails
+	if sent, err := n.RunOnce(); sent != 1 || err != nil {
+		t.Fatalf("first run = %d, %v", sent, err)
+	}
+	if len(desk.sent) != 1 || !strings.Contains(desk.sent[0], "英伟达遭出口限制") ||
+		!strings.Contains(desk.sent[0], "🔴 严重") || !strings.Contains(desk.sent[0], "https://example.com/n1") {
+		t.Fatalf("desk got %q", desk.sent)
+	}
+	items, _, _ := store.ListNotifications("", "nvda", "", 10, 0)
+	if len(items) != 1 || items[0].Status != storage.DeliveryPending || items[0].Attempts != 1 ||
+		items[0].LastError != "HTTP 502" || !items[0].NextAttemptAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("nvda after failure = %+v", items)
+	}
+	if items, _, _ := store.ListNotifications("al2", "desk", storage.DeliveryPending, 10, 0); len(items) != 1 || items[0].Attempts != 0 {
+		t.Errorf("rate-limited notification = %+v, want pending without an attempt", items)
+	}
+
+	now = now.Add(time.Minute)
+	if sent, _ := n.RunOnce(); sent != 1 || len(desk.sent) != 2 {
+		t.Errorf("second run sent %d, desk has %d", sent, len(desk.sent))
+	}
+	if items, _, _ := store.ListNotifications("", "nvda", storage.DeliveryFailed, 10, 0); len(items) != 1 || items[0].Attempts != 2 {
+		t.Errorf("nvda = %+v, want failed after 2 attempts", items)
+	}
+	if a, _ := store.GetAlert("al2"); !a.Notified {
+		t.Error("al2 not marked notified")
+	}
+	if _, total, _ := store.ListNotifications("", "", "", 10, 0); total != 3 {
+		t.Errorf("%d notifications, want 3 (re-polling must not re-queue)", total)
+	}
+}
+
+func TestNotifierEscalations(t *testing.T) {
+	store, err := storage.New(filepath.Join(t.TempDir(), "notify.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	now := time.Now().Truncate(time.Second)
+	n, err := New(config.NotifierConfig{Lookback: time.Hour, Channels: []config.ChannelConfig{
+		{Name: "all", Type: TypeSlack, URL: "http://slack.local"},
+		{Name: "oncall", Type: TypeSlack, URL: "http://pager.local", Severities: []string{"critical"}},
+	}}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.now = func() time.Time { return now }
+	all, oncall := &fakeSender{}, &fakeSender{}
+	n.byName["all"].sender, n.byName["oncall"].sender = all, oncall
+
+	alert := storage.Alert{ID: "al1", Title: "英伟达遭出口限制", Severity: "high", Stocks: []string{"NVDA"}, CreatedAt: now.Add(-time.Second)}
+	if err := store.SaveAlert(&alert); err != nil {
+		t.Fatal(err)
+	}
+	if sent, err := n.RunOnce(); sent != 1 || err != nil || len(oncall.sent) != 0 {
+		t.Fatalf("first run = %d, %v, oncall got %q", sent, err, oncall.sent)
+	}
+
+	alert.Severity, alert.Updates, alert.Escalations, alert.EscalatedAt = "critical", 1, 1, &now
+	if err := store.AttachAlertUpdate(&alert, &storage.AlertUpdate{NewsID: "n2", Severity: "critical", Escalated: true}); err != nil {
+		t.Fatal(err)
+	}
+	if sent, err := n.RunOnce(); sent != 2 || err != nil {
+		t.Fatalf("escalation run = %d, %v", sent, err)
+	}
+	if len(oncall.sent) != 1 || !strings.Contains(oncall.sent[0], "（已升级）") || !strings.Contains(oncall.sent[0], "后续报道：1 条") {
+		t.Errorf("oncall got %q", oncall.sent)
+	}
+	if sent, _ := n.RunOnce(); sent != 0 || len(all.sent) != 2 {
+		t.Errorf("re-run sent %d, all has %d", sent, len(all.sent))
+	}
+
+	// escalations of a snoozed alert stay quiet
+	until := now.Add(time.Hour)
+	if _, err := store.ChangeAlertState("al1", &storage.AlertEvent{ToState: storage.AlertSnoozed, SnoozedUntil: &until, CreatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	later := now.Add(time.Minute)
+	alert.State, alert.SnoozedUntil = storage.AlertSnoozed, &until
+	alert.Updates, alert.Escalations, alert.EscalatedAt = 2, 2, &later
+	if err := store.AttachAlertUpdate(&alert, &storage.AlertUpdate{NewsID: "n3", Severity: "critical", Escalated: true}); err != nil {
+		t.Fatal(err)
+	}
+	now = later
+	if sent, err := n.RunOnce(); sent != 0 || err != nil {
+		t.Errorf("snoozed escalation sent %d, %v", sent, err)
+	}
+}
+
+func TestRuleChannelsOverrideRoutes(t *testing.T) {
+	c := &channel{name: "desk", route: config.ChannelConfig{Severities: []string{"critical"}}}
+	tests := []struct {
+		alert storage.Alert
+		want  bool
+	}{
+		{storage.Alert{Severity: "high"}, false},
+		{storage.Alert{Severity: "critical"}, true},
+		{storage.Alert{Severity: "high", Channels: []string{"ops", "Desk"}}, true},
+		{storage.Alert{Severity: "critical", Channels: []string{"ops"}}, false},
+	}
+	for _, tt := range tests {
+		if got := c.matches(&tt.alert); got != tt.want {
+			t.Errorf("matches(%s, %v) = %v, want %v", tt.alert.Severity, tt.alert.Channels, got, tt.want)
+		}
+	}
+}
+
+func TestNewRejectsBadChannels(t *testing.T) {
+	for _, chans := range [][]config.ChannelConfig{
+		{{Type: TypeSlack, URL: "http://x"}},
+		{{Name: "a", Type: TypeSlack, URL: "http://x"}, {Name: "a", Type: TypeDiscord, URL: "http://y"}},
+		{{Name: "a", Type: TypeTelegram, Token: "t"}},
+		{{Name: "a", Type: TypeSlack, URL: "http://x", Template: "{{.Nope"}},
+	} {
+		if _, err := New(config.NotifierConfig{Channels: chans}, nil); err == nil {
+			t.Errorf("New(%+v) accepted", chans)
+		}
+	}
+}
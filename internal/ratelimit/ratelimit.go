@@ -0,0 +1,49 @@
+// Package ratelimit provides the token bucket behind the API's per-token
+// limits and the notifier's per-channel limits.
+package ratelimit
+
+import "time"
+
+// Bucket is a token bucket holding up to rate tokens, refilled evenly over
+// per. It is not safe for concurrent use.
+type Bucket struct {
+	rate   float64
+	per    time.Duration
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket returns a full bucket
+func NewBucket(rate int, per time.Duration) *Bucket {
+	return &Bucket{rate: float64(rate), per: per, tokens: float64(rate)}
+}
+
+// Rate is the capacity of the bucket
+func (b *Bucket) Rate() float64 { return b.rate }
+
+// Tokens is what the bucket held at the last Take
+func (b *Bucket) Tokens() float64 { return b.tokens }
+
+// Take spends n tokens if they are available at now
+func (b *Bucket) Take(now time.Time, n float64) bool {
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() / b.per.Seconds() * b.rate
+		if b.tokens > b.rate {
+			b.tokens = b.rate
+		}
+	}
+	b.last = now
+	if b.tokens < n {
+		return false
+	}
+	b.tokens -= n
+	return true
+}
+
+// Wait is how long until the bucket holds n tokens
+func (b *Bucket) Wait(n float64) time.Duration {
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(b.per))
+}
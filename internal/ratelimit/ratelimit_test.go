@@ -0,0 +1,24 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketRefills(t *testing.T) {
+	b := NewBucket(2, time.Minute)
+	start := time.Now()
+	if !b.Take(start, 1) || !b.Take(start, 1) || b.Take(start, 1) {
+		t.Fatal("bucket of 2 should allow exactly 2 at once")
+	}
+	if !b.Take(start.Add(30*time.Second), 1) || b.Take(start.Add(30*time.Second), 1) {
+		t.Error("half a minute should refill one token")
+	}
+	// an idle hour fills the bucket, but only up to the rate
+	if b.Take(start.Add(time.Hour), 3) || !b.Take(start.Add(time.Hour), 2) {
+		t.Error("bucket should cap at its rate")
+	}
+	if w := b.Wait(1); w != 30*time.Second {
+		t.Errorf("Wait(1) = %v, want 30s", w)
+	}
+}
@@ -2,58 +2,250 @@ package reporter
 
 import (
 	"fmt"
+	"log"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+	"github.com/chenzhiguo/market-sentinel/internal/rules"
 	"github.com/chenzhiguo/market-sentinel/internal/storage"
 )
 
+// AlertManager is the one place alerts are created. The analysis engine
+// hands it every analysis, the volume detector its spikes; both end up in
+// Raise, which stores the alert for the webhook, notifier and stream
+// consumers.
+//
+// Analyses of a story that already alerted in the same direction, on an
+// overlapping set of symbols, within the cooldown of that alert's severity
+// attach to it as updates instead. An update with a higher severity
+// escalates the alert, which notifies again and restarts the cooldown.
 type AlertManager struct {
-	store *storage.Storage
+	store    storage.Store
+	rules    *rules.Set
+	cooldown map[string]time.Duration // by severity
+	now      func() time.Time
+
+	mu sync.Mutex // serializes grouping across engine workers
 }
 
-func NewAlertManager(store *storage.Storage) *AlertManager {
-	return &AlertManager{store: store}
+// NewAlertManager uses ruleSet to decide which analyses alert. A nil
+// ruleSet applies the built-in rules; a nil cooldown never groups.
+func NewAlertManager(store storage.Store, ruleSet *rules.Set, cooldown map[string]time.Duration) *AlertManager {
+	if ruleSet == nil {
+		ruleSet, _ = rules.NewSet(config.AlertingConfig{}, nil)
+	}
+	return &AlertManager{store: store, rules: ruleSet, cooldown: cooldown, now: time.Now}
 }
 
-// CheckAndCreateAlert evaluates an analysis and creates an alert if needed
+// CheckAndCreateAlert evaluates an analysis against the alert rules and
+// creates an alert if any matches, or updates the open alert of its story.
+// It returns the created or updated alert. news may be nil.
 func (am *AlertManager) CheckAndCreateAlert(analysis *storage.Analysis, news *storage.NewsItem) (*storage.Alert, error) {
-	// Only create alerts for high impact items
-	if analysis.ImpactLevel != "high" {
-		return nil, nil
+	decision, err := am.rules.Evaluate(analysis, news)
+	if err != nil || decision == nil {
+		return nil, err
 	}
 
-	// Build alert title
-	title := buildAlertTitle(analysis, news)
+	alert := &storage.Alert{
+		Kind:        storage.AlertKindImpact,
+		NewsID:      analysis.NewsID,
+		AnalysisID:  analysis.ID,
+		Severity:    decision.Severity,
+		Title:       buildAlertTitle(analysis, news, decision),
+		Description: buildAlertMessage(analysis, decision),
+		Stocks:      decision.Symbols,
+		Rule:        decision.Rule,
+		Channels:    decision.Channels,
+		Direction:   direction(analysis),
+	}
+	if news != nil {
+		alert.Source, alert.URL, alert.StoryID = news.Source, news.URL, news.StoryID
+	}
 
-	// Build alert message
-	message := buildAlertMessage(analysis, news)
+	am.mu.Lock()
+	defer am.mu.Unlock()
 
-	// Extract stock symbols
-	var stocks []string
-	for _, s := range analysis.StockDetails {
-		stocks = append(stocks, s.Symbol)
+	open, err := am.openAlert(alert)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up open alerts: %w", err)
 	}
+	if open != nil {
+		if err := am.attach(open, alert); err != nil {
+			return nil, err
+		}
+		return open, nil
+	}
+	if err := am.Raise(alert); err != nil {
+		return nil, err
+	}
+	return alert, nil
+}
 
-	alert := &storage.Alert{
-		ID:          fmt.Sprintf("alert_%d", time.Now().UnixNano()),
-		NewsID:      analysis.NewsID,
-		AnalysisID:  analysis.ID,
-		Severity:    determineAlertLevel(analysis),
-		Title:       title,
-		Description: message,
-		Stocks:      stocks,
-		CreatedAt:   time.Now(),
-		Notified:    false,
+// openAlert finds the alert a would follow up on, if any
+func (am *AlertManager) openAlert(a *storage.Alert) (*storage.Alert, error) {
+	if a.StoryID == "" {
+		return nil, nil
+	}
+	var longest time.Duration
+	for _, w := range am.cooldown {
+		if w > longest {
+			longest = w
+		}
+	}
+	if longest <= 0 {
+		return nil, nil
 	}
 
-	if err := am.store.SaveAlert(alert); err != nil {
+	now := am.now()
+	candidates, err := am.store.GroupAlerts(a.Kind, a.StoryID, now.Add(-longest))
+	if err != nil {
 		return nil, err
 	}
+	for i := range candidates {
+		c := &candidates[i]
+		// an escalation notifies again, so it restarts the cooldown
+		start := c.CreatedAt
+		if c.EscalatedAt != nil {
+			start = *c.EscalatedAt
+		}
+		w := am.cooldown[c.Severity]
+		if w <= 0 || !start.After(now.Add(-w)) {
+			continue
+		}
+		// an unanalyzed follow-up has no direction or symbols of its own
+		if a.Direction != "" && (c.Direction != a.Direction || !overlaps(c.Stocks, a.Stocks)) {
+			continue
+		}
+		return c, nil
+	}
+	return nil, nil
+}
 
-	return alert, nil
+// FollowUp attaches a news item of an already analyzed story, which the
+// engine does not analyze again, to the story's open alert. It returns that
+// alert, or nil when the story has none.
+func (am *AlertManager) FollowUp(news *storage.NewsItem) (*storage.Alert, error) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+
+	item := &storage.Alert{Kind: storage.AlertKindImpact, NewsID: news.ID, Title: news.Title, StoryID: news.StoryID}
+	open, err := am.openAlert(item)
+	if err != nil || open == nil {
+		return nil, err
+	}
+	return open, am.attach(open, item)
+}
+
+// attach records a as an update of open, merging its symbols and channels
+// and escalating open when a is more severe
+func (am *AlertManager) attach(open, a *storage.Alert) error {
+	now := am.now()
+	u := &storage.AlertUpdate{
+		NewsID:     a.NewsID,
+		AnalysisID: a.AnalysisID,
+		Title:      a.Title,
+		Severity:   a.Severity,
+		Stocks:     a.Stocks,
+		CreatedAt:  now,
+	}
+	open.Stocks = union(open.Stocks, a.Stocks)
+	open.Channels = union(open.Channels, a.Channels)
+	open.Updates++
+	open.LastUpdateAt = &now
+	if rules.SeverityRank(a.Severity) > rules.SeverityRank(open.Severity) {
+		open.Severity, open.Rule = a.Severity, a.Rule
+		open.Escalations++
+		open.EscalatedAt = &now
+		u.Escalated = true
+		log.Printf("🚨 %s ALERT escalated (%s): %s", strings.ToUpper(open.Severity), open.Rule, open.Title)
+	} else {
+		log.Printf("Alerts: %s follow-up #%d: %s", open.ID, open.Updates, a.Title)
+	}
+	if err := am.store.AttachAlertUpdate(open, u); err != nil {
+		return fmt.Errorf("failed to update alert %s: %w", open.ID, err)
+	}
+	return nil
+}
+
+// direction is the way an analysis expects its stocks to move
+func direction(a *storage.Analysis) string {
+	switch a.Sentiment {
+	case "positive":
+		return "up"
+	case "negative":
+		return "down"
+	}
+	return "flat"
+}
+
+// overlaps reports whether a and b share a symbol. Two alerts without
+// symbols overlap.
+func overlaps(a, b []string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// union appends the items of b missing from a
+func union(a, b []string) []string {
+	for _, y := range b {
+		found := false
+		for _, x := range a {
+			found = found || x == y
+		}
+		if !found {
+			a = append(a, y)
+		}
+	}
+	return a
+}
+
+// Raise stores alert, filling in its ID, kind and creation time when unset,
+// and the source and link of its news item
+func (am *AlertManager) Raise(alert *storage.Alert) error {
+	now := am.now()
+	if alert.ID == "" {
+		alert.ID = fmt.Sprintf("alert_%d", time.Now().UnixNano())
+	}
+	if alert.Kind == "" {
+		alert.Kind = storage.AlertKindImpact
+	}
+	if alert.CreatedAt.IsZero() {
+		alert.CreatedAt = now
+	}
+	if alert.URL == "" && alert.NewsID != "" {
+		if news, err := am.store.GetNews(alert.NewsID); err == nil && news != nil {
+			alert.URL = news.URL
+			if alert.Source == "" {
+				alert.Source = news.Source
+			}
+		}
+	}
+
+	rule := ""
+	if alert.Rule != "" {
+		rule = " (" + alert.Rule + ")"
+	}
+	log.Printf("🚨 %s ALERT%s: %s", strings.ToUpper(alert.Severity), rule, alert.Title)
+
+	if err := am.store.SaveAlert(alert); err != nil {
+		return fmt.Errorf("failed to save alert: %w", err)
+	}
+	return nil
 }
 
-func buildAlertTitle(analysis *storage.Analysis, news *storage.NewsItem) string {
+// buildAlertTitle reads like "📉 高影响事件 | <headline>"
+func buildAlertTitle(analysis *storage.Analysis, news *storage.NewsItem, d *rules.Decision) string {
 	sentiment := "📰"
 	switch analysis.Sentiment {
 	case "positive":
@@ -62,58 +254,47 @@ func buildAlertTitle(analysis *storage.Analysis, news *storage.NewsItem) string
 		sentiment = "📉"
 	}
 
-	source := "Unknown"
+	headline := "Unknown"
 	if news != nil {
-		source = news.Author
+		switch {
+		case news.Title != "":
+			headline = news.Title
+		case news.Author != "":
+			headline = news.Author
+		case news.Source != "":
+			headline = news.Source
+		}
+	}
+	if r := []rune(headline); len(r) > 80 {
+		headline = string(r[:79]) + "…"
 	}
 
-	return fmt.Sprintf("%s 高影响事件 | %s", sentiment, source)
+	name := d.Name
+	if name == "" {
+		name = "高影响事件"
+	}
+	return fmt.Sprintf("%s %s | %s", sentiment, name, headline)
 }
 
-func buildAlertMessage(analysis *storage.Analysis, news *storage.NewsItem) string {
+// buildAlertMessage is the analysis summary followed by the alerted stocks
+// with their scores, and the impact and confidence of the analysis
+func buildAlertMessage(analysis *storage.Analysis, d *rules.Decision) string {
 	msg := analysis.Summary
 
-	if len(analysis.StockDetails) > 0 {
+	scores := make(map[string]storage.StockMention)
+	for _, m := range storage.MentionsFor(analysis) {
+		scores[m.Symbol] = m
+	}
+	if len(d.Symbols) > 0 {
 		msg += "\n\n关联股票: "
-		for i, s := range analysis.StockDetails {
+		for i, sym := range d.Symbols {
 			if i > 0 {
 				msg += ", "
 			}
-			scoreSign := "+"
-			if s.Score < 0 {
-				scoreSign = ""
-			}
-			msg += fmt.Sprintf("%s (%s%d)", s.Symbol, scoreSign, s.Score)
-		}
-	}
-
-	return msg
-}
-
-func determineAlertLevel(analysis *storage.Analysis) string {
-	// Critical if high confidence and strong sentiment
-	if analysis.Confidence > 0.8 {
-		for _, s := range analysis.StockDetails {
-			if s.Score >= 8 || s.Score <= -8 {
-				return "critical"
-			}
+			msg += fmt.Sprintf("%s (%+g)", sym, scores[sym].Score)
 		}
 	}
-	return "high"
-}
 
-// GetPendingAlerts returns alerts that haven't been notified yet
-func (am *AlertManager) GetPendingAlerts() ([]storage.Alert, error) {
-	alerts, _, err := am.store.ListAlerts("", 100, 0)
-	if err != nil {
-		return nil, err
-	}
-
-	var pending []storage.Alert
-	for _, a := range alerts {
-		if !a.Notified {
-			pending = append(pending, a)
-		}
-	}
-	return pending, nil
+	msg += fmt.Sprintf("\n影响: %s　置信度: %.0f%%", analysis.ImpactLevel, analysis.Confidence*100)
+	return strings.TrimSpace(msg)
 }
@@ -0,0 +1,147 @@
+package reporter
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+func TestAlertManager(t *testing.T) {
+	store, err := storage.New(filepath.Join(t.TempDir(), "alerts.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	now := time.Date(2025, 3, 10, 14, 30, 0, 0, time.UTC)
+	news := &storage.NewsItem{ID: "n1", Source: "rss:Reuters", Author: "Reuters Business", URL: "https://example.com/n1",
+		Title: "US tightens chip export curbs", PublishedAt: now}
+	if err := store.SaveNews(news); err != nil {
+		t.Fatal(err)
+	}
+	am := NewAlertManager(store, nil, nil)
+	tick := now
+	am.now = func() time.Time { tick = tick.Add(time.Second); return tick }
+
+	medium := &storage.Analysis{ID: "a0", NewsID: "n1", ImpactLevel: "medium", Sentiment: "negative", SentimentScore: -0.7}
+	if a, err := am.CheckAndCreateAlert(medium, news); a != nil || err != nil {
+		t.Fatalf("medium impact alert = %+v, %v", a, err)
+	}
+
+	analysis := &storage.Analysis{ID: "a1", NewsID: "n1", ImpactLevel: "high", Sentiment: "negative", SentimentScore: -0.7,
+		Confidence: 0.9, Summary: "出口限制收紧", RelatedStocks: []string{"TSM"},
+		StockDetails: []storage.StockImpact{{Symbol: "NVDA", Score: -8}, {Symbol: "AMD", Score: -5}}}
+	a, err := am.CheckAndCreateAlert(analysis, news)
+	if err != nil || a == nil {
+		t.Fatalf("alert = %+v, %v", a, err)
+	}
+	if a.Severity != "critical" || a.Rule != "high-impact-strong" || a.Kind != storage.AlertKindImpact ||
+		a.Title != "📉 高影响强信号 | US tightens chip export curbs" || a.Source != "rss:Reuters" || a.URL != news.URL {
+		t.Errorf("alert = %+v", a)
+	}
+	if want := "出口限制收紧\n\n关联股票: NVDA (-8), AMD (-5), TSM (-0.7)\n影响: high　置信度: 90%"; a.Description != want {
+		t.Errorf("description = %q, want %q", a.Description, want)
+	}
+
+	spike := &storage.Alert{Kind: storage.AlertKindVolumeSpike, NewsID: "n1", Severity: "high", Title: "📊 提及量异常", Source: "reddit:r/stocks"}
+	if err := am.Raise(spike); err != nil {
+		t.Fatal(err)
+	}
+	if spike.ID == "" || !spike.CreatedAt.Equal(now.Add(2*time.Second)) || spike.URL != news.URL || spike.Source != "reddit:r/stocks" {
+		t.Errorf("raised = %+v", spike)
+	}
+
+	alerts, total, err := store.ListAlerts(storage.AlertQuery{Limit: 10})
+	if err != nil || total != 2 {
+		t.Fatalf("stored %d alerts, %v", total, err)
+	}
+	for _, got := range alerts {
+		if got.URL != news.URL || !strings.HasPrefix(got.ID, "alert_") {
+			t.Errorf("stored alert = %+v", got)
+		}
+	}
+}
+
+func TestAlertGrouping(t *testing.T) {
+	store, err := storage.New(filepath.Join(t.TempDir(), "alerts.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	now := time.Date(2025, 3, 10, 14, 30, 0, 0, time.UTC)
+	am := NewAlertManager(store, nil, map[string]time.Duration{"high": 2 * time.Hour, "critical": time.Hour})
+	am.now = func() time.Time { return now }
+
+	seq := 0
+	analyze := func(story, sentiment string, confidence float64, stocks ...storage.StockImpact) (*storage.Alert, error) {
+		seq++
+		news := &storage.NewsItem{ID: fmt.Sprintf("n%d", seq), Source: "rss:Reuters", Title: fmt.Sprintf("copy %d", seq),
+			URL: fmt.Sprintf("https://example.com/%d", seq), StoryID: story, PublishedAt: now}
+		a := &storage.Analysis{ID: fmt.Sprintf("a%d", seq), NewsID: news.ID, ImpactLevel: "high", Sentiment: sentiment,
+			SentimentScore: -0.6, Confidence: confidence, StockDetails: stocks, AnalyzedAt: now}
+		return am.CheckAndCreateAlert(a, news)
+	}
+	nvda := storage.StockImpact{Symbol: "NVDA", Score: -6}
+
+	first, err := analyze("st1", "negative", 0.7, nvda)
+	if err != nil || first == nil {
+		t.Fatalf("first = %+v, %v", first, err)
+	}
+
+	// another copy of the story, same direction and symbol: an update
+	now = now.Add(30 * time.Minute)
+	got, err := analyze("st1", "negative", 0.7, nvda, storage.StockImpact{Symbol: "AMD", Score: -3})
+	if err != nil || got.ID != first.ID || got.Updates != 1 || got.Escalations != 0 || len(got.Stocks) != 2 {
+		t.Fatalf("follow-up = %+v, %v", got, err)
+	}
+
+	// a more severe copy escalates the same alert
+	now = now.Add(30 * time.Minute)
+	got, err = analyze("st1", "negative", 0.95, storage.StockImpact{Symbol: "NVDA", Score: -9})
+	if err != nil || got.ID != first.ID || got.Severity != "critical" || got.Escalations != 1 || got.EscalatedAt == nil {
+		t.Fatalf("escalation = %+v, %v", got, err)
+	}
+
+	// unanalyzed copies of the story count as updates
+	if a, err := am.FollowUp(&storage.NewsItem{ID: "dup", Title: "copy", StoryID: "st1"}); err != nil || a == nil || a.ID != first.ID || a.Updates != 3 {
+		t.Errorf("FollowUp = %+v, %v", a, err)
+	}
+
+	// the opposite direction, another story and a story-less item alert anew
+	for _, story := range []string{"st1", "st2", ""} {
+		sentiment := "negative"
+		if story == "st1" {
+			sentiment = "positive"
+		}
+		if a, err := analyze(story, sentiment, 0.7, nvda); err != nil || a.ID == first.ID {
+			t.Errorf("story %q %s grouped: %+v, %v", story, sentiment, a, err)
+		}
+	}
+
+	// the alert is critical now: its one-hour cooldown runs from the escalation
+	now = now.Add(45 * time.Minute)
+	if a, err := analyze("st1", "negative", 0.7, nvda); err != nil || a.ID != first.ID {
+		t.Errorf("within cooldown = %+v, %v", a, err)
+	}
+	now = now.Add(15 * time.Minute)
+	if a, err := analyze("st1", "negative", 0.7, nvda); err != nil || a.ID == first.ID {
+		t.Errorf("after cooldown = %+v, %v", a, err)
+	}
+
+	stored, err := store.GetAlert(first.ID)
+	if err != nil || stored.Updates != 4 || stored.Severity != "critical" || stored.LastUpdateAt == nil {
+		t.Fatalf("stored = %+v, %v", stored, err)
+	}
+	updates, err := store.ListAlertUpdates(first.ID)
+	if err != nil || len(updates) != 4 || updates[0].NewsID != "n2" || !updates[1].Escalated || updates[2].NewsID != "dup" {
+		t.Errorf("updates = %+v, %v", updates, err)
+	}
+	if _, total, _ := store.ListAlerts(storage.AlertQuery{Limit: 10}); total != 5 {
+		t.Errorf("%d alerts, want 5", total)
+	}
+}
@@ -9,15 +9,16 @@ import (
 	"time"
 
 	"github.com/chenzhiguo/market-sentinel/internal/config"
+	"github.com/chenzhiguo/market-sentinel/internal/events"
 	"github.com/chenzhiguo/market-sentinel/internal/storage"
 )
 
 type Reporter struct {
 	cfg   *config.Config
-	store *storage.Storage
+	store storage.Store
 }
 
-func New(cfg *config.Config, store *storage.Storage) *Reporter {
+func New(cfg *config.Config, store storage.Store) *Reporter {
 	return &Reporter{
 		cfg:   cfg,
 		store: store,
@@ -50,14 +51,36 @@ type MarketMood struct {
 }
 
 type HighlightItem struct {
-	NewsID    string                `json:"news_id"`
-	Source    string                `json:"source"`
-	Author    string                `json:"author"`
-	Content   string                `json:"content"`
-	Sentiment string                `json:"sentiment"`
-	Impact    string                `json:"impact"`
-	Summary   string                `json:"summary"`
-	Stocks    []storage.StockImpact `json:"stocks"`
+	NewsID     string                `json:"news_id"`
+	EventID    string                `json:"event_id"`
+	EventTitle string                `json:"event_title"`
+	Stories    int                   `json:"stories"`  // stories in the event
+	Mentions   int                   `json:"mentions"` // news items across those stories
+	Source     string                `json:"source"`
+	Author     string                `json:"author"`
+	Content    string                `json:"content"`
+	Sentiment  string                `json:"sentiment"`
+	Impact     string                `json:"impact"`
+	Summary    string                `json:"summary"`
+	Stocks     []storage.StockImpact `json:"stocks"`
+}
+
+// leadMember picks the event's most impactful, most repeated story, or nil
+// when none of its stories is high or medium impact
+func leadMember(e events.Event) *events.Member {
+	rank := map[string]int{"high": 2, "medium": 1}
+	var lead *events.Member
+	for i := range e.Members {
+		m := &e.Members[i]
+		if rank[m.Impact] == 0 {
+			continue
+		}
+		if lead == nil || rank[m.Impact] > rank[lead.Impact] ||
+			(rank[m.Impact] == rank[lead.Impact] && m.Mentions > lead.Mentions) {
+			lead = m
+		}
+	}
+	return lead
 }
 
 type StockSummary struct {
@@ -93,31 +116,40 @@ func (r *Reporter) generateReport(ctx context.Context, reportType, title string,
 	// Calculate market mood
 	mood := calculateMarketMood(analyses)
 
-	// Get highlights (high impact items)
+	// Get highlights: one per event, so a story told ten ways shows up once
+	members, err := events.Members(r.store, analyses)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load news for analyses: %w", err)
+	}
 	var highlights []HighlightItem
-	stockScores := make(map[string][]int)
-
-	for _, a := range analyses {
-		// Fetch original news
-		news, _ := r.store.GetNews(a.NewsID)
-		
-		if a.ImpactLevel == "high" || a.ImpactLevel == "medium" {
-			item := HighlightItem{
-				NewsID:    a.NewsID,
-				Sentiment: a.Sentiment,
-				Impact:    a.ImpactLevel,
-				Summary:   a.Summary,
-				Stocks:    a.StockDetails,
-			}
-			if news != nil {
-				item.Source = news.Source
-				item.Author = news.Author
-				item.Content = truncate(news.Content, 200)
-			}
-			highlights = append(highlights, item)
+	for _, e := range events.Cluster(members, until) {
+		lead := leadMember(e)
+		if lead == nil {
+			continue
+		}
+		a := lead.Analysis
+		item := HighlightItem{
+			NewsID:     a.NewsID,
+			EventID:    e.ID,
+			EventTitle: e.Title,
+			Stories:    e.StoryCount,
+			Mentions:   e.MentionCount,
+			Sentiment:  a.Sentiment,
+			Impact:     a.ImpactLevel,
+			Summary:    a.Summary,
+			Stocks:     a.StockDetails,
 		}
+		if news := lead.News; news != nil {
+			item.Source = news.Source
+			item.Author = news.Author
+			item.Content = truncate(news.Content, 200)
+		}
+		highlights = append(highlights, item)
+	}
 
-		// Aggregate stock scores
+	// Aggregate stock scores
+	stockScores := make(map[string][]int)
+	for _, a := range analyses {
 		for _, stock := range a.StockDetails {
 			stockScores[stock.Symbol] = append(stockScores[stock.Symbol], stock.Score)
 		}
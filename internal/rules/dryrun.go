@@ -0,0 +1,90 @@
+package rules
+
+import (
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+// MaxDryRun caps the analyses one dry run evaluates
+const MaxDryRun = 10000
+
+// DryRunMatch is an analysis the rule would have alerted on
+type DryRunMatch struct {
+	AnalysisID string    `json:"analysis_id"`
+	NewsID     string    `json:"news_id"`
+	Title      string    `json:"title"`
+	Source     string    `json:"source"`
+	Symbols    []string  `json:"symbols"`
+	AnalyzedAt time.Time `json:"analyzed_at"`
+}
+
+// DryRunResult summarizes a rule evaluated against stored analyses
+type DryRunResult struct {
+	Rule      Rule           `json:"rule"`
+	Since     time.Time      `json:"since"`
+	Until     time.Time      `json:"until"`
+	Evaluated int            `json:"evaluated"`
+	Matched   int            `json:"matched"`
+	Truncated bool           `json:"truncated"` // stopped after MaxDryRun analyses
+	Symbols   map[string]int `json:"symbols"`   // matches per symbol
+	Matches   []DryRunMatch  `json:"matches"`   // the latest matches, up to the limit
+}
+
+// DryRun evaluates r alone against the analyses in (since, until], each as
+// of when it was analyzed: mentions and velocity count analyses up to it. No
+// alerts are created. r must be compiled.
+func (s *Set) DryRun(r Rule, since, until time.Time, limit int) (*DryRunResult, error) {
+	res := &DryRunResult{Rule: r, Since: since, Until: until, Symbols: make(map[string]int), Matches: []DryRunMatch{}}
+	rules := []Rule{r}
+	c := storage.Cursor{Time: since}
+scan:
+	for {
+		page, err := s.store.AnalysesAfter(c, until, 500)
+		if err != nil {
+			return nil, err
+		}
+		for i := range page {
+			if res.Evaluated == MaxDryRun {
+				res.Truncated = true
+				break scan
+			}
+			a := &page[i]
+			res.Evaluated++
+			news, err := s.store.GetNews(a.NewsID)
+			if err != nil {
+				return nil, err
+			}
+			d, err := s.decide(rules, a, news)
+			if err != nil {
+				return nil, err
+			}
+			if d == nil {
+				continue
+			}
+			res.Matched++
+			for _, sym := range d.Symbols {
+				res.Symbols[sym]++
+			}
+			m := DryRunMatch{AnalysisID: a.ID, NewsID: a.NewsID, Symbols: d.Symbols, AnalyzedAt: a.AnalyzedAt}
+			if news != nil {
+				m.Title, m.Source = news.Title, news.Source
+			}
+			// keep the latest: analyses arrive oldest first
+			res.Matches = append(res.Matches, m)
+			if len(res.Matches) > limit {
+				res.Matches = res.Matches[1:]
+			}
+		}
+		if len(page) < 500 {
+			break
+		}
+		last := page[len(page)-1]
+		c = storage.Cursor{Time: last.AnalyzedAt, ID: last.ID}
+	}
+	// newest first, like the other listings
+	for i, j := 0, len(res.Matches)-1; i < j; i, j = i+1, j-1 {
+		res.Matches[i], res.Matches[j] = res.Matches[j], res.Matches[i]
+	}
+	return res, nil
+}
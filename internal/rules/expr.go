@@ -0,0 +1,546 @@
+package rules
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The expression language is a small typed subset of Go/JS syntax:
+//
+//	impact == "high" && confidence >= 0.8 && abs(score) >= 8
+//	source in ["rss:Reuters", "rss:Bloomberg"] or watchlist == "critical"
+//	contains(author, "musk") and velocity > 3
+//
+// Operators: || or, && and, ! not, == != < <= > >=, in / not in a list
+// literal, unary minus. Strings compare case-insensitively. Functions:
+// abs(number), contains(string, substring). Types are checked when the rule
+// is compiled, so a rule that compiles cannot fail at evaluation.
+
+type kind int
+
+const (
+	kindNum kind = iota
+	kindStr
+	kindBool
+	kindList
+)
+
+func (k kind) String() string {
+	return [...]string{"number", "string", "bool", "list"}[k]
+}
+
+// Variables lists the names rules can use, with their types
+var Variables = map[string]kind{
+	"impact":          kindStr,  // high, medium, low
+	"sentiment":       kindStr,  // positive, negative, neutral
+	"sentiment_score": kindNum,  // analysis score, -1 to 1
+	"confidence":      kindNum,  // 0 to 1
+	"source":          kindStr,  // news source, e.g. rss:Reuters
+	"author":          kindStr,  // news author or account
+	"watchlist":       kindStr,  // watchlist priority of the author or feed, "" if not listed
+	"watchlisted":     kindBool, // author or feed is on the watchlist
+	"symbol":          kindStr,  // the symbol being evaluated
+	"score":           kindNum,  // per-symbol score, -10 to 10
+	"mentions":        kindNum,  // analyses mentioning the symbol in the velocity window
+	"velocity":        kindNum,  // mentions relative to the baseline average window
+}
+
+// Env supplies variable values during evaluation
+type Env interface {
+	Get(name string) interface{} // float64, string or bool
+}
+
+// Expr is a compiled, type-checked expression
+type Expr struct {
+	src  string
+	root node
+	vars map[string]bool // variables referenced
+}
+
+// Compile parses src, which must be a boolean expression
+func Compile(src string) (*Expr, error) {
+	p := &parser{src: src}
+	if err := p.lex(); err != nil {
+		return nil, err
+	}
+	e := &Expr{src: src, vars: make(map[string]bool)}
+	p.vars = e.vars
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "unexpected %q", t.text)
+	}
+	if root.kind() != kindBool {
+		return nil, fmt.Errorf("expression is a %s, want a condition", root.kind())
+	}
+	e.root = root
+	return e, nil
+}
+
+// Match evaluates the expression
+func (e *Expr) Match(env Env) bool {
+	return e.root.eval(env).(bool)
+}
+
+// Uses reports whether the expression references variable name
+func (e *Expr) Uses(name string) bool {
+	return e.vars[name]
+}
+
+func (e *Expr) String() string { return e.src }
+
+// nodes
+
+type node interface {
+	kind() kind
+	eval(env Env) interface{}
+}
+
+type literal struct {
+	k kind
+	v interface{}
+}
+
+func (n literal) kind() kind           { return n.k }
+func (n literal) eval(Env) interface{} { return n.v }
+
+type variable string
+
+func (n variable) kind() kind             { return Variables[string(n)] }
+func (n variable) eval(e Env) interface{} { return e.Get(string(n)) }
+
+type not struct{ x node }
+
+func (not) kind() kind               { return kindBool }
+func (n not) eval(e Env) interface{} { return !n.x.eval(e).(bool) }
+
+type neg struct{ x node }
+
+func (neg) kind() kind               { return kindNum }
+func (n neg) eval(e Env) interface{} { return -n.x.eval(e).(float64) }
+
+type logical struct {
+	and  bool
+	l, r node
+}
+
+func (logical) kind() kind { return kindBool }
+func (n logical) eval(e Env) interface{} {
+	l := n.l.eval(e).(bool)
+	if n.and != l { // false && x, true || x
+		return l
+	}
+	return n.r.eval(e).(bool)
+}
+
+type compare struct {
+	op   string
+	l, r node
+}
+
+func (compare) kind() kind { return kindBool }
+func (n compare) eval(e Env) interface{} {
+	l, r := n.l.eval(e), n.r.eval(e)
+	switch l := l.(type) {
+	case float64:
+		r := r.(float64)
+		switch n.op {
+		case "==":
+			return l == r
+		case "!=":
+			return l != r
+		case "<":
+			return l < r
+		case "<=":
+			return l <= r
+		case ">":
+			return l > r
+		default:
+			return l >= r
+		}
+	case string:
+		eq := strings.EqualFold(l, r.(string))
+		return eq == (n.op == "==")
+	default:
+		eq := l == r
+		return eq == (n.op == "==")
+	}
+}
+
+type in struct {
+	negate bool
+	x      node
+	list   []interface{}
+}
+
+func (in) kind() kind { return kindBool }
+func (n in) eval(e Env) interface{} {
+	x := n.x.eval(e)
+	for _, v := range n.list {
+		if s, ok := x.(string); ok && strings.EqualFold(s, v.(string)) || x == v {
+			return !n.negate
+		}
+	}
+	return n.negate
+}
+
+type call struct {
+	fn   string
+	args []node
+}
+
+// functions maps each function to its argument and result types
+var functions = map[string]struct {
+	args []kind
+	ret  kind
+}{
+	"abs":      {[]kind{kindNum}, kindNum},
+	"contains": {[]kind{kindStr, kindStr}, kindBool},
+}
+
+func (n call) kind() kind { return functions[n.fn].ret }
+func (n call) eval(e Env) interface{} {
+	switch n.fn {
+	case "abs":
+		return math.Abs(n.args[0].eval(e).(float64))
+	default:
+		return strings.Contains(strings.ToLower(n.args[0].eval(e).(string)), strings.ToLower(n.args[1].eval(e).(string)))
+	}
+}
+
+// lexer
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokNum
+	tokStr
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+	num  float64
+	str  string
+}
+
+type parser struct {
+	src  string
+	toks []token
+	i    int
+	vars map[string]bool
+}
+
+func (p *parser) errorf(t token, format string, args ...interface{}) error {
+	return fmt.Errorf("at %d: %s", t.pos+1, fmt.Sprintf(format, args...))
+}
+
+var twoCharOps = []string{"&&", "||", "==", "!=", "<=", ">="}
+
+func (p *parser) lex() error {
+	s := p.src
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c >= '0' && c <= '9' || c == '.':
+			j := i
+			for j < len(s) && (s[j] >= '0' && s[j] <= '9' || s[j] == '.') {
+				j++
+			}
+			f, err := strconv.ParseFloat(s[i:j], 64)
+			if err != nil {
+				return fmt.Errorf("at %d: bad number %q", i+1, s[i:j])
+			}
+			p.toks = append(p.toks, token{kind: tokNum, text: s[i:j], pos: i, num: f})
+			i = j
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(s) && rune(s[j]) != c {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return fmt.Errorf("at %d: unterminated string", i+1)
+			}
+			body := s[i+1 : j]
+			if c == '\'' {
+				body = strings.ReplaceAll(strings.ReplaceAll(body, `"`, `\"`), `\'`, `'`)
+			}
+			str, err := strconv.Unquote(`"` + body + `"`)
+			if err != nil {
+				return fmt.Errorf("at %d: bad string %s", i+1, s[i:j+1])
+			}
+			p.toks = append(p.toks, token{kind: tokStr, text: s[i : j+1], pos: i, str: str})
+			i = j + 1
+		case c == '_' || unicode.IsLetter(c):
+			j := i
+			for j < len(s) && (s[j] == '_' || unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			p.toks = append(p.toks, token{kind: tokIdent, text: s[i:j], pos: i})
+			i = j
+		default:
+			op := string(c)
+			for _, two := range twoCharOps {
+				if strings.HasPrefix(s[i:], two) {
+					op = two
+				}
+			}
+			if !strings.Contains("!<>()[],-", op) && len(op) == 1 {
+				return fmt.Errorf("at %d: unexpected %q", i+1, op)
+			}
+			p.toks = append(p.toks, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	p.toks = append(p.toks, token{kind: tokEOF, text: "end of expression", pos: len(s)})
+	return nil
+}
+
+func (p *parser) peek() token { return p.toks[p.i] }
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// accept consumes the next token if it is one of the operators or keywords
+func (p *parser) accept(texts ...string) (token, bool) {
+	t := p.peek()
+	if t.kind == tokOp || t.kind == tokIdent {
+		for _, s := range texts {
+			if t.text == s {
+				return p.next(), true
+			}
+		}
+	}
+	return t, false
+}
+
+func (p *parser) expect(text string) error {
+	if t, ok := p.accept(text); !ok {
+		return p.errorf(t, "expected %q, found %q", text, t.text)
+	}
+	return nil
+}
+
+// parser, lowest precedence first
+
+func (p *parser) parseOr() (node, error) {
+	return p.parseLogical(false, []string{"||", "or"}, p.parseAnd)
+}
+
+func (p *parser) parseAnd() (node, error) {
+	return p.parseLogical(true, []string{"&&", "and"}, p.parseNot)
+}
+
+func (p *parser) parseLogical(and bool, ops []string, operand func() (node, error)) (node, error) {
+	l, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t, ok := p.accept(ops...)
+		if !ok {
+			return l, nil
+		}
+		r, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		if l.kind() != kindBool || r.kind() != kindBool {
+			return nil, p.errorf(t, "%s needs conditions on both sides", t.text)
+		}
+		l = logical{and: and, l: l, r: r}
+	}
+}
+
+func (p *parser) parseNot() (node, error) {
+	if t, ok := p.accept("!", "not"); ok {
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if x.kind() != kindBool {
+			return nil, p.errorf(t, "%s needs a condition", t.text)
+		}
+		return not{x}, nil
+	}
+	return p.parseCompare()
+}
+
+func (p *parser) parseCompare() (node, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if t, ok := p.accept("==", "!=", "<", "<=", ">", ">="); ok {
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if l.kind() != r.kind() || l.kind() == kindList {
+			return nil, p.errorf(t, "cannot compare %s with %s", l.kind(), r.kind())
+		}
+		if l.kind() != kindNum && t.text != "==" && t.text != "!=" {
+			return nil, p.errorf(t, "%s needs numbers", t.text)
+		}
+		return compare{op: t.text, l: l, r: r}, nil
+	}
+
+	negate := false
+	if t := p.peek(); t.kind == tokIdent && t.text == "not" && p.toks[p.i+1].text == "in" {
+		p.next()
+		negate = true
+	}
+	if t, ok := p.accept("in"); ok {
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		list, isList := r.(literal)
+		if !isList || list.k != kindList {
+			return nil, p.errorf(t, "in needs a list like [\"a\", \"b\"]")
+		}
+		items := list.v.([]interface{})
+		for _, v := range items {
+			if (l.kind() == kindNum) != isNum(v) || l.kind() == kindBool || l.kind() == kindList {
+				return nil, p.errorf(t, "cannot look for a %s in this list", l.kind())
+			}
+		}
+		return in{negate: negate, x: l, list: items}, nil
+	}
+	return l, nil
+}
+
+func isNum(v interface{}) bool {
+	_, ok := v.(float64)
+	return ok
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if t, ok := p.accept("-"); ok {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if x.kind() != kindNum {
+			return nil, p.errorf(t, "- needs a number")
+		}
+		if lit, ok := x.(literal); ok {
+			return literal{kindNum, -lit.v.(float64)}, nil
+		}
+		return neg{x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNum:
+		return literal{kindNum, t.num}, nil
+	case tokStr:
+		return literal{kindStr, t.str}, nil
+	case tokIdent:
+		switch t.text {
+		case "true", "false":
+			return literal{kindBool, t.text == "true"}, nil
+		}
+		if fn, ok := functions[t.text]; ok {
+			return p.parseCall(t, fn.args)
+		}
+		if _, ok := Variables[t.text]; !ok {
+			if p.peek().text == "(" {
+				return nil, p.errorf(t, "unknown function %q (functions: abs, contains)", t.text)
+			}
+			return nil, p.errorf(t, "unknown name %q (variables: %s)", t.text, strings.Join(variableNames(), ", "))
+		}
+		p.vars[t.text] = true
+		return variable(t.text), nil
+	case tokOp:
+		switch t.text {
+		case "(":
+			x, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		case "[":
+			return p.parseList()
+		}
+	}
+	return nil, p.errorf(t, "unexpected %q", t.text)
+}
+
+func (p *parser) parseCall(name token, args []kind) (node, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	c := call{fn: name.text}
+	for i := range args {
+		if i > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if x.kind() != args[i] {
+			return nil, p.errorf(name, "%s argument %d must be a %s", name.text, i+1, args[i])
+		}
+		c.args = append(c.args, x)
+	}
+	return c, p.expect(")")
+}
+
+// parseList reads a list of literals after "["
+func (p *parser) parseList() (node, error) {
+	var items []interface{}
+	for {
+		if _, ok := p.accept("]"); ok {
+			return literal{kindList, items}, nil
+		}
+		if len(items) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		lit, ok := x.(literal)
+		if !ok || (lit.k != kindNum && lit.k != kindStr) {
+			return nil, p.errorf(p.peek(), "lists hold only numbers and strings")
+		}
+		items = append(items, lit.v)
+	}
+}
+
+func variableNames() []string {
+	names := make([]string, 0, len(Variables))
+	for n := range Variables {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
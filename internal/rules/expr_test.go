@@ -0,0 +1,95 @@
+package rules
+
+import (
+	"strings"
+	"testing"
+)
+
+type mapEnv map[string]interface{}
+
+func (m mapEnv) Get(name string) interface{} { return m[name] }
+
+func TestExprMatch(t *testing.T) {
+	env := mapEnv{
+		"impact": "high", "sentiment": "negative", "sentiment_score": -0.6, "confidence": 0.9,
+		"source": "rss:Reuters", "author": "Elon Musk", "watchlist": "critical", "watchlisted": true,
+		"symbol": "TSLA", "score": -8.0, "mentions": 12.0, "velocity": 4.5,
+	}
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{`impact == "high"`, true},
+		{`impact == "HIGH"`, true},
+		{`impact != "high"`, false},
+		{`confidence > 0.8 && abs(score) >= 8`, true},
+		{`confidence > 0.95 || score <= -8`, true},
+		{`confidence > 0.95 or velocity < 2`, false},
+		{`!watchlisted`, false},
+		{`not (watchlisted and sentiment == "positive")`, true},
+		{`watchlisted == true`, true},
+		{`source in ["rss:Bloomberg", "rss:reuters"]`, true},
+		{`symbol not in ["TSLA", "NVDA"]`, false},
+		{`score in [-8, 8]`, true},
+		{`contains(author, "musk")`, true},
+		{`sentiment_score < -0.5 and score == -8`, true},
+		{`-score > 7`, true},
+		{`mentions >= 10 && velocity > 3 && !(impact == "low")`, true},
+		{`1 < 2 && 2 <= 2 && 3 != 4`, true},
+	}
+	for _, tt := range tests {
+		e, err := Compile(tt.src)
+		if err != nil {
+			t.Errorf("Compile(%s): %v", tt.src, err)
+			continue
+		}
+		if got := e.Match(env); got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestExprShortCircuit(t *testing.T) {
+	e, err := Compile(`impact == "low" && velocity > 3`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// velocity is not looked up once impact rules the rule out
+	if e.Match(mapEnv{"impact": "high"}) {
+		t.Error("matched")
+	}
+	if !e.Uses("velocity") || e.Uses("mentions") {
+		t.Errorf("Uses: velocity %v, mentions %v", e.Uses("velocity"), e.Uses("mentions"))
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{``, "unexpected"},
+		{`impact`, "want a condition"},
+		{`impact == `, "unexpected"},
+		{`price > 10`, "unknown name"},
+		{`impact > 1`, "string"},
+		{`confidence == "high"`, "number"},
+		{`abs(impact) > 1`, "abs"},
+		{`nope(score)`, "unknown function"},
+		{`symbol in ["TSLA", 8]`, "list"},
+		{`(score > 1`, ")"},
+		{`impact == "high`, "unterminated"},
+		{`score > 1 score`, "unexpected"},
+		{`score # 1`, "unexpected"},
+	}
+	for _, tt := range tests {
+		_, err := Compile(tt.src)
+		if err == nil {
+			t.Errorf("Compile(%s) succeeded", tt.src)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Compile(%s) = %v, want it to mention %q", tt.src, err, tt.want)
+		}
+	}
+}
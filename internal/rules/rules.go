@@ -0,0 +1,340 @@
+// Package rules decides which analyses raise alerts. A rule is a boolean
+// expression (see Compile) evaluated for each symbol of an analysis, with
+// the severity and notifier channels of the alert it raises. Rules come from
+// alerting.rules in the config, or DefaultRules when that is empty, plus
+// rules created through the API.
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+// Rule sources
+const (
+	SourceDefault = "default"
+	SourceConfig  = "config"
+	SourceAPI     = "api"
+)
+
+// Severities are the accepted rule severities, lowest first
+var Severities = []string{"high", "critical"}
+
+// Rule is a compiled alert rule
+type Rule struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	When     string   `json:"when"`
+	Severity string   `json:"severity"`
+	Channels []string `json:"channels,omitempty"`
+	Enabled  bool     `json:"enabled"`
+	Source   string   `json:"source"`
+
+	expr *Expr
+}
+
+// DefaultRules reproduce the conditions alerts used before rules were
+// configurable: high impact with a non-zero score, critical when the model
+// is confident and a symbol scores ±8 or more
+var DefaultRules = []Rule{
+	{ID: "high-impact", Name: "高影响事件", Severity: "high",
+		When: `impact == "high" && sentiment_score != 0`},
+	{ID: "high-impact-strong", Name: "高影响强信号", Severity: "critical",
+		When: `impact == "high" && sentiment_score != 0 && confidence > 0.8 && abs(score) >= 8`},
+}
+
+// Compile checks r's severity and compiles its expression
+func (r *Rule) Compile() error {
+	if SeverityRank(r.Severity) < 0 {
+		return fmt.Errorf("rule %q: severity must be one of %v", r.Name, Severities)
+	}
+	expr, err := Compile(r.When)
+	if err != nil {
+		return fmt.Errorf("rule %q: %w", r.Name, err)
+	}
+	r.expr = expr
+	return nil
+}
+
+// FromStored converts a rule created through the API
+func FromStored(sr storage.AlertRule) Rule {
+	return Rule{
+		ID:       sr.ID,
+		Name:     sr.Name,
+		When:     sr.When,
+		Severity: sr.Severity,
+		Channels: sr.Channels,
+		Enabled:  sr.Enabled,
+		Source:   SourceAPI,
+	}
+}
+
+// SeverityRank orders severities: the index in Severities, -1 if unknown
+func SeverityRank(s string) int {
+	for i, v := range Severities {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// Decision is what the matching rules decided for one analysis
+type Decision struct {
+	Rule     string   `json:"rule"` // rule that set the severity
+	Name     string   `json:"name"` // that rule's name
+	Severity string   `json:"severity"`
+	Symbols  []string `json:"symbols"` // symbols any rule matched
+	Channels []string `json:"channels,omitempty"`
+	Matched  []string `json:"matched"` // every matching rule
+}
+
+// Set holds the active rules
+type Set struct {
+	cfg       config.AlertingConfig
+	store     storage.Store
+	watchlist *Watchlist
+	static    []Rule // config or default rules
+
+	mu     sync.RWMutex
+	active []Rule // enabled static and stored rules
+}
+
+// NewSet compiles the config rules and loads the stored ones. A missing
+// watchlist file leaves the watchlist variables empty. Without a store
+// only the config rules apply and mentions and velocity are 0.
+func NewSet(cfg config.AlertingConfig, store storage.Store) (*Set, error) {
+	if cfg.VelocityWindow <= 0 {
+		cfg.VelocityWindow = time.Hour
+	}
+	if cfg.VelocityBaseline < cfg.VelocityWindow {
+		cfg.VelocityBaseline = 24 * cfg.VelocityWindow
+	}
+	s := &Set{cfg: cfg, store: store}
+
+	if cfg.Watchlist != "" {
+		w, err := LoadWatchlist(cfg.Watchlist)
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+			log.Printf("Rules: watchlist %s not found, watchlist variables are empty", cfg.Watchlist)
+		}
+		s.watchlist = w
+	}
+
+	if len(cfg.Rules) == 0 {
+		for _, r := range DefaultRules {
+			r.Enabled, r.Source = true, SourceDefault
+			s.static = append(s.static, r)
+		}
+	}
+	seen := make(map[string]bool)
+	for i, rc := range cfg.Rules {
+		if rc.Name == "" {
+			return nil, fmt.Errorf("alerting.rules[%d]: name is required", i)
+		}
+		if seen[rc.Name] {
+			return nil, fmt.Errorf("alerting.rules[%d]: duplicate name %q", i, rc.Name)
+		}
+		seen[rc.Name] = true
+		s.static = append(s.static, Rule{
+			ID: rc.Name, Name: rc.Name, When: rc.When, Severity: rc.Severity,
+			Channels: rc.Channels, Enabled: true, Source: SourceConfig,
+		})
+	}
+	for i := range s.static {
+		if err := s.static[i].Compile(); err != nil {
+			return nil, err
+		}
+	}
+	return s, s.Reload()
+}
+
+// Reload re-reads the rules created through the API. A stored rule that no
+// longer compiles is skipped.
+func (s *Set) Reload() error {
+	active := append([]Rule(nil), s.static...)
+	if s.store != nil {
+		stored, err := s.store.ListAlertRules()
+		if err != nil {
+			return fmt.Errorf("failed to load alert rules: %w", err)
+		}
+		for _, sr := range stored {
+			r := FromStored(sr)
+			if !r.Enabled {
+				continue
+			}
+			if err := r.Compile(); err != nil {
+				log.Printf("Rules: skipping %s: %v", r.ID, err)
+				continue
+			}
+			active = append(active, r)
+		}
+	}
+	s.mu.Lock()
+	s.active = active
+	s.mu.Unlock()
+	return nil
+}
+
+// Static returns the config (or default) rules, which the API cannot change
+func (s *Set) Static() []Rule {
+	return append([]Rule(nil), s.static...)
+}
+
+// Evaluate runs the active rules over an analysis and its news item (which
+// may be nil). It returns nil when no rule matches.
+func (s *Set) Evaluate(a *storage.Analysis, news *storage.NewsItem) (*Decision, error) {
+	s.mu.RLock()
+	active := s.active
+	s.mu.RUnlock()
+	return s.decide(active, a, news)
+}
+
+func (s *Set) decide(rules []Rule, a *storage.Analysis, news *storage.NewsItem) (*Decision, error) {
+	now := a.AnalyzedAt
+	if now.IsZero() {
+		now = time.Now()
+	}
+	env := &env{set: s, a: a, news: news, now: now, counts: make(map[string][2]float64)}
+	env.priority = s.watchlist.Priority(news)
+
+	// an analysis without symbols is evaluated once, scored as a whole
+	subjects := storage.MentionsFor(a)
+	if len(subjects) == 0 {
+		subjects = []storage.StockMention{{Score: a.SentimentScore}}
+	}
+
+	var d *Decision
+	matchedSymbol := make(map[string]bool)
+	for _, r := range rules {
+		hit := false
+		for _, m := range subjects {
+			env.mention = m
+			if r.expr.Match(env) {
+				hit = true
+				matchedSymbol[m.Symbol] = true
+			}
+		}
+		if env.err != nil {
+			return nil, env.err
+		}
+		if !hit {
+			continue
+		}
+		if d == nil {
+			d = &Decision{Rule: r.ID, Name: r.Name, Severity: r.Severity}
+		} else if SeverityRank(r.Severity) > SeverityRank(d.Severity) {
+			d.Rule, d.Name, d.Severity = r.ID, r.Name, r.Severity
+		}
+		d.Matched = append(d.Matched, r.ID)
+		for _, ch := range r.Channels {
+			if !contains(d.Channels, ch) {
+				d.Channels = append(d.Channels, ch)
+			}
+		}
+	}
+	if d != nil {
+		for _, m := range subjects {
+			if m.Symbol != "" && matchedSymbol[m.Symbol] {
+				d.Symbols = append(d.Symbols, m.Symbol)
+			}
+		}
+	}
+	return d, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// env evaluates one analysis. Mention counts are looked up once per symbol
+// and only when a rule uses them.
+type env struct {
+	set      *Set
+	a        *storage.Analysis
+	news     *storage.NewsItem
+	now      time.Time
+	priority string
+	mention  storage.StockMention
+	counts   map[string][2]float64 // symbol -> mentions, velocity
+	err      error
+}
+
+func (e *env) Get(name string) interface{} {
+	switch name {
+	case "impact":
+		return e.a.ImpactLevel
+	case "sentiment":
+		return e.a.Sentiment
+	case "sentiment_score":
+		return e.a.SentimentScore
+	case "confidence":
+		return e.a.Confidence
+	case "source", "author":
+		if e.news == nil {
+			return ""
+		}
+		if name == "source" {
+			return e.news.Source
+		}
+		return e.news.Author
+	case "watchlist":
+		return e.priority
+	case "watchlisted":
+		return e.priority != ""
+	case "symbol":
+		return e.mention.Symbol
+	case "score":
+		return e.mention.Score
+	case "mentions":
+		return e.velocity()[0]
+	case "velocity":
+		return e.velocity()[1]
+	}
+	panic("rules: unknown variable " + name) // Compile rejects unknown names
+}
+
+// velocity counts analyses mentioning the symbol in the window ending at
+// the analysis, and divides by the average window over the baseline before
+// it, floored at one mention so a quiet symbol is not a surge on its own
+func (e *env) velocity() [2]float64 {
+	sym := e.mention.Symbol
+	if sym == "" || e.err != nil || e.set.store == nil {
+		return [2]float64{}
+	}
+	if c, ok := e.counts[sym]; ok {
+		return c
+	}
+	window, baseline := e.set.cfg.VelocityWindow, e.set.cfg.VelocityBaseline
+	recent, err := e.set.store.CountMentions(sym, e.now.Add(-window), e.now)
+	if err != nil {
+		e.err = err
+		return [2]float64{}
+	}
+	before, err := e.set.store.CountMentions(sym, e.now.Add(-window-baseline), e.now.Add(-window))
+	if err != nil {
+		e.err = err
+		return [2]float64{}
+	}
+	avg := float64(before) / (float64(baseline) / float64(window))
+	if avg < 1 {
+		avg = 1
+	}
+	c := [2]float64{float64(recent), float64(recent) / avg}
+	e.counts[sym] = c
+	return c
+}
@@ -0,0 +1,247 @@
+package rules
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+func newTestStore(t *testing.T) *storage.Storage {
+	t.Helper()
+	s, err := storage.New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestDefaultRules(t *testing.T) {
+	set, err := NewSet(config.AlertingConfig{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		a        storage.Analysis
+		severity string // "" for no alert
+	}{
+		{"medium impact", storage.Analysis{ImpactLevel: "medium", SentimentScore: 0.9, Confidence: 0.95,
+			StockDetails: []storage.StockImpact{{Symbol: "NVDA", Score: 9}}}, ""},
+		{"neutral score", storage.Analysis{ImpactLevel: "high", Confidence: 0.95,
+			StockDetails: []storage.StockImpact{{Symbol: "NVDA", Score: 9}}}, ""},
+		{"high", storage.Analysis{ImpactLevel: "high", SentimentScore: 0.5, Confidence: 0.95,
+			StockDetails: []storage.StockImpact{{Symbol: "NVDA", Score: 7}}}, "high"},
+		{"low confidence", storage.Analysis{ImpactLevel: "high", SentimentScore: -0.5, Confidence: 0.7,
+			StockDetails: []storage.StockImpact{{Symbol: "NVDA", Score: -9}}}, "high"},
+		{"critical", storage.Analysis{ImpactLevel: "high", SentimentScore: -0.5, Confidence: 0.9,
+			StockDetails: []storage.StockImpact{{Symbol: "AAPL", Score: -2}, {Symbol: "NVDA", Score: -8}}}, "critical"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := set.Evaluate(&tt.a, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.severity == "" {
+				if d != nil {
+					t.Errorf("decision = %+v, want none", d)
+				}
+				return
+			}
+			if d == nil || d.Severity != tt.severity {
+				t.Fatalf("decision = %+v, want %s", d, tt.severity)
+			}
+		})
+	}
+}
+
+func TestEvaluatePerSymbol(t *testing.T) {
+	cfg := config.AlertingConfig{Rules: []config.RuleConfig{
+		{Name: "nvda-drop", When: `symbol == "NVDA" && score <= -5`, Severity: "critical", Channels: []string{"desk"}},
+		{Name: "negative", When: `sentiment == "negative"`, Severity: "high", Channels: []string{"ops", "desk"}},
+		{Name: "positive", When: `sentiment == "positive"`, Severity: "critical"},
+	}}
+	set, err := NewSet(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &storage.Analysis{Sentiment: "negative", SentimentScore: -0.4, RelatedStocks: []string{"AAPL"},
+		StockDetails: []storage.StockImpact{{Symbol: "NVDA", Score: -6}, {Symbol: "AMD", Score: -1}}}
+	d, err := set.Evaluate(a, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Decision{
+		Rule: "nvda-drop", Name: "nvda-drop", Severity: "critical",
+		Symbols:  []string{"NVDA", "AMD", "AAPL"},
+		Channels: []string{"desk", "ops"},
+		Matched:  []string{"nvda-drop", "negative"},
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("decision = %+v\nwant %+v", d, want)
+	}
+
+	// only the symbols a rule matched are alerted on
+	a.Sentiment = "neutral"
+	d, err = set.Evaluate(a, nil)
+	if err != nil || d == nil || !reflect.DeepEqual(d.Symbols, []string{"NVDA"}) {
+		t.Errorf("decision = %+v, %v", d, err)
+	}
+}
+
+func TestNewSetErrors(t *testing.T) {
+	tests := []config.AlertingConfig{
+		{Rules: []config.RuleConfig{{When: `impact == "high"`, Severity: "high"}}},
+		{Rules: []config.RuleConfig{{Name: "a", When: `impact == "high"`, Severity: "low"}}},
+		{Rules: []config.RuleConfig{{Name: "a", When: `impact = "high"`, Severity: "high"}}},
+		{Rules: []config.RuleConfig{
+			{Name: "a", When: `impact == "high"`, Severity: "high"},
+			{Name: "a", When: `impact == "low"`, Severity: "high"},
+		}},
+	}
+	for i, cfg := range tests {
+		if _, err := NewSet(cfg, nil); err == nil {
+			t.Errorf("config %d loaded", i)
+		}
+	}
+}
+
+func TestWatchlistVariables(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "watchlist.yaml")
+	yaml := `twitter:
+  ceo:
+    - handle: "@elonmusk"
+      priority: critical
+rss:
+  news:
+    - name: Reuters Business
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.AlertingConfig{Watchlist: path, Rules: []config.RuleConfig{
+		{Name: "ceo", When: `watchlist == "critical"`, Severity: "critical"},
+		{Name: "listed", When: `watchlisted`, Severity: "high"},
+	}}
+	set, err := NewSet(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &storage.Analysis{}
+	for author, want := range map[string]string{"elonmusk": "critical", "reuters business": "high", "someone": ""} {
+		d, err := set.Evaluate(a, &storage.NewsItem{Author: author})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if d != nil {
+			got = d.Severity
+		}
+		if got != want {
+			t.Errorf("%s: severity %q, want %q", author, got, want)
+		}
+	}
+
+	cfg.Watchlist = filepath.Join(t.TempDir(), "missing.yaml")
+	if _, err := NewSet(cfg, nil); err != nil {
+		t.Errorf("missing watchlist: %v", err)
+	}
+}
+
+// seedMentions stores one analysis of symbol at each time
+func seedMentions(t *testing.T, s *storage.Storage, symbol string, times ...time.Time) {
+	t.Helper()
+	for _, at := range times {
+		id := fmt.Sprintf("%s_%d", symbol, at.UnixNano())
+		if err := s.SaveNews(&storage.NewsItem{ID: id, Source: "rss:Test", Title: symbol + " news", PublishedAt: at}); err != nil {
+			t.Fatal(err)
+		}
+		a := &storage.Analysis{ID: "a_" + id, NewsID: id, ImpactLevel: "medium", Sentiment: "positive",
+			StockDetails: []storage.StockImpact{{Symbol: symbol, Score: 3}}, AnalyzedAt: at}
+		if err := s.SaveAnalysis(a); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestVelocityAndDryRun(t *testing.T) {
+	store := newTestStore(t)
+	now := time.Now().Truncate(time.Minute)
+
+	// a mention every four hours for a day, then six in the last hour
+	var times []time.Time
+	for h := 24; h > 1; h -= 4 {
+		times = append(times, now.Add(-time.Duration(h)*time.Hour))
+	}
+	for i := 5; i >= 0; i-- {
+		times = append(times, now.Add(-time.Duration(i*5)*time.Minute))
+	}
+	seedMentions(t, store, "GME", times...)
+
+	cfg := config.AlertingConfig{Rules: []config.RuleConfig{
+		{Name: "surge", When: `mentions >= 5 && velocity >= 5`, Severity: "high"},
+	}}
+	set, err := NewSet(cfg, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	latest := &storage.Analysis{StockDetails: []storage.StockImpact{{Symbol: "GME", Score: 3}}, AnalyzedAt: now}
+	d, err := set.Evaluate(latest, nil)
+	if err != nil || d == nil || d.Rule != "surge" {
+		t.Fatalf("decision = %+v, %v", d, err)
+	}
+	latest.AnalyzedAt = now.Add(-2 * time.Hour)
+	if d, err := set.Evaluate(latest, nil); d != nil || err != nil {
+		t.Errorf("quiet hour decision = %+v, %v", d, err)
+	}
+
+	rule := set.Static()[0]
+	res, err := set.DryRun(rule, now.Add(-48*time.Hour), now, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the fifth and sixth mentions of the burst reach five in the window
+	if res.Evaluated != len(times) || res.Matched != 2 || res.Symbols["GME"] != 2 || res.Truncated {
+		t.Errorf("dry run = %+v", res)
+	}
+	if len(res.Matches) != 1 || !res.Matches[0].AnalyzedAt.Equal(now) || res.Matches[0].Title != "GME news" {
+		t.Errorf("matches = %+v, want the latest", res.Matches)
+	}
+}
+
+func TestReloadStoredRules(t *testing.T) {
+	store := newTestStore(t)
+	set, err := NewSet(config.AlertingConfig{}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &storage.Analysis{ImpactLevel: "low", Sentiment: "negative"}
+	if d, _ := set.Evaluate(a, nil); d != nil {
+		t.Fatalf("decision before reload = %+v", d)
+	}
+
+	for _, r := range []storage.AlertRule{
+		{ID: "rule_neg", Name: "negative", When: `sentiment == "negative"`, Severity: "high", Enabled: true},
+		{ID: "rule_off", Name: "off", When: `sentiment == "negative"`, Severity: "critical"},
+	} {
+		r := r
+		if err := store.CreateAlertRule(&r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := set.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	d, err := set.Evaluate(a, nil)
+	if err != nil || d == nil || !reflect.DeepEqual(d.Matched, []string{"rule_neg"}) {
+		t.Errorf("decision = %+v, %v", d, err)
+	}
+}
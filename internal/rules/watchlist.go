@@ -0,0 +1,73 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+// Watchlist holds the accounts and feeds of configs/watchlist.yaml by
+// priority. Twitter entries match the news author (@handle); RSS entries
+// match the feed title the rss collector stores as the author.
+type Watchlist struct {
+	priority map[string]string // lowercased handle or feed name -> priority
+}
+
+type watchlistFile struct {
+	Twitter map[string][]struct {
+		Handle   string `mapstructure:"handle"`
+		Priority string `mapstructure:"priority"`
+	} `mapstructure:"twitter"`
+	RSS map[string][]struct {
+		Name     string `mapstructure:"name"`
+		Priority string `mapstructure:"priority"`
+	} `mapstructure:"rss"`
+}
+
+// LoadWatchlist reads a watchlist file
+func LoadWatchlist(path string) (*Watchlist, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read watchlist: %w", err)
+	}
+	var f watchlistFile
+	if err := v.Unmarshal(&f); err != nil {
+		return nil, fmt.Errorf("failed to parse watchlist: %w", err)
+	}
+
+	w := &Watchlist{priority: make(map[string]string)}
+	for _, group := range f.Twitter {
+		for _, acct := range group {
+			w.add(strings.TrimPrefix(acct.Handle, "@"), acct.Priority)
+		}
+	}
+	for _, group := range f.RSS {
+		for _, feed := range group {
+			w.add(feed.Name, feed.Priority)
+		}
+	}
+	return w, nil
+}
+
+func (w *Watchlist) add(name, priority string) {
+	if name == "" {
+		return
+	}
+	if priority == "" {
+		priority = "medium"
+	}
+	w.priority[strings.ToLower(name)] = strings.ToLower(priority)
+}
+
+// Priority returns the watchlist priority of news's author, or "" when the
+// author is not listed
+func (w *Watchlist) Priority(news *storage.NewsItem) string {
+	if w == nil || news == nil {
+		return ""
+	}
+	return w.priority[strings.ToLower(strings.TrimPrefix(news.Author, "@"))]
+}
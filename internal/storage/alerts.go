@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Alert states. A snoozed alert is open again once its snooze runs out.
+const (
+	AlertOpen         = "open"
+	AlertAcknowledged = "acknowledged"
+	AlertSnoozed      = "snoozed"
+	AlertResolved     = "resolved"
+)
+
+// ErrAlertState is returned for state changes an alert cannot make
+var ErrAlertState = errors.New("invalid alert state change")
+
+// AlertEvent is one entry of an alert's audit trail: a state change, who
+// made it and when
+type AlertEvent struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	AlertID      string     `json:"alert_id" gorm:"index:idx_alert_events_alert"`
+	FromState    string     `json:"from"`
+	ToState      string     `json:"to"`
+	Actor        string     `json:"actor"`
+	Note         string     `json:"note,omitempty"`
+	SnoozedUntil *time.Time `json:"snoozed_until,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// AlertUpdate is a follow-up item attached to an existing alert instead of
+// raising a new one
+type AlertUpdate struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	AlertID    string    `json:"alert_id" gorm:"index:idx_alert_updates_alert"`
+	NewsID     string    `json:"news_id"`
+	AnalysisID string    `json:"analysis_id"`
+	Title      string    `json:"title"`
+	Severity   string    `json:"severity"` // severity the follow-up alone would have had
+	Stocks     []string  `json:"stocks" gorm:"serializer:json"`
+	Escalated  bool      `json:"escalated"` // raised the alert's severity
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// AlertSymbol indexes the normalized symbols of an alert, so listing the
+// alerts of one symbol is exact and indexed. Unlike stock_mentions it also
+// covers alerts without an analysis, such as volume spikes.
+type AlertSymbol struct {
+	AlertID string `json:"alert_id" gorm:"primaryKey"`
+	Symbol  string `json:"symbol" gorm:"primaryKey;index:idx_alert_symbols_symbol"`
+}
+
+// saveAlertSymbols replaces the indexed symbols of a with its Stocks
+func saveAlertSymbols(tx *gorm.DB, a *Alert) error {
+	if err := tx.Where("alert_id = ?", a.ID).Delete(&AlertSymbol{}).Error; err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	var rows []AlertSymbol
+	for _, symbol := range a.Stocks {
+		symbol = NormalizeSymbol(symbol)
+		if symbol == "" || seen[symbol] {
+			continue
+		}
+		seen[symbol] = true
+		rows = append(rows, AlertSymbol{AlertID: a.ID, Symbol: symbol})
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return tx.Create(&rows).Error
+}
+
+// backfillAlertSymbols indexes the symbols of all alerts
+func backfillAlertSymbols(db *gorm.DB) error {
+	var batch []Alert
+	return db.Model(&Alert{}).Select("id", "stocks").FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for i := range batch {
+			if err := saveAlertSymbols(db, &batch[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
+
+// GroupAlerts 获取同一类型、同一故事且创建或升级于 since 之后的未解决警报（最新在前）
+func (s *Storage) GroupAlerts(kind, storyID string, since time.Time) ([]Alert, error) {
+	var items []Alert
+	err := s.db.Where("kind = ? AND story_id = ? AND (created_at > ? OR escalated_at > ?)", kind, storyID, since, since).
+		Where("state <> ?", AlertResolved).
+		Order("created_at DESC").
+		Find(&items).Error
+	return items, err
+}
+
+// AttachAlertUpdate 记录后续更新并保存警报的新状态；升级时重新投递 webhook 并推送
+func (s *Storage) AttachAlertUpdate(alert *Alert, u *AlertUpdate) error {
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now()
+	}
+	u.AlertID = alert.ID
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(u).Error; err != nil {
+			return err
+		}
+		err := tx.Model(alert).
+			Select("severity", "stocks", "rule", "channels", "updates", "last_update_at", "escalations", "escalated_at").
+			Updates(alert).Error
+		if err != nil {
+			return err
+		}
+		if err := saveAlertSymbols(tx, alert); err != nil || !u.Escalated {
+			return err
+		}
+		return enqueueWebhooks(tx, alert)
+	})
+	if err != nil {
+		return err
+	}
+	// alert may predate a state change made meanwhile, so mirror the row
+	s.mirrorAlert(alert.ID)
+	s.mirrorRecord(MirrorAlertUpdates, u)
+	if u.Escalated {
+		s.publish(alert)
+	}
+	return nil
+}
+
+// ListAlertUpdates 获取警报的后续更新（按时间）
+func (s *Storage) ListAlertUpdates(alertID string) ([]AlertUpdate, error) {
+	var items []AlertUpdate
+	err := s.db.Where("alert_id = ?", alertID).Order("created_at").Order("id").Find(&items).Error
+	return items, err
+}
+
+// EscalationsAfter 按升级时间增量读取升级过的警报
+func (s *Storage) EscalationsAfter(c Cursor, limit int) ([]Alert, error) {
+	var items []Alert
+	err := afterCursor(s.db.Where("escalated_at IS NOT NULL"), "escalated_at", c, time.Time{}, limit).Find(&items).Error
+	return items, err
+}
+
+// Snoozed reports whether a is snoozed at now
+func (a *Alert) Snoozed(now time.Time) bool {
+	return a.State == AlertSnoozed && a.SnoozedUntil != nil && a.SnoozedUntil.After(now)
+}
+
+// wake reports a snoozed alert whose snooze has run out as open
+func (a *Alert) wake(now time.Time) {
+	if a.State == AlertSnoozed && !a.Snoozed(now) {
+		a.State = AlertOpen
+	}
+}
+
+// ChangeAlertState 变更警报状态并记录审计事件；警报不存在时返回 nil
+func (s *Storage) ChangeAlertState(id string, ev *AlertEvent) (*Alert, error) {
+	if ev.CreatedAt.IsZero() {
+		ev.CreatedAt = time.Now()
+	}
+	var alert Alert
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&alert, "id = ?", id).Error; err != nil {
+			return err
+		}
+		alert.wake(ev.CreatedAt)
+		if alert.State == AlertResolved {
+			return fmt.Errorf("%w: alert is resolved", ErrAlertState)
+		}
+		if alert.State == ev.ToState && ev.ToState != AlertSnoozed {
+			return fmt.Errorf("%w: alert is already %s", ErrAlertState, ev.ToState)
+		}
+
+		at := ev.CreatedAt
+		cols := []string{"state"}
+		switch ev.ToState {
+		case AlertAcknowledged:
+			alert.Acknowledged, alert.AckedBy, alert.AckedAt, alert.SnoozedUntil = 1, ev.Actor, &at, nil
+			cols = append(cols, "acknowledged", "acked_by", "acked_at", "snoozed_until")
+		case AlertSnoozed:
+			if ev.SnoozedUntil == nil || !ev.SnoozedUntil.After(at) {
+				return fmt.Errorf("%w: snooze must end in the future", ErrAlertState)
+			}
+			alert.SnoozedUntil = ev.SnoozedUntil
+			cols = append(cols, "snoozed_until")
+		case AlertResolved:
+			alert.Acknowledged, alert.ResolvedBy, alert.ResolvedAt = 1, ev.Actor, &at
+			cols = append(cols, "acknowledged", "resolved_by", "resolved_at")
+		default:
+			return fmt.Errorf("%w: unknown state %q", ErrAlertState, ev.ToState)
+		}
+		ev.AlertID, ev.FromState = alert.ID, alert.State
+		alert.State = ev.ToState
+
+		if err := tx.Model(&alert).Select(cols).Updates(&alert).Error; err != nil {
+			return err
+		}
+		return tx.Create(ev).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.mirrorRecord(MirrorAlerts, &alert)
+	s.mirrorRecord(MirrorAlertEvents, ev)
+	return &alert, nil
+}
+
+// ListAlertEvents 获取警报的状态变更记录（按时间）
+func (s *Storage) ListAlertEvents(alertID string) ([]AlertEvent, error) {
+	var items []AlertEvent
+	err := s.db.Where("alert_id = ?", alertID).Order("created_at").Order("id").Find(&items).Error
+	return items, err
+}
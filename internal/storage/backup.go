@@ -0,0 +1,300 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// ErrBackupUnsupported is returned by Backup on engines without online
+// snapshots; PostgreSQL deployments should use pg_dump or WAL archiving
+var ErrBackupUnsupported = errors.New("online snapshots are only supported for sqlite (use pg_dump for postgres)")
+
+const (
+	snapshotPrefix = "sentinel-"
+	snapshotSuffix = ".db"
+	snapshotLayout = "20060102T150405.000Z"
+	// snapshots taken before names had milliseconds
+	snapshotLayoutSeconds = "20060102T150405Z"
+)
+
+// Snapshot is one database snapshot file
+type Snapshot struct {
+	Name      string        `json:"name"`
+	Path      string        `json:"path"`
+	Size      int64         `json:"size"`
+	CreatedAt time.Time     `json:"created_at"`
+	Duration  time.Duration `json:"duration,omitempty"` // set when just taken
+}
+
+// Backup 在线生成一致的数据库快照（VACUUM INTO），并校验完整性
+//
+// The snapshot is written to a temp file and only renamed to
+// <dir>/sentinel-<UTC time with milliseconds>.db once PRAGMA integrity_check passes, so every
+// file matching that name is a verified copy. Writers are not blocked.
+func (s *Storage) Backup(dir string) (*Snapshot, error) {
+	s.backupMu.Lock()
+	defer s.backupMu.Unlock()
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	// names hold milliseconds; a name already taken moves on a millisecond,
+	// so no snapshot overwrites another
+	stamp := start.UTC().Truncate(time.Millisecond)
+	var name, final string
+	for {
+		name = snapshotPrefix + stamp.Format(snapshotLayout) + snapshotSuffix
+		final = filepath.Join(dir, name)
+		if _, err := os.Stat(final); os.IsNotExist(err) {
+			break
+		}
+		stamp = stamp.Add(time.Millisecond)
+	}
+	tmp := final + ".tmp"
+	os.Remove(tmp) // left over from a crashed run
+
+	if err := s.dialect.snapshot(s.db, tmp); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	if err := VerifySnapshot(tmp); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	if err := os.Rename(tmp, final); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+
+	info, err := os.Stat(final)
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{
+		Name:      name,
+		Path:      final,
+		Size:      info.Size(),
+		CreatedAt: stamp,
+		Duration:  time.Since(start),
+	}, nil
+}
+
+// VerifySnapshot opens a SQLite file read-only and runs PRAGMA integrity_check
+func VerifySnapshot(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	db, err := gorm.Open(sqlite.Open("file:"+path+"?mode=ro"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		return fmt.Errorf("open snapshot: %w", err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+
+	var problems []string
+	if err := db.Raw("PRAGMA integrity_check").Scan(&problems).Error; err != nil {
+		return fmt.Errorf("integrity check: %w", err)
+	}
+	if len(problems) != 1 || problems[0] != "ok" {
+		if len(problems) > 5 {
+			problems = append(problems[:5], "...")
+		}
+		return fmt.Errorf("integrity check failed: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// ListSnapshots returns the snapshots in dir, newest first
+func ListSnapshots(dir string) ([]Snapshot, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snaps []Snapshot
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotSuffix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotSuffix)
+		created, err := time.Parse(snapshotLayout, stamp)
+		if err != nil {
+			if created, err = time.Parse(snapshotLayoutSeconds, stamp); err != nil {
+				continue
+			}
+		}
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, Snapshot{Name: name, Path: filepath.Join(dir, name), Size: info.Size(), CreatedAt: created})
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].CreatedAt.After(snaps[j].CreatedAt) })
+	return snaps, nil
+}
+
+// PruneSnapshots deletes all but the newest keep snapshots in dir
+func PruneSnapshots(dir string, keep int) ([]string, error) {
+	if keep <= 0 {
+		return nil, nil
+	}
+	snaps, err := ListSnapshots(dir)
+	if err != nil || len(snaps) <= keep {
+		return nil, err
+	}
+	var removed []string
+	for _, snap := range snaps[keep:] {
+		if err := os.Remove(snap.Path); err != nil {
+			return removed, err
+		}
+		removed = append(removed, snap.Name)
+	}
+	return removed, nil
+}
+
+// Snapshotter takes snapshots on a schedule and keeps the newest N
+type Snapshotter struct {
+	store     Store
+	dir       string
+	keep      int
+	interval  time.Duration
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+	isRunning bool
+	mu        sync.Mutex
+
+	stateMu sync.Mutex
+	busy    bool
+	last    *Snapshot
+	lastErr error
+}
+
+func NewSnapshotter(store Store, cfg config.BackupConfig) *Snapshotter {
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+	return &Snapshotter{
+		store:    store,
+		dir:      cfg.Dir,
+		keep:     cfg.Keep,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Dir returns the snapshot directory
+func (s *Snapshotter) Dir() string { return s.dir }
+
+// Start takes a snapshot every interval; the first one after one interval,
+// since a restart should not produce a burst of snapshots
+func (s *Snapshotter) Start() {
+	s.mu.Lock()
+	if s.isRunning {
+		s.mu.Unlock()
+		return
+	}
+	s.isRunning = true
+	s.stopCh = make(chan struct{})
+	s.mu.Unlock()
+
+	log.Printf("Starting Snapshotter (every %s, keep %d) to %s", s.interval, s.keep, s.dir)
+
+	s.wg.Add(1)
+	go s.loop()
+}
+
+// Stop waits for a running snapshot to finish
+func (s *Snapshotter) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.isRunning {
+		return
+	}
+	close(s.stopCh)
+	s.isRunning = false
+	s.wg.Wait()
+	log.Println("Snapshotter stopped")
+}
+
+func (s *Snapshotter) loop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+			s.RunOnce()
+		}
+	}
+}
+
+// RunOnce takes a snapshot and prunes old ones
+func (s *Snapshotter) RunOnce() (*Snapshot, error) {
+	s.stateMu.Lock()
+	s.busy = true
+	s.stateMu.Unlock()
+
+	snap, err := s.store.Backup(s.dir)
+	if err == nil {
+		log.Printf("Snapshotter: wrote %s (%d bytes) in %s", snap.Name, snap.Size, snap.Duration.Round(time.Millisecond))
+		removed, pruneErr := PruneSnapshots(s.dir, s.keep)
+		for _, name := range removed {
+			log.Printf("Snapshotter: removed %s", name)
+		}
+		err = pruneErr
+	}
+	if err != nil {
+		log.Printf("Snapshotter: %v", err)
+	}
+
+	s.stateMu.Lock()
+	s.busy = false
+	if snap != nil {
+		s.last = snap
+	}
+	s.lastErr = err
+	s.stateMu.Unlock()
+	return snap, err
+}
+
+// TryRunAsync starts a snapshot in the background unless one is running
+func (s *Snapshotter) TryRunAsync() bool {
+	s.stateMu.Lock()
+	if s.busy {
+		s.stateMu.Unlock()
+		return false
+	}
+	s.busy = true
+	s.stateMu.Unlock()
+	go s.RunOnce()
+	return true
+}
+
+// Status reports whether a snapshot is in progress and how the last one went
+func (s *Snapshotter) Status() (busy bool, last *Snapshot, lastErr error) {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	return s.busy, s.last, s.lastErr
+}
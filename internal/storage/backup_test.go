@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSQLiteBackupSnapshot(t *testing.T) {
+	s := newSQLiteTestStore(t)
+	mustSaveNews(t, s, NewsItem{ID: "n1", Title: "snapshotted", PublishedAt: time.Now()})
+
+	dir := t.TempDir()
+	snap, err := s.Backup(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snap.Size == 0 || filepath.Dir(snap.Path) != dir {
+		t.Errorf("snapshot = %+v", snap)
+	}
+	if _, err := os.Stat(snap.Path + ".tmp"); !os.IsNotExist(err) {
+		t.Error("temp file left behind")
+	}
+
+	// the snapshot is a complete, current database
+	restored, err := New(snap.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	if n, err := restored.GetNews("n1"); err != nil || n == nil || n.Title != "snapshotted" {
+		t.Errorf("GetNews from snapshot = %+v, %v", n, err)
+	}
+
+	// snapshots taken in quick succession never overwrite one another
+	for i := 0; i < 2; i++ {
+		if _, err := s.Backup(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if snaps, _ := ListSnapshots(dir); len(snaps) != 3 || snaps[0].Name == snaps[1].Name || snaps[1].Name == snaps[2].Name {
+		t.Errorf("snapshots = %+v, want 3", snaps)
+	}
+}
+
+func TestVerifySnapshotRejectsCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sentinel-20250310T000000Z.db")
+	if err := os.WriteFile(path, []byte("not a database, just some bytes padded out to look plausible"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySnapshot(path); err == nil {
+		t.Error("corrupt snapshot passed verification")
+	}
+	if err := VerifySnapshot(path + ".missing"); err == nil {
+		t.Error("missing snapshot passed verification")
+	}
+}
+
+func TestPruneSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"sentinel-20250308T000000Z.db",
+		"sentinel-20250310T000000.250Z.db",
+		"sentinel-20250309T000000Z.db",     // named before milliseconds
+		"sentinel-20250301T000000Z.db.tmp", // in progress, never pruned
+		"notes.txt",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	removed, err := PruneSnapshots(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 1 || removed[0] != "sentinel-20250308T000000Z.db" {
+		t.Errorf("removed = %v", removed)
+	}
+	snaps, _ := ListSnapshots(dir)
+	if len(snaps) != 2 || snaps[0].Name != "sentinel-20250310T000000.250Z.db" {
+		t.Errorf("remaining = %+v", snaps)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sentinel-20250301T000000Z.db.tmp")); err != nil {
+		t.Error("temp file was pruned")
+	}
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Cursor is a keyset position in a table ordered by (time, id). Exports
+// resume strictly after it, so rows sharing a timestamp are not skipped.
+type Cursor struct {
+	Time time.Time `json:"time"`
+	ID   string    `json:"id"`
+}
+
+func afterCursor(tx *gorm.DB, column string, c Cursor, until time.Time, limit int) *gorm.DB {
+	if !c.Time.IsZero() || c.ID != "" {
+		tx = tx.Where("("+column+" > ? OR ("+column+" = ? AND id > ?))", c.Time, c.Time, c.ID)
+	}
+	if !until.IsZero() {
+		tx = tx.Where(column+" <= ?", until)
+	}
+	return tx.Order(column + " ASC").Order("id ASC").Limit(limit)
+}
+
+// NewsAfter 按采集时间增量读取新闻（用于导出）
+func (s *Storage) NewsAfter(c Cursor, until time.Time, limit int) ([]NewsItem, error) {
+	var items []NewsItem
+	err := afterCursor(s.db, "collected_at", c, until, limit).Find(&items).Error
+	return items, err
+}
+
+// AnalysesAfter 按分析时间增量读取分析（用于导出）
+func (s *Storage) AnalysesAfter(c Cursor, until time.Time, limit int) ([]Analysis, error) {
+	var items []Analysis
+	err := afterCursor(s.db, "analyzed_at", c, until, limit).Find(&items).Error
+	return items, err
+}
+
+// AlertsAfter 按创建时间增量读取警报（用于导出）
+func (s *Storage) AlertsAfter(c Cursor, until time.Time, limit int) ([]Alert, error) {
+	var items []Alert
+	err := afterCursor(s.db, "created_at", c, until, limit).Find(&items).Error
+	return items, err
+}
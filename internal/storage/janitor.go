@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+)
+
+// Janitor enforces the retention rules in the background
+type Janitor struct {
+	store     Store
+	rules     []RetentionRule
+	interval  time.Duration
+	vacuum    string
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+	isRunning bool
+	mu        sync.Mutex
+}
+
+func NewJanitor(store Store, cfg config.RetentionConfig) *Janitor {
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = 6 * time.Hour
+	}
+	return &Janitor{
+		store:    store,
+		rules:    RetentionRules(cfg),
+		interval: interval,
+		vacuum:   cfg.Vacuum,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Start runs a first pass right away, then one per interval
+func (j *Janitor) Start() {
+	j.mu.Lock()
+	if j.isRunning || len(j.rules) == 0 {
+		j.mu.Unlock()
+		return
+	}
+	j.isRunning = true
+	j.stopCh = make(chan struct{})
+	j.mu.Unlock()
+
+	log.Printf("Starting Janitor with %d retention rules (every %s)", len(j.rules), j.interval)
+
+	j.wg.Add(1)
+	go j.loop()
+}
+
+// Stop waits for a running pass to finish
+func (j *Janitor) Stop() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.isRunning {
+		return
+	}
+	close(j.stopCh)
+	j.isRunning = false
+	j.wg.Wait()
+	log.Println("Janitor stopped")
+}
+
+func (j *Janitor) loop() {
+	defer j.wg.Done()
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	j.RunOnce()
+	for {
+		select {
+		case <-j.stopCh:
+			return
+		case <-ticker.C:
+			j.RunOnce()
+		}
+	}
+}
+
+// RunOnce prunes every rule and vacuums if anything was removed
+func (j *Janitor) RunOnce() ([]PruneResult, error) {
+	results, err := j.store.Prune(j.rules, false)
+	var removed int64
+	for _, r := range results {
+		if r.Rows > 0 {
+			log.Printf("Janitor: %s %d rows from %s (%s, older than %s)",
+				r.Action, r.Rows, r.Table, r.Rule, r.Cutoff.Format(time.RFC3339))
+		}
+		removed += r.Rows
+		for table, n := range r.Cascaded {
+			if n > 0 {
+				log.Printf("Janitor: deleted %d rows from %s with them", n, table)
+			}
+			removed += n
+		}
+	}
+	if err != nil {
+		log.Printf("Janitor: prune failed: %v", err)
+		return results, err
+	}
+
+	if removed > 0 {
+		if err := j.store.Vacuum(j.vacuum); err != nil {
+			log.Printf("Janitor: vacuum failed: %v", err)
+			return results, err
+		}
+	}
+	return results, nil
+}
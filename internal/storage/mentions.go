@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// MentionsFor derives one StockMention per distinct symbol of an analysis.
+// Symbols with a StockImpact entry use its score; symbols only found by the
+// keyword mapper inherit the overall analysis score.
+func MentionsFor(a *Analysis) []StockMention {
+	details := make(map[string]StockImpact, len(a.StockDetails))
+	for _, d := range a.StockDetails {
+		details[NormalizeSymbol(d.Symbol)] = d
+	}
+
+	seen := make(map[string]bool)
+	var mentions []StockMention
+	add := func(symbol string) {
+		symbol = NormalizeSymbol(symbol)
+		if symbol == "" || seen[symbol] {
+			return
+		}
+		seen[symbol] = true
+
+		m := StockMention{
+			AnalysisID: a.ID,
+			NewsID:     a.NewsID,
+			Symbol:     symbol,
+			Score:      a.SentimentScore,
+			Sentiment:  a.Sentiment,
+			Confidence: a.Confidence,
+			AnalyzedAt: a.AnalyzedAt,
+		}
+		if d, ok := details[symbol]; ok {
+			m.Score = float64(d.Score)
+			m.Timeframe = d.Timeframe
+		}
+		mentions = append(mentions, m)
+	}
+
+	for _, d := range a.StockDetails {
+		add(d.Symbol)
+	}
+	for _, symbol := range a.RelatedStocks {
+		add(symbol)
+	}
+	return mentions
+}
+
+// NormalizeSymbol uppercases a ticker and strips a leading cashtag $
+func NormalizeSymbol(s string) string {
+	return strings.ToUpper(strings.TrimPrefix(strings.TrimSpace(s), "$"))
+}
+
+// backfillStockMentions repopulates stock_mentions from all analyses
+func backfillStockMentions(db *gorm.DB) error {
+	if err := db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&StockMention{}).Error; err != nil {
+		return err
+	}
+	var batch []Analysis
+	return db.Model(&Analysis{}).FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		var mentions []StockMention
+		for i := range batch {
+			mentions = append(mentions, MentionsFor(&batch[i])...)
+		}
+		if len(mentions) == 0 {
+			return nil
+		}
+		return db.CreateInBatches(mentions, 500).Error
+	}).Error
+}
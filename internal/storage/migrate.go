@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrSchemaTooNew is returned when the database was migrated by a newer
+// binary. Running against it could silently corrupt data.
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+
+// ErrSchemaOutdated is returned by Open when migrations are pending and
+// storage.auto_migrate is off.
+var ErrSchemaOutdated = errors.New("database schema is out of date")
+
+// Migration is one ordered, versioned schema change. Up and Down run in a
+// transaction together with the schema_migrations bookkeeping. Migrations
+// are frozen once released: DDL is written out by hand, and data steps may
+// only touch columns that exist at their version.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaMigration records an applied migration
+type SchemaMigration struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// TableName pins the bookkeeping table name
+func (SchemaMigration) TableName() string { return "schema_migrations" }
+
+// MigrationStatus describes one known or applied migration
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	Unknown   bool       `json:"unknown,omitempty"` // applied by a newer binary
+}
+
+// execAll returns a migration step running the statements in order
+func execAll(stmts ...string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, stmt := range stmts {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Migrator applies and rolls back the migrations of one database
+type Migrator struct {
+	db         *gorm.DB
+	dialect    dialect
+	migrations []Migration
+}
+
+func newMigrator(db *gorm.DB, d dialect) *Migrator {
+	return &Migrator{db: db, dialect: d, migrations: d.migrations()}
+}
+
+// Latest returns the highest version this binary knows
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+func (m *Migrator) ensureTable() error {
+	return m.db.AutoMigrate(&SchemaMigration{})
+}
+
+func (m *Migrator) applied(db *gorm.DB) (map[int]SchemaMigration, error) {
+	var rows []SchemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[int]SchemaMigration, len(rows))
+	for _, r := range rows {
+		out[r.Version] = r
+	}
+	return out, nil
+}
+
+// Version returns the highest applied version, 0 for a fresh database
+func (m *Migrator) Version() (int, error) {
+	if err := m.ensureTable(); err != nil {
+		return 0, err
+	}
+	var v int
+	err := m.db.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&v).Error
+	return v, err
+}
+
+// checkNotNewer refuses databases migrated past Latest
+func (m *Migrator) checkNotNewer() (int, error) {
+	v, err := m.Version()
+	if err != nil {
+		return 0, err
+	}
+	if v > m.Latest() {
+		return v, fmt.Errorf("%w: database is at version %d, this binary supports up to %d", ErrSchemaTooNew, v, m.Latest())
+	}
+	return v, nil
+}
+
+// Status lists every known migration plus any unknown applied ones
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []MigrationStatus
+	known := make(map[int]bool, len(m.migrations))
+	for _, mig := range m.migrations {
+		known[mig.Version] = true
+		st := MigrationStatus{Version: mig.Version, Name: mig.Name}
+		if row, ok := applied[mig.Version]; ok {
+			at := row.AppliedAt
+			st.Applied, st.AppliedAt = true, &at
+		}
+		out = append(out, st)
+	}
+	for v, row := range applied {
+		if !known[v] {
+			at := row.AppliedAt
+			out = append(out, MigrationStatus{Version: v, Name: row.Name, Applied: true, AppliedAt: &at, Unknown: true})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// Pending returns the known migrations not yet applied
+func (m *Migrator) Pending() ([]Migration, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(m.db)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; !ok {
+			pending = append(pending, mig)
+		}
+	}
+	return pending, nil
+}
+
+// Migrate applies pending migrations up to target (0 for all) and returns
+// the ones it ran.
+func (m *Migrator) Migrate(target int) ([]Migration, error) {
+	if _, err := m.checkNotNewer(); err != nil {
+		return nil, err
+	}
+	pending, err := m.Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+	for _, mig := range pending {
+		if target > 0 && mig.Version > target {
+			break
+		}
+		mig := mig
+		done := false
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := m.dialect.lockMigrations(tx); err != nil {
+				return err
+			}
+			// another instance may have applied it while we waited for the lock
+			var n int64
+			if err := tx.Model(&SchemaMigration{}).Where("version = ?", mig.Version).Count(&n).Error; err != nil {
+				return err
+			}
+			if n > 0 {
+				return nil
+			}
+			if err := mig.Up(tx); err != nil {
+				return err
+			}
+			done = true
+			return tx.Create(&SchemaMigration{Version: mig.Version, Name: mig.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return ran, fmt.Errorf("migration %d (%s): %w", mig.Version, mig.Name, err)
+		}
+		if done {
+			ran = append(ran, mig)
+		}
+	}
+	return ran, nil
+}
+
+// Rollback reverts the last steps applied migrations, newest first
+func (m *Migrator) Rollback(steps int) ([]Migration, error) {
+	if _, err := m.checkNotNewer(); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(ran) < steps; i-- {
+		mig := m.migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		if mig.Down == nil {
+			return ran, fmt.Errorf("migration %d (%s) cannot be rolled back", mig.Version, mig.Name)
+		}
+		err := m.db.Transaction(func(tx *gorm.DB) error {
+			if err := m.dialect.lockMigrations(tx); err != nil {
+				return err
+			}
+			if err := mig.Down(tx); err != nil {
+				return err
+			}
+			return tx.Delete(&SchemaMigration{}, "version = ?", mig.Version).Error
+		})
+		if err != nil {
+			return ran, fmt.Errorf("rollback %d (%s): %w", mig.Version, mig.Name, err)
+		}
+		ran = append(ran, mig)
+	}
+	return ran, nil
+}
+
+// Close releases the database connection
+func (m *Migrator) Close() error {
+	sqlDB, err := m.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
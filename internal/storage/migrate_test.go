@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+)
+
+func TestMigrateFreshAndRollback(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "m.db")
+	s, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	m, err := OpenMigrator(config.StorageConfig{Database: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if v, _ := m.Version(); v != m.Latest() {
+		t.Fatalf("version = %d, want %d", v, m.Latest())
+	}
+	status, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, st := range status {
+		if !st.Applied {
+			t.Errorf("migration %d %s not applied", st.Version, st.Name)
+		}
+	}
+
+	ran, err := m.Rollback(14)
+	if err != nil || len(ran) != 14 || ran[0].Version != m.Latest() {
+		t.Fatalf("Rollback(14) = %+v, %v", ran, err)
+	}
+	if m.db.Migrator().HasTable("stock_mentions") || m.db.Migrator().HasTable("sentiment_rollups") ||
+		m.db.Migrator().HasTable("stories") || m.db.Migrator().HasColumn(&NewsItem{}, "story_id") ||
+		m.db.Migrator().HasColumn(&Alert{}, "kind") || m.db.Migrator().HasTable("webhook_deliveries") ||
+		m.db.Migrator().HasTable("notifications") || m.db.Migrator().HasTable("alert_rules") ||
+		m.db.Migrator().HasColumn(&Alert{}, "rule") || m.db.Migrator().HasColumn(&Alert{}, "url") ||
+		m.db.Migrator().HasTable("alert_updates") || m.db.Migrator().HasColumn(&Alert{}, "story_id") ||
+		m.db.Migrator().HasTable("alert_events") || m.db.Migrator().HasColumn(&Alert{}, "state") ||
+		m.db.Migrator().HasTable("api_tokens") || m.db.Migrator().HasColumn(&NewsItem{}, "imported") ||
+		m.db.Migrator().HasTable("alert_symbols") {
+		t.Error("rolled back tables still exist")
+	}
+
+	if _, err := Open(config.StorageConfig{Database: path}); !errors.Is(err, ErrSchemaOutdated) {
+		t.Errorf("Open without auto_migrate err = %v, want ErrSchemaOutdated", err)
+	}
+
+	ran, err = m.Migrate(0)
+	if err != nil || len(ran) != 14 {
+		t.Fatalf("Migrate = %+v, %v", ran, err)
+	}
+	if ran, _ := m.Migrate(0); len(ran) != 0 {
+		t.Errorf("second Migrate ran %d migrations", len(ran))
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "m.db")
+	s, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	future := SchemaMigration{Version: 9999, Name: "from_the_future", AppliedAt: time.Now()}
+	if err := s.db.Create(&future).Error; err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	if _, err := New(path); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("New err = %v, want ErrSchemaTooNew", err)
+	}
+
+	m, err := OpenMigrator(config.StorageConfig{Database: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if _, err := m.Migrate(0); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Migrate err = %v, want ErrSchemaTooNew", err)
+	}
+	if _, err := m.Rollback(1); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("Rollback err = %v, want ErrSchemaTooNew", err)
+	}
+	status, _ := m.Status()
+	if last := status[len(status)-1]; !last.Unknown || last.Version != 9999 {
+		t.Errorf("status last = %+v, want unknown 9999", last)
+	}
+}
+
+// A database created by the old AutoMigrate has tables but no
+// schema_migrations. It must be adopted in place with its data intact.
+func TestMigrateAdoptsLegacyDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+	db, err := openSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy := []string{
+		"CREATE TABLE `news_items` (`id` text,`source` text,`source_id` text,`author` text,`title` text,`content` text,`url` text,`published_at` datetime,`collected_at` datetime,`processed` integer,PRIMARY KEY (`id`))",
+		"CREATE UNIQUE INDEX `idx_source_source_id` ON `news_items`(`source_id`)",
+		"CREATE TABLE `analyses` (`id` text,`news_id` text,`sentiment` text,`sentiment_score` real,`confidence` real,`entities` text,`related_stocks` text,`stock_details` text,`impact_level` text,`summary` text,`key_points` text,`analyzed_at` datetime,`raw_response` text,PRIMARY KEY (`id`),CONSTRAINT `fk_analyses_news` FOREIGN KEY (`news_id`) REFERENCES `news_items`(`id`))",
+		"CREATE TABLE `alerts` (`id` text,`news_id` text,`analysis_id` text,`title` text,`description` text,`severity` text,`stocks` text,`created_at` datetime,`acknowledged` integer,`notified` numeric,PRIMARY KEY (`id`))",
+		"CREATE TABLE `reports` (`id` text,`type` text,`title` text,`start_time` datetime,`end_time` datetime,`summary` text,`content` text,`top_news` text,`stock_impact` text,`created_at` datetime,`generated_at` datetime,`file_path` text,PRIMARY KEY (`id`))",
+	}
+	if err := execAll(legacy...)(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&Analysis{ID: "a1", NewsID: "n1", Sentiment: "positive", SentimentScore: 4,
+		RelatedStocks: []string{"NVDA"}, AnalyzedAt: time.Now()}).Error; err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.Close()
+
+	s, err := New(path)
+	if err != nil {
+		t.Fatalf("adopting legacy database: %v", err)
+	}
+	defer s.Close()
+
+	got, err := s.GetStockSentiment("NVDA", 24)
+	if err != nil || got.TotalMentions != 1 {
+		t.Errorf("backfilled NVDA mentions = %+v, %v", got, err)
+	}
+
+	// the old source_id-only unique index rejected a second item without a source id
+	mustSaveNews(t, s,
+		NewsItem{ID: "x1", Source: "rss:A", PublishedAt: time.Now()},
+		NewsItem{ID: "x2", Source: "rss:B", PublishedAt: time.Now()},
+	)
+	if _, total, _ := s.ListNews(time.Time{}, time.Time{}, "", 10, 0); total != 2 {
+		t.Errorf("news total = %d, want 2", total)
+	}
+}
+
+// Databases that lost the old source_id index may hold the same item twice.
+// news_source_unique keeps one and moves what referred to the other onto it.
+func TestMigrateDedupesNewsSourceIDs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "m.db")
+	s, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	m, err := OpenMigrator(config.StorageConfig{Database: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	if ran, err := m.Rollback(2); err != nil || ran[1].Name != "news_source_unique" {
+		t.Fatalf("Rollback(2) = %+v, %v", ran, err)
+	}
+	if err := m.db.Exec("DROP INDEX `idx_source_source_id`").Error; err != nil {
+		t.Fatal(err)
+	}
+	rows := []interface{}{
+		&NewsItem{ID: "n1", Source: "reddit", SourceID: "t3_1", PublishedAt: time.Now()},
+		&NewsItem{ID: "n2", Source: "reddit", SourceID: "t3_1", PublishedAt: time.Now()},
+		&NewsItem{ID: "n3", Source: "rss:A", PublishedAt: time.Now()},
+		&NewsItem{ID: "n4", Source: "rss:B", PublishedAt: time.Now()},
+		&Analysis{ID: "a2", NewsID: "n2", AnalyzedAt: time.Now()},
+		&StockMention{AnalysisID: "a2", NewsID: "n2", Symbol: "NVDA", AnalyzedAt: time.Now()},
+		&Alert{ID: "al2", NewsID: "n2", AnalysisID: "a2", CreatedAt: time.Now()},
+	}
+	for _, row := range rows {
+		if err := m.db.Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := m.Migrate(0); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	m.db.Model(&NewsItem{}).Order("id").Pluck("id", &ids)
+	if len(ids) != 3 || ids[0] != "n1" {
+		t.Errorf("news = %v, want n1 n3 n4", ids)
+	}
+	var analysis, mention, alert string
+	m.db.Raw("SELECT news_id FROM analyses WHERE id = 'a2'").Scan(&analysis)
+	m.db.Raw("SELECT news_id FROM stock_mentions WHERE analysis_id = 'a2'").Scan(&mention)
+	m.db.Raw("SELECT news_id FROM alerts WHERE id = 'al2'").Scan(&alert)
+	if analysis != "n1" || mention != "n1" || alert != "n1" {
+		t.Errorf("news_id of analysis %q, mention %q, alert %q; want n1", analysis, mention, alert)
+	}
+}
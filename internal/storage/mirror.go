@@ -0,0 +1,512 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Mirrored tables, in restore order
+const (
+	MirrorNews         = "news"
+	MirrorAnalyses     = "analyses"
+	MirrorAlerts       = "alerts"
+	MirrorAlertUpdates = "alert_updates"
+	MirrorAlertEvents  = "alert_events"
+	MirrorReports      = "reports"
+)
+
+var mirrorTables = []string{MirrorNews, MirrorAnalyses, MirrorAlerts, MirrorAlertUpdates, MirrorAlertEvents, MirrorReports}
+
+// mirror appends every row the Storage creates to JSON Lines files, one per
+// table and UTC day: <dir>/<table>/YYYY-MM-DD.jsonl. When the day changes the
+// finished files are gzipped (if enabled) and files past maxAge are deleted.
+//
+// News, analyses and reports are recorded as first written. An alert is
+// recorded again whole each time it changes (follow-ups, escalations, state
+// changes, first delivery), and restore keeps its last record.
+type mirror struct {
+	dir      string
+	compress bool
+	maxAge   time.Duration
+	now      func() time.Time
+
+	mu    sync.Mutex
+	day   string
+	files map[string]*os.File
+}
+
+func newMirror(cfg config.MirrorConfig) (*mirror, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("storage.mirror.dir is required")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0755); err != nil {
+		return nil, err
+	}
+	return &mirror{
+		dir:      cfg.Dir,
+		compress: cfg.Compress,
+		maxAge:   cfg.MaxAge,
+		now:      time.Now,
+		files:    make(map[string]*os.File),
+	}, nil
+}
+
+// write appends rows to today's file of table with a single write call, so
+// a crash leaves at most one truncated trailing line
+func (m *mirror) write(table string, rows ...interface{}) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range rows {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	day := m.now().UTC().Format("2006-01-02")
+	if day != m.day {
+		m.closeFiles()
+		m.day = day
+		if err := m.rotate(); err != nil {
+			log.Printf("Storage: mirror rotation failed: %v", err)
+		}
+	}
+
+	f, ok := m.files[table]
+	if !ok {
+		dir := filepath.Join(m.dir, table)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		var err error
+		f, err = os.OpenFile(filepath.Join(dir, day+".jsonl"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		m.files[table] = f
+	}
+	_, err := f.Write(buf.Bytes())
+	return err
+}
+
+// rotate compresses finished day files and removes expired ones
+func (m *mirror) rotate() error {
+	var cutoff string
+	if m.maxAge > 0 {
+		cutoff = m.now().Add(-m.maxAge).UTC().Format("2006-01-02")
+	}
+	for _, table := range mirrorTables {
+		files, err := mirrorFiles(filepath.Join(m.dir, table))
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			switch {
+			case cutoff != "" && f.day < cutoff:
+				if err := os.Remove(f.path); err != nil {
+					return err
+				}
+			case m.compress && f.day < m.day && !f.gzipped:
+				if err := gzipFile(f.path); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (m *mirror) closeFiles() {
+	for table, f := range m.files {
+		f.Close()
+		delete(m.files, table)
+	}
+}
+
+func (m *mirror) close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closeFiles()
+}
+
+// mirrorRecord logs instead of failing: the database write has already
+// committed, and reporting an error would make callers retry it
+func (s *Storage) mirrorRecord(table string, rows ...interface{}) {
+	if s.mirror == nil {
+		return
+	}
+	if err := s.mirror.write(table, rows...); err != nil {
+		log.Printf("Storage: mirror %s: %v", table, err)
+	}
+}
+
+// mirrorAlert records the current state of alert id after an update
+func (s *Storage) mirrorAlert(id string) {
+	if s.mirror == nil {
+		return
+	}
+	var alert Alert
+	if err := s.db.First(&alert, "id = ?", id).Error; err != nil {
+		log.Printf("Storage: mirror alert %s: %v", id, err)
+		return
+	}
+	s.mirrorRecord(MirrorAlerts, &alert)
+}
+
+type mirrorFile struct {
+	path    string
+	day     string
+	gzipped bool
+}
+
+// mirrorFiles lists the day files of one table directory, oldest first
+func mirrorFiles(dir string) ([]mirrorFile, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var files []mirrorFile
+	for _, e := range entries {
+		name := e.Name()
+		f := mirrorFile{path: filepath.Join(dir, name)}
+		switch {
+		case strings.HasSuffix(name, ".jsonl.gz"):
+			f.day, f.gzipped = strings.TrimSuffix(name, ".jsonl.gz"), true
+		case strings.HasSuffix(name, ".jsonl"):
+			f.day = strings.TrimSuffix(name, ".jsonl")
+		default:
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", f.day); err != nil {
+			continue
+		}
+		files = append(files, f)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].day != files[j].day {
+			return files[i].day < files[j].day
+		}
+		// a day left uncompressed after a crash restores after its .gz
+		return files[i].gzipped && !files[j].gzipped
+	})
+	return files, nil
+}
+
+// gzipFile replaces path with path.gz
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp := path + ".gz.tmp"
+	dst, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if err == nil {
+		err = gz.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// RestoreResult counts the rows restored from one mirrored table
+type RestoreResult struct {
+	Table    string `json:"table"`
+	Files    int    `json:"files"`
+	Read     int    `json:"read"`
+	Restored int    `json:"restored"` // rows not already in the database
+	Corrupt  int    `json:"corrupt"`  // lines that failed to decode
+}
+
+const restoreBatch = 500
+
+// RestoreMirror 从镜像目录恢复数据（已存在的行跳过，警报以最后一条记录为准）
+//
+// Day files before since are ignored. News is regrouped into stories,
+// analyses rebuild their stock mentions and rollups, and news that has an analysis is marked processed so it is
+// not sent to the LLM again. Alerts take the state of their last record,
+// follow-ups and audit events missing from the database are added, and
+// stories are linked to any analysis of their members in the database.
+//
+// What was never mirrored is not restored: notification and webhook
+// delivery logs, rule and webhook settings, and a story's analysis when that
+// analysis was mirrored before since and is not in the database.
+func (s *Storage) RestoreMirror(dir string, since time.Time) ([]RestoreResult, error) {
+	var results []RestoreResult
+	for _, table := range mirrorTables {
+		var res RestoreResult
+		var err error
+		switch table {
+		case MirrorNews:
+			res, err = restoreTable(s, dir, table, since, func(tx *gorm.DB, rows []NewsItem) (int64, error) {
+				var n int64
+				for i := range rows {
+					inserted, err := s.insertNews(tx, &rows[i])
+					if err != nil {
+						return n, err
+					}
+					if inserted {
+						n++
+					}
+				}
+				return n, nil
+			})
+		case MirrorAnalyses:
+			res, err = restoreTable(s, dir, table, since, func(tx *gorm.DB, rows []Analysis) (int64, error) {
+				var n int64
+				for i := range rows {
+					r := s.dialect.insertIgnore(tx).Create(&rows[i])
+					if r.Error != nil {
+						return n, r.Error
+					}
+					if r.RowsAffected == 0 {
+						continue
+					}
+					n++
+					if err := linkStoryAnalysis(tx, &rows[i]); err != nil {
+						return n, err
+					}
+					if mentions := MentionsFor(&rows[i]); len(mentions) > 0 {
+						if err := tx.Create(&mentions).Error; err != nil {
+							return n, err
+						}
+						if err := applyRollups(tx, mentions); err != nil {
+							return n, err
+						}
+					}
+				}
+				return n, nil
+			})
+		case MirrorAlerts:
+			res, err = restoreTable(s, dir, table, since, restoreAlerts)
+		case MirrorAlertUpdates:
+			res, err = restoreTable(s, dir, table, since, func(tx *gorm.DB, rows []AlertUpdate) (int64, error) {
+				return restoreAlertRecords(tx, rows, func(u *AlertUpdate) *gorm.DB {
+					u.ID = 0
+					return tx.Model(&AlertUpdate{}).Where("alert_id = ? AND news_id = ? AND created_at = ?", u.AlertID, u.NewsID, u.CreatedAt)
+				})
+			})
+		case MirrorAlertEvents:
+			res, err = restoreTable(s, dir, table, since, func(tx *gorm.DB, rows []AlertEvent) (int64, error) {
+				return restoreAlertRecords(tx, rows, func(ev *AlertEvent) *gorm.DB {
+					ev.ID = 0
+					return tx.Model(&AlertEvent{}).Where("alert_id = ? AND to_state = ? AND created_at = ?", ev.AlertID, ev.ToState, ev.CreatedAt)
+				})
+			})
+		case MirrorReports:
+			res, err = restoreTable(s, dir, table, since, func(tx *gorm.DB, rows []Report) (int64, error) {
+				r := s.dialect.insertIgnore(tx).Create(&rows)
+				return r.RowsAffected, r.Error
+			})
+		}
+		results = append(results, res)
+		if err != nil {
+			return results, fmt.Errorf("restore %s: %w", table, err)
+		}
+	}
+
+	err := s.db.Model(&NewsItem{}).
+		Where("processed = ? AND EXISTS (SELECT 1 FROM analyses WHERE analyses.news_id = news_items.id)", 0).
+		Update("processed", 1).Error
+	if err != nil {
+		return results, err
+	}
+	// news restored after its analysis, or into a database that already
+	// had the analysis, joins a story that was not linked when it was read
+	err = s.db.Model(&Story{}).
+		Where("analysis_id = '' AND EXISTS (?)", storyAnalyses(s.db)).
+		Update("analysis_id", gorm.Expr("(?)", storyAnalyses(s.db).Select("analyses.id").Order("analyses.analyzed_at").Limit(1))).Error
+	return results, err
+}
+
+// storyAnalyses selects the analyses of the members of the story being updated
+func storyAnalyses(db *gorm.DB) *gorm.DB {
+	return db.Model(&Analysis{}).Select("1").
+		Joins("JOIN news_items ON news_items.id = analyses.news_id").
+		Where("news_items.story_id = stories.id")
+}
+
+// restoreAlerts upserts alerts. An alert is mirrored again each time it
+// changes, so the last record of an alert wins, also over the database.
+// It returns the alerts that were not in the database.
+func restoreAlerts(tx *gorm.DB, rows []Alert) (int64, error) {
+	last := make(map[string]int, len(rows))
+	for i := range rows {
+		if rows[i].Kind == "" { // mirrored before alerts had kinds
+			rows[i].Kind = AlertKindImpact
+		}
+		if rows[i].State == "" { // mirrored before alerts had states
+			rows[i].State = AlertOpen
+		}
+		last[rows[i].ID] = i
+	}
+	ids := make([]string, 0, len(last))
+	alerts := make([]Alert, 0, len(last))
+	for i := range rows {
+		if last[rows[i].ID] == i {
+			ids = append(ids, rows[i].ID)
+			alerts = append(alerts, rows[i])
+		}
+	}
+
+	var existing int64
+	if err := tx.Model(&Alert{}).Where("id IN ?", ids).Count(&existing).Error; err != nil {
+		return 0, err
+	}
+	if err := tx.Omit(clause.Associations).Clauses(clause.OnConflict{UpdateAll: true}).Create(&alerts).Error; err != nil {
+		return 0, err
+	}
+	for i := range alerts {
+		if err := saveAlertSymbols(tx, &alerts[i]); err != nil {
+			return 0, err
+		}
+	}
+	return int64(len(alerts)) - existing, nil
+}
+
+// restoreAlertRecords inserts follow-ups or audit events that are not in the
+// database yet. find clears the row's ID, which is local to the database it
+// was mirrored from, and selects copies of the row by alert and time.
+func restoreAlertRecords[T any](tx *gorm.DB, rows []T, find func(*T) *gorm.DB) (int64, error) {
+	var n int64
+	for i := range rows {
+		var count int64
+		if err := find(&rows[i]).Count(&count).Error; err != nil {
+			return n, err
+		}
+		if count > 0 {
+			continue
+		}
+		if err := tx.Create(&rows[i]).Error; err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func restoreTable[T any](s *Storage, dir, table string, since time.Time, insert func(*gorm.DB, []T) (int64, error)) (RestoreResult, error) {
+	res := RestoreResult{Table: table}
+	files, err := mirrorFiles(filepath.Join(dir, table))
+	if err != nil {
+		return res, err
+	}
+	minDay := ""
+	if !since.IsZero() {
+		minDay = since.UTC().Format("2006-01-02")
+	}
+
+	batch := make([]T, 0, restoreBatch)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		var n int64
+		err := s.db.Transaction(func(tx *gorm.DB) (err error) {
+			n, err = insert(tx, batch)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		res.Restored += int(n)
+		batch = batch[:0]
+		return nil
+	}
+
+	for _, f := range files {
+		if f.day < minDay {
+			continue
+		}
+		res.Files++
+		err := readMirrorFile(f, func(line []byte) error {
+			res.Read++
+			var row T
+			if err := json.Unmarshal(line, &row); err != nil {
+				res.Corrupt++
+				return nil
+			}
+			batch = append(batch, row)
+			if len(batch) == restoreBatch {
+				return flush()
+			}
+			return nil
+		})
+		if err != nil {
+			return res, fmt.Errorf("%s: %w", f.path, err)
+		}
+	}
+	return res, flush()
+}
+
+func readMirrorFile(f mirrorFile, fn func(line []byte) error) error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if f.gzipped {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for sc.Scan() {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	// a gzip stream cut short by a crash still yields its complete lines
+	if err := sc.Err(); err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+)
+
+func TestMirrorRotateAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	s := newSQLiteTestStore(t)
+	m, err := newMirror(config.MirrorConfig{Dir: dir, Compress: true, MaxAge: 48 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mirror = m
+
+	day1 := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	clock := day1
+	m.now = func() time.Time { return clock }
+
+	mustSaveNews(t, s, NewsItem{ID: "n1", Title: "first", PublishedAt: day1})
+	if _, err := s.SaveNewsBatch([]NewsItem{
+		{ID: "n1", Title: "first again"}, // duplicate, not mirrored
+		{ID: "n2", Title: "second", PublishedAt: day1},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveAnalysis(&Analysis{
+		ID: "a1", NewsID: "n1", Sentiment: "positive", SentimentScore: 5,
+		RelatedStocks: []string{"NVDA"}, AnalyzedAt: day1,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.MarkNewsProcessed("n1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// next day: day 1 files are compressed on the first write
+	clock = day1.Add(24 * time.Hour)
+	if err := s.SaveAlert(&Alert{ID: "al1", AnalysisID: "a1", Severity: "high", CreatedAt: clock}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveReport(&Report{ID: "r1", Type: "daily_summary", CreatedAt: clock}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"news/2025-03-10.jsonl.gz", "analyses/2025-03-10.jsonl.gz", "alerts/2025-03-11.jsonl"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected %s: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "news/2025-03-10.jsonl")); !os.IsNotExist(err) {
+		t.Error("rotated file was not removed")
+	}
+
+	// a crash mid-write leaves a truncated line
+	f, err := os.OpenFile(filepath.Join(dir, "alerts/2025-03-11.jsonl"), os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"id":"al2","sev`)
+	f.Close()
+
+	fresh := newSQLiteTestStore(t)
+	results, err := fresh.RestoreMirror(dir, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][2]int{"news": {2, 0}, "analyses": {1, 0}, "alerts": {1, 1}, "reports": {1, 0}}
+	for _, r := range results {
+		if w := want[r.Table]; r.Restored != w[0] || r.Corrupt != w[1] {
+			t.Errorf("%s: restored %d, corrupt %d; want %v", r.Table, r.Restored, r.Corrupt, w)
+		}
+	}
+
+	n1, _ := fresh.GetNews("n1")
+	if n1 == nil || n1.Title != "first" || n1.Processed != 1 {
+		t.Errorf("restored n1 = %+v, want processed because it has an analysis", n1)
+	}
+	if pending, _ := fresh.GetUnprocessedNews(10); len(pending) != 1 || pending[0].ID != "n2" {
+		t.Errorf("unprocessed after restore = %+v", pending)
+	}
+	if sent, err := fresh.GetStockSentiment("NVDA", 24*365*10); err != nil || sent.TotalMentions != 1 {
+		t.Errorf("mentions not rebuilt: %+v, %v", sent, err)
+	}
+
+	// restoring again only finds existing rows
+	results, err = fresh.RestoreMirror(dir, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range results {
+		if r.Restored != 0 {
+			t.Errorf("%s: second restore inserted %d rows", r.Table, r.Restored)
+		}
+	}
+
+	// day 1 expires once it is older than max_age
+	clock = day1.Add(4 * 24 * time.Hour)
+	mustSaveNews(t, s, NewsItem{ID: "n3", PublishedAt: clock})
+	if _, err := os.Stat(filepath.Join(dir, "news/2025-03-10.jsonl.gz")); !os.IsNotExist(err) {
+		t.Error("expired mirror file was kept")
+	}
+}
+
+func TestMirrorRestoresAlertState(t *testing.T) {
+	dir := t.TempDir()
+	s := newSQLiteTestStore(t)
+	m, err := newMirror(config.MirrorConfig{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mirror = m
+
+	day1 := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	clock := day1
+	m.now = func() time.Time { return clock }
+
+	if err := s.SaveAnalysis(&Analysis{ID: "a1", NewsID: "n1", Sentiment: "negative", AnalyzedAt: day1}); err != nil {
+		t.Fatal(err)
+	}
+	alert := &Alert{ID: "al1", NewsID: "n1", AnalysisID: "a1", Severity: "high", CreatedAt: day1}
+	if err := s.SaveAlert(alert); err != nil {
+		t.Fatal(err)
+	}
+
+	// the news, the follow-up and every state change land on day 2
+	clock = day1.Add(24 * time.Hour)
+	mustSaveNews(t, s, NewsItem{ID: "n1", Title: "Chip export ban widened", PublishedAt: clock})
+	alert.Severity, alert.Updates = "critical", 1
+	if err := s.AttachAlertUpdate(alert, &AlertUpdate{NewsID: "n2", Severity: "critical", Escalated: true, CreatedAt: clock}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.RecordNotificationAttempt(&Notification{ID: "ntf_al1_log", AlertID: "al1", Status: DeliveryDelivered}); err != nil {
+		t.Fatal(err)
+	}
+	for i, to := range []string{AlertAcknowledged, AlertResolved} {
+		ev := &AlertEvent{ToState: to, Actor: "token:ops", CreatedAt: clock.Add(time.Duration(i+1) * time.Minute)}
+		if got, err := s.ChangeAlertState("al1", ev); err != nil || got == nil {
+			t.Fatalf("ChangeAlertState %s: %v, %v", to, got, err)
+		}
+	}
+
+	// the analysis is only in the day 1 files, which --since skips, but
+	// the database being restored into already has it
+	fresh := newSQLiteTestStore(t)
+	if err := fresh.SaveAnalysis(&Analysis{ID: "a1", NewsID: "n1", Sentiment: "negative", AnalyzedAt: day1}); err != nil {
+		t.Fatal(err)
+	}
+	for pass := 0; pass < 2; pass++ {
+		if _, err := fresh.RestoreMirror(dir, day1.Add(24*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := fresh.GetAlert("al1")
+	if err != nil || got == nil {
+		t.Fatalf("GetAlert: %v, %v", got, err)
+	}
+	if got.State != AlertResolved || got.ResolvedBy != "token:ops" || got.AckedAt == nil || !got.Notified ||
+		got.Severity != "critical" || got.Updates != 1 {
+		t.Errorf("restored alert = %+v, want its last state", got)
+	}
+	if updates, _ := fresh.ListAlertUpdates("al1"); len(updates) != 1 || !updates[0].Escalated {
+		t.Errorf("restored updates = %+v", updates)
+	}
+	events, _ := fresh.ListAlertEvents("al1")
+	if len(events) != 2 || events[0].ToState != AlertAcknowledged || events[1].FromState != AlertAcknowledged {
+		t.Errorf("restored events = %+v", events)
+	}
+	if story, _ := fresh.GetStory("n1"); story == nil || story.AnalysisID != "a1" {
+		t.Errorf("restored story = %+v, want linked to the analysis in the database", story)
+	}
+}
@@ -16,6 +16,28 @@ type NewsItem struct {
 	PublishedAt time.Time `json:"published_at" gorm:"index:idx_news_published"`
 	CollectedAt time.Time `json:"collected_at"`
 	Processed   int       `json:"processed" gorm:"index:idx_news_processed"` // 0 or 1
+	StoryID     string    `json:"story_id" gorm:"index:idx_news_story"`     // near-duplicate group, "" for rows older than stories
+	Imported    bool      `json:"imported"`                                 // backfilled by sentinel import, kept by unanalyzed_news
+}
+
+// Story groups near-duplicate news items: one headline reposted by several
+// outlets, accounts and subreddits. It is analyzed once; MentionCount and
+// SourceCount measure how far it spread.
+type Story struct {
+	ID           string    `json:"id" gorm:"primaryKey"` // ID of the first news item
+	Signature    string    `json:"-"`                    // hex MinHash of the first item, "" if too short to match
+	Title        string    `json:"title"`
+	FirstSeenAt  time.Time `json:"first_seen_at"`
+	LastSeenAt   time.Time `json:"last_seen_at" gorm:"index:idx_stories_last_seen"`
+	MentionCount int       `json:"mention_count"` // news items in the story
+	SourceCount  int       `json:"source_count"`  // distinct NewsItem.Source values
+	AnalysisID   string    `json:"analysis_id"`   // the story's analysis, "" until analyzed
+}
+
+// StoryBand indexes a story's MinHash band keys for candidate lookup
+type StoryBand struct {
+	BandKey int64  `gorm:"primaryKey;autoIncrement:false"`
+	StoryID string `gorm:"primaryKey;index:idx_story_bands_story"`
 }
 
 // Analysis represents AI analysis result
@@ -36,9 +58,30 @@ type Analysis struct {
 	RawResponse    string    `json:"raw_response"`
 }
 
+// StockMention is one symbol referenced by an analysis. It normalizes
+// Analysis.RelatedStocks so per-symbol queries are exact and indexed.
+type StockMention struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	AnalysisID string    `json:"analysis_id" gorm:"index:idx_mentions_analysis"`
+	NewsID     string    `json:"news_id" gorm:"index:idx_mentions_news"`
+	Symbol     string    `json:"symbol" gorm:"index:idx_mentions_symbol_time,priority:1"`
+	Score      float64   `json:"score"`     // per-stock score, falls back to the analysis score
+	Sentiment  string    `json:"sentiment"` // sentiment of the parent analysis
+	Confidence float64   `json:"confidence"`
+	Timeframe  string    `json:"timeframe"`
+	AnalyzedAt time.Time `json:"analyzed_at" gorm:"index:idx_mentions_symbol_time,priority:2;index:idx_mentions_analyzed"`
+}
+
+// Alert kinds
+const (
+	AlertKindImpact      = "impact"       // high-impact analysis
+	AlertKindVolumeSpike = "volume_spike" // unusual burst of mentions, raised before analysis
+)
+
 // Alert represents a high-impact alert
 type Alert struct {
 	ID           string    `json:"id" gorm:"primaryKey"`
+	Kind         string    `json:"kind" gorm:"index:idx_alerts_kind"` // AlertKindImpact, AlertKindVolumeSpike
 	NewsID       string    `json:"news_id"`
 	AnalysisID   string    `json:"analysis_id"`
 	Analysis     Analysis  `json:"-" gorm:"foreignKey:AnalysisID"`
@@ -49,6 +92,22 @@ type Alert struct {
 	CreatedAt    time.Time `json:"created_at" gorm:"index:idx_alerts_created"`
 	Acknowledged int       `json:"acknowledged"` // 0 or 1
 	Notified     bool      `json:"notified"`     // Whether alert has been sent
+	Rule         string    `json:"rule,omitempty"`                            // rule that set the severity
+	Channels     []string  `json:"channels,omitempty" gorm:"serializer:json"` // notifier channels chosen by rules
+	Source       string    `json:"source,omitempty"` // source of the news behind the alert
+	URL          string    `json:"url,omitempty"`    // link to that news item
+	StoryID      string     `json:"story_id,omitempty" gorm:"index:idx_alerts_story"`
+	Direction    string     `json:"direction,omitempty"` // up, down, flat
+	Updates      int        `json:"updates"`             // follow-up items attached
+	LastUpdateAt *time.Time `json:"last_update_at,omitempty"`
+	Escalations  int        `json:"escalations"` // times a follow-up raised the severity
+	EscalatedAt  *time.Time `json:"escalated_at,omitempty" gorm:"index:idx_alerts_escalated"`
+	State        string     `json:"state" gorm:"index:idx_alerts_state"` // open, acknowledged, snoozed, resolved
+	AckedBy      string     `json:"acked_by,omitempty"`
+	AckedAt      *time.Time `json:"acked_at,omitempty"`
+	SnoozedUntil *time.Time `json:"snoozed_until,omitempty"`
+	ResolvedBy   string     `json:"resolved_by,omitempty"`
+	ResolvedAt   *time.Time `json:"resolved_at,omitempty"`
 }
 
 // Report represents a generated report
@@ -78,10 +137,12 @@ type StockImpact struct {
 // StockSentiment (This is a result struct, not a table)
 type StockSentiment struct {
 	Symbol        string     `json:"symbol"`
-	TotalMentions int        `json:"total_mentions"`
+	TotalMentions int        `json:"total_mentions"` // analyses mentioning the symbol, one per story
 	PositiveCount int        `json:"positive_count"`
 	NegativeCount int        `json:"negative_count"`
 	NeutralCount  int        `json:"neutral_count"`
+	NewsCount     int        `json:"news_count"`   // news items in the mentioning stories, duplicates included
+	SourceCount   int        `json:"source_count"` // distinct sources carrying those stories
 	OverallScore  float64    `json:"overall_score"`
 	RecentNews    []NewsItem `json:"recent_news"`
 	LastUpdated   time.Time  `json:"last_updated"`
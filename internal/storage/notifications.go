@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Notification is one alert routed to one configured notifier channel.
+// Like WebhookDelivery it is both the outbox and the delivery log, and uses
+// the same Delivery* statuses.
+type Notification struct {
+	ID            string     `json:"id" gorm:"primaryKey"` // ntf_<alert>_<channel>
+	AlertID       string     `json:"alert_id" gorm:"index:idx_notifications_alert"`
+	Channel       string     `json:"channel"` // channel name from notifier.channels
+	Status        string     `json:"status" gorm:"index:idx_notifications_due,priority:1"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"index:idx_notifications_due,priority:2"`
+	LastError     string     `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	SentAt        *time.Time `json:"sent_at,omitempty"`
+}
+
+// GetAlert 获取单条警报
+func (s *Storage) GetAlert(id string) (*Alert, error) {
+	var item Alert
+	if err := s.db.First(&item, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	item.wake(time.Now())
+	return &item, nil
+}
+
+// QueueNotifications 写入待发送通知（已存在的跳过），返回新写入的条数
+func (s *Storage) QueueNotifications(items []Notification) (int, error) {
+	if len(items) == 0 {
+		return 0, nil
+	}
+	res := s.dialect.insertIgnore(s.db).Create(&items)
+	return int(res.RowsAffected), res.Error
+}
+
+// DueNotifications 获取到期待发送的通知（最早到期在前）
+func (s *Storage) DueNotifications(now time.Time, limit int) ([]Notification, error) {
+	var items []Notification
+	err := s.db.Where("status = ? AND next_attempt_at <= ?", DeliveryPending, now).
+		Order("next_attempt_at").
+		Limit(limit).
+		Find(&items).Error
+	return items, err
+}
+
+// RecordNotificationAttempt 保存一次发送尝试的结果，发送成功时将警报标记为已通知
+func (s *Storage) RecordNotificationAttempt(n *Notification) error {
+	flipped := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&Notification{}).Where("id = ?", n.ID).Updates(map[string]interface{}{
+			"status":          n.Status,
+			"attempts":        n.Attempts,
+			"next_attempt_at": n.NextAttemptAt,
+			"last_error":      n.LastError,
+			"sent_at":         n.SentAt,
+		}).Error
+		if err != nil || n.Status != DeliveryDelivered {
+			return err
+		}
+		res := tx.Model(&Alert{}).Where("id = ? AND notified = ?", n.AlertID, false).Update("notified", true)
+		flipped = res.RowsAffected > 0
+		return res.Error
+	})
+	if err == nil && flipped {
+		s.mirrorAlert(n.AlertID)
+	}
+	return err
+}
+
+// ListNotifications 获取通知发送记录（最新在前，参数为空表示不过滤）
+func (s *Storage) ListNotifications(alertID, channel, status string, limit, offset int) ([]Notification, int, error) {
+	var items []Notification
+	var total int64
+
+	tx := s.db.Model(&Notification{})
+	if alertID != "" {
+		tx = tx.Where("alert_id = ?", alertID)
+	}
+	if channel != "" {
+		tx = tx.Where("channel = ?", channel)
+	}
+	if status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := tx.Order("created_at DESC").Limit(limit).Offset(offset).Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	return items, int(total), nil
+}
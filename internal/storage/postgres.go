@@ -0,0 +1,645 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+// NewPostgres creates a PostgreSQL-backed storage instance using GORM and
+// applies pending migrations. JSON fields are stored as jsonb and search
+// uses generated tsvector columns.
+func NewPostgres(dsn string) (*Storage, error) {
+	db, err := openPostgres(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return newStorage(db, postgresDialect{}, true)
+}
+
+func openPostgres(dsn string) (*gorm.DB, error) {
+	config := &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Warn),
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	sqlDB.SetMaxIdleConns(10)
+	sqlDB.SetMaxOpenConns(50)
+	sqlDB.SetConnMaxLifetime(time.Hour)
+
+	return db, nil
+}
+
+// postgresTextConfig is the text search configuration used for indexing
+const postgresTextConfig = "english"
+
+// postgresMigrations is the PostgreSQL schema history, kept version for
+// version in step with SQLite. DDL is written by hand instead of AutoMigrate
+// so JSON columns can be jsonb and search vectors can be generated columns.
+func postgresMigrations() []Migration {
+	return []Migration{
+		{
+			Version: 1,
+			Name:    "initial_schema",
+			Up: execAll(
+				`CREATE TABLE IF NOT EXISTS news_items (
+					id text PRIMARY KEY,
+					source text NOT NULL DEFAULT '',
+					source_id text NOT NULL DEFAULT '',
+					author text NOT NULL DEFAULT '',
+					title text NOT NULL DEFAULT '',
+					content text NOT NULL DEFAULT '',
+					url text NOT NULL DEFAULT '',
+					published_at timestamptz,
+					collected_at timestamptz,
+					processed bigint NOT NULL DEFAULT 0,
+					search_vector tsvector GENERATED ALWAYS AS (
+						setweight(to_tsvector('`+postgresTextConfig+`', coalesce(title, '')), 'A') ||
+						setweight(to_tsvector('`+postgresTextConfig+`', coalesce(content, '')), 'B')
+					) STORED
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_news_source ON news_items (source)`,
+				`CREATE UNIQUE INDEX IF NOT EXISTS idx_source_source_id ON news_items (source_id)`,
+				`CREATE INDEX IF NOT EXISTS idx_news_published ON news_items (published_at)`,
+				`CREATE INDEX IF NOT EXISTS idx_news_processed ON news_items (processed)`,
+				`CREATE INDEX IF NOT EXISTS idx_news_search ON news_items USING gin (search_vector)`,
+
+				`CREATE TABLE IF NOT EXISTS analyses (
+					id text PRIMARY KEY,
+					news_id text NOT NULL DEFAULT '',
+					sentiment text NOT NULL DEFAULT '',
+					sentiment_score double precision NOT NULL DEFAULT 0,
+					confidence double precision NOT NULL DEFAULT 0,
+					entities jsonb,
+					related_stocks jsonb,
+					stock_details jsonb,
+					impact_level text NOT NULL DEFAULT '',
+					summary text NOT NULL DEFAULT '',
+					key_points jsonb,
+					analyzed_at timestamptz,
+					raw_response text NOT NULL DEFAULT '',
+					search_vector tsvector GENERATED ALWAYS AS (
+						setweight(to_tsvector('`+postgresTextConfig+`', coalesce(summary, '')), 'A') ||
+						setweight(to_tsvector('`+postgresTextConfig+`', coalesce(key_points, '[]'::jsonb)), 'B')
+					) STORED
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_analysis_news ON analyses (news_id)`,
+				`CREATE INDEX IF NOT EXISTS idx_analysis_analyzed ON analyses (analyzed_at)`,
+				`CREATE INDEX IF NOT EXISTS idx_analysis_search ON analyses USING gin (search_vector)`,
+
+				`CREATE TABLE IF NOT EXISTS alerts (
+					id text PRIMARY KEY,
+					news_id text NOT NULL DEFAULT '',
+					analysis_id text NOT NULL DEFAULT '',
+					title text NOT NULL DEFAULT '',
+					description text NOT NULL DEFAULT '',
+					severity text NOT NULL DEFAULT '',
+					stocks jsonb,
+					created_at timestamptz,
+					acknowledged bigint NOT NULL DEFAULT 0,
+					notified boolean NOT NULL DEFAULT false
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_alerts_created ON alerts (created_at)`,
+
+				`CREATE TABLE IF NOT EXISTS reports (
+					id text PRIMARY KEY,
+					type text NOT NULL DEFAULT '',
+					title text NOT NULL DEFAULT '',
+					start_time timestamptz,
+					end_time timestamptz,
+					summary text NOT NULL DEFAULT '',
+					content text NOT NULL DEFAULT '',
+					top_news jsonb,
+					stock_impact jsonb,
+					created_at timestamptz,
+					generated_at timestamptz,
+					file_path text NOT NULL DEFAULT ''
+				)`,
+			),
+			Down: execAll(
+				`DROP TABLE IF EXISTS reports`,
+				`DROP TABLE IF EXISTS alerts`,
+				`DROP TABLE IF EXISTS analyses`,
+				`DROP TABLE IF EXISTS news_items`,
+			),
+		},
+		{
+			Version: 2,
+			Name:    "stock_mentions",
+			Up: func(tx *gorm.DB) error {
+				err := execAll(
+					`CREATE TABLE IF NOT EXISTS stock_mentions (
+						id bigserial PRIMARY KEY,
+						analysis_id text NOT NULL DEFAULT '',
+						news_id text NOT NULL DEFAULT '',
+						symbol text NOT NULL DEFAULT '',
+						score double precision NOT NULL DEFAULT 0,
+						sentiment text NOT NULL DEFAULT '',
+						confidence double precision NOT NULL DEFAULT 0,
+						timeframe text NOT NULL DEFAULT '',
+						analyzed_at timestamptz
+					)`,
+					`CREATE INDEX IF NOT EXISTS idx_mentions_analysis ON stock_mentions (analysis_id)`,
+					`CREATE INDEX IF NOT EXISTS idx_mentions_news ON stock_mentions (news_id)`,
+					`CREATE INDEX IF NOT EXISTS idx_mentions_symbol_time ON stock_mentions (symbol, analyzed_at)`,
+					`CREATE INDEX IF NOT EXISTS idx_mentions_analyzed ON stock_mentions (analyzed_at)`,
+				)(tx)
+				if err != nil {
+					return err
+				}
+				return backfillStockMentions(tx)
+			},
+			Down: execAll(`DROP TABLE IF EXISTS stock_mentions`),
+		},
+		{
+			Version: 3,
+			Name:    "sentiment_rollups",
+			Up: func(tx *gorm.DB) error {
+				err := execAll(
+					`CREATE TABLE IF NOT EXISTS sentiment_rollups (
+						symbol text NOT NULL,
+						bucket_interval text NOT NULL,
+						bucket_start timestamptz NOT NULL,
+						mention_count bigint NOT NULL DEFAULT 0,
+						score_sum double precision NOT NULL DEFAULT 0,
+						weighted_score_sum double precision NOT NULL DEFAULT 0,
+						weight_sum double precision NOT NULL DEFAULT 0,
+						positive_count bigint NOT NULL DEFAULT 0,
+						negative_count bigint NOT NULL DEFAULT 0,
+						neutral_count bigint NOT NULL DEFAULT 0,
+						PRIMARY KEY (symbol, bucket_interval, bucket_start)
+					)`,
+				)(tx)
+				if err != nil {
+					return err
+				}
+				return rebuildRollups(tx)
+			},
+			Down: execAll(`DROP TABLE IF EXISTS sentiment_rollups`),
+		},
+		{
+			Version: 4,
+			Name:    "stories",
+			Up: execAll(
+				`CREATE TABLE IF NOT EXISTS stories (
+					id text PRIMARY KEY,
+					signature text NOT NULL DEFAULT '',
+					title text NOT NULL DEFAULT '',
+					first_seen_at timestamptz,
+					last_seen_at timestamptz,
+					mention_count bigint NOT NULL DEFAULT 0,
+					source_count bigint NOT NULL DEFAULT 0,
+					analysis_id text NOT NULL DEFAULT ''
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_stories_last_seen ON stories (last_seen_at)`,
+				`CREATE TABLE IF NOT EXISTS story_bands (
+					band_key bigint NOT NULL,
+					story_id text NOT NULL,
+					PRIMARY KEY (band_key, story_id)
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_story_bands_story ON story_bands (story_id)`,
+				`ALTER TABLE news_items ADD COLUMN IF NOT EXISTS story_id text NOT NULL DEFAULT ''`,
+				`CREATE INDEX IF NOT EXISTS idx_news_story ON news_items (story_id)`,
+			),
+			Down: execAll(
+				`DROP INDEX IF EXISTS idx_news_story`,
+				`ALTER TABLE news_items DROP COLUMN IF EXISTS story_id`,
+				`DROP TABLE IF EXISTS story_bands`,
+				`DROP TABLE IF EXISTS stories`,
+			),
+		},
+		{
+			Version: 5,
+			Name:    "alert_kind",
+			Up: execAll(
+				`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS kind text NOT NULL DEFAULT 'impact'`,
+				`CREATE INDEX IF NOT EXISTS idx_alerts_kind ON alerts (kind)`,
+			),
+			Down: execAll(
+				`DROP INDEX IF EXISTS idx_alerts_kind`,
+				`ALTER TABLE alerts DROP COLUMN IF EXISTS kind`,
+			),
+		},
+		{
+			Version: 6,
+			Name:    "webhooks",
+			Up: execAll(
+				`CREATE TABLE IF NOT EXISTS webhooks (
+					id text PRIMARY KEY,
+					name text NOT NULL DEFAULT '',
+					url text NOT NULL,
+					secret text NOT NULL DEFAULT '',
+					symbols text,
+					severities text,
+					sentiments text,
+					event_types text,
+					created_at timestamptz
+				)`,
+				`CREATE TABLE IF NOT EXISTS webhook_deliveries (
+					id text PRIMARY KEY,
+					webhook_id text NOT NULL,
+					alert_id text NOT NULL,
+					event_type text NOT NULL DEFAULT '',
+					payload text NOT NULL,
+					status text NOT NULL,
+					attempts bigint NOT NULL DEFAULT 0,
+					next_attempt_at timestamptz,
+					last_status_code bigint NOT NULL DEFAULT 0,
+					last_error text NOT NULL DEFAULT '',
+					created_at timestamptz,
+					delivered_at timestamptz
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_deliveries_webhook ON webhook_deliveries (webhook_id)`,
+				`CREATE INDEX IF NOT EXISTS idx_deliveries_due ON webhook_deliveries (status, next_attempt_at)`,
+			),
+			Down: execAll(
+				`DROP TABLE IF EXISTS webhook_deliveries`,
+				`DROP TABLE IF EXISTS webhooks`,
+			),
+		},
+		{
+			Version: 7,
+			Name:    "notifications",
+			Up: execAll(
+				`CREATE TABLE IF NOT EXISTS notifications (
+					id text PRIMARY KEY,
+					alert_id text NOT NULL,
+					channel text NOT NULL,
+					status text NOT NULL,
+					attempts bigint NOT NULL DEFAULT 0,
+					next_attempt_at timestamptz,
+					last_error text NOT NULL DEFAULT '',
+					created_at timestamptz,
+					sent_at timestamptz
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_notifications_alert ON notifications (alert_id)`,
+				`CREATE INDEX IF NOT EXISTS idx_notifications_due ON notifications (status, next_attempt_at)`,
+			),
+			Down: execAll(`DROP TABLE IF EXISTS notifications`),
+		},
+		{
+			Version: 8,
+			Name:    "alert_rules",
+			Up: execAll(
+				`CREATE TABLE IF NOT EXISTS alert_rules (
+					id text PRIMARY KEY,
+					name text NOT NULL DEFAULT '',
+					expr text NOT NULL,
+					severity text NOT NULL,
+					channels text,
+					enabled boolean NOT NULL DEFAULT true,
+					created_at timestamptz,
+					updated_at timestamptz
+				)`,
+				`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS rule text NOT NULL DEFAULT ''`,
+				`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS channels text`,
+			),
+			Down: execAll(
+				`ALTER TABLE alerts DROP COLUMN IF EXISTS channels`,
+				`ALTER TABLE alerts DROP COLUMN IF EXISTS rule`,
+				`DROP TABLE IF EXISTS alert_rules`,
+			),
+		},
+		{
+			Version: 9,
+			Name:    "alert_source",
+			Up: execAll(
+				`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS source text NOT NULL DEFAULT ''`,
+				`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS url text NOT NULL DEFAULT ''`,
+			),
+			Down: execAll(
+				`ALTER TABLE alerts DROP COLUMN IF EXISTS url`,
+				`ALTER TABLE alerts DROP COLUMN IF EXISTS source`,
+			),
+		},
+		{
+			Version: 10,
+			Name:    "alert_groups",
+			Up: execAll(
+				`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS story_id text NOT NULL DEFAULT ''`,
+				`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS direction text NOT NULL DEFAULT ''`,
+				`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS updates bigint NOT NULL DEFAULT 0`,
+				`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS last_update_at timestamptz`,
+				`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS escalations bigint NOT NULL DEFAULT 0`,
+				`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS escalated_at timestamptz`,
+				`CREATE INDEX IF NOT EXISTS idx_alerts_story ON alerts (story_id, created_at)`,
+				`CREATE INDEX IF NOT EXISTS idx_alerts_escalated ON alerts (escalated_at)`,
+				`CREATE TABLE IF NOT EXISTS alert_updates (
+					id bigserial PRIMARY KEY,
+					alert_id text NOT NULL DEFAULT '',
+					news_id text NOT NULL DEFAULT '',
+					analysis_id text NOT NULL DEFAULT '',
+					title text NOT NULL DEFAULT '',
+					severity text NOT NULL DEFAULT '',
+					stocks text,
+					escalated boolean NOT NULL DEFAULT false,
+					created_at timestamptz
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_alert_updates_alert ON alert_updates (alert_id)`,
+			),
+			Down: execAll(
+				`DROP TABLE IF EXISTS alert_updates`,
+				`DROP INDEX IF EXISTS idx_alerts_escalated`,
+				`DROP INDEX IF EXISTS idx_alerts_story`,
+				`ALTER TABLE alerts DROP COLUMN IF EXISTS escalated_at`,
+				`ALTER TABLE alerts DROP COLUMN IF EXISTS escalations`,
+				`ALTER TABLE alerts DROP COLUMN IF EXISTS last_update_at`,
+				`ALTER TABLE alerts DROP COLUMN IF EXISTS updates`,
+				`ALTER TABLE alerts DROP COLUMN IF EXISTS direction`,
+				`ALTER TABLE alerts DROP COLUMN IF EXISTS story_id`,
+			),
+		},
+		{
+			Version: 11,
+			Name:    "alert_states",
+			Up: execAll(
+				`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS state text NOT NULL DEFAULT 'open'`,
+				`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS acked_by text NOT NULL DEFAULT ''`,
+				`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS acked_at timestamptz`,
+				`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS snoozed_until timestamptz`,
+				`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS resolved_by text NOT NULL DEFAULT ''`,
+				`ALTER TABLE alerts ADD COLUMN IF NOT EXISTS resolved_at timestamptz`,
+				`UPDATE alerts SET state = 'acknowledged' WHERE acknowledged = 1`,
+				`CREATE INDEX IF NOT EXISTS idx_alerts_state ON alerts (state)`,
+				`CREATE TABLE IF NOT EXISTS alert_events (
+					id bigserial PRIMARY KEY,
+					alert_id text NOT NULL DEFAULT '',
+					from_state text NOT NULL DEFAULT '',
+					to_state text NOT NULL DEFAULT '',
+					actor text NOT NULL DEFAULT '',
+					note text NOT NULL DEFAULT '',
+					snoozed_until timestamptz,
+					created_at timestamptz
+				)`,
+				`CREATE INDEX IF NOT EXISTS idx_alert_events_alert ON alert_events (alert_id)`,
+			),
+			Down: execAll(
+				`DROP TABLE IF EXISTS alert_events`,
+				`DROP INDEX IF EXISTS idx_alerts_state`,
+				`ALTER TABLE alerts DROP COLUMN IF EXISTS resolved_at`,
+				`ALTER TABLE alerts DROP COLUMN IF EXISTS resolved_by`,
+				`ALTER TABLE alerts DROP COLUMN IF EXISTS snoozed_until`,
+				`ALTER TABLE alerts DROP COLUMN IF EXISTS acked_at`,
+				`ALTER TABLE alerts DROP COLUMN IF EXISTS acked_by`,
+				`ALTER TABLE alerts DROP COLUMN IF EXISTS state`,
+			),
+		},
+		{
+			Version: 12,
+			Name:    "api_tokens",
+			Up: execAll(
+				`CREATE TABLE IF NOT EXISTS api_tokens (
+					id text PRIMARY KEY,
+					name text NOT NULL DEFAULT '',
+					hash text NOT NULL DEFAULT '',
+					prefix text NOT NULL DEFAULT '',
+					scopes text,
+					expires_at timestamptz,
+					revoked_at timestamptz,
+					created_at timestamptz
+				)`,
+				`CREATE UNIQUE INDEX IF NOT EXISTS idx_api_tokens_name ON api_tokens (name)`,
+				`CREATE UNIQUE INDEX IF NOT EXISTS idx_api_tokens_hash ON api_tokens (hash)`,
+			),
+			Down: execAll(`DROP TABLE IF EXISTS api_tokens`),
+		},
+		{
+			Version: 13,
+			Name:    "news_imported",
+			Up:      execAll(`ALTER TABLE news_items ADD COLUMN IF NOT EXISTS imported boolean NOT NULL DEFAULT false`),
+			Down:    execAll(`ALTER TABLE news_items DROP COLUMN IF EXISTS imported`),
+		},
+		{
+			Version: 14,
+			Name:    "news_source_unique",
+			Up: execAll(append(dedupeNewsSourceIDs(),
+				`DROP INDEX IF EXISTS idx_source_source_id`,
+				`CREATE UNIQUE INDEX idx_source_source_id ON news_items (source, source_id) WHERE source_id <> ''`,
+			)...),
+			Down: execAll(
+				`DROP INDEX IF EXISTS idx_source_source_id`,
+				`CREATE UNIQUE INDEX idx_source_source_id ON news_items (source_id)`,
+			),
+		},
+		{
+			Version: 15,
+			Name:    "alert_symbols",
+			Up: func(tx *gorm.DB) error {
+				err := execAll(
+					`CREATE TABLE IF NOT EXISTS alert_symbols (
+						alert_id text NOT NULL,
+						symbol text NOT NULL,
+						PRIMARY KEY (alert_id, symbol)
+					)`,
+					`CREATE INDEX IF NOT EXISTS idx_alert_symbols_symbol ON alert_symbols (symbol)`,
+				)(tx)
+				if err != nil {
+					return err
+				}
+				return backfillAlertSymbols(tx)
+			},
+			Down: execAll(`DROP TABLE IF EXISTS alert_symbols`),
+		},
+	}
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Name() string { return "postgres" }
+
+func (postgresDialect) migrations() []Migration { return postgresMigrations() }
+
+// postgresMigrationLock is the advisory lock key held while migrating
+const postgresMigrationLock = 0x73656e74 // "sent"
+
+// lockMigrations serializes instances migrating the same database
+func (postgresDialect) lockMigrations(tx *gorm.DB) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(?)", postgresMigrationLock).Error
+}
+
+// insertIgnore uses ON CONFLICT DO NOTHING, which covers every unique index
+func (postgresDialect) insertIgnore(tx *gorm.DB) *gorm.DB {
+	return tx.Clauses(clause.OnConflict{DoNothing: true})
+}
+
+func (postgresDialect) snapshot(db *gorm.DB, path string) error {
+	return ErrBackupUnsupported
+}
+
+// vacuum runs VACUUM ANALYZE. Autovacuum normally keeps up; FULL rewrites
+// the tables and returns space to the OS but takes exclusive locks.
+func (postgresDialect) vacuum(db *gorm.DB, mode string) error {
+	if mode == VacuumFull {
+		return db.Exec("VACUUM (FULL, ANALYZE)").Error
+	}
+	return db.Exec("VACUUM (ANALYZE)").Error
+}
+
+// setupSearch has nothing to do: the tsvector columns are part of the schema
+func (postgresDialect) setupSearch(db *gorm.DB) (bool, error) {
+	return true, nil
+}
+
+const postgresHeadlineOptions = "StartSel=" + snippetOpen + ", StopSel=" + snippetClose +
+	", MaxWords=35, MinWords=15, MaxFragments=1, FragmentDelimiter=…"
+
+// search matches the generated tsvector columns, ranked by ts_rank_cd
+func (postgresDialect) search(db *gorm.DB, expr []searchToken, q SearchQuery) ([]SearchHit, int, error) {
+	tsquery, queryArgs := postgresTSQuery(expr)
+	if tsquery == "" {
+		return nil, 0, nil
+	}
+
+	var parts []string
+	var args []interface{}
+
+	filter, filterArgs := searchFilters(q)
+	if q.Type == "" || q.Type == SearchTypeNews {
+		parts = append(parts, `
+			SELECT 'news' AS type, n.id AS id, n.id AS news_id, n.title AS title,
+				ts_headline('`+postgresTextConfig+`', n.title || ' ' || n.content, q.query, '`+postgresHeadlineOptions+`') AS snippet,
+				ts_rank_cd(n.search_vector, q.query) AS score,
+				n.source AS source, n.url AS url, n.published_at AS published_at
+			FROM news_items n, q
+			WHERE n.search_vector @@ q.query`+filter)
+		args = append(args, filterArgs...)
+	}
+	if q.Type == "" || q.Type == SearchTypeAnalysis {
+		parts = append(parts, `
+			SELECT 'analysis' AS type, a.id AS id, n.id AS news_id, n.title AS title,
+				ts_headline('`+postgresTextConfig+`', a.summary, q.query, '`+postgresHeadlineOptions+`') AS snippet,
+				ts_rank_cd(a.search_vector, q.query) AS score,
+				n.source AS source, n.url AS url, n.published_at AS published_at
+			FROM analyses a JOIN news_items n ON n.id = a.news_id, q
+			WHERE a.search_vector @@ q.query`+filter)
+		args = append(args, filterArgs...)
+	}
+
+	with := "WITH q AS (SELECT " + tsquery + " AS query) "
+	union := strings.Join(parts, " UNION ALL ")
+	args = append(queryArgs, args...)
+
+	var total int64
+	if err := db.Raw(with+"SELECT COUNT(*) FROM ("+union+") t", args...).Scan(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var hits []SearchHit
+	pageArgs := append(append([]interface{}{}, args...), q.Limit, q.Offset)
+	if err := db.Raw(with+"SELECT * FROM ("+union+") t ORDER BY score DESC, published_at DESC LIMIT ? OFFSET ?", pageArgs...).
+		Scan(&hits).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return hits, int(total), nil
+}
+
+// postgresTSQuery renders a parsed query as a tsquery expression. tsquery
+// operators all share one precedence level, so the FTS5 precedence
+// (NOT > AND > OR) is applied here and the result fully parenthesized.
+// Terms and phrases are bind parameters to plainto/phraseto_tsquery, so user
+// text never reaches the tsquery parser.
+func postgresTSQuery(expr []searchToken) (string, []interface{}) {
+	p := &tsqueryParser{tokens: expr}
+	return p.or(), p.args
+}
+
+type tsqueryParser struct {
+	tokens []searchToken
+	pos    int
+	args   []interface{}
+}
+
+func (p *tsqueryParser) peek() (searchToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return searchToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *tsqueryParser) or() string {
+	left := p.and()
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind != tokenOr {
+			return left
+		}
+		p.pos++
+		left = "(" + left + " || " + p.and() + ")"
+	}
+}
+
+func (p *tsqueryParser) and() string {
+	left := p.not()
+	for {
+		t, ok := p.peek()
+		if !ok {
+			return left
+		}
+		switch {
+		case t.kind == tokenAnd:
+			p.pos++
+		case t.operand() || t.kind == tokenOpen:
+			// implicit AND between adjacent operands
+		default:
+			return left
+		}
+		left = "(" + left + " && " + p.not() + ")"
+	}
+}
+
+func (p *tsqueryParser) not() string {
+	left := p.primary()
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind != tokenNot {
+			return left
+		}
+		p.pos++
+		left = "(" + left + " && !!" + p.primary() + ")"
+	}
+}
+
+func (p *tsqueryParser) primary() string {
+	t, _ := p.peek()
+	p.pos++
+	switch t.kind {
+	case tokenOpen:
+		inner := p.or()
+		p.pos++ // closing parenthesis, guaranteed by validateSearchTokens
+		return inner
+	case tokenPhrase:
+		p.args = append(p.args, t.text)
+		return "phraseto_tsquery('" + postgresTextConfig + "', ?)"
+	default:
+		if word := tsPrefixWord(t.text); t.prefix && word != "" {
+			p.args = append(p.args, word+":*")
+			return "to_tsquery('" + postgresTextConfig + "', ?)"
+		}
+		p.args = append(p.args, t.text)
+		return "plainto_tsquery('" + postgresTextConfig + "', ?)"
+	}
+}
+
+func tsPrefixWord(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, s)
+}
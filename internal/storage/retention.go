@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+	"gorm.io/gorm"
+)
+
+// Vacuum modes
+const (
+	VacuumOff         = "off"
+	VacuumIncremental = "incremental"
+	VacuumFull        = "full"
+)
+
+// RetentionRule removes data of one kind older than MaxAge
+type RetentionRule struct {
+	Name   string
+	MaxAge time.Duration
+}
+
+// PruneResult reports what one rule deleted or cleared (or would, in a dry run)
+type PruneResult struct {
+	Rule     string           `json:"rule"`
+	Table    string           `json:"table"`
+	Action   string           `json:"action"` // delete or clear
+	Cutoff   time.Time        `json:"cutoff"`
+	Rows     int64            `json:"rows"`               // rows of Table
+	Cascaded map[string]int64 `json:"cascaded,omitempty"` // dependent rows deleted with them, by table
+}
+
+// RetentionRules returns the enabled rules of cfg in execution order.
+// Whole news and analyses go first so the narrower rules only see what is left.
+func RetentionRules(cfg config.RetentionConfig) []RetentionRule {
+	// stories go once their news is gone, so they follow the shorter news rule
+	stories := cfg.News
+	if stories == 0 || (cfg.UnanalyzedNews > 0 && cfg.UnanalyzedNews < stories) {
+		stories = cfg.UnanalyzedNews
+	}
+	all := []RetentionRule{
+		{"news", cfg.News},
+		{"analyses", cfg.Analyses},
+		{"unanalyzed_news", cfg.UnanalyzedNews},
+		{"stories", stories},
+		{"raw_responses", cfg.RawResponses},
+		{"alerts", cfg.Alerts},
+		{"webhook_deliveries", cfg.WebhookDeliveries},
+		{"notifications", cfg.Notifications},
+		{"reports", cfg.Reports},
+		{"report_content", cfg.ReportContent},
+		{"rollups_5m", cfg.Rollups5m},
+		{"rollups_1h", cfg.Rollups1h},
+	}
+	var rules []RetentionRule
+	for _, r := range all {
+		if r.MaxAge > 0 {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// pruner selects the rows a rule affects and removes them
+type pruner struct {
+	table  string
+	model  interface{}
+	action string
+	scope  func(db *gorm.DB, cutoff time.Time) *gorm.DB
+	// dependents are deleted, in order, before the scoped rows
+	dependents []dependent
+	// apply overrides the default delete of the scoped rows
+	apply func(tx *gorm.DB, cutoff time.Time) (int64, error)
+}
+
+// dependent selects the rows of another table that refer to the rows a
+// pruner deletes
+type dependent struct {
+	table string
+	model interface{}
+	scope func(db *gorm.DB, cutoff time.Time) *gorm.DB
+}
+
+var pruners = map[string]pruner{
+	"news": {
+		table: "news_items", model: &NewsItem{}, action: "delete",
+		scope: func(db *gorm.DB, cutoff time.Time) *gorm.DB {
+			return db.Where("published_at < ?", cutoff)
+		},
+		dependents: []dependent{
+			{"stock_mentions", &StockMention{}, oldNews},
+			{"analyses", &Analysis{}, oldNews},
+		},
+	},
+	"analyses": {
+		table: "analyses", model: &Analysis{}, action: "delete",
+		scope: func(db *gorm.DB, cutoff time.Time) *gorm.DB {
+			return db.Where("analyzed_at < ?", cutoff)
+		},
+		dependents: []dependent{
+			{"stock_mentions", &StockMention{}, func(db *gorm.DB, cutoff time.Time) *gorm.DB {
+				return db.Where("analysis_id IN (?)", db.Model(&Analysis{}).Select("id").Where("analyzed_at < ?", cutoff))
+			}},
+		},
+	},
+	"unanalyzed_news": {
+		table: "news_items", model: &NewsItem{}, action: "delete",
+		scope: func(db *gorm.DB, cutoff time.Time) *gorm.DB {
+			// copies of an analyzed story keep its spread and mention count,
+			// and backfills are kept for backtesting
+			return db.Where("collected_at < ? AND imported = ?", cutoff, false).
+				Where("NOT EXISTS (SELECT 1 FROM analyses a WHERE a.news_id = news_items.id)").
+				Where("NOT EXISTS (SELECT 1 FROM stories s WHERE s.id = news_items.story_id AND s.analysis_id <> '')")
+		},
+	},
+	"stories": {
+		table: "stories", model: &Story{}, action: "delete",
+		scope: orphanStories,
+		dependents: []dependent{
+			{"story_bands", &StoryBand{}, func(db *gorm.DB, cutoff time.Time) *gorm.DB {
+				return db.Where("story_id IN (?)", orphanStories(db.Model(&Story{}).Select("id"), cutoff))
+			}},
+		},
+	},
+	"raw_responses": {
+		table: "analyses", model: &Analysis{}, action: "clear",
+		scope: func(db *gorm.DB, cutoff time.Time) *gorm.DB {
+			return db.Where("analyzed_at < ? AND raw_response <> ''", cutoff)
+		},
+		apply: func(tx *gorm.DB, cutoff time.Time) (int64, error) {
+			res := tx.Model(&Analysis{}).Where("analyzed_at < ? AND raw_response <> ''", cutoff).
+				Update("raw_response", "")
+			return res.RowsAffected, res.Error
+		},
+	},
+	"alerts": {
+		table: "alerts", model: &Alert{}, action: "delete",
+		scope: func(db *gorm.DB, cutoff time.Time) *gorm.DB {
+			return db.Where("created_at < ?", cutoff)
+		},
+		dependents: []dependent{
+			{"alert_updates", &AlertUpdate{}, oldAlerts},
+			{"alert_events", &AlertEvent{}, oldAlerts},
+			{"alert_symbols", &AlertSymbol{}, oldAlerts},
+		},
+	},
+	// the outbox keeps pending deliveries until they are sent or abandoned
+	"webhook_deliveries": {
+		table: "webhook_deliveries", model: &WebhookDelivery{}, action: "delete",
+		scope: func(db *gorm.DB, cutoff time.Time) *gorm.DB {
+			return db.Where("created_at < ? AND status <> ?", cutoff, DeliveryPending)
+		},
+	},
+	"notifications": {
+		table: "notifications", model: &Notification{}, action: "delete",
+		scope: func(db *gorm.DB, cutoff time.Time) *gorm.DB {
+			return db.Where("created_at < ? AND status <> ?", cutoff, DeliveryPending)
+		},
+	},
+	"reports": {
+		table: "reports", model: &Report{}, action: "delete",
+		scope: func(db *gorm.DB, cutoff time.Time) *gorm.DB {
+			return db.Where("created_at < ?", cutoff)
+		},
+	},
+	"report_content": {
+		table: "reports", model: &Report{}, action: "clear",
+		scope: func(db *gorm.DB, cutoff time.Time) *gorm.DB {
+			return db.Where("created_at < ? AND content <> ''", cutoff)
+		},
+		apply: func(tx *gorm.DB, cutoff time.Time) (int64, error) {
+			res := tx.Model(&Report{}).Where("created_at < ? AND content <> ''", cutoff).Update("content", "")
+			return res.RowsAffected, res.Error
+		},
+	},
+	"rollups_5m": rollupPruner("5m"),
+	"rollups_1h": rollupPruner("1h"),
+}
+
+// oldNews scopes the rows of news the news rule deletes
+func oldNews(db *gorm.DB, cutoff time.Time) *gorm.DB {
+	return db.Where("news_id IN (?)", db.Model(&NewsItem{}).Select("id").Where("published_at < ?", cutoff))
+}
+
+// oldAlerts scopes the rows of alerts the alerts rule deletes
+func oldAlerts(db *gorm.DB, cutoff time.Time) *gorm.DB {
+	return db.Where("alert_id IN (?)", db.Model(&Alert{}).Select("id").Where("created_at < ?", cutoff))
+}
+
+// orphanStories scopes stories whose news has all been pruned
+func orphanStories(db *gorm.DB, cutoff time.Time) *gorm.DB {
+	return db.Where("last_seen_at < ?", cutoff).
+		Where("NOT EXISTS (SELECT 1 FROM news_items n WHERE n.story_id = stories.id)")
+}
+
+func rollupPruner(interval string) pruner {
+	return pruner{
+		table: "sentiment_rollups", model: &SentimentRollup{}, action: "delete",
+		scope: func(db *gorm.DB, cutoff time.Time) *gorm.DB {
+			return db.Where("bucket_interval = ? AND bucket_start < ?", interval, cutoff.UTC())
+		},
+	}
+}
+
+// Prune 按保留策略删除或清空过期数据（dryRun 时只统计行数，含级联删除的行）
+func (s *Storage) Prune(rules []RetentionRule, dryRun bool) ([]PruneResult, error) {
+	now := time.Now()
+	results := make([]PruneResult, 0, len(rules))
+
+	for _, rule := range rules {
+		p, ok := pruners[rule.Name]
+		if !ok {
+			return results, fmt.Errorf("unknown retention rule %q", rule.Name)
+		}
+		res := PruneResult{Rule: rule.Name, Table: p.table, Action: p.action, Cutoff: now.Add(-rule.MaxAge)}
+		if len(p.dependents) > 0 {
+			res.Cascaded = make(map[string]int64, len(p.dependents))
+		}
+
+		if dryRun {
+			for _, d := range p.dependents {
+				var n int64
+				if err := d.scope(s.db, res.Cutoff).Model(d.model).Count(&n).Error; err != nil {
+					return results, fmt.Errorf("retention %s: %w", rule.Name, err)
+				}
+				res.Cascaded[d.table] = n
+			}
+			if err := p.scope(s.db.Model(p.model), res.Cutoff).Count(&res.Rows).Error; err != nil {
+				return results, fmt.Errorf("retention %s: %w", rule.Name, err)
+			}
+			results = append(results, res)
+			continue
+		}
+
+		err := s.db.Transaction(func(tx *gorm.DB) error {
+			for _, d := range p.dependents {
+				del := d.scope(tx, res.Cutoff).Delete(d.model)
+				if del.Error != nil {
+					return del.Error
+				}
+				res.Cascaded[d.table] = del.RowsAffected
+			}
+			if p.apply != nil {
+				n, err := p.apply(tx, res.Cutoff)
+				res.Rows = n
+				return err
+			}
+			del := p.scope(tx, res.Cutoff).Delete(p.model)
+			res.Rows = del.RowsAffected
+			return del.Error
+		})
+		if err != nil {
+			return results, fmt.Errorf("retention %s: %w", rule.Name, err)
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// Vacuum 回收已删除数据占用的空间（incremental 或 full）
+func (s *Storage) Vacuum(mode string) error {
+	switch mode {
+	case "", VacuumOff:
+		return nil
+	case VacuumIncremental, VacuumFull:
+		return s.dialect.vacuum(s.db, mode)
+	default:
+		return fmt.Errorf("unknown vacuum mode %q (incremental, full, off)", mode)
+	}
+}
@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+)
+
+func TestRetentionRules(t *testing.T) {
+	rules := RetentionRules(config.RetentionConfig{
+		Alerts:         time.Hour,
+		News:           2 * time.Hour,
+		UnanalyzedNews: 3 * time.Hour,
+	})
+	var names []string
+	for _, r := range rules {
+		if _, ok := pruners[r.Name]; !ok {
+			t.Errorf("rule %s has no pruner", r.Name)
+		}
+		names = append(names, r.Name)
+	}
+	if len(names) != 4 || names[0] != "news" || names[1] != "unanalyzed_news" || names[2] != "stories" || names[3] != "alerts" {
+		t.Errorf("rules = %v, want zero durations skipped and news first", names)
+	}
+	if rules[2].MaxAge != 2*time.Hour {
+		t.Errorf("stories max age = %v, want the shorter news rule", rules[2].MaxAge)
+	}
+}
+
+func TestSQLiteIncrementalVacuum(t *testing.T) {
+	s := newSQLiteTestStore(t)
+
+	if err := s.Vacuum(VacuumIncremental); err != nil {
+		t.Fatal(err)
+	}
+	var mode int
+	s.db.Raw("PRAGMA auto_vacuum").Scan(&mode)
+	if mode != 2 {
+		t.Fatalf("auto_vacuum = %d, want 2 (incremental)", mode)
+	}
+	// already incremental: just releases free pages
+	if err := s.Vacuum(VacuumIncremental); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Vacuum("sometimes"); err == nil {
+		t.Error("unknown vacuum mode accepted")
+	}
+}
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvalidInterval is returned for rollup intervals other than RollupIntervals
+var ErrInvalidInterval = errors.New("invalid rollup interval")
+
+// RollupIntervals are the bucket sizes maintained for every symbol
+var RollupIntervals = map[string]time.Duration{
+	"5m": 5 * time.Minute,
+	"1h": time.Hour,
+	"1d": 24 * time.Hour,
+}
+
+// defaultRollupLookback bounds a timeseries query without an explicit since
+var defaultRollupLookback = map[string]time.Duration{
+	"5m": 6 * time.Hour,
+	"1h": 7 * 24 * time.Hour,
+	"1d": 90 * 24 * time.Hour,
+}
+
+// SentimentRollup aggregates the stock mentions of one symbol in one time
+// bucket. Sums are stored instead of averages so buckets can be updated
+// incrementally with a single upsert.
+type SentimentRollup struct {
+	Symbol           string    `json:"symbol" gorm:"primaryKey"`
+	Interval         string    `json:"interval" gorm:"primaryKey;column:bucket_interval"`
+	BucketStart      time.Time `json:"bucket_start" gorm:"primaryKey"` // UTC
+	MentionCount     int       `json:"mention_count"`
+	ScoreSum         float64   `json:"score_sum"`
+	WeightedScoreSum float64   `json:"weighted_score_sum"` // score * confidence
+	WeightSum        float64   `json:"weight_sum"`         // confidence
+	PositiveCount    int       `json:"positive_count"`
+	NegativeCount    int       `json:"negative_count"`
+	NeutralCount     int       `json:"neutral_count"`
+}
+
+// TimeseriesPoint is one bucket of a symbol's sentiment history
+type TimeseriesPoint struct {
+	BucketStart   time.Time `json:"bucket_start"`
+	MentionCount  int       `json:"mention_count"`
+	AvgScore      float64   `json:"avg_score"`
+	WeightedScore float64   `json:"weighted_score"` // confidence-weighted average
+	PositiveCount int       `json:"positive_count"`
+	NegativeCount int       `json:"negative_count"`
+	NeutralCount  int       `json:"neutral_count"`
+}
+
+// rollupDeltas expands mentions into one increment per (symbol, interval, bucket)
+func rollupDeltas(mentions []StockMention) []SentimentRollup {
+	var deltas []SentimentRollup
+	for _, m := range mentions {
+		at := m.AnalyzedAt.UTC()
+		for name, size := range RollupIntervals {
+			d := SentimentRollup{
+				Symbol:           m.Symbol,
+				Interval:         name,
+				BucketStart:      at.Truncate(size),
+				MentionCount:     1,
+				ScoreSum:         m.Score,
+				WeightedScoreSum: m.Score * m.Confidence,
+				WeightSum:        m.Confidence,
+			}
+			switch m.Sentiment {
+			case "positive":
+				d.PositiveCount = 1
+			case "negative":
+				d.NegativeCount = 1
+			default:
+				d.NeutralCount = 1
+			}
+			deltas = append(deltas, d)
+		}
+	}
+	return deltas
+}
+
+// applyRollups adds mentions to their buckets, creating buckets on first use
+func applyRollups(tx *gorm.DB, mentions []StockMention) error {
+	for _, d := range rollupDeltas(mentions) {
+		d := d
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "symbol"}, {Name: "bucket_interval"}, {Name: "bucket_start"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"mention_count":      gorm.Expr("sentiment_rollups.mention_count + ?", d.MentionCount),
+				"score_sum":          gorm.Expr("sentiment_rollups.score_sum + ?", d.ScoreSum),
+				"weighted_score_sum": gorm.Expr("sentiment_rollups.weighted_score_sum + ?", d.WeightedScoreSum),
+				"weight_sum":         gorm.Expr("sentiment_rollups.weight_sum + ?", d.WeightSum),
+				"positive_count":     gorm.Expr("sentiment_rollups.positive_count + ?", d.PositiveCount),
+				"negative_count":     gorm.Expr("sentiment_rollups.negative_count + ?", d.NegativeCount),
+				"neutral_count":      gorm.Expr("sentiment_rollups.neutral_count + ?", d.NeutralCount),
+			}),
+		}).Create(&d).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebuildRollups recomputes every bucket from stock_mentions
+func rebuildRollups(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&SentimentRollup{}).Error; err != nil {
+			return err
+		}
+		var batch []StockMention
+		return tx.Model(&StockMention{}).FindInBatches(&batch, 500, func(_ *gorm.DB, _ int) error {
+			return applyRollups(tx, batch)
+		}).Error
+	})
+}
+
+// GetSentimentTimeseries 获取股票情绪时间序列（按 5m/1h/1d 聚合）
+func (s *Storage) GetSentimentTimeseries(symbol, interval string, since, until time.Time) ([]TimeseriesPoint, error) {
+	if _, ok := RollupIntervals[interval]; !ok {
+		return nil, ErrInvalidInterval
+	}
+	if since.IsZero() {
+		since = time.Now().Add(-defaultRollupLookback[interval])
+	}
+
+	tx := s.db.Where("symbol = ? AND bucket_interval = ? AND bucket_start >= ?",
+		NormalizeSymbol(symbol), interval, since.UTC().Truncate(RollupIntervals[interval]))
+	if !until.IsZero() {
+		tx = tx.Where("bucket_start <= ?", until.UTC())
+	}
+
+	var rows []SentimentRollup
+	if err := tx.Order("bucket_start ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	points := make([]TimeseriesPoint, 0, len(rows))
+	for _, r := range rows {
+		p := TimeseriesPoint{
+			BucketStart:   r.BucketStart.UTC(),
+			MentionCount:  r.MentionCount,
+			PositiveCount: r.PositiveCount,
+			NegativeCount: r.NegativeCount,
+			NeutralCount:  r.NeutralCount,
+		}
+		if r.MentionCount > 0 {
+			p.AvgScore = r.ScoreSum / float64(r.MentionCount)
+			p.WeightedScore = p.AvgScore
+		}
+		if r.WeightSum > 0 {
+			p.WeightedScore = r.WeightedScoreSum / r.WeightSum
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AlertRule is an alert rule managed through the API. Rules from the config
+// file are not stored.
+type AlertRule struct {
+	ID        string    `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name"`
+	When      string    `json:"when" gorm:"column:expr"` // rules expression
+	Severity  string    `json:"severity"`                // high, critical
+	Channels  []string  `json:"channels" gorm:"serializer:json"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CreateAlertRule 创建警报规则
+func (s *Storage) CreateAlertRule(r *AlertRule) error {
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now()
+	}
+	r.UpdatedAt = r.CreatedAt
+	return s.db.Create(r).Error
+}
+
+// UpdateAlertRule 更新警报规则，返回是否存在
+func (s *Storage) UpdateAlertRule(r *AlertRule) (bool, error) {
+	r.UpdatedAt = time.Now()
+	res := s.db.Model(r).Select("name", "expr", "severity", "channels", "enabled", "updated_at").Updates(r)
+	return res.RowsAffected > 0, res.Error
+}
+
+// ListAlertRules 获取全部警报规则（按创建时间）
+func (s *Storage) ListAlertRules() ([]AlertRule, error) {
+	var rules []AlertRule
+	err := s.db.Order("created_at").Order("id").Find(&rules).Error
+	return rules, err
+}
+
+// GetAlertRule 获取单条警报规则
+func (s *Storage) GetAlertRule(id string) (*AlertRule, error) {
+	var r AlertRule
+	if err := s.db.First(&r, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &r, nil
+}
+
+// DeleteAlertRule 删除警报规则，返回是否存在
+func (s *Storage) DeleteAlertRule(id string) (bool, error) {
+	res := s.db.Where("id = ?", id).Delete(&AlertRule{})
+	return res.RowsAffected > 0, res.Error
+}
+
+// CountMentions 统计股票在时间段内被分析提及的次数
+func (s *Storage) CountMentions(symbol string, since, until time.Time) (int, error) {
+	var n int64
+	err := s.db.Model(&StockMention{}).
+		Where("symbol = ? AND analyzed_at > ? AND analyzed_at <= ?", symbol, since, until).
+		Count(&n).Error
+	return int(n), err
+}
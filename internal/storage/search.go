@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ErrSearchUnavailable is returned when the database has no usable full-text
+// index, e.g. SQLite built without FTS5 (build with -tags sqlite_fts5).
+var ErrSearchUnavailable = errors.New("full-text search unavailable: sqlite built without fts5")
+
+// ErrInvalidQuery wraps malformed search expressions
+var ErrInvalidQuery = errors.New("invalid search query")
+
+// Search document types
+const (
+	SearchTypeNews     = "news"
+	SearchTypeAnalysis = "analysis"
+)
+
+// SearchQuery describes a full-text search request
+type SearchQuery struct {
+	Query  string    // terms, "phrases", AND/OR/NOT, parentheses, prefix*
+	Type   string    // news, analysis or empty for both
+	Since  time.Time // filters on the news publish time
+	Until  time.Time
+	Source string
+	Symbol string
+	Limit  int
+	Offset int
+}
+
+// SearchHit is a single ranked match
+type SearchHit struct {
+	Type        string    `json:"type"`
+	ID          string    `json:"id"`
+	NewsID      string    `json:"news_id"`
+	Title       string    `json:"title"`
+	Snippet     string    `json:"snippet"`
+	Score       float64   `json:"score"` // higher is more relevant
+	Source      string    `json:"source"`
+	URL         string    `json:"url"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+const (
+	snippetOpen  = "<mark>"
+	snippetClose = "</mark>"
+)
+
+// SearchAvailable 报告全文检索是否可用（SQLite 需以 -tags sqlite_fts5 编译）
+func (s *Storage) SearchAvailable() bool {
+	return s.searchEnabled
+}
+
+// Search 全文检索新闻与分析（按相关度排序，带高亮摘要）
+func (s *Storage) Search(q SearchQuery) ([]SearchHit, int, error) {
+	if !s.searchEnabled {
+		return nil, 0, ErrSearchUnavailable
+	}
+	if q.Type != "" && q.Type != SearchTypeNews && q.Type != SearchTypeAnalysis {
+		return nil, 0, fmt.Errorf("%w: unknown type %q", ErrInvalidQuery, q.Type)
+	}
+
+	expr, err := parseSearchQuery(q.Query)
+	if err != nil {
+		return nil, 0, err
+	}
+	return s.dialect.search(s.db, expr, q)
+}
+
+// searchFilters renders the non-text filters against news alias n
+func searchFilters(q SearchQuery) (string, []interface{}) {
+	var sb strings.Builder
+	var args []interface{}
+	if !q.Since.IsZero() {
+		sb.WriteString(" AND n.published_at >= ?")
+		args = append(args, q.Since)
+	}
+	if !q.Until.IsZero() {
+		sb.WriteString(" AND n.published_at <= ?")
+		args = append(args, q.Until)
+	}
+	if q.Source != "" {
+		sb.WriteString(" AND n.source = ?")
+		args = append(args, q.Source)
+	}
+	if q.Symbol != "" {
+		sb.WriteString(` AND EXISTS (SELECT 1 FROM stock_mentions sm WHERE sm.news_id = n.id AND sm.symbol = ?)`)
+		args = append(args, NormalizeSymbol(q.Symbol))
+	}
+	return sb.String(), args
+}
+
+type searchTokenKind int
+
+const (
+	tokenTerm searchTokenKind = iota
+	tokenPhrase
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+)
+
+// searchToken is one element of a parsed query, rendered per dialect
+type searchToken struct {
+	kind   searchTokenKind
+	text   string
+	prefix bool
+}
+
+func (t searchToken) operand() bool {
+	return t.kind == tokenTerm || t.kind == tokenPhrase
+}
+
+// parseSearchQuery splits user input into terms, "phrases", trailing-*
+// prefixes, AND/OR/NOT and parentheses. Adjacent operands are implicitly
+// ANDed by the renderers.
+func parseSearchQuery(input string) ([]searchToken, error) {
+	var out []searchToken
+	depth := 0
+	runes := []rune(strings.TrimSpace(input))
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			out = append(out, searchToken{kind: tokenOpen})
+			depth++
+			i++
+		case r == ')':
+			if depth == 0 {
+				return nil, fmt.Errorf("%w: unbalanced parenthesis", ErrInvalidQuery)
+			}
+			out = append(out, searchToken{kind: tokenClose})
+			depth--
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("%w: unterminated phrase", ErrInvalidQuery)
+			}
+			phrase := strings.TrimSpace(string(runes[i+1 : end]))
+			if phrase != "" {
+				out = append(out, searchToken{kind: tokenPhrase, text: phrase})
+			}
+			i = end + 1
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != '(' && runes[end] != ')' && runes[end] != '"' {
+				end++
+			}
+			word := string(runes[i:end])
+			i = end
+			switch word {
+			case "AND":
+				out = append(out, searchToken{kind: tokenAnd})
+				continue
+			case "OR":
+				out = append(out, searchToken{kind: tokenOr})
+				continue
+			case "NOT":
+				out = append(out, searchToken{kind: tokenNot})
+				continue
+			}
+			prefix := strings.HasSuffix(word, "*")
+			word = strings.TrimRight(word, "*")
+			if word == "" {
+				continue
+			}
+			out = append(out, searchToken{kind: tokenTerm, text: word, prefix: prefix})
+		}
+	}
+
+	if depth != 0 {
+		return nil, fmt.Errorf("%w: unbalanced parenthesis", ErrInvalidQuery)
+	}
+	if err := validateSearchTokens(out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// validateSearchTokens rejects operator sequences neither engine accepts
+func validateSearchTokens(tokens []searchToken) error {
+	operands := 0
+	expectOperand := true
+	for i, t := range tokens {
+		switch t.kind {
+		case tokenTerm, tokenPhrase:
+			operands++
+			expectOperand = false
+		case tokenOpen:
+			expectOperand = true
+		case tokenClose:
+			if expectOperand {
+				return fmt.Errorf("%w: empty or dangling group", ErrInvalidQuery)
+			}
+		case tokenAnd, tokenOr, tokenNot:
+			if expectOperand || i == len(tokens)-1 {
+				return fmt.Errorf("%w: operator without operand", ErrInvalidQuery)
+			}
+			expectOperand = true
+		}
+	}
+	if operands == 0 {
+		return fmt.Errorf("%w: empty query", ErrInvalidQuery)
+	}
+	return nil
+}
+
+func quoteTerm(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
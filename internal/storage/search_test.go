@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSearchQueryRendering(t *testing.T) {
+	tests := []struct {
+		in       string
+		fts5     string
+		postgres string
+		err      bool
+	}{
+		{in: "tariff", fts5: `"tariff"`, postgres: "plainto_tsquery('english', ?)"},
+		{
+			in:       `china tariffs OR "trade war"`,
+			fts5:     `"china" "tariffs" OR "trade war"`,
+			postgres: "((plainto_tsquery('english', ?) && plainto_tsquery('english', ?)) || phraseto_tsquery('english', ?))",
+		},
+		{
+			in:       "S&P NOT (crash OR selloff)",
+			fts5:     `"S&P" NOT ( "crash" OR "selloff" )`,
+			postgres: "(plainto_tsquery('english', ?) && !!(plainto_tsquery('english', ?) || plainto_tsquery('english', ?)))",
+		},
+		{in: "semi*", fts5: `"semi"*`, postgres: "to_tsquery('english', ?)"},
+		{in: `AAPL's`, fts5: `"AAPL's"`, postgres: "plainto_tsquery('english', ?)"},
+		{in: `"open phrase`, err: true},
+		{in: "(a OR b", err: true},
+		{in: "a OR", err: true},
+		{in: "NOT a", err: true},
+		{in: "()", err: true},
+		{in: "   ", err: true},
+	}
+	for _, tt := range tests {
+		expr, err := parseSearchQuery(tt.in)
+		if tt.err {
+			if !errors.Is(err, ErrInvalidQuery) {
+				t.Errorf("parseSearchQuery(%q) err = %v, want ErrInvalidQuery", tt.in, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseSearchQuery(%q): %v", tt.in, err)
+			continue
+		}
+		if got := fts5Match(expr); got != tt.fts5 {
+			t.Errorf("fts5Match(%q) = %q, want %q", tt.in, got, tt.fts5)
+		}
+		if got, _ := postgresTSQuery(expr); got != tt.postgres {
+			t.Errorf("postgresTSQuery(%q) = %q, want %q", tt.in, got, tt.postgres)
+		}
+	}
+
+	expr, _ := parseSearchQuery("Semi-Conductor*")
+	if _, args := postgresTSQuery(expr); args[0] != "semiconductor:*" {
+		t.Errorf("prefix arg = %v, want sanitized semiconductor:*", args[0])
+	}
+}
@@ -1,10 +1,10 @@
 package storage
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"gorm.io/driver/sqlite"
@@ -13,13 +13,17 @@ import (
 	"gorm.io/gorm/logger"
 )
 
-type Storage struct {
-	db         *gorm.DB
-	backupPath string
+// New creates a new SQLite-backed storage instance using GORM and applies
+// pending migrations
+func New(dbPath string) (*Storage, error) {
+	db, err := openSQLite(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	return newStorage(db, sqliteDialect{}, true)
 }
 
-// New creates a new storage instance using GORM
-func New(dbPath string) (*Storage, error) {
+func openSQLite(dbPath string) (*gorm.DB, error) {
 	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
 		return nil, fmt.Errorf("failed to create db directory: %w", err)
 	}
@@ -33,10 +37,6 @@ func New(dbPath string) (*Storage, error) {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	if err := db.AutoMigrate(&NewsItem{}, &Analysis{}, &Alert{}, &Report{}); err != nil {
-		return nil, fmt.Errorf("failed to migrate database: %w", err)
-	}
-
 	sqlDB, err := db.DB()
 	if err != nil {
 		return nil, err
@@ -47,288 +47,446 @@ func New(dbPath string) (*Storage, error) {
 	// Ignore WAL error
 	sqlDB.Exec("PRAGMA journal_mode=WAL;")
 
-	return &Storage{
-		db:         db,
-		backupPath: "",
-	}, nil
-}
-
-// SaveNews 保存新闻
-func (s *Storage) SaveNews(news *NewsItem) error {
-	// 使用 SQLite 特有的 INSERT OR IGNORE
-	// 这避免了 ON CONFLICT 必须匹配具体索引的严格限制
-	result := s.db.Clauses(clause.Insert{Modifier: "OR IGNORE"}).Create(news)
-	return result.Error
+	return db, nil
 }
 
-// ListNews 获取新闻列表（支持过滤和分页）
-func (s *Storage) ListNews(since, until time.Time, source string, limit, offset int) ([]NewsItem, int, error) {
-	var items []NewsItem
-	var total int64
-
-	tx := s.db.Model(&NewsItem{})
-
-	if !since.IsZero() {
-		tx = tx.Where("published_at >= ?", since)
-	}
-	if !until.IsZero() {
-		tx = tx.Where("published_at <= ?", until)
-	}
-	if source != "" {
-		tx = tx.Where("source = ?", source)
+type sqliteDialect struct{}
+
+func (sqliteDialect) Name() string { return "sqlite" }
+
+// migrations is the SQLite schema history. Version 1 matches the tables the
+// old AutoMigrate created, so existing databases are adopted in place.
+func (sqliteDialect) migrations() []Migration {
+	return []Migration{
+		{
+			Version: 1,
+			Name:    "initial_schema",
+			Up: execAll(
+				"CREATE TABLE IF NOT EXISTS `news_items` (`id` text,`source` text,`source_id` text,`author` text,`title` text,`content` text,`url` text,`published_at` datetime,`collected_at` datetime,`processed` integer,PRIMARY KEY (`id`))",
+				"CREATE INDEX IF NOT EXISTS `idx_news_processed` ON `news_items`(`processed`)",
+				"CREATE INDEX IF NOT EXISTS `idx_news_published` ON `news_items`(`published_at`)",
+				"CREATE UNIQUE INDEX IF NOT EXISTS `idx_source_source_id` ON `news_items`(`source_id`)",
+				"CREATE INDEX IF NOT EXISTS `idx_news_source` ON `news_items`(`source`)",
+				"CREATE TABLE IF NOT EXISTS `analyses` (`id` text,`news_id` text,`sentiment` text,`sentiment_score` real,`confidence` real,`entities` text,`related_stocks` text,`stock_details` text,`impact_level` text,`summary` text,`key_points` text,`analyzed_at` datetime,`raw_response` text,PRIMARY KEY (`id`))",
+				"CREATE INDEX IF NOT EXISTS `idx_analysis_news` ON `analyses`(`news_id`)",
+				"CREATE TABLE IF NOT EXISTS `alerts` (`id` text,`news_id` text,`analysis_id` text,`title` text,`description` text,`severity` text,`stocks` text,`created_at` datetime,`acknowledged` integer,`notified` numeric,PRIMARY KEY (`id`))",
+				"CREATE INDEX IF NOT EXISTS `idx_alerts_created` ON `alerts`(`created_at`)",
+				"CREATE TABLE IF NOT EXISTS `reports` (`id` text,`type` text,`title` text,`start_time` datetime,`end_time` datetime,`summary` text,`content` text,`top_news` text,`stock_impact` text,`created_at` datetime,`generated_at` datetime,`file_path` text,PRIMARY KEY (`id`))",
+			),
+			Down: func(tx *gorm.DB) error {
+				// the FTS tables reference these; they are recreated on next start
+				tx.Exec("DROP TABLE IF EXISTS news_fts")
+				tx.Exec("DROP TABLE IF EXISTS analyses_fts")
+				return execAll(
+					"DROP TABLE IF EXISTS `reports`",
+					"DROP TABLE IF EXISTS `alerts`",
+					"DROP TABLE IF EXISTS `analyses`",
+					"DROP TABLE IF EXISTS `news_items`",
+				)(tx)
+			},
+		},
+		{
+			Version: 2,
+			Name:    "stock_mentions",
+			Up: func(tx *gorm.DB) error {
+				err := execAll(
+					"CREATE TABLE IF NOT EXISTS `stock_mentions` (`id` integer PRIMARY KEY AUTOINCREMENT,`analysis_id` text,`news_id` text,`symbol` text,`score` real,`sentiment` text,`confidence` real,`timeframe` text,`analyzed_at` datetime)",
+					"CREATE INDEX IF NOT EXISTS `idx_mentions_analyzed` ON `stock_mentions`(`analyzed_at`)",
+					"CREATE INDEX IF NOT EXISTS `idx_mentions_symbol_time` ON `stock_mentions`(`symbol`,`analyzed_at`)",
+					"CREATE INDEX IF NOT EXISTS `idx_mentions_news` ON `stock_mentions`(`news_id`)",
+					"CREATE INDEX IF NOT EXISTS `idx_mentions_analysis` ON `stock_mentions`(`analysis_id`)",
+				)(tx)
+				if err != nil {
+					return err
+				}
+				return backfillStockMentions(tx)
+			},
+			Down: execAll("DROP TABLE IF EXISTS `stock_mentions`"),
+		},
+		{
+			Version: 3,
+			Name:    "sentiment_rollups",
+			Up: func(tx *gorm.DB) error {
+				err := execAll(
+					"CREATE TABLE IF NOT EXISTS `sentiment_rollups` (`symbol` text,`bucket_interval` text,`bucket_start` datetime,`mention_count` integer,`score_sum` real,`weighted_score_sum` real,`weight_sum` real,`positive_count` integer,`negative_count` integer,`neutral_count` integer,PRIMARY KEY (`symbol`,`bucket_interval`,`bucket_start`))",
+				)(tx)
+				if err != nil {
+					return err
+				}
+				return rebuildRollups(tx)
+			},
+			Down: execAll("DROP TABLE IF EXISTS `sentiment_rollups`"),
+		},
+		{
+			// news from before this version keeps an empty story_id
+			Version: 4,
+			Name:    "stories",
+			Up: execAll(
+				"CREATE TABLE IF NOT EXISTS `stories` (`id` text,`signature` text,`title` text,`first_seen_at` datetime,`last_seen_at` datetime,`mention_count` integer,`source_count` integer,`analysis_id` text,PRIMARY KEY (`id`))",
+				"CREATE INDEX IF NOT EXISTS `idx_stories_last_seen` ON `stories`(`last_seen_at`)",
+				"CREATE TABLE IF NOT EXISTS `story_bands` (`band_key` integer,`story_id` text,PRIMARY KEY (`band_key`,`story_id`))",
+				"CREATE INDEX IF NOT EXISTS `idx_story_bands_story` ON `story_bands`(`story_id`)",
+				"ALTER TABLE `news_items` ADD COLUMN `story_id` text DEFAULT ''",
+				"CREATE INDEX IF NOT EXISTS `idx_news_story` ON `news_items`(`story_id`)",
+			),
+			Down: execAll(
+				"DROP INDEX IF EXISTS `idx_news_story`",
+				"ALTER TABLE `news_items` DROP COLUMN `story_id`",
+				"DROP TABLE IF EXISTS `story_bands`",
+				"DROP TABLE IF EXISTS `stories`",
+			),
+		},
+		{
+			// existing alerts all came from the analysis engine
+			Version: 5,
+			Name:    "alert_kind",
+			Up: execAll(
+				"ALTER TABLE `alerts` ADD COLUMN `kind` text DEFAULT 'impact'",
+				"CREATE INDEX IF NOT EXISTS `idx_alerts_kind` ON `alerts`(`kind`)",
+			),
+			Down: execAll(
+				"DROP INDEX IF EXISTS `idx_alerts_kind`",
+				"ALTER TABLE `alerts` DROP COLUMN `kind`",
+			),
+		},
+		{
+			Version: 6,
+			Name:    "webhooks",
+			Up: execAll(
+				"CREATE TABLE IF NOT EXISTS `webhooks` (`id` text,`name` text,`url` text,`secret` text,`symbols` text,`severities` text,`sentiments` text,`event_types` text,`created_at` datetime,PRIMARY KEY (`id`))",
+				"CREATE TABLE IF NOT EXISTS `webhook_deliveries` (`id` text,`webhook_id` text,`alert_id` text,`event_type` text,`payload` text,`status` text,`attempts` integer,`next_attempt_at` datetime,`last_status_code` integer,`last_error` text,`created_at` datetime,`delivered_at` datetime,PRIMARY KEY (`id`))",
+				"CREATE INDEX IF NOT EXISTS `idx_deliveries_webhook` ON `webhook_deliveries`(`webhook_id`)",
+				"CREATE INDEX IF NOT EXISTS `idx_deliveries_due` ON `webhook_deliveries`(`status`,`next_attempt_at`)",
+			),
+			Down: execAll(
+				"DROP TABLE IF EXISTS `webhook_deliveries`",
+				"DROP TABLE IF EXISTS `webhooks`",
+			),
+		},
+		{
+			Version: 7,
+			Name:    "notifications",
+			Up: execAll(
+				"CREATE TABLE IF NOT EXISTS `notifications` (`id` text,`alert_id` text,`channel` text,`status` text,`attempts` integer,`next_attempt_at` datetime,`last_error` text,`created_at` datetime,`sent_at` datetime,PRIMARY KEY (`id`))",
+				"CREATE INDEX IF NOT EXISTS `idx_notifications_alert` ON `notifications`(`alert_id`)",
+				"CREATE INDEX IF NOT EXISTS `idx_notifications_due` ON `notifications`(`status`,`next_attempt_at`)",
+			),
+			Down: execAll("DROP TABLE IF EXISTS `notifications`"),
+		},
+		{
+			Version: 8,
+			Name:    "alert_rules",
+			Up: execAll(
+				"CREATE TABLE IF NOT EXISTS `alert_rules` (`id` text,`name` text,`expr` text,`severity` text,`channels` text,`enabled` numeric,`created_at` datetime,`updated_at` datetime,PRIMARY KEY (`id`))",
+				"ALTER TABLE `alerts` ADD COLUMN `rule` text DEFAULT ''",
+				"ALTER TABLE `alerts` ADD COLUMN `channels` text",
+			),
+			Down: execAll(
+				"ALTER TABLE `alerts` DROP COLUMN `channels`",
+				"ALTER TABLE `alerts` DROP COLUMN `rule`",
+				"DROP TABLE IF EXISTS `alert_rules`",
+			),
+		},
+		{
+			Version: 9,
+			Name:    "alert_source",
+			Up: execAll(
+				"ALTER TABLE `alerts` ADD COLUMN `source` text DEFAULT ''",
+				"ALTER TABLE `alerts` ADD COLUMN `url` text DEFAULT ''",
+			),
+			Down: execAll(
+				"ALTER TABLE `alerts` DROP COLUMN `url`",
+				"ALTER TABLE `alerts` DROP COLUMN `source`",
+			),
+		},
+		{
+			Version: 10,
+			Name:    "alert_groups",
+			Up: execAll(
+				"ALTER TABLE `alerts` ADD COLUMN `story_id` text DEFAULT ''",
+				"ALTER TABLE `alerts` ADD COLUMN `direction` text DEFAULT ''",
+				"ALTER TABLE `alerts` ADD COLUMN `updates` integer DEFAULT 0",
+				"ALTER TABLE `alerts` ADD COLUMN `last_update_at` datetime",
+				"ALTER TABLE `alerts` ADD COLUMN `escalations` integer DEFAULT 0",
+				"ALTER TABLE `alerts` ADD COLUMN `escalated_at` datetime",
+				"CREATE INDEX IF NOT EXISTS `idx_alerts_story` ON `alerts`(`story_id`,`created_at`)",
+				"CREATE INDEX IF NOT EXISTS `idx_alerts_escalated` ON `alerts`(`escalated_at`)",
+				"CREATE TABLE IF NOT EXISTS `alert_updates` (`id` integer PRIMARY KEY AUTOINCREMENT,`alert_id` text,`news_id` text,`analysis_id` text,`title` text,`severity` text,`stocks` text,`escalated` numeric,`created_at` datetime)",
+				"CREATE INDEX IF NOT EXISTS `idx_alert_updates_alert` ON `alert_updates`(`alert_id`)",
+			),
+			Down: execAll(
+				"DROP TABLE IF EXISTS `alert_updates`",
+				"DROP INDEX IF EXISTS `idx_alerts_escalated`",
+				"DROP INDEX IF EXISTS `idx_alerts_story`",
+				"ALTER TABLE `alerts` DROP COLUMN `escalated_at`",
+				"ALTER TABLE `alerts` DROP COLUMN `escalations`",
+				"ALTER TABLE `alerts` DROP COLUMN `last_update_at`",
+				"ALTER TABLE `alerts` DROP COLUMN `updates`",
+				"ALTER TABLE `alerts` DROP COLUMN `direction`",
+				"ALTER TABLE `alerts` DROP COLUMN `story_id`",
+			),
+		},
+		{
+			Version: 11,
+			Name:    "alert_states",
+			Up: execAll(
+				"ALTER TABLE `alerts` ADD COLUMN `state` text DEFAULT 'open'",
+				"ALTER TABLE `alerts` ADD COLUMN `acked_by` text DEFAULT ''",
+				"ALTER TABLE `alerts` ADD COLUMN `acked_at` datetime",
+				"ALTER TABLE `alerts` ADD COLUMN `snoozed_until` datetime",
+				"ALTER TABLE `alerts` ADD COLUMN `resolved_by` text DEFAULT ''",
+				"ALTER TABLE `alerts` ADD COLUMN `resolved_at` datetime",
+				"UPDATE `alerts` SET `state` = 'acknowledged' WHERE `acknowledged` = 1",
+				"CREATE INDEX IF NOT EXISTS `idx_alerts_state` ON `alerts`(`state`)",
+				"CREATE TABLE IF NOT EXISTS `alert_events` (`id` integer PRIMARY KEY AUTOINCREMENT,`alert_id` text,`from_state` text,`to_state` text,`actor` text,`note` text,`snoozed_until` datetime,`created_at` datetime)",
+				"CREATE INDEX IF NOT EXISTS `idx_alert_events_alert` ON `alert_events`(`alert_id`)",
+			),
+			Down: execAll(
+				"DROP TABLE IF EXISTS `alert_events`",
+				"DROP INDEX IF EXISTS `idx_alerts_state`",
+				"ALTER TABLE `alerts` DROP COLUMN `resolved_at`",
+				"ALTER TABLE `alerts` DROP COLUMN `resolved_by`",
+				"ALTER TABLE `alerts` DROP COLUMN `snoozed_until`",
+				"ALTER TABLE `alerts` DROP COLUMN `acked_at`",
+				"ALTER TABLE `alerts` DROP COLUMN `acked_by`",
+				"ALTER TABLE `alerts` DROP COLUMN `state`",
+			),
+		},
+		{
+			Version: 12,
+			Name:    "api_tokens",
+			Up: execAll(
+				"CREATE TABLE IF NOT EXISTS `api_tokens` (`id` text,`name` text,`hash` text,`prefix` text,`scopes` text,`expires_at` datetime,`revoked_at` datetime,`created_at` datetime,PRIMARY KEY (`id`))",
+				"CREATE UNIQUE INDEX IF NOT EXISTS `idx_api_tokens_name` ON `api_tokens`(`name`)",
+				"CREATE UNIQUE INDEX IF NOT EXISTS `idx_api_tokens_hash` ON `api_tokens`(`hash`)",
+			),
+			Down: execAll("DROP TABLE IF EXISTS `api_tokens`"),
+		},
+		{
+			Version: 13,
+			Name:    "news_imported",
+			Up:      execAll("ALTER TABLE `news_items` ADD COLUMN `imported` numeric DEFAULT 0"),
+			Down:    execAll("ALTER TABLE `news_items` DROP COLUMN `imported`"),
+		},
+		{
+			// source_id alone was unique, so items without one collided and
+			// two sources could not share an id
+			Version: 14,
+			Name:    "news_source_unique",
+			Up: execAll(append(dedupeNewsSourceIDs(),
+				"DROP INDEX IF EXISTS `idx_source_source_id`",
+				"CREATE UNIQUE INDEX `idx_source_source_id` ON `news_items`(`source`,`source_id`) WHERE `source_id` <> ''",
+			)...),
+			Down: execAll(
+				"DROP INDEX IF EXISTS `idx_source_source_id`",
+				"CREATE UNIQUE INDEX `idx_source_source_id` ON `news_items`(`source_id`)",
+			),
+		},
+		{
+			Version: 15,
+			Name:    "alert_symbols",
+			Up: func(tx *gorm.DB) error {
+				err := execAll(
+					"CREATE TABLE IF NOT EXISTS `alert_symbols` (`alert_id` text,`symbol` text,PRIMARY KEY (`alert_id`,`symbol`))",
+					"CREATE INDEX IF NOT EXISTS `idx_alert_symbols_symbol` ON `alert_symbols`(`symbol`)",
+				)(tx)
+				if err != nil {
+					return err
+				}
+				return backfillAlertSymbols(tx)
+			},
+			Down: execAll("DROP TABLE IF EXISTS `alert_symbols`"),
+		},
 	}
-
-	if err := tx.Count(&total).Error; err != nil {
-		return nil, 0, err
-	}
-
-	if err := tx.Order("published_at DESC").Limit(limit).Offset(offset).Find(&items).Error; err != nil {
-		return nil, 0, err
-	}
-
-	return items, int(total), nil
 }
 
-// GetNews 获取单条新闻
-func (s *Storage) GetNews(id string) (*NewsItem, error) {
-	var item NewsItem
-	if err := s.db.First(&item, "id = ?", id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, nil
+// vacuum uses SQLite's incremental auto-vacuum. Switching an existing
+// database to it takes one full VACUUM, done on first use.
+func (sqliteDialect) vacuum(db *gorm.DB, mode string) error {
+	if mode == VacuumFull {
+		return db.Exec("VACUUM").Error
+	}
+	// PRAGMA auto_vacuum is per connection until the VACUUM persists it
+	return db.Connection(func(conn *gorm.DB) error {
+		var autoVacuum int
+		if err := conn.Raw("PRAGMA auto_vacuum").Scan(&autoVacuum).Error; err != nil {
+			return err
 		}
-		return nil, err
-	}
-	return &item, nil
+		if autoVacuum != 2 {
+			if err := conn.Exec("PRAGMA auto_vacuum = INCREMENTAL").Error; err != nil {
+				return err
+			}
+			return conn.Exec("VACUUM").Error
+		}
+		return conn.Exec("PRAGMA incremental_vacuum").Error
+	})
 }
 
-// GetUnprocessedNews 获取未处理的新闻
-func (s *Storage) GetUnprocessedNews(limit int) ([]NewsItem, error) {
-	var items []NewsItem
-	err := s.db.Where("processed = ?", 0).
-		Order("published_at DESC").
-		Limit(limit).
-		Find(&items).Error
-	return items, err
+// snapshot uses VACUUM INTO, which reads a consistent view of the database
+// in one transaction and does not block writers under WAL
+func (sqliteDialect) snapshot(db *gorm.DB, path string) error {
+	return db.Exec("VACUUM INTO ?", path).Error
 }
 
-// MarkNewsProcessed 标记新闻为已处理
-func (s *Storage) MarkNewsProcessed(newsID string) error {
-	return s.db.Model(&NewsItem{}).
-		Where("id = ?", newsID).
-		Update("processed", 1).Error
-}
+// lockMigrations is a no-op: SQLite serializes writers on the database file
+func (sqliteDialect) lockMigrations(tx *gorm.DB) error { return nil }
 
-// SaveAnalysis 保存分析结果
-func (s *Storage) SaveAnalysis(analysis *Analysis) error {
-	if err := s.db.Create(analysis).Error; err != nil {
-		return err
-	}
-	if s.backupPath != "" {
-		return s.backupToFile("analysis", analysis.ID, analysis)
-	}
-	return nil
+// insertIgnore 使用 SQLite 特有的 INSERT OR IGNORE
+// 这避免了 ON CONFLICT 必须匹配具体索引的严格限制
+func (sqliteDialect) insertIgnore(tx *gorm.DB) *gorm.DB {
+	return tx.Clauses(clause.Insert{Modifier: "OR IGNORE"})
 }
 
-// ListAnalysis 获取分析列表
-func (s *Storage) ListAnalysis(since, until time.Time, impact string, limit, offset int) ([]Analysis, int, error) {
-	var items []Analysis
-	var total int64
-
-	tx := s.db.Model(&Analysis{})
-
-	if !since.IsZero() {
-		tx = tx.Where("analyzed_at >= ?", since)
-	}
-	if !until.IsZero() {
-		tx = tx.Where("analyzed_at <= ?", until)
-	}
-	if impact != "" {
-		tx = tx.Where("impact_level = ?", impact)
-	}
-
-	if err := tx.Count(&total).Error; err != nil {
-		return nil, 0, err
-	}
-
-	if err := tx.Order("analyzed_at DESC").Limit(limit).Offset(offset).Find(&items).Error; err != nil {
-		return nil, 0, err
-	}
-
-	return items, int(total), nil
+// ftsSetup creates the FTS5 indexes and the triggers that keep them in sync
+// with news_items and analyses. Both use external content so the text is not
+// stored twice.
+var ftsSetup = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS news_fts USING fts5(
+		title, content,
+		content='news_items', content_rowid='rowid', tokenize='unicode61 remove_diacritics 2')`,
+	`CREATE TRIGGER IF NOT EXISTS news_fts_ai AFTER INSERT ON news_items BEGIN
+		INSERT INTO news_fts(rowid, title, content) VALUES (new.rowid, new.title, new.content);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS news_fts_ad AFTER DELETE ON news_items BEGIN
+		INSERT INTO news_fts(news_fts, rowid, title, content) VALUES ('delete', old.rowid, old.title, old.content);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS news_fts_au AFTER UPDATE OF title, content ON news_items BEGIN
+		INSERT INTO news_fts(news_fts, rowid, title, content) VALUES ('delete', old.rowid, old.title, old.content);
+		INSERT INTO news_fts(rowid, title, content) VALUES (new.rowid, new.title, new.content);
+	END`,
+	`CREATE VIRTUAL TABLE IF NOT EXISTS analyses_fts USING fts5(
+		summary, key_points,
+		content='analyses', content_rowid='rowid', tokenize='unicode61 remove_diacritics 2')`,
+	`CREATE TRIGGER IF NOT EXISTS analyses_fts_ai AFTER INSERT ON analyses BEGIN
+		INSERT INTO analyses_fts(rowid, summary, key_points) VALUES (new.rowid, new.summary, new.key_points);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS analyses_fts_ad AFTER DELETE ON analyses BEGIN
+		INSERT INTO analyses_fts(analyses_fts, rowid, summary, key_points) VALUES ('delete', old.rowid, old.summary, old.key_points);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS analyses_fts_au AFTER UPDATE OF summary, key_points ON analyses BEGIN
+		INSERT INTO analyses_fts(analyses_fts, rowid, summary, key_points) VALUES ('delete', old.rowid, old.summary, old.key_points);
+		INSERT INTO analyses_fts(rowid, summary, key_points) VALUES (new.rowid, new.summary, new.key_points);
+	END`,
 }
 
-// GetAnalysis 获取单条分析
-func (s *Storage) GetAnalysis(id string) (*Analysis, error) {
-	var item Analysis
-	if err := s.db.First(&item, "id = ?", id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, nil
+// setupSearch enables FTS5 if the linked SQLite supports it. Indexes created
+// for the first time are rebuilt from the existing rows.
+func (sqliteDialect) setupSearch(db *gorm.DB) (bool, error) {
+	probe := db.Session(&gorm.Session{Logger: db.Logger.LogMode(logger.Silent)})
+	if err := probe.Exec("CREATE VIRTUAL TABLE temp.fts5_probe USING fts5(x)").Error; err != nil {
+		if strings.Contains(err.Error(), "no such module") {
+			return false, nil
 		}
-		return nil, err
+		return false, err
 	}
-	return &item, nil
-}
-
-// SaveAlert 保存警报
-func (s *Storage) SaveAlert(alert *Alert) error {
-	if err := s.db.Create(alert).Error; err != nil {
-		return err
-	}
-	if s.backupPath != "" {
-		return s.backupToFile("alerts", alert.ID, alert)
-	}
-	return nil
-}
-
-// ListAlerts 获取警报列表
-func (s *Storage) ListAlerts(severity string, limit, offset int) ([]Alert, int, error) {
-	var items []Alert
-	var total int64
-
-	tx := s.db.Model(&Alert{})
+	db.Exec("DROP TABLE temp.fts5_probe")
 
-	if severity != "" {
-		tx = tx.Where("severity = ?", severity)
+	var existing int64
+	if err := db.Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'news_fts'").
+		Scan(&existing).Error; err != nil {
+		return false, err
 	}
 
-	if err := tx.Count(&total).Error; err != nil {
-		return nil, 0, err
+	for _, stmt := range ftsSetup {
+		if err := db.Exec(stmt).Error; err != nil {
+			return false, err
+		}
 	}
 
-	if err := tx.Order("created_at DESC").Limit(limit).Offset(offset).Find(&items).Error; err != nil {
-		return nil, 0, err
+	if existing == 0 {
+		if err := db.Exec("INSERT INTO news_fts(news_fts) VALUES ('rebuild')").Error; err != nil {
+			return false, err
+		}
+		if err := db.Exec("INSERT INTO analyses_fts(analyses_fts) VALUES ('rebuild')").Error; err != nil {
+			return false, err
+		}
 	}
 
-	return items, int(total), nil
+	return true, nil
 }
 
-// SaveReport 保存报告
-func (s *Storage) SaveReport(report *Report) error {
-	if err := s.db.Create(report).Error; err != nil {
-		return err
-	}
-	if s.backupPath != "" {
-		return s.backupToFile("reports", report.ID, report)
-	}
-	return nil
-}
+// search runs an FTS5 MATCH ranked by bm25, titles weighted over bodies
+func (sqliteDialect) search(db *gorm.DB, expr []searchToken, q SearchQuery) ([]SearchHit, int, error) {
+	match := fts5Match(expr)
+
+	var parts []string
+	var args []interface{}
+
+	filter, filterArgs := searchFilters(q)
+	if q.Type == "" || q.Type == SearchTypeNews {
+		parts = append(parts, `
+			SELECT 'news' AS type, n.id AS id, n.id AS news_id, n.title AS title,
+				snippet(news_fts, -1, '`+snippetOpen+`', '`+snippetClose+`', '…', 24) AS snippet,
+				-bm25(news_fts, 10.0, 1.0) AS score,
+				n.source AS source, n.url AS url, n.published_at AS published_at
+			FROM news_fts JOIN news_items n ON n.rowid = news_fts.rowid
+			WHERE news_fts MATCH ?`+filter)
+		args = append(args, match)
+		args = append(args, filterArgs...)
+	}
+	if q.Type == "" || q.Type == SearchTypeAnalysis {
+		parts = append(parts, `
+			SELECT 'analysis' AS type, a.id AS id, n.id AS news_id, n.title AS title,
+				snippet(analyses_fts, -1, '`+snippetOpen+`', '`+snippetClose+`', '…', 24) AS snippet,
+				-bm25(analyses_fts, 5.0, 1.0) AS score,
+				n.source AS source, n.url AS url, n.published_at AS published_at
+			FROM analyses_fts
+				JOIN analyses a ON a.rowid = analyses_fts.rowid
+				JOIN news_items n ON n.id = a.news_id
+			WHERE analyses_fts MATCH ?`+filter)
+		args = append(args, match)
+		args = append(args, filterArgs...)
+	}
+
+	union := strings.Join(parts, " UNION ALL ")
 
-// ListReports 获取报告列表
-func (s *Storage) ListReports(reportType string, limit, offset int) ([]Report, int, error) {
-	var items []Report
 	var total int64
-
-	tx := s.db.Model(&Report{})
-
-	if reportType != "" {
-		tx = tx.Where("type = ?", reportType)
-	}
-
-	if err := tx.Count(&total).Error; err != nil {
-		return nil, 0, err
+	if err := db.Raw("SELECT COUNT(*) FROM ("+union+")", args...).Scan(&total).Error; err != nil {
+		return nil, 0, wrapFTS5Error(err)
 	}
 
-	if err := tx.Order("created_at DESC").Limit(limit).Offset(offset).Find(&items).Error; err != nil {
-		return nil, 0, err
+	var hits []SearchHit
+	pageArgs := append(append([]interface{}{}, args...), q.Limit, q.Offset)
+	if err := db.Raw("SELECT * FROM ("+union+") ORDER BY score DESC, published_at DESC LIMIT ? OFFSET ?", pageArgs...).
+		Scan(&hits).Error; err != nil {
+		return nil, 0, wrapFTS5Error(err)
 	}
 
-	return items, int(total), nil
-}
-
-// GetReport 获取报告详情
-func (s *Storage) GetReport(id string) (*Report, error) {
-	var item Report
-	if err := s.db.First(&item, "id = ?", id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, nil
-		}
-		return nil, err
-	}
-	return &item, nil
-}
-
-// GetLatestReport 获取最新报告
-func (s *Storage) GetLatestReport() (*Report, error) {
-	var item Report
-	err := s.db.Order("created_at DESC").First(&item).Error
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, nil
-		}
-		return nil, err
-	}
-	return &item, nil
+	return hits, int(total), nil
 }
 
-// GetStockSentiment 获取股票舆情评分
-func (s *Storage) GetStockSentiment(symbol string, hours int) (*StockSentiment, error) {
-	var analyses []Analysis
-	// 默认 24 小时，如果传入 hours 则使用传入值
-	if hours <= 0 {
-		hours = 24
-	}
-	cutoff := time.Now().Add(time.Duration(-hours) * time.Hour)
-
-	// 使用 LIKE 查询 JSON 数组字符串
-	err := s.db.Where("related_stocks LIKE ? AND analyzed_at > ?", "%"+symbol+"%", cutoff).
-		Order("analyzed_at DESC").
-		Preload("News").
-		Find(&analyses).Error
-
-	if err != nil {
-		return nil, err
-	}
-
-	sentiment := &StockSentiment{
-		Symbol:      symbol,
-		LastUpdated: time.Now(),
-	}
-
-	var totalScore float64
-	for _, a := range analyses {
-		totalScore += a.SentimentScore
-		sentiment.TotalMentions++
-
-		switch a.Sentiment {
-		case "positive":
-			sentiment.PositiveCount++
-		case "negative":
-			sentiment.NegativeCount++
-		default:
-			sentiment.NeutralCount++
-		}
-
-		if len(sentiment.RecentNews) < 5 {
-			if a.News.ID != "" {
-				sentiment.RecentNews = append(sentiment.RecentNews, a.News)
+// fts5Match renders a parsed query as an FTS5 MATCH expression. Every term
+// is quoted so punctuation like "S&P" or "AAPL's" cannot break the parser.
+func fts5Match(expr []searchToken) string {
+	parts := make([]string, 0, len(expr))
+	for _, t := range expr {
+		switch t.kind {
+		case tokenTerm:
+			term := quoteTerm(t.text)
+			if t.prefix {
+				term += "*"
 			}
+			parts = append(parts, term)
+		case tokenPhrase:
+			parts = append(parts, quoteTerm(t.text))
+		case tokenAnd:
+			parts = append(parts, "AND")
+		case tokenOr:
+			parts = append(parts, "OR")
+		case tokenNot:
+			parts = append(parts, "NOT")
+		case tokenOpen:
+			parts = append(parts, "(")
+		case tokenClose:
+			parts = append(parts, ")")
 		}
 	}
-
-	if sentiment.TotalMentions > 0 {
-		sentiment.OverallScore = totalScore / float64(sentiment.TotalMentions)
-	}
-
-	return sentiment, nil
+	return strings.Join(parts, " ")
 }
 
-func (s *Storage) backupToFile(category, id string, data interface{}) error {
-	dir := filepath.Join(s.backupPath, category, time.Now().Format("2006-01-02"))
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
-	}
-	filePath := filepath.Join(dir, id+".json")
-	content, err := json.MarshalIndent(data, "", "  ")
-	if err != nil {
-		return err
-	}
-	return os.WriteFile(filePath, content, 0644)
-}
-
-func (s *Storage) Close() error {
-	sqlDB, err := s.db.DB()
-	if err != nil {
-		return err
+func wrapFTS5Error(err error) error {
+	if strings.Contains(err.Error(), "fts5: syntax error") || strings.Contains(err.Error(), "unterminated string") {
+		return fmt.Errorf("%w: %v", ErrInvalidQuery, err)
 	}
-	return sqlDB.Close()
+	return err
 }
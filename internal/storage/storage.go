@@ -0,0 +1,494 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Storage is the GORM implementation of Store. Everything expressible in
+// portable GORM lives here; the dialect supplies schema setup, conflict
+// handling and full-text search for SQLite or PostgreSQL.
+type Storage struct {
+	db            *gorm.DB
+	dialect       dialect
+	mirror        *mirror   // nil unless storage.mirror is enabled
+	publisher     Publisher // nil unless SetPublisher was called
+	backupMu      sync.Mutex
+	searchEnabled bool
+}
+
+// dialect isolates the SQL that differs between database engines
+type dialect interface {
+	Name() string
+	// migrations returns the ordered schema history
+	migrations() []Migration
+	// lockMigrations serializes concurrent migrators inside tx
+	lockMigrations(tx *gorm.DB) error
+	// insertIgnore makes an INSERT skip rows that violate a unique constraint
+	insertIgnore(tx *gorm.DB) *gorm.DB
+	// setupSearch prepares the full-text index and reports whether it is usable
+	setupSearch(db *gorm.DB) (bool, error)
+	search(db *gorm.DB, expr []searchToken, q SearchQuery) ([]SearchHit, int, error)
+	// vacuum reclaims free pages after pruning
+	vacuum(db *gorm.DB, mode string) error
+	// snapshot writes a consistent copy of a live database to path
+	snapshot(db *gorm.DB, path string) error
+}
+
+func newStorage(db *gorm.DB, d dialect, autoMigrate bool) (*Storage, error) {
+	m := newMigrator(db, d)
+	version, err := m.checkNotNewer()
+	if err != nil {
+		return nil, err
+	}
+
+	if autoMigrate {
+		if _, err := m.Migrate(0); err != nil {
+			return nil, fmt.Errorf("failed to migrate database: %w", err)
+		}
+	} else if pending, err := m.Pending(); err != nil {
+		return nil, err
+	} else if len(pending) > 0 {
+		return nil, fmt.Errorf("%w: database is at version %d, this binary expects %d (run `sentinel db migrate`)",
+			ErrSchemaOutdated, version, m.Latest())
+	}
+
+	searchEnabled, err := d.setupSearch(db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up search index: %w", err)
+	}
+
+	return &Storage{
+		db:            db,
+		dialect:       d,
+		searchEnabled: searchEnabled,
+	}, nil
+}
+
+// Dialect returns the database engine name (sqlite or postgres)
+func (s *Storage) Dialect() string {
+	return s.dialect.Name()
+}
+
+// dedupeNewsSourceIDs returns the statements that keep the lowest id of
+// news sharing a source and source_id and move the analyses, mentions and
+// alerts of the others onto it, so the (source, source_id) unique index can
+// be built. Only databases that lost the old source_id index have such rows.
+func dedupeNewsSourceIDs() []string {
+	keeper := "(SELECT MIN(k.id) FROM news_items k JOIN news_items d ON k.source = d.source AND k.source_id = d.source_id WHERE d.id = %[1]s.news_id)"
+	dup := "SELECT d.id FROM news_items d WHERE d.source_id <> '' AND EXISTS " +
+		"(SELECT 1 FROM news_items k WHERE k.source = d.source AND k.source_id = d.source_id AND k.id < d.id)"
+	var stmts []string
+	for _, table := range []string{"analyses", "stock_mentions", "alerts"} {
+		stmts = append(stmts, fmt.Sprintf("UPDATE %[1]s SET news_id = "+keeper+" WHERE news_id IN ("+dup+")", table))
+	}
+	return append(stmts, "DELETE FROM news_items WHERE id IN ("+dup+")")
+}
+
+// SaveNews 保存新闻（已存在则忽略），新新闻归入相似故事
+func (s *Storage) SaveNews(news *NewsItem) error {
+	var inserted bool
+	err := s.db.Transaction(func(tx *gorm.DB) (err error) {
+		inserted, err = s.insertNews(tx, news)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if inserted {
+		s.mirrorRecord(MirrorNews, news)
+		s.publish(news)
+	}
+	return nil
+}
+
+// SaveNewsBatch 批量保存新闻（已存在则忽略），返回实际插入的条数
+func (s *Storage) SaveNewsBatch(items []NewsItem) (int, error) {
+	if len(items) == 0 {
+		return 0, nil
+	}
+	var fresh []interface{}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		fresh = fresh[:0]
+		for i := range items {
+			inserted, err := s.insertNews(tx, &items[i])
+			if err != nil {
+				return err
+			}
+			if inserted {
+				fresh = append(fresh, &items[i])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.mirrorRecord(MirrorNews, fresh...)
+	s.publish(fresh...)
+	return len(fresh), nil
+}
+
+// ListNews 获取新闻列表（支持过滤和分页）
+func (s *Storage) ListNews(since, until time.Time, source string, limit, offset int) ([]NewsItem, int, error) {
+	var items []NewsItem
+	var total int64
+
+	tx := s.db.Model(&NewsItem{})
+
+	if !since.IsZero() {
+		tx = tx.Where("published_at >= ?", since)
+	}
+	if !until.IsZero() {
+		tx = tx.Where("published_at <= ?", until)
+	}
+	if source != "" {
+		tx = tx.Where("source = ?", source)
+	}
+
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := tx.Order("published_at DESC").Limit(limit).Offset(offset).Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return items, int(total), nil
+}
+
+// GetNews 获取单条新闻
+func (s *Storage) GetNews(id string) (*NewsItem, error) {
+	var item NewsItem
+	if err := s.db.First(&item, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &item, nil
+}
+
+// GetUnprocessedNews 获取未处理的新闻
+func (s *Storage) GetUnprocessedNews(limit int) ([]NewsItem, error) {
+	var items []NewsItem
+	err := s.db.Where("processed = ?", 0).
+		Order("published_at DESC").
+		Limit(limit).
+		Find(&items).Error
+	return items, err
+}
+
+// MarkNewsProcessed 标记新闻为已处理
+func (s *Storage) MarkNewsProcessed(newsID string) error {
+	return s.db.Model(&NewsItem{}).
+		Where("id = ?", newsID).
+		Update("processed", 1).Error
+}
+
+// SaveAnalysis 保存分析结果（同一事务内写入 stock_mentions、更新情绪聚合并关联故事）
+func (s *Storage) SaveAnalysis(analysis *Analysis) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(analysis).Error; err != nil {
+			return err
+		}
+		if err := linkStoryAnalysis(tx, analysis); err != nil {
+			return err
+		}
+		if mentions := MentionsFor(analysis); len(mentions) > 0 {
+			if err := tx.Create(&mentions).Error; err != nil {
+				return err
+			}
+			return applyRollups(tx, mentions)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.mirrorRecord(MirrorAnalyses, analysis)
+	s.publish(analysis)
+	return nil
+}
+
+// ListAnalysis 获取分析列表
+func (s *Storage) ListAnalysis(since, until time.Time, impact string, limit, offset int) ([]Analysis, int, error) {
+	var items []Analysis
+	var total int64
+
+	tx := s.db.Model(&Analysis{})
+
+	if !since.IsZero() {
+		tx = tx.Where("analyzed_at >= ?", since)
+	}
+	if !until.IsZero() {
+		tx = tx.Where("analyzed_at <= ?", until)
+	}
+	if impact != "" {
+		tx = tx.Where("impact_level = ?", impact)
+	}
+
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := tx.Order("analyzed_at DESC").Limit(limit).Offset(offset).Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return items, int(total), nil
+}
+
+// GetAnalysis 获取单条分析
+func (s *Storage) GetAnalysis(id string) (*Analysis, error) {
+	var item Analysis
+	if err := s.db.First(&item, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &item, nil
+}
+
+// SaveAlert 保存警报（同一事务内为匹配的 webhook 订阅排入投递队列）
+func (s *Storage) SaveAlert(alert *Alert) error {
+	if alert.Kind == "" {
+		alert.Kind = AlertKindImpact
+	}
+	if alert.State == "" {
+		alert.State = AlertOpen
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(alert).Error; err != nil {
+			return err
+		}
+		if err := saveAlertSymbols(tx, alert); err != nil {
+			return err
+		}
+		return enqueueWebhooks(tx, alert)
+	})
+	if err != nil {
+		return err
+	}
+	s.mirrorRecord(MirrorAlerts, alert)
+	s.publish(alert)
+	return nil
+}
+
+// AlertQuery filters ListAlerts. State matches the current state, so an
+// alert whose snooze has run out lists as open.
+type AlertQuery struct {
+	Severity string
+	State    string
+	Symbol   string
+	Since    time.Time // filters on the creation time
+	Until    time.Time
+	Limit    int
+	Offset   int
+}
+
+// ListAlerts 获取警报列表
+func (s *Storage) ListAlerts(q AlertQuery) ([]Alert, int, error) {
+	var items []Alert
+	var total int64
+
+	tx := s.db.Model(&Alert{})
+
+	if q.Severity != "" {
+		tx = tx.Where("severity = ?", q.Severity)
+	}
+	now := time.Now()
+	switch q.State {
+	case "":
+	case AlertOpen:
+		tx = tx.Where("(state = ? OR (state = ? AND snoozed_until <= ?))", AlertOpen, AlertSnoozed, now)
+	case AlertSnoozed:
+		tx = tx.Where("state = ? AND snoozed_until > ?", AlertSnoozed, now)
+	default:
+		tx = tx.Where("state = ?", q.State)
+	}
+	if q.Symbol != "" {
+		tx = tx.Where("id IN (?)", s.db.Model(&AlertSymbol{}).Select("alert_id").Where("symbol = ?", NormalizeSymbol(q.Symbol)))
+	}
+	if !q.Since.IsZero() {
+		tx = tx.Where("created_at >= ?", q.Since)
+	}
+	if !q.Until.IsZero() {
+		tx = tx.Where("created_at <= ?", q.Until)
+	}
+
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := tx.Order("created_at DESC").Limit(q.Limit).Offset(q.Offset).Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	for i := range items {
+		items[i].wake(now)
+	}
+
+	return items, int(total), nil
+}
+
+// SaveReport 保存报告
+func (s *Storage) SaveReport(report *Report) error {
+	if err := s.db.Create(report).Error; err != nil {
+		return err
+	}
+	s.mirrorRecord(MirrorReports, report)
+	return nil
+}
+
+// ListReports 获取报告列表
+func (s *Storage) ListReports(reportType string, limit, offset int) ([]Report, int, error) {
+	var items []Report
+	var total int64
+
+	tx := s.db.Model(&Report{})
+
+	if reportType != "" {
+		tx = tx.Where("type = ?", reportType)
+	}
+
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := tx.Order("created_at DESC").Limit(limit).Offset(offset).Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return items, int(total), nil
+}
+
+// GetReport 获取报告详情
+func (s *Storage) GetReport(id string) (*Report, error) {
+	var item Report
+	if err := s.db.First(&item, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &item, nil
+}
+
+// GetLatestReport 获取最新报告
+func (s *Storage) GetLatestReport() (*Report, error) {
+	var item Report
+	err := s.db.Order("created_at DESC").First(&item).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &item, nil
+}
+
+// GetStockSentiment 获取股票舆情评分（基于 stock_mentions 精确匹配）
+func (s *Storage) GetStockSentiment(symbol string, hours int) (*StockSentiment, error) {
+	var mentions []StockMention
+	// 默认 24 小时，如果传入 hours 则使用传入值
+	if hours <= 0 {
+		hours = 24
+	}
+	cutoff := time.Now().Add(time.Duration(-hours) * time.Hour)
+	symbol = NormalizeSymbol(symbol)
+
+	err := s.db.Where("symbol = ? AND analyzed_at > ?", symbol, cutoff).
+		Order("analyzed_at DESC").
+		Find(&mentions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	sentiment := &StockSentiment{
+		Symbol:      symbol,
+		LastUpdated: time.Now(),
+	}
+
+	var totalScore float64
+	var recentIDs []string
+	for _, m := range mentions {
+		totalScore += m.Score
+		sentiment.TotalMentions++
+
+		switch m.Sentiment {
+		case "positive":
+			sentiment.PositiveCount++
+		case "negative":
+			sentiment.NegativeCount++
+		default:
+			sentiment.NeutralCount++
+		}
+
+		if len(recentIDs) < 5 && m.NewsID != "" {
+			recentIDs = append(recentIDs, m.NewsID)
+		}
+	}
+
+	if sentiment.TotalMentions > 0 {
+		sentiment.OverallScore = totalScore / float64(sentiment.TotalMentions)
+	}
+
+	// spread: every copy of the mentioning stories, and the sources carrying them
+	if sentiment.TotalMentions > 0 {
+		newsIDs := s.db.Model(&StockMention{}).Select("news_id").Where("symbol = ? AND analyzed_at > ?", symbol, cutoff)
+		storyIDs := s.db.Model(&NewsItem{}).Select("story_id").Where("id IN (?) AND story_id <> ''", newsIDs)
+		var spread struct {
+			NewsCount   int
+			SourceCount int
+		}
+		err := s.db.Model(&NewsItem{}).
+			Select("COUNT(*) AS news_count, COUNT(DISTINCT source) AS source_count").
+			Where("story_id IN (?) OR (id IN (?) AND story_id = '')", storyIDs, newsIDs).
+			Scan(&spread).Error
+		if err != nil {
+			return nil, err
+		}
+		sentiment.NewsCount = spread.NewsCount
+		sentiment.SourceCount = spread.SourceCount
+	}
+
+	if len(recentIDs) > 0 {
+		if err := s.db.Where("id IN ?", recentIDs).
+			Order("published_at DESC").
+			Find(&sentiment.RecentNews).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	return sentiment, nil
+}
+
+// SetPublisher sends every news item, analysis and alert created from now
+// on to p. Call it before the Storage is shared.
+func (s *Storage) SetPublisher(p Publisher) {
+	s.publisher = p
+}
+
+func (s *Storage) publish(rows ...interface{}) {
+	if s.publisher == nil {
+		return
+	}
+	for _, r := range rows {
+		s.publisher.Publish(r)
+	}
+}
+
+func (s *Storage) Close() error {
+	if s.mirror != nil {
+		s.mirror.close()
+	}
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+	"gorm.io/gorm"
+)
+
+// Store is the persistence API the collector, analyzer, API and reporter
+// depend on. Storage implements it for SQLite and PostgreSQL.
+type Store interface {
+	SaveNews(news *NewsItem) error
+	SaveNewsBatch(items []NewsItem) (int, error)
+	ListNews(since, until time.Time, source string, limit, offset int) ([]NewsItem, int, error)
+	GetNews(id string) (*NewsItem, error)
+	GetUnprocessedNews(limit int) ([]NewsItem, error)
+	MarkNewsProcessed(newsID string) error
+
+	GetStory(id string) (*Story, error)
+	ListStoryNews(storyID string) ([]NewsItem, error)
+
+	SaveAnalysis(analysis *Analysis) error
+	ListAnalysis(since, until time.Time, impact string, limit, offset int) ([]Analysis, int, error)
+	GetAnalysis(id string) (*Analysis, error)
+
+	SaveAlert(alert *Alert) error
+	ListAlerts(q AlertQuery) ([]Alert, int, error)
+	GetAlert(id string) (*Alert, error)
+	GroupAlerts(kind, storyID string, since time.Time) ([]Alert, error)
+	AttachAlertUpdate(alert *Alert, u *AlertUpdate) error
+	ListAlertUpdates(alertID string) ([]AlertUpdate, error)
+	EscalationsAfter(c Cursor, limit int) ([]Alert, error)
+	ChangeAlertState(id string, ev *AlertEvent) (*Alert, error)
+	ListAlertEvents(alertID string) ([]AlertEvent, error)
+
+	CreateWebhook(w *Webhook) error
+	ListWebhooks() ([]Webhook, error)
+	GetWebhook(id string) (*Webhook, error)
+	DeleteWebhook(id string) (bool, error)
+	ListWebhookDeliveries(webhookID, status string, limit, offset int) ([]WebhookDelivery, int, error)
+	DueWebhookDeliveries(now time.Time, limit int) ([]WebhookDelivery, error)
+	RecordWebhookAttempt(d *WebhookDelivery) error
+
+	QueueNotifications(items []Notification) (int, error)
+	DueNotifications(now time.Time, limit int) ([]Notification, error)
+	RecordNotificationAttempt(n *Notification) error
+	ListNotifications(alertID, channel, status string, limit, offset int) ([]Notification, int, error)
+
+	CreateAlertRule(r *AlertRule) error
+	UpdateAlertRule(r *AlertRule) (bool, error)
+	ListAlertRules() ([]AlertRule, error)
+	GetAlertRule(id string) (*AlertRule, error)
+	DeleteAlertRule(id string) (bool, error)
+	CountMentions(symbol string, since, until time.Time) (int, error)
+
+	CreateAPIToken(t *APIToken) error
+	ListAPITokens() ([]APIToken, error)
+	GetAPITokenByHash(hash string) (*APIToken, error)
+	RevokeAPIToken(idOrName string, at time.Time) (bool, error)
+
+	SaveReport(report *Report) error
+	ListReports(reportType string, limit, offset int) ([]Report, int, error)
+	GetReport(id string) (*Report, error)
+	GetLatestReport() (*Report, error)
+
+	GetStockSentiment(symbol string, hours int) (*StockSentiment, error)
+	GetSentimentTimeseries(symbol, interval string, since, until time.Time) ([]TimeseriesPoint, error)
+	Search(q SearchQuery) ([]SearchHit, int, error)
+	SearchAvailable() bool
+
+	// Incremental readers ordered by (time, id), strictly after the cursor
+	NewsAfter(c Cursor, until time.Time, limit int) ([]NewsItem, error)
+	AnalysesAfter(c Cursor, until time.Time, limit int) ([]Analysis, error)
+	AlertsAfter(c Cursor, until time.Time, limit int) ([]Alert, error)
+
+	Prune(rules []RetentionRule, dryRun bool) ([]PruneResult, error)
+	RestoreMirror(dir string, since time.Time) ([]RestoreResult, error)
+	Vacuum(mode string) error
+	Backup(dir string) (*Snapshot, error)
+
+	// SetPublisher streams created news, analyses and alerts to p
+	SetPublisher(p Publisher)
+
+	// Dialect returns the database engine name (sqlite or postgres)
+	Dialect() string
+	Close() error
+}
+
+// Publisher is told about each *NewsItem, *Analysis and *Alert once it has
+// been committed. Publish runs on the writer's goroutine and must not block.
+type Publisher interface {
+	Publish(row interface{})
+}
+
+var _ Store = (*Storage)(nil)
+
+// Open creates the Store selected by cfg.Driver. Pending migrations are
+// applied when cfg.AutoMigrate is set; otherwise Open fails until
+// `sentinel db migrate` has run. With cfg.Mirror enabled, created rows are
+// also appended to the JSONL mirror.
+func Open(cfg config.StorageConfig) (Store, error) {
+	db, d, err := openDB(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newStorage(db, d, cfg.AutoMigrate)
+	if err == nil && cfg.Mirror.Enabled {
+		s.mirror, err = newMirror(cfg.Mirror)
+	}
+	if err != nil {
+		if sqlDB, dbErr := db.DB(); dbErr == nil {
+			sqlDB.Close()
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+// OpenMigrator connects to the configured database for schema management
+// without touching the schema
+func OpenMigrator(cfg config.StorageConfig) (*Migrator, error) {
+	db, d, err := openDB(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newMigrator(db, d), nil
+}
+
+func openDB(cfg config.StorageConfig) (*gorm.DB, dialect, error) {
+	switch cfg.Driver {
+	case "", "sqlite":
+		db, err := openSQLite(cfg.Database)
+		return db, sqliteDialect{}, err
+	case "postgres":
+		if cfg.DSN == "" {
+			return nil, nil, fmt.Errorf("storage.dsn is required for the postgres driver")
+		}
+		db, err := openPostgres(cfg.DSN)
+		return db, postgresDialect{}, err
+	default:
+		return nil, nil, fmt.Errorf("unknown storage driver %q (sqlite, postgres)", cfg.Driver)
+	}
+}
@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"strings"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/minhash"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// storyWindow bounds how far apart in time two items of one story can be.
+// Older copies of a headline are usually a new development, not a repost.
+const storyWindow = 48 * time.Hour
+
+// insertNews inserts item unless it exists and files it under a story.
+// It reports whether the row was new.
+func (s *Storage) insertNews(tx *gorm.DB, item *NewsItem) (bool, error) {
+	item.StoryID = ""
+	res := s.dialect.insertIgnore(tx).Create(item)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return false, res.Error
+	}
+	return true, assignStory(tx, item)
+}
+
+// storyText is what gets compared: the headline, or the start of the post
+// for sources without titles
+func storyText(item *NewsItem) string {
+	if len(minhash.Words(item.Title)) >= 4 {
+		return item.Title
+	}
+	text := item.Content
+	if r := []rune(text); len(r) > 280 {
+		text = string(r[:280])
+	}
+	return text
+}
+
+// assignStory 将新闻归入时间窗口内最相似的故事，没有则新建
+func assignStory(tx *gorm.DB, item *NewsItem) error {
+	seen := item.PublishedAt
+	if seen.IsZero() {
+		seen = item.CollectedAt
+	}
+	if seen.IsZero() {
+		seen = time.Now()
+	}
+
+	sig, ok := minhash.Compute(storyText(item))
+	var story *Story
+	if ok {
+		var err error
+		if story, err = findStory(tx, sig, seen); err != nil {
+			return err
+		}
+	}
+
+	if story == nil {
+		story = &Story{
+			ID:           item.ID,
+			Title:        storyTitle(item),
+			FirstSeenAt:  seen,
+			LastSeenAt:   seen,
+			MentionCount: 1,
+			SourceCount:  1,
+		}
+		if ok {
+			story.Signature = sig.String()
+		}
+		// a story left behind by pruned news may hold this ID; reuse it
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(story).Error; err != nil {
+			return err
+		}
+		if ok {
+			keys := sig.BandKeys()
+			bands := make([]StoryBand, 0, len(keys))
+			for _, k := range keys {
+				bands = append(bands, StoryBand{BandKey: k, StoryID: story.ID})
+			}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&bands).Error; err != nil {
+				return err
+			}
+		}
+	} else {
+		var sameSource int64
+		if err := tx.Model(&NewsItem{}).
+			Where("story_id = ? AND source = ?", story.ID, item.Source).
+			Count(&sameSource).Error; err != nil {
+			return err
+		}
+		updates := map[string]interface{}{
+			"mention_count": gorm.Expr("mention_count + 1"),
+		}
+		if sameSource == 0 {
+			updates["source_count"] = gorm.Expr("source_count + 1")
+		}
+		if seen.After(story.LastSeenAt) {
+			updates["last_seen_at"] = seen
+		}
+		if seen.Before(story.FirstSeenAt) {
+			updates["first_seen_at"] = seen
+		}
+		if err := tx.Model(&Story{}).Where("id = ?", story.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+	}
+
+	item.StoryID = story.ID
+	return tx.Model(&NewsItem{}).Where("id = ?", item.ID).Update("story_id", story.ID).Error
+}
+
+// findStory returns the most similar story seen within storyWindow of at,
+// or nil when none reaches minhash.Threshold
+func findStory(tx *gorm.DB, sig minhash.Signature, at time.Time) (*Story, error) {
+	keys := sig.BandKeys()
+	var candidates []Story
+	err := tx.Where("id IN (?)", tx.Model(&StoryBand{}).Select("story_id").Where("band_key IN ?", keys[:])).
+		Where("last_seen_at >= ? AND first_seen_at <= ?", at.Add(-storyWindow), at.Add(storyWindow)).
+		Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var best *Story
+	bestSim := minhash.Threshold
+	for i := range candidates {
+		other, err := minhash.Parse(candidates[i].Signature)
+		if err != nil {
+			continue
+		}
+		if sim := sig.Similarity(other); sim >= bestSim {
+			best, bestSim = &candidates[i], sim
+		}
+	}
+	return best, nil
+}
+
+func storyTitle(item *NewsItem) string {
+	title := item.Title
+	if title == "" {
+		title = strings.SplitN(item.Content, "\n", 2)[0]
+	}
+	if r := []rune(title); len(r) > 200 {
+		title = string(r[:200])
+	}
+	return title
+}
+
+// linkStoryAnalysis makes a the analysis of its news item's story, unless
+// the story already has one
+func linkStoryAnalysis(tx *gorm.DB, a *Analysis) error {
+	return tx.Model(&Story{}).
+		Where("id = (?)", tx.Model(&NewsItem{}).Select("story_id").Where("id = ?", a.NewsID)).
+		Where("analysis_id = ''").
+		Update("analysis_id", a.ID).Error
+}
+
+// GetStory 获取故事（不存在返回 nil）
+func (s *Storage) GetStory(id string) (*Story, error) {
+	var story Story
+	if err := s.db.First(&story, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &story, nil
+}
+
+// ListStoryNews 获取故事下的全部新闻（按发布时间升序）
+func (s *Storage) ListStoryNews(storyID string) ([]NewsItem, error) {
+	var items []NewsItem
+	err := s.db.Where("story_id = ?", storyID).Order("published_at ASC").Find(&items).Error
+	return items, err
+}
@@ -0,0 +1,57 @@
+package storage
+
+import "time"
+
+// APIToken is a named API token created with `sentinel token create`. Only
+// the SHA-256 of the secret is stored; Prefix is enough of the secret to
+// recognize it in listings.
+type APIToken struct {
+	ID        string     `json:"id" gorm:"primaryKey"` // tok_<hex>
+	Name      string     `json:"name" gorm:"uniqueIndex:idx_api_tokens_name"`
+	Hash      string     `json:"-" gorm:"uniqueIndex:idx_api_tokens_hash"` // hex SHA-256 of the secret
+	Prefix    string     `json:"prefix"`
+	Scopes    []string   `json:"scopes" gorm:"serializer:json"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // nil never expires
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Active reports whether t authenticates requests at now
+func (t *APIToken) Active(now time.Time) bool {
+	return t.RevokedAt == nil && (t.ExpiresAt == nil || t.ExpiresAt.After(now))
+}
+
+// CreateAPIToken 创建 API Token
+func (s *Storage) CreateAPIToken(t *APIToken) error {
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now()
+	}
+	return s.db.Create(t).Error
+}
+
+// ListAPITokens 获取全部 API Token（含已吊销和已过期的）
+func (s *Storage) ListAPITokens() ([]APIToken, error) {
+	var items []APIToken
+	err := s.db.Order("created_at").Find(&items).Error
+	return items, err
+}
+
+// GetAPITokenByHash 按密钥哈希查找 API Token
+func (s *Storage) GetAPITokenByHash(hash string) (*APIToken, error) {
+	var item APIToken
+	if err := s.db.Limit(1).Find(&item, "hash = ?", hash).Error; err != nil {
+		return nil, err
+	}
+	if item.ID == "" {
+		return nil, nil
+	}
+	return &item, nil
+}
+
+// RevokeAPIToken 按 ID 或名称吊销 API Token，返回是否找到未吊销的 Token
+func (s *Storage) RevokeAPIToken(idOrName string, at time.Time) (bool, error) {
+	res := s.db.Model(&APIToken{}).
+		Where("(id = ? OR name = ?) AND revoked_at IS NULL", idOrName, idOrName).
+		Update("revoked_at", at)
+	return res.RowsAffected > 0, res.Error
+}
@@ -0,0 +1,239 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Webhook delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed" // gave up after the last attempt
+)
+
+// Webhook subscribes a URL to alerts. Empty filters match everything;
+// values within one filter are alternatives.
+type Webhook struct {
+	ID         string    `json:"id" gorm:"primaryKey"`
+	Name       string    `json:"name"`
+	URL        string    `json:"url"`
+	Secret     string    `json:"-"` // HMAC-SHA256 signing key
+	Symbols    []string  `json:"symbols" gorm:"serializer:json"`
+	Severities []string  `json:"severities" gorm:"serializer:json"`
+	Sentiments []string  `json:"sentiments" gorm:"serializer:json"`  // sentiment of the alert's analysis
+	EventTypes []string  `json:"event_types" gorm:"serializer:json"` // alert kinds
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Matches reports whether alert passes the filters. sentiment is that of
+// the alert's analysis, "" for alerts without one.
+func (w *Webhook) Matches(alert *Alert, sentiment string) bool {
+	if len(w.Severities) > 0 && !hasFold(w.Severities, alert.Severity) {
+		return false
+	}
+	if len(w.Sentiments) > 0 && !hasFold(w.Sentiments, sentiment) {
+		return false
+	}
+	if len(w.EventTypes) > 0 && !hasFold(w.EventTypes, alert.Kind) {
+		return false
+	}
+	if len(w.Symbols) > 0 {
+		for _, s := range alert.Stocks {
+			if hasFold(w.Symbols, s) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func hasFold(list []string, s string) bool {
+	for _, v := range list {
+		if s != "" && strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is one alert queued for one webhook. Queued rows are the
+// outbox the dispatcher drains; sent and abandoned rows are the delivery log.
+type WebhookDelivery struct {
+	ID             string     `json:"id" gorm:"primaryKey"`
+	WebhookID      string     `json:"webhook_id" gorm:"index:idx_deliveries_webhook"`
+	AlertID        string     `json:"alert_id"`
+	EventType      string     `json:"event_type"`
+	Payload        string     `json:"-"` // request body, fixed when queued
+	Status         string     `json:"status" gorm:"index:idx_deliveries_due,priority:1"`
+	Attempts       int        `json:"attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" gorm:"index:idx_deliveries_due,priority:2"`
+	LastStatusCode int        `json:"last_status_code,omitempty"`
+	LastError      string     `json:"last_error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+}
+
+// WebhookPayload is the JSON body POSTed to a webhook
+type WebhookPayload struct {
+	DeliveryID string    `json:"delivery_id"` // stable across retries, for deduplication
+	EventType  string    `json:"event_type"`
+	Sentiment  string    `json:"sentiment,omitempty"`
+	Alert      Alert     `json:"alert"`
+	QueuedAt   time.Time `json:"queued_at"`
+}
+
+// CreateWebhook 创建 webhook 订阅
+func (s *Storage) CreateWebhook(w *Webhook) error {
+	if w.CreatedAt.IsZero() {
+		w.CreatedAt = time.Now()
+	}
+	return s.db.Create(w).Error
+}
+
+// ListWebhooks 获取全部 webhook 订阅
+func (s *Storage) ListWebhooks() ([]Webhook, error) {
+	var hooks []Webhook
+	err := s.db.Order("created_at").Find(&hooks).Error
+	return hooks, err
+}
+
+// GetWebhook 获取单个 webhook 订阅
+func (s *Storage) GetWebhook(id string) (*Webhook, error) {
+	var w Webhook
+	if err := s.db.First(&w, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &w, nil
+}
+
+// DeleteWebhook 删除 webhook 订阅及其投递记录，返回是否存在
+func (s *Storage) DeleteWebhook(id string) (bool, error) {
+	var found bool
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", id).Delete(&WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		res := tx.Where("id = ?", id).Delete(&Webhook{})
+		found = res.RowsAffected > 0
+		return res.Error
+	})
+	return found, err
+}
+
+// ListWebhookDeliveries 获取 webhook 的投递记录（最新在前）
+func (s *Storage) ListWebhookDeliveries(webhookID, status string, limit, offset int) ([]WebhookDelivery, int, error) {
+	var items []WebhookDelivery
+	var total int64
+
+	tx := s.db.Model(&WebhookDelivery{}).Where("webhook_id = ?", webhookID)
+	if status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	if err := tx.Order("created_at DESC").Limit(limit).Offset(offset).Find(&items).Error; err != nil {
+		return nil, 0, err
+	}
+	return items, int(total), nil
+}
+
+// DueWebhookDeliveries 获取到期待投递的记录（最早到期在前）
+func (s *Storage) DueWebhookDeliveries(now time.Time, limit int) ([]WebhookDelivery, error) {
+	var items []WebhookDelivery
+	err := s.db.Where("status = ? AND next_attempt_at <= ?", DeliveryPending, now).
+		Order("next_attempt_at").
+		Limit(limit).
+		Find(&items).Error
+	return items, err
+}
+
+// RecordWebhookAttempt 保存一次投递尝试的结果，投递成功时将警报标记为已通知
+func (s *Storage) RecordWebhookAttempt(d *WebhookDelivery) error {
+	flipped := false
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&WebhookDelivery{}).Where("id = ?", d.ID).Updates(map[string]interface{}{
+			"status":           d.Status,
+			"attempts":         d.Attempts,
+			"next_attempt_at":  d.NextAttemptAt,
+			"last_status_code": d.LastStatusCode,
+			"last_error":       d.LastError,
+			"delivered_at":     d.DeliveredAt,
+		}).Error
+		if err != nil || d.Status != DeliveryDelivered {
+			return err
+		}
+		res := tx.Model(&Alert{}).Where("id = ? AND notified = ?", d.AlertID, false).Update("notified", true)
+		flipped = res.RowsAffected > 0
+		return res.Error
+	})
+	if err == nil && flipped {
+		s.mirrorAlert(d.AlertID)
+	}
+	return err
+}
+
+// enqueueWebhooks queues alert for every matching webhook in the alert's
+// own transaction, so an alert is never saved without its deliveries
+func enqueueWebhooks(tx *gorm.DB, alert *Alert) error {
+	var hooks []Webhook
+	if err := tx.Find(&hooks).Error; err != nil || len(hooks) == 0 {
+		return err
+	}
+
+	var sentiment string
+	if alert.AnalysisID != "" {
+		var sentiments []string
+		if err := tx.Model(&Analysis{}).Where("id = ?", alert.AnalysisID).Pluck("sentiment", &sentiments).Error; err != nil {
+			return err
+		}
+		if len(sentiments) > 0 {
+			sentiment = sentiments[0]
+		}
+	}
+
+	now := time.Now()
+	var deliveries []WebhookDelivery
+	for i := range hooks {
+		if !hooks[i].Matches(alert, sentiment) {
+			continue
+		}
+		id := fmt.Sprintf("dlv_%s_%s", alert.ID, hooks[i].ID)
+		if alert.Escalations > 0 {
+			id += fmt.Sprintf("_e%d", alert.Escalations)
+		}
+		body, err := json.Marshal(WebhookPayload{
+			DeliveryID: id,
+			EventType:  alert.Kind,
+			Sentiment:  sentiment,
+			Alert:      *alert,
+			QueuedAt:   now,
+		})
+		if err != nil {
+			return err
+		}
+		deliveries = append(deliveries, WebhookDelivery{
+			ID:            id,
+			WebhookID:     hooks[i].ID,
+			AlertID:       alert.ID,
+			EventType:     alert.Kind,
+			Payload:       string(body),
+			Status:        DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return tx.Create(&deliveries).Error
+}
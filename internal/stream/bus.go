@@ -0,0 +1,242 @@
+// Package stream fans out news, analyses and alerts to live subscribers.
+//
+// Storage publishes every row it creates to a Bus (see
+// storage.Store.SetPublisher), so alerts raised or escalated through
+// reporter.AlertManager, analyses from SaveAnalysis and freshly collected
+// news all arrive here once committed. The Bus numbers events and keeps the most
+// recent ones, so a client that reconnects with the last ID it saw gets what
+// it missed replayed before live events.
+package stream
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/analyzer"
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+// Topics
+const (
+	TopicAlert    = "alert"
+	TopicAnalysis = "analysis"
+	TopicNews     = "news"
+)
+
+// Topics lists every topic a client can subscribe to
+var Topics = []string{TopicAlert, TopicAnalysis, TopicNews}
+
+const (
+	// DefaultBuffer is how many recent events are kept for replay
+	DefaultBuffer = 1024
+
+	// subscriberBuffer is how far a subscriber may fall behind before it
+	// is dropped; it reconnects with Last-Event-ID and catches up by replay
+	subscriberBuffer = 256
+)
+
+// Event is one published row. IDs increase across restarts: they start from
+// the bus creation time in milliseconds times 1000, which leaves room for
+// 1000 events per millisecond of uptime and stays exact in JavaScript.
+type Event struct {
+	ID       uint64      `json:"id,omitempty"` // 0 for gap and heartbeat messages
+	Topic    string      `json:"topic"`
+	Time     time.Time   `json:"time"`
+	Symbols  []string    `json:"symbols,omitempty"`
+	Severity string      `json:"severity,omitempty"` // alert severity or analysis impact level
+	Source   string      `json:"source,omitempty"`   // source of the news item
+	Data     interface{} `json:"data"`
+}
+
+// Filter selects events. Empty fields match everything; values within a
+// field are alternatives and match case-insensitively.
+type Filter struct {
+	Topics     []string
+	Symbols    []string
+	Severities []string // news has no severity and never matches
+	Sources    []string
+}
+
+// Match reports whether e passes the filter
+func (f Filter) Match(e Event) bool {
+	if len(f.Topics) > 0 && !containsFold(f.Topics, e.Topic) {
+		return false
+	}
+	if len(f.Severities) > 0 && !containsFold(f.Severities, e.Severity) {
+		return false
+	}
+	if len(f.Sources) > 0 && !containsFold(f.Sources, e.Source) {
+		return false
+	}
+	if len(f.Symbols) > 0 {
+		for _, s := range e.Symbols {
+			if containsFold(f.Symbols, s) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func containsFold(list []string, s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Bus numbers published rows, keeps the latest for replay and delivers them
+// to subscribers. It implements storage.Publisher.
+type Bus struct {
+	store  storage.Store // resolves the source of analyses and alerts
+	mapper *analyzer.StockMapper
+
+	mu     sync.Mutex
+	lastID uint64
+	ring   []Event // ring buffer of the latest events
+	head   int     // index of the oldest event once the ring is full
+	subs   map[*Subscription]struct{}
+}
+
+// NewBus keeps the latest size events. store may be nil, in which case
+// analyses and alerts carry no source.
+func NewBus(size int, store storage.Store) *Bus {
+	if size <= 0 {
+		size = DefaultBuffer
+	}
+	return &Bus{
+		store:  store,
+		mapper: analyzer.NewStockMapper(),
+		lastID: uint64(time.Now().UnixMilli()) * 1000,
+		ring:   make([]Event, 0, size),
+		subs:   make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish wraps a *storage.NewsItem, *storage.Analysis or *storage.Alert in
+// an Event and delivers it. Other rows are ignored.
+func (b *Bus) Publish(row interface{}) {
+	var e Event
+	switch v := row.(type) {
+	case *storage.NewsItem:
+		e = Event{Topic: TopicNews, Source: v.Source, Data: *v,
+			Symbols: b.mapper.FindMentionedStocks(v.Title + " " + v.Content)}
+	case *storage.Analysis:
+		e = Event{Topic: TopicAnalysis, Severity: v.ImpactLevel, Source: b.sourceOf(v.NewsID), Data: *v,
+			Symbols: v.RelatedStocks}
+	case *storage.Alert:
+		e = Event{Topic: TopicAlert, Severity: v.Severity, Source: b.sourceOf(v.NewsID), Data: *v,
+			Symbols: v.Stocks}
+	default:
+		return
+	}
+	e.Time = time.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	e.ID = b.lastID
+	if len(b.ring) < cap(b.ring) {
+		b.ring = append(b.ring, e)
+	} else {
+		b.ring[b.head] = e
+		b.head = (b.head + 1) % len(b.ring)
+	}
+
+	for sub := range b.subs {
+		if !sub.filter.Match(e) {
+			continue
+		}
+		select {
+		case sub.c <- e:
+		default:
+			log.Printf("Stream: dropping slow subscriber at event %d", e.ID)
+			b.remove(sub)
+		}
+	}
+}
+
+func (b *Bus) sourceOf(newsID string) string {
+	if b.store == nil || newsID == "" {
+		return ""
+	}
+	item, err := b.store.GetNews(newsID)
+	if err != nil || item == nil {
+		return ""
+	}
+	return item.Source
+}
+
+// Subscription receives the events matching its filter on C. C is closed
+// when the subscription is closed or dropped for falling behind.
+type Subscription struct {
+	C <-chan Event
+
+	// Replay holds the buffered events after the requested ID, oldest first
+	Replay []Event
+	// Gap is set when events after the requested ID have already left the
+	// buffer; the client should reload through the REST API
+	Gap bool
+
+	c      chan Event
+	filter Filter
+	bus    *Bus
+}
+
+// Subscribe registers a subscriber. With lastID > 0 the buffered events
+// after it are returned in Replay; live events follow on C without gaps or
+// duplicates.
+func (b *Bus) Subscribe(f Filter, lastID uint64) *Subscription {
+	c := make(chan Event, subscriberBuffer)
+	sub := &Subscription{C: c, c: c, filter: f, bus: b}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if lastID > 0 {
+		oldest := b.lastID + 1
+		if len(b.ring) > 0 {
+			oldest = b.ring[b.head].ID
+		}
+		sub.Gap = lastID+1 < oldest
+		for i := range b.ring {
+			e := b.ring[(b.head+i)%len(b.ring)]
+			if e.ID > lastID && f.Match(e) {
+				sub.Replay = append(sub.Replay, e)
+			}
+		}
+	}
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+// Close unsubscribes and closes C. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.remove(s)
+}
+
+// remove drops sub; the caller holds mu
+func (b *Bus) remove(sub *Subscription) {
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.c)
+	}
+}
+
+// Subscribers returns the number of live subscriptions
+func (b *Bus) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
@@ -0,0 +1,68 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+func TestBusFilterAndReplay(t *testing.T) {
+	b := NewBus(3, nil)
+	live := b.Subscribe(Filter{Topics: []string{"alert"}, Symbols: []string{"nvda"}}, 0)
+	defer live.Close()
+
+	b.Publish(&storage.NewsItem{ID: "n1", Source: "rss:Reuters", Title: "Nvidia beats estimates, $NVDA up"})
+	b.Publish(&storage.Alert{ID: "a1", Severity: "high", Stocks: []string{"AAPL"}})
+	b.Publish(&storage.Alert{ID: "a2", Severity: "critical", Stocks: []string{"NVDA", "AMD"}})
+	b.Publish("not a row")
+
+	e := <-live.C
+	if e.Topic != TopicAlert || e.Data.(storage.Alert).ID != "a2" {
+		t.Fatalf("live event = %+v, want alert a2", e)
+	}
+	select {
+	case e := <-live.C:
+		t.Fatalf("unexpected event %+v", e)
+	default:
+	}
+
+	// resume after the news item: both alerts are replayed
+	news := b.ring[0]
+	if news.Topic != TopicNews || len(news.Symbols) != 1 || news.Symbols[0] != "NVDA" || news.Source != "rss:Reuters" {
+		t.Fatalf("news event = %+v", news)
+	}
+	sub := b.Subscribe(Filter{}, news.ID)
+	if sub.Gap || len(sub.Replay) != 2 || sub.Replay[0].ID != news.ID+1 {
+		t.Errorf("replay = %+v, gap %v", sub.Replay, sub.Gap)
+	}
+	sub.Close()
+	sub.Close()
+
+	// two more push the news item and the first alert out of the buffer
+	b.Publish(&storage.Analysis{ID: "x1", ImpactLevel: "high", RelatedStocks: []string{"TSLA"}})
+	b.Publish(&storage.Analysis{ID: "x2", ImpactLevel: "low"})
+	sub = b.Subscribe(Filter{Severities: []string{"HIGH", "critical"}}, news.ID)
+	defer sub.Close()
+	if !sub.Gap || len(sub.Replay) != 2 || sub.Replay[0].Data.(storage.Alert).ID != "a2" || sub.Replay[1].Data.(storage.Analysis).ID != "x1" {
+		t.Errorf("replay after eviction = %+v, gap %v", sub.Replay, sub.Gap)
+	}
+}
+
+func TestBusDropsSlowSubscriber(t *testing.T) {
+	b := NewBus(10, nil)
+	slow := b.Subscribe(Filter{}, 0)
+	for i := 0; i <= subscriberBuffer; i++ {
+		b.Publish(&storage.Alert{ID: "a"})
+	}
+	if b.Subscribers() != 0 {
+		t.Fatal("slow subscriber was kept")
+	}
+	n := 0
+	for range slow.C {
+		n++
+	}
+	if n != subscriberBuffer {
+		t.Errorf("drained %d events, want %d", n, subscriberBuffer)
+	}
+	slow.Close()
+}
@@ -0,0 +1,227 @@
+// Package webhook delivers queued alerts to webhook subscriptions.
+//
+// Storage queues one WebhookDelivery per matching subscription in the same
+// transaction that saves the alert. The Dispatcher drains that outbox: it
+// POSTs each payload signed with the subscription's secret, retries failures
+// with exponential backoff and records every attempt. Delivery is at least
+// once; receivers deduplicate on X-Sentinel-Delivery.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+// Request headers
+const (
+	HeaderSignature = "X-Sentinel-Signature" // sha256=<hex HMAC of "<timestamp>.<body>">
+	HeaderTimestamp = "X-Sentinel-Timestamp" // unix seconds
+	HeaderEvent     = "X-Sentinel-Event"     // alert kind
+	HeaderDelivery  = "X-Sentinel-Delivery"  // delivery ID, the same on every retry
+)
+
+// batchSize is how many due deliveries one poll sends
+const batchSize = 50
+
+// Sign returns the signature header value for body sent at timestamp
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature header in constant time
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Dispatcher sends due deliveries from the outbox
+type Dispatcher struct {
+	cfg    config.WebhookConfig
+	store  storage.Store
+	client *http.Client
+	now    func() time.Time
+
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+	isRunning bool
+	mu        sync.Mutex
+}
+
+func NewDispatcher(cfg config.WebhookConfig, store storage.Store) *Dispatcher {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 5 * time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 8
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = 30 * time.Second
+	}
+	if cfg.MaxBackoff < cfg.Backoff {
+		cfg.MaxBackoff = cfg.Backoff
+	}
+	return &Dispatcher{
+		cfg:    cfg,
+		store:  store,
+		client: &http.Client{Timeout: cfg.Timeout},
+		now:    time.Now,
+		stopCh: make(chan struct{}),
+	}
+}
+
+// Start begins draining the outbox
+func (d *Dispatcher) Start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.isRunning {
+		return
+	}
+	d.isRunning = true
+	d.stopCh = make(chan struct{})
+
+	log.Printf("Starting Webhook Dispatcher (every %s, %d attempts)", d.cfg.PollInterval, d.cfg.MaxAttempts)
+
+	d.wg.Add(1)
+	go d.loop()
+}
+
+// Stop waits for the current batch and shuts down
+func (d *Dispatcher) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.isRunning {
+		return
+	}
+	close(d.stopCh)
+	d.isRunning = false
+	d.wg.Wait()
+	log.Println("Webhook Dispatcher stopped")
+}
+
+func (d *Dispatcher) loop() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(d.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.RunOnce(); err != nil {
+			log.Printf("Webhook: failed to read outbox: %v", err)
+		}
+		select {
+		case <-d.stopCh:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce sends the deliveries due now and returns how many it attempted
+func (d *Dispatcher) RunOnce() (int, error) {
+	due, err := d.store.DueWebhookDeliveries(d.now(), batchSize)
+	if err != nil {
+		return 0, err
+	}
+	hooks := make(map[string]*storage.Webhook)
+	for i := range due {
+		dl := &due[i]
+		hook, ok := hooks[dl.WebhookID]
+		if !ok {
+			if hook, err = d.store.GetWebhook(dl.WebhookID); err != nil {
+				return i, err
+			}
+			hooks[dl.WebhookID] = hook
+		}
+		if hook == nil {
+			continue // deleted since the poll; its deliveries went with it
+		}
+		d.attempt(hook, dl)
+		if err := d.store.RecordWebhookAttempt(dl); err != nil {
+			log.Printf("Webhook: failed to record delivery %s: %v", dl.ID, err)
+		}
+	}
+	return len(due), nil
+}
+
+// attempt POSTs dl once and updates its status, retry time and last result
+func (d *Dispatcher) attempt(hook *storage.Webhook, dl *storage.WebhookDelivery) {
+	now := d.now()
+	dl.Attempts++
+	dl.LastStatusCode = 0
+	dl.LastError = ""
+
+	err := d.post(hook, dl, now)
+	if err == nil {
+		dl.Status = storage.DeliveryDelivered
+		dl.DeliveredAt = &now
+		return
+	}
+
+	dl.LastError = err.Error()
+	if dl.Attempts >= d.cfg.MaxAttempts {
+		dl.Status = storage.DeliveryFailed
+		log.Printf("Webhook: giving up on %s to %s after %d attempts: %v", dl.ID, hook.URL, dl.Attempts, err)
+		return
+	}
+	dl.NextAttemptAt = now.Add(d.backoff(dl.Attempts))
+	log.Printf("Webhook: delivery %s to %s failed (attempt %d), retrying at %s: %v",
+		dl.ID, hook.URL, dl.Attempts, dl.NextAttemptAt.Format(time.RFC3339), err)
+}
+
+func (d *Dispatcher) post(hook *storage.Webhook, dl *storage.WebhookDelivery, now time.Time) error {
+	body := []byte(dl.Payload)
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	ts := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "MarketSentinel-Webhook/1.0")
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, ts, body))
+	req.Header.Set(HeaderEvent, dl.EventType)
+	req.Header.Set(HeaderDelivery, dl.ID)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	dl.LastStatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(snippet))
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	return nil
+}
+
+// backoff is the wait after the given failed attempt: Backoff, doubled per
+// further attempt, capped at MaxBackoff
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.cfg.Backoff
+	for i := 1; i < attempts && wait < d.cfg.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > d.cfg.MaxBackoff {
+		wait = d.cfg.MaxBackoff
+	}
+	return wait
+}
@@ -0,0 +1,96 @@
+package webhook
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chenzhiguo/market-sentinel/internal/config"
+	"github.com/chenzhiguo/market-sentinel/internal/storage"
+)
+
+func TestDispatcherSignsAndRetries(t *testing.T) {
+	store, err := storage.New(filepath.Join(t.TempDir(), "hooks.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	// the receiver fails the first request, then verifies and accepts
+	var calls atomic.Int32
+	var badSignature atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		ts, _ := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+		if !Verify("s3cret", ts, body, r.Header.Get(HeaderSignature)) || r.Header.Get(HeaderDelivery) == "" {
+			badSignature.Store(true)
+		}
+		if calls.Add(1) == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	if err := store.CreateWebhook(&storage.Webhook{ID: "oms", URL: srv.URL, Secret: "s3cret"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CreateWebhook(&storage.Webhook{ID: "dead", URL: "http://127.0.0.1:1/hook", Secret: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveAlert(&storage.Alert{ID: "al1", Severity: "high", Stocks: []string{"TSLA"}, CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	d := NewDispatcher(config.WebhookConfig{MaxAttempts: 3, Backoff: time.Minute, MaxBackoff: 90 * time.Second, Timeout: time.Second}, store)
+	d.now = func() time.Time { return now }
+
+	if n, err := d.RunOnce(); n != 2 || err != nil {
+		t.Fatalf("first run = %d, %v", n, err)
+	}
+	log, _, _ := store.ListWebhookDeliveries("oms", "", 10, 0)
+	if log[0].Status != storage.DeliveryPending || log[0].LastStatusCode != 503 || !log[0].NextAttemptAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("after failure = %+v", log[0])
+	}
+	if n, _ := d.RunOnce(); n != 0 {
+		t.Errorf("retried %d deliveries before their backoff", n)
+	}
+
+	now = now.Add(time.Minute)
+	d.RunOnce()
+	log, _, _ = store.ListWebhookDeliveries("oms", "", 10, 0)
+	if log[0].Status != storage.DeliveryDelivered || log[0].Attempts != 2 || log[0].LastError != "" {
+		t.Errorf("after retry = %+v", log[0])
+	}
+	if badSignature.Load() {
+		t.Error("receiver rejected the signature")
+	}
+	alerts, _, _ := store.ListAlerts(storage.AlertQuery{Limit: 10})
+	if !alerts[0].Notified {
+		t.Error("alert not marked notified")
+	}
+
+	// the unreachable hook backs off 1m, then 90s (capped), then gives up
+	now = now.Add(90 * time.Second)
+	d.RunOnce()
+	log, _, _ = store.ListWebhookDeliveries("dead", "", 10, 0)
+	if log[0].Status != storage.DeliveryFailed || log[0].Attempts != 3 || log[0].LastError == "" {
+		t.Errorf("unreachable hook = %+v, want failed after 3 attempts", log[0])
+	}
+}
+
+func TestBackoffCaps(t *testing.T) {
+	d := NewDispatcher(config.WebhookConfig{Backoff: 30 * time.Second, MaxBackoff: time.Hour}, nil)
+	for attempts, want := range map[int]time.Duration{1: 30 * time.Second, 2: time.Minute, 4: 4 * time.Minute, 20: time.Hour} {
+		if got := d.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}